@@ -0,0 +1,283 @@
+package wongdim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"equa.link/wongdim/batch"
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	log "github.com/sirupsen/logrus"
+)
+
+//ProgressInterval is the minimum time between progress updates of batch
+const ProgressInterval = 5 * time.Second
+
+//fillInfoRunning is set while fillinfo batch started by admin is running
+var fillInfoRunning int32
+
+//editFields are field names accepted by /edit
+var editFields = map[string]dao.ShopField{
+	"name":     dao.FieldName,
+	"address":  dao.FieldAddress,
+	"location": dao.FieldLocation,
+	"type":     dao.FieldType,
+	"district": dao.FieldDistrict,
+	"url":      dao.FieldURL,
+	"tags":     dao.FieldTags,
+	"notes":    dao.FieldNotes,
+	"hours":    dao.FieldHours,
+}
+
+//adminLogger returns logger of admin command in msg
+func adminLogger(msg *tgbotapi.Message) *log.Entry {
+	return log.WithFields(log.Fields{
+		"adminID": msg.From.ID,
+		"command": msg.Text,
+	})
+}
+
+//adminReply makes handler of admin command f, which returns reply to the
+//admin. Errors are sent to the admin instead
+func (r *ServeBot) adminReply(f func(ctx context.Context, msg *tgbotapi.Message) (string, error)) func(context.Context, *tgbotapi.Message) error {
+	return func(ctx context.Context, msg *tgbotapi.Message) error {
+		logger := adminLogger(msg)
+		reply, err := f(ctx, msg)
+		if err != nil {
+			logger.WithError(err).Error("Admin command failed")
+			reply = locale.T(ctx, "admin.error", err.Error())
+		} else {
+			logger.Info("Admin command")
+		}
+		if reply == "" {
+			return nil
+		}
+		return r.SendText(msg.Chat.ID, reply)
+	}
+}
+
+//stats returns shop count by status and district, cache size and pending
+//submissions
+func (r *ServeBot) stats(ctx context.Context) (string, error) {
+	cnt, err := r.da.ShopCount(ctx)
+	if err != nil {
+		return "", err
+	}
+	lines := []string{locale.T(ctx, "admin.shopCount", cnt)}
+	if ex, ok := r.da.(dao.Exporter); ok {
+		shops, err := ex.AllShops(ctx)
+		if err != nil {
+			return "", err
+		}
+		byStatus := make(map[string]int)
+		byDistrict := make(map[string]int)
+		for i := range shops {
+			byStatus[shops[i].Status]++
+			if !shops[i].IsClosed() {
+				byDistrict[shops[i].District]++
+			}
+		}
+		lines = append(lines, locale.T(ctx, "admin.byStatus",
+			byStatus[dao.StatusOpen], byStatus[dao.StatusTempClosed], byStatus[dao.StatusClosed], byStatus[dao.StatusMoved]))
+		names := make([]string, 0, len(byDistrict))
+		for d := range byDistrict {
+			names = append(names, d)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if byDistrict[names[i]] != byDistrict[names[j]] {
+				return byDistrict[names[i]] > byDistrict[names[j]]
+			}
+			return names[i] < names[j]
+		})
+		lines = append(lines, "", locale.T(ctx, "admin.byDistrict"))
+		for _, d := range names {
+			lines = append(lines, fmt.Sprintf("%s: %d", d, byDistrict[d]))
+		}
+		lines = append(lines, "")
+	}
+	lines = append(lines, locale.T(ctx, "admin.cacheItems", cache.ItemCount()))
+	pending, err := r.submissions.PendingSubmissions(ctx)
+	if err != nil {
+		return "", err
+	}
+	lines = append(lines, locale.T(ctx, "admin.pending", len(pending)))
+	return strings.Join(lines, "\n"), nil
+}
+
+//startFillInfo runs the fillinfo batch in background, editing a message
+//with progress in language of ctx
+func (r *ServeBot) startFillInfo(ctx context.Context, chatID int64, logger *log.Entry) (string, error) {
+	if r.mapClient == nil {
+		return locale.T(ctx, "admin.noMapClient"), nil
+	}
+	if !atomic.CompareAndSwapInt32(&fillInfoRunning, 0, 1) {
+		return locale.T(ctx, "admin.fillInfoRunning"), nil
+	}
+	lang := locale.FromContext(ctx)
+	progressMsg, err := r.bot.Send(tgbotapi.NewMessage(chatID, locale.Get(lang, "admin.fillInfoStart")))
+	if err != nil {
+		atomic.StoreInt32(&fillInfoRunning, 0)
+		return "", err
+	}
+	var lastUpdate time.Time
+	progress := func(done, total int) {
+		if done < total && time.Since(lastUpdate) < ProgressInterval {
+			return
+		}
+		lastUpdate = time.Now()
+		_, err := r.bot.Send(tgbotapi.NewEditMessageText(chatID, progressMsg.MessageID,
+			locale.Get(lang, "admin.fillInfoProgress", done, total)))
+		if err != nil {
+			log.WithError(err).Error("Telegram error")
+		}
+	}
+	//Batch outlives the update, so it does not take the update context
+	errCh := batch.RunWithProgress(context.Background(), r.da, r.mapClient.FillGeocode, progress)
+	go func() {
+		defer atomic.StoreInt32(&fillInfoRunning, 0)
+		errCnt := 0
+		for e := range errCh {
+			log.WithError(e).Error("Batch error")
+			errCnt++
+		}
+		cache.Flush()
+		logger.WithField("errorCount", errCnt).Info("Fillinfo batch finished")
+		r.SendText(chatID, locale.Get(lang, "admin.fillInfoDone", errCnt))
+	}()
+	return "", nil
+}
+
+//refreshKeywords rebuilds keywords for suggestion
+func (r *ServeBot) refreshKeywords(ctx context.Context) (string, error) {
+	tb, ok := r.da.(dao.TaggedBackend)
+	if !ok {
+		return locale.T(ctx, "admin.noKeywords"), nil
+	}
+	cnt, err := tb.RefreshKeywords(ctx)
+	if err != nil {
+		return "", err
+	}
+	return locale.T(ctx, "admin.keywordsRefreshed", cnt), nil
+}
+
+//shopArg parses shop ID in first argument and returns the shop
+func (r *ServeBot) shopArg(ctx context.Context, args []string) (dao.Shop, error) {
+	if len(args) == 0 {
+		return dao.Shop{}, errors.New(locale.T(ctx, "admin.noShopID"))
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return dao.Shop{}, errors.New(locale.T(ctx, "admin.badShopID", args[0]))
+	}
+	return r.da.ShopByID(ctx, id)
+}
+
+//closeShop marks shop closed, since today or date in second argument
+func (r *ServeBot) closeShop(ctx context.Context, args []string) (string, error) {
+	shop, err := r.shopArg(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	at := time.Now()
+	if len(args) > 1 {
+		at, err = time.ParseInLocation("2006-01-02", args[1], dao.HKT)
+		if err != nil {
+			return "", errors.New(locale.T(ctx, "admin.badDate", args[1]))
+		}
+	}
+	err = r.da.ArchiveShop(ctx, shop.ID, at)
+	if err != nil {
+		return "", err
+	}
+	cache.Flush()
+	return locale.T(ctx, "admin.closed", shop.ID, shop.Name), nil
+}
+
+//reopenShop marks shop open from now
+func (r *ServeBot) reopenShop(ctx context.Context, args []string) (string, error) {
+	shop, err := r.shopArg(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	err = r.da.UpdateShop(ctx, dao.Shop{ID: shop.ID, Status: dao.StatusOpen, StatusSince: time.Now()}, dao.FieldStatus)
+	if err != nil {
+		return "", err
+	}
+	cache.Flush()
+	return locale.T(ctx, "admin.reopened", shop.ID, shop.Name), nil
+}
+
+//editShop sets a field of shop, arguments are shop ID, field name and value
+func (r *ServeBot) editShop(ctx context.Context, args string) (string, error) {
+	parts := strings.SplitN(strings.TrimSpace(args), " ", 3)
+	if len(parts) < 2 {
+		names := make([]string, 0, len(editFields))
+		for name := range editFields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return locale.T(ctx, "admin.editUsage", strings.Join(names, ", ")), nil
+	}
+	shop, err := r.shopArg(ctx, parts[:1])
+	if err != nil {
+		return "", err
+	}
+	field, ok := editFields[strings.ToLower(parts[1])]
+	if !ok {
+		return "", errors.New(locale.T(ctx, "admin.unknownField", parts[1]))
+	}
+	value := ""
+	if len(parts) > 2 {
+		value = strings.TrimSpace(parts[2])
+	}
+	patch := dao.Shop{ID: shop.ID}
+	switch field {
+	case dao.FieldName:
+		patch.Name = value
+	case dao.FieldAddress:
+		patch.Address = value
+	case dao.FieldLocation:
+		if value != "" {
+			var lat, long float64
+			_, err = fmt.Sscanf(strings.Replace(value, ",", " ", 1), "%f %f", &lat, &long)
+			if err != nil {
+				return "", errors.New(locale.T(ctx, "admin.badLocation", value))
+			}
+			patch.Position = dao.Coord{Lat: lat, Long: long}
+		}
+	case dao.FieldType:
+		patch.Type = value
+	case dao.FieldDistrict:
+		patch.District = value
+	case dao.FieldURL:
+		patch.URL = value
+	case dao.FieldTags:
+		patch.Tags = strings.Fields(value)
+	case dao.FieldNotes:
+		patch.Notes = value
+	case dao.FieldHours:
+		if value != "" {
+			h, err := dao.ParseHours(value)
+			if err != nil {
+				return "", err
+			}
+			patch.Hours = &h
+		}
+	}
+	err = r.da.UpdateShop(ctx, patch, field)
+	var conflict *dao.ConflictError
+	if errors.As(err, &conflict) {
+		return locale.T(ctx, "admin.editConflict", conflict.ShopID), nil
+	} else if err != nil {
+		return "", err
+	}
+	cache.Flush()
+	return locale.T(ctx, "admin.edited", shop.ID, shop.Name, strings.ToLower(parts[1])), nil
+}
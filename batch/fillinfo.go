@@ -2,6 +2,7 @@ package batch
 
 import (
 	"context"
+	"time"
 
 	"equa.link/wongdim/dao"
 	log "github.com/sirupsen/logrus"
@@ -16,20 +17,33 @@ var (
 // Processor is a function on processing Shop info
 type Processor func(context.Context, dao.Shop) (dao.Shop, error)
 
-//Run is a batch function that fill missing geohash, addresses, tags into shop info and save to DB
+// Progress is called with the number of shops processed and the total number
+// of shops missing info
+type Progress func(done, total int)
+
+//Run is a batch function that fill missing geohash, addresses, tags into shop info and save to DB,
+//and reopens shops after temporary closure
 func Run(ctx context.Context, backend dao.Backend, geoCodeAPI Processor) <-chan error {
+	return RunWithProgress(ctx, backend, geoCodeAPI, nil)
+}
+
+//RunWithProgress is Run reporting progress after each shop processed, from
+//a single goroutine
+func RunWithProgress(ctx context.Context, backend dao.Backend, geoCodeAPI Processor, progress Progress) <-chan error {
 	gCodeFunc = geoCodeAPI
 	da = backend
 	errCh := make(chan error)
-	go batchController(ctx, errCh)
+	go batchController(ctx, errCh, progress)
 	return errCh
 }
 
-func batchController(ctx context.Context, errCh chan<- error) {
-	grp, ctx := errgroup.WithContext(ctx)
+func batchController(ctx context.Context, errCh chan<- error, progress Progress) {
+	// gctx is cancelled once the group finishes, so the final writes below
+	// use the caller's ctx instead
+	grp, gctx := errgroup.WithContext(ctx)
 	inCh := make(chan dao.Shop)
 	resultCh := make(chan dao.Shop)
-	shopList, err := da.ShopMissingInfo()
+	shopList, err := da.ShopMissingInfo(ctx)
 	if err != nil {
 		errCh <- err
 	}
@@ -39,13 +53,15 @@ func batchController(ctx context.Context, errCh chan<- error) {
 		for i := range shopList {
 			select {
 			case inCh <- shopList[i]:
-			case <-ctx.Done():
-				return ctx.Err()
+			case <-gctx.Done():
+				return gctx.Err()
 			}
 		}
 		return nil
 	})
 
+	//doneCh counts shops processed, with or without error
+	doneCh := make(chan struct{})
 	for i := 0; i < 5; i++ {
 		grp.Go(func() error {
 			//Take from inChannel and process
@@ -53,7 +69,7 @@ func batchController(ctx context.Context, errCh chan<- error) {
 				var s1 dao.Shop
 				var err error
 				if !s0.HasPhyLoc() {
-					s1, err = gCodeFunc(ctx, s0)
+					s1, err = gCodeFunc(gctx, s0)
 					lat, long := s1.ToCoord()
 					log.WithFields(log.Fields{
 						"shopName": s1.Name,
@@ -67,17 +83,21 @@ func batchController(ctx context.Context, errCh chan<- error) {
 					// channel instead. Also we skip processing
 					select {
 					case errCh <- err:
-					case <-ctx.Done():
-						return ctx.Err()
+					case <-gctx.Done():
+						return gctx.Err()
 					}
 				} else {
 					select {
 					case resultCh <- s1:
-					case <-ctx.Done():
-						return ctx.Err()
+					case <-gctx.Done():
+						return gctx.Err()
 					}
 				}
-
+				select {
+				case doneCh <- struct{}{}:
+				case <-gctx.Done():
+					return gctx.Err()
+				}
 			}
 			return nil
 		})
@@ -86,26 +106,46 @@ func batchController(ctx context.Context, errCh chan<- error) {
 	go func() {
 		grp.Wait()
 		close(resultCh)
+		close(doneCh)
 		log.Debug("All channels closed")
 	}()
 	resultList := make([]dao.Shop, 0)
-	for shop := range resultCh {
-		resultList = append(resultList, shop)
+	done := 0
+	//Closed channels are set to nil to stop selecting them
+	results, dones := resultCh, doneCh
+	for results != nil || dones != nil {
+		select {
+		case shop, ok := <-results:
+			if !ok {
+				results = nil
+				continue
+			}
+			resultList = append(resultList, shop)
+		case _, ok := <-dones:
+			if !ok {
+				dones = nil
+				continue
+			}
+			done++
+			if progress != nil {
+				progress(done, len(shopList))
+			}
+		}
 	}
 	log.WithField("affectedRows", len(resultList)).Info("Updated shops info into database")
-	err = da.UpdateShopInfo(resultList)
+	err = da.UpdateShopInfo(ctx, resultList)
 	if err != nil {
 		errCh <- err
 	}
 	pg, ok := da.(dao.TaggedBackend)
 	if ok {
-		res, err := pg.UpdateTags()
+		res, err := pg.UpdateTags(ctx)
 		if err != nil {
 			errCh <- err
 		} else {
 			log.WithField("affectedRows", res).Printf("Updating rows with tags")
 		}
-		res, err = pg.RefreshKeywords()
+		res, err = pg.RefreshKeywords(ctx)
 		if err != nil {
 			errCh <- err
 		} else {
@@ -113,5 +153,12 @@ func batchController(ctx context.Context, errCh chan<- error) {
 		}
 	}
 
+	res, err := ReopenExpired(ctx, da, time.Now())
+	if err != nil {
+		errCh <- err
+	} else {
+		log.WithField("affectedRows", res).Info("Reopened shops after temporary closure")
+	}
+
 	close(errCh)
 }
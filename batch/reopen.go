@@ -0,0 +1,37 @@
+package batch
+
+import (
+	"context"
+	"time"
+
+	"equa.link/wongdim/dao"
+	log "github.com/sirupsen/logrus"
+)
+
+//ReopenExpired reopens temporarily closed shops whose closure ended before
+//now, returning the number of shops reopened
+func ReopenExpired(ctx context.Context, backend dao.Backend, now time.Time) (int, error) {
+	shops, err := backend.ShopsWithStatus(ctx, dao.StatusTempClosed)
+	if err != nil {
+		return 0, err
+	}
+	reopened := make([]dao.Shop, 0)
+	for _, shop := range shops {
+		if shop.StatusAt(now) != dao.StatusOpen {
+			continue
+		}
+		log.WithFields(log.Fields{
+			"shopID":   shop.ID,
+			"shopName": shop.Name,
+			"until":    shop.StatusUntil,
+		}).Info("Reopening shop after temporary closure")
+		shop.Status = dao.StatusOpen
+		shop.StatusSince = shop.StatusUntil
+		shop.StatusUntil = time.Time{}
+		reopened = append(reopened, shop)
+	}
+	if len(reopened) == 0 {
+		return 0, nil
+	}
+	return len(reopened), backend.UpdateShopStatus(ctx, reopened)
+}
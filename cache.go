@@ -1,6 +1,7 @@
 package wongdim
 
 import (
+	"context"
 	"equa.link/wongdim/dao"
 	"fmt"
 	ghash "github.com/mmcloughlin/geohash"
@@ -10,10 +11,12 @@ import (
 )
 
 const (
-	geoLocPrefix  = "<G>"
-	keywordPrefix = "<S>"
-	advPrefix     = "<A>"
-	kwGeoPrefix   = "<KG>"
+	geoLocPrefix    = "<G>"
+	geoLocAllPrefix = "<GA>"
+	keywordPrefix   = "<S>"
+	advPrefix       = "<A>"
+	advAllPrefix    = "<AA>"
+	kwGeoPrefix     = "<KG>"
 )
 
 var (
@@ -26,53 +29,59 @@ func init() {
 	districts = make(map[string]struct{})
 }
 
-func (s *ServeBot) shopWithGeohash(geohash, distance string) ([]dao.Shop, error) {
+//shopWithGeohash returns shops within distance of geohash, closed and moved
+//shops included if includeClosed is set
+func (s *ServeBot) shopWithGeohash(ctx context.Context, geohash, distance string, includeClosed bool) ([]dao.Shop, error) {
 	var shops []dao.Shop
 	var err error
+	prefix := geoLocPrefix
+	if includeClosed {
+		prefix = geoLocAllPrefix
+	}
 
-	v, ok := cache.Get(geoLocPrefix + geohash)
+	v, ok := cache.Get(prefix + geohash + "@" + distance)
 	if ok {
 		shops = v.([]dao.Shop)
 	} else {
 		lat, long := ghash.DecodeCenter(geohash)
-		shops, err = s.da.NearestShops(lat, long, distance)
+		shops, err = s.da.NearestShops(ctx, lat, long, distance, includeClosed)
 		if err != nil {
 			log.WithError(err).Error("Database error")
 			return nil, err
 		}
-		cache.SetDefault(geoLocPrefix+geohash, shops)
+		cache.SetDefault(prefix+geohash+"@"+distance, shops)
 	}
 
 	return shops, nil
 }
 
-func (s *ServeBot) shopWithCoord(lat, long float64, distance string) ([]dao.Shop, error) {
+func (s *ServeBot) shopWithCoord(ctx context.Context, lat, long float64, distance string) ([]dao.Shop, error) {
 	var err error
 	geohash := ghash.EncodeWithPrecision(lat, long, GeohashPrecision)
-	v, ok := cache.Get(geoLocPrefix + geohash)
+	v, ok := cache.Get(geoLocPrefix + geohash + "@" + distance)
 	var shops []dao.Shop
 	if ok {
 		shops = v.([]dao.Shop)
 	} else {
-		shops, err = s.da.NearestShops(lat, long, distance)
+		shops, err = s.da.NearestShops(ctx, lat, long, distance, false)
 		if err != nil {
 			log.WithError(err).Error("Database error")
 			return nil, err
 		}
-		cache.SetDefault(geoLocPrefix+geohash, shops)
+		cache.SetDefault(geoLocPrefix+geohash+"@"+distance, shops)
 	}
 
 	return shops, nil
 }
 
-func (s *ServeBot) shopWithTags(keywords string) ([]dao.Shop, error) {
+func (s *ServeBot) shopWithTags(ctx context.Context, keywords string) ([]dao.Shop, error) {
 	var err error
 	v, ok := cache.Get(keywordPrefix + keywords)
 	var shops []dao.Shop
 	if ok {
 		shops = v.([]dao.Shop)
 	} else {
-		shops, err = s.da.ShopsWithKeyword(keywords)
+		shops, err = s.da.ShopsWithKeyword(ctx, keywords)
 		if err != nil {
 			log.WithError(err).Error("Database error")
 			return nil, err
@@ -83,14 +92,14 @@ func (s *ServeBot) shopWithTags(keywords string) ([]dao.Shop, error) {
 	return shops, nil
 }
 
-func (s *ServeBot) shopsWithKeywordSortByDist(keyword string, lat, long float64) ([]dao.Shop, error) {
+func (s *ServeBot) shopsWithKeywordSortByDist(ctx context.Context, keyword string, lat, long float64) ([]dao.Shop, error) {
 	v, ok := cache.Get(fmt.Sprintf(kwGeoPrefix+"%s (%f %f)", keyword, lat, long))
 	var shops []dao.Shop
 	var err error
 	if ok {
 		shops = v.([]dao.Shop)
 	} else {
-		shops, err = s.da.ShopsWithKeywordSortByDist(keyword, lat, long)
+		shops, err = s.da.ShopsWithKeywordSortByDist(ctx, keyword, lat, long)
 		if err != nil {
 			log.WithError(err).Error("Database error")
 			return nil, err
@@ -101,27 +110,35 @@ func (s *ServeBot) shopsWithKeywordSortByDist(keyword string, lat, long float64)
 	return shops, nil
 }
 
-func (s *ServeBot) advSearch(query string) ([]dao.Shop, error) {
+func (s *ServeBot) advSearch(ctx context.Context, q dao.Query, includeClosed bool) ([]dao.Shop, error) {
+	if q.Near != "" {
+		return s.advSearchNear(ctx, q, includeClosed)
+	}
+	query := q.String()
 	var err error
-	v, ok := cache.Get(advPrefix + query)
+	prefix := advPrefix
+	if includeClosed {
+		prefix = advAllPrefix
+	}
+	v, ok := cache.Get(prefix + query)
 	var shops []dao.Shop
 	if ok {
 		shops = v.([]dao.Shop)
 	} else {
-		shops, err = s.da.AdvQuery(query)
+		shops, err = s.da.AdvQuery(ctx, q, includeClosed)
 		if err != nil {
 			log.WithError(err).Error("Database error")
 			return nil, err
 		}
-		cache.SetDefault(advPrefix+query, shops)
+		cache.SetDefault(prefix+query, shops)
 	}
 
 	return shops, nil
 }
 
-func (s *ServeBot) isDistrict(d string) bool {
+func (s *ServeBot) isDistrict(ctx context.Context, d string) bool {
 	if len(districts) == 0 {
-		dList, err := s.da.Districts()
+		dList, err := s.da.Districts(ctx)
 		if err != nil {
 			return true
 		}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"equa.link/wongdim/dao"
@@ -18,6 +19,10 @@ func init() {
 	viper.SetDefault("db.db", "wongdim")
 
 	viper.SetDefault("bleve.path", "/wongdim/datastore")
+
+	viper.SetDefault("sqlite.path", "/wongdim/wongdim.db")
+	//Target backend to import into, either bleve or sqlite
+	viper.SetDefault("migrate.target", dao.Bleve)
 }
 
 func main() {
@@ -55,19 +60,33 @@ func main() {
 	defer db.Close()
 	log.Info("Database connected")
 
-	blevebe, err := dao.NewBleveBackend(viper.GetString("bleve.path"))
-	if err != nil {
-		log.WithError(err).Fatal("Could not create index")
-	}
-	defer blevebe.Close()
-	shops, err := db.AllShops()
+	ctx := context.Background()
+	shops, err := db.AllShops(ctx)
 	if err != nil {
 		log.WithError(err).Fatal("Could not extract shops from database")
 	}
 	log.Printf("%d rows extracted", len(shops))
-	err = blevebe.UpdateShopInfo(shops)
+
+	var target dao.Importer
+	switch viper.GetString("migrate.target") {
+	case dao.SQLite:
+		target, err = dao.NewSQLiteBackend(viper.GetString("sqlite.path"))
+	default:
+		target, err = dao.NewBleveBackend(viper.GetString("bleve.path"))
+	}
+	if err != nil {
+		log.WithError(err).Fatal("Could not open target store")
+	}
+	defer target.Close()
+	err = target.ImportShops(ctx, shops)
 	if err != nil {
-		log.WithError(err).Fatal("Could not import shops into bleve store")
+		log.WithError(err).Fatal("Could not import shops into target store")
+	}
+	if tb, ok := target.(dao.TaggedBackend); ok {
+		_, err = tb.RefreshKeywords(ctx)
+		if err != nil {
+			log.WithError(err).Fatal("Could not refresh keywords")
+		}
 	}
 	log.Info("Done")
 }
@@ -3,9 +3,15 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"equa.link/wongdim"
 	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	"equa.link/wongdim/render"
 	"github.com/orandin/lumberjackrus"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -30,7 +36,32 @@ func init() {
 
 	viper.SetDefault("bleve.path", "/wongdim/datastore")
 
+	viper.SetDefault("sqlite.path", "/wongdim/wongdim.db")
+
+	viper.SetDefault("memory.fixture", "/wongdim/shops.json")
+
+	//Help in other languages is read from files next to it, such as
+	//help.en.txt
 	viper.SetDefault("helpfile", "/wongdim/help.txt")
+	//Public holidays in YYYY-MM-DD, for opening hours
+	viper.SetDefault("holidays", []string{})
+	//Telegram user IDs of admins
+	viper.SetDefault("admins", []string{})
+	//Closed reports before a shop is flagged for admins to verify
+	viper.SetDefault("report.closedThreshold", wongdim.DefaultReportThreshold)
+	//Where unfinished dialogs are kept, "memory" or "backend"
+	viper.SetDefault("session.storage", wongdim.SessionBackend)
+	//Time before a /lunch poll in group is closed
+	viper.SetDefault("lunch.pollDuration", wongdim.DefaultLunchPollDuration)
+	//Parse mode of shop messages, "HTML" or "MarkdownV2"
+	viper.SetDefault("render.mode", render.ModeHTML)
+	//Directory of list.tmpl, detail.tmpl, notes.tmpl and inline.tmpl
+	//overriding the default templates
+	viper.SetDefault("render.templateDir", "")
+	//Requests a user may make, one more every interval up to burst at once.
+	//Zero burst disables the limit
+	viper.SetDefault("limit.interval", wongdim.DefaultRateInterval)
+	viper.SetDefault("limit.burst", wongdim.DefaultRateBurst)
 
 	hook, err := lumberjackrus.NewHook(
 		&lumberjackrus.LogFile{
@@ -104,11 +135,42 @@ func main() {
 			log.WithError(err).Fatal("Could not create index")
 		}
 		beOptCfg = wongdim.WithBackend(blevebe)
+	case dao.SQLite:
+		//Use single file SQLite database
+		db, err := dao.NewSQLiteBackend(viper.GetString("sqlite.path"))
+		if err != nil {
+			log.WithError(err).Fatal("Could not open database file")
+		}
+		defer db.Close()
+		log.Info("Database opened")
+		beOptCfg = wongdim.WithBackend(db)
+	case dao.Memory:
+		//Hold everything in memory, loaded from JSON/CSV fixture
+		mem, err := dao.NewMemoryBackendFromFile(viper.GetString("memory.fixture"))
+		if err != nil {
+			log.WithError(err).Fatal("Could not load fixture")
+		}
+		beOptCfg = wongdim.WithBackend(mem)
 	}
-	helpContent, err := ioutil.ReadFile(viper.GetString("helpfile"))
+	helpFile := viper.GetString("helpfile")
+	helpContent, err := ioutil.ReadFile(helpFile)
 	if err != nil {
 		log.WithError(err).Fatal("Cannot read help file")
 	}
+	helpOpts := make([]wongdim.Option, 0, len(locale.Langs))
+	ext := filepath.Ext(helpFile)
+	for _, lang := range locale.Langs {
+		if lang == locale.Default {
+			continue
+		}
+		content, err := ioutil.ReadFile(strings.TrimSuffix(helpFile, ext) + "." + lang + ext)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			log.WithError(err).WithField("lang", lang).Fatal("Cannot read help file")
+		}
+		helpOpts = append(helpOpts, wongdim.WithLocaleHelpMsg(lang, string(content)))
+	}
 
 	mapService := viper.Get("geocode.service")
 	var mapOpt wongdim.Option
@@ -118,13 +180,29 @@ func main() {
 	case "bing":
 		mapOpt = wongdim.WithBingMapAPIKey(viper.GetString("geocode.key"))
 	}
-	bot, err := wongdim.New(
+	admins := make([]int, 0)
+	for _, id := range viper.GetStringSlice("admins") {
+		adminID, err := strconv.Atoi(id)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid admin ID")
+		}
+		admins = append(admins, adminID)
+	}
+	opts := []wongdim.Option{
 		beOptCfg,
 		wongdim.WithTelegramAPIKey(viper.GetString("tg.key"), viper.GetBool("tg.debug")),
 		wongdim.WithWebhookURL(viper.GetString("tg.serveURL")),
 		mapOpt,
 		wongdim.WithHelpMsg(string(helpContent)),
-	)
+		wongdim.WithHolidays(viper.GetStringSlice("holidays")),
+		wongdim.WithAdmins(admins),
+		wongdim.WithReportThreshold(viper.GetInt("report.closedThreshold")),
+		wongdim.WithSessionStorage(viper.GetString("session.storage")),
+		wongdim.WithLunchPollDuration(viper.GetDuration("lunch.pollDuration")),
+		wongdim.WithTemplates(viper.GetString("render.mode"), viper.GetString("render.templateDir")),
+		wongdim.WithRateLimit(viper.GetDuration("limit.interval"), viper.GetInt("limit.burst")),
+	}
+	bot, err := wongdim.New(append(opts, helpOpts...)...)
 	if err != nil {
 		log.WithError(err).Fatal("Could not create TG bot")
 	}
@@ -0,0 +1,236 @@
+package wongdim
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	log "github.com/sirupsen/logrus"
+)
+
+//Command is a bot command listed by /help and registered with Telegram for
+//autocomplete
+type Command struct {
+	Name string
+	//Description is the catalog key of one line description, commands
+	//without one are not listed
+	Description string
+	//Help is the catalog key of details shown by /help <command>
+	Help string
+	//Admin commands are only listed and served to admins
+	Admin bool
+	//Handler serves the command, nil if it is served elsewhere such as
+	//searches and /cancel
+	Handler func(ctx context.Context, msg *tgbotapi.Message) error
+}
+
+//botCommand is a command in setMyCommands, which is not supported by the bot
+//library
+type botCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+//registerCommand adds c to commands, in the order listed
+func (r *ServeBot) registerCommand(c Command) {
+	r.commands = append(r.commands, c)
+}
+
+//commandDefs returns commands of the bot
+func (r *ServeBot) commandDefs() []Command {
+	withArgs := func(f func(ctx context.Context, args []string) (string, error)) func(context.Context, *tgbotapi.Message) (string, error) {
+		return func(ctx context.Context, msg *tgbotapi.Message) (string, error) {
+			return f(ctx, strings.Fields(msg.CommandArguments()))
+		}
+	}
+	return []Command{
+		{Name: "start", Handler: r.startCommand},
+		{Name: "help", Description: "cmd.help", Help: "cmd.help.help", Handler: r.helpCommand},
+		{Name: "query", Description: "cmd.query", Help: "cmd.query.help"},
+		{Name: "queryall", Description: "cmd.queryall", Help: "cmd.queryall.help"},
+		{Name: "random", Description: "cmd.random", Help: "cmd.random.help", Handler: r.randomCommand},
+		{Name: "radius", Description: "cmd.radius", Help: "cmd.radius.help", Handler: r.radiusCommand},
+		{Name: "favs", Description: "cmd.favs", Help: "cmd.favs.help", Handler: r.favsCommand},
+		{Name: "history", Description: "cmd.history", Help: "cmd.history.help", Handler: r.historyCommand},
+		{Name: "lunch", Description: "cmd.lunch", Help: "cmd.lunch.help", Handler: r.lunchCommand},
+		{Name: "submit", Description: "cmd.submit", Help: "cmd.submit.help", Handler: func(ctx context.Context, msg *tgbotapi.Message) error {
+			return r.StartSubmit(ctx, msg.Chat.ID, msg.From.ID)
+		}},
+		{Name: "cancel", Description: "cmd.cancel", Help: "cmd.cancel.help"},
+		{Name: "lang", Description: "cmd.lang", Help: "cmd.lang.help", Handler: r.langCommand},
+
+		{Name: "stats", Description: "cmd.stats", Help: "cmd.stats.help", Admin: true,
+			Handler: r.adminReply(func(ctx context.Context, msg *tgbotapi.Message) (string, error) {
+				return r.stats(ctx)
+			})},
+		{Name: "reports", Description: "cmd.reports", Help: "cmd.reports.help", Admin: true,
+			Handler: r.adminReply(func(ctx context.Context, msg *tgbotapi.Message) (string, error) {
+				return r.listReports(ctx, msg.Chat.ID)
+			})},
+		{Name: "edit", Description: "cmd.edit", Help: "cmd.edit.help", Admin: true,
+			Handler: r.adminReply(func(ctx context.Context, msg *tgbotapi.Message) (string, error) {
+				return r.editShop(ctx, msg.CommandArguments())
+			})},
+		{Name: "close", Description: "cmd.close", Help: "cmd.close.help", Admin: true,
+			Handler: r.adminReply(withArgs(r.closeShop))},
+		{Name: "reopen", Description: "cmd.reopen", Help: "cmd.reopen.help", Admin: true,
+			Handler: r.adminReply(withArgs(r.reopenShop))},
+		{Name: "fillinfo", Description: "cmd.fillinfo", Help: "cmd.fillinfo.help", Admin: true,
+			Handler: r.adminReply(func(ctx context.Context, msg *tgbotapi.Message) (string, error) {
+				return r.startFillInfo(ctx, msg.Chat.ID, adminLogger(msg))
+			})},
+		{Name: "refreshkeywords", Description: "cmd.refreshkeywords", Help: "cmd.refreshkeywords.help", Admin: true,
+			Handler: r.adminReply(func(ctx context.Context, msg *tgbotapi.Message) (string, error) {
+				return r.refreshKeywords(ctx)
+			})},
+		{Name: "flush", Description: "cmd.flush", Help: "cmd.flush.help", Admin: true,
+			Handler: r.adminReply(func(ctx context.Context, msg *tgbotapi.Message) (string, error) {
+				cache.Flush()
+				return locale.T(ctx, "admin.flushed"), nil
+			})},
+		{Name: "ban", Description: "cmd.ban", Help: "cmd.ban.help", Admin: true,
+			Handler: r.adminReply(r.banUser)},
+		{Name: "unban", Description: "cmd.unban", Help: "cmd.unban.help", Admin: true,
+			Handler: r.adminReply(r.unbanUser)},
+		{Name: "bans", Description: "cmd.bans", Help: "cmd.bans.help", Admin: true,
+			Handler: r.adminReply(func(ctx context.Context, msg *tgbotapi.Message) (string, error) {
+				return r.listBans(ctx)
+			})},
+	}
+}
+
+//command returns command of name available to user
+func (r *ServeBot) command(name string, userID int) (Command, bool) {
+	for _, c := range r.commands {
+		if c.Name == name {
+			return c, !c.Admin || r.isAdmin(userID)
+		}
+	}
+	return Command{}, false
+}
+
+//serveCommand runs handler of command in msg. It returns false if msg is not
+//a command served here, or the sender may not use it, so it is served as
+//usual
+func (r *ServeBot) serveCommand(ctx context.Context, msg *tgbotapi.Message) bool {
+	if msg.From == nil || !msg.IsCommand() {
+		return false
+	}
+	c, ok := r.command(msg.Command(), msg.From.ID)
+	if !ok || c.Handler == nil {
+		return false
+	}
+	err := c.Handler(ctx, msg)
+	if err != nil {
+		log.WithError(err).WithField("command", c.Name).Error("Telegram error")
+	}
+	return true
+}
+
+//listed returns commands shown to users, including admin commands if admin
+func (r *ServeBot) listed(admin bool) []Command {
+	result := make([]Command, 0, len(r.commands))
+	for _, c := range r.commands {
+		if c.Description != "" && (!c.Admin || admin) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+//startCommand greets user with help message
+func (r *ServeBot) startCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	log.Info("New joiner")
+	return r.SendMsg(msg.Chat.ID, r.help(ctx))
+}
+
+//helpCommand lists commands available to user, or details of command in
+//argument
+func (r *ServeBot) helpCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	topic := strings.TrimPrefix(strings.TrimSpace(msg.CommandArguments()), "/")
+	if topic != "" {
+		c, ok := r.command(strings.ToLower(topic), msg.From.ID)
+		if !ok || c.Description == "" {
+			return r.SendText(msg.Chat.ID, locale.T(ctx, "help.unknown", topic))
+		}
+		return r.SendText(msg.Chat.ID, "/"+c.Name+" - "+locale.T(ctx, c.Description)+"\n\n"+locale.T(ctx, c.Help))
+	}
+	lines := []string{locale.T(ctx, "help.commands")}
+	admin := r.isAdmin(msg.From.ID)
+	for _, c := range r.listed(admin) {
+		lines = append(lines, "/"+c.Name+" - "+locale.T(ctx, c.Description))
+	}
+	lines = append(lines, "", locale.T(ctx, "help.details"))
+	return r.SendText(msg.Chat.ID, strings.Join(lines, "\n"))
+}
+
+//commandLangCode returns language code of lang for setMyCommands, which
+//takes two-letter codes only. Default language has none, making it the
+//fallback of all other users. Other languages sharing its code cannot be
+//told apart by Telegram and return false, users get them in their private
+//chat after /lang instead
+func commandLangCode(lang string) (string, bool) {
+	if lang == locale.Default {
+		return "", true
+	}
+	code := strings.SplitN(lang, "-", 2)[0]
+	return code, code != strings.SplitN(locale.Default, "-", 2)[0]
+}
+
+//publishCommands registers command list with Telegram for autocomplete, in
+//every language of locale. Admins get admin commands as well in their
+//private chats, falling back to the language they chose
+func (r *ServeBot) publishCommands() {
+	for _, lang := range locale.Langs {
+		code, ok := commandLangCode(lang)
+		if !ok {
+			log.WithField("lang", lang).Debug("Language shares code of default, commands left to /lang")
+			continue
+		}
+		err := r.setMyCommands(lang, code, r.listed(false), 0)
+		if err != nil {
+			log.WithError(err).WithField("lang", lang).Error("Cannot register commands")
+		}
+		for id := range r.admins {
+			adminLang := lang
+			if code == "" {
+				adminLang = r.langOf(context.Background(), id)
+			}
+			err = r.setMyCommands(adminLang, code, r.listed(true), int64(id))
+			if err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"lang":    lang,
+					"adminID": id,
+				}).Error("Cannot register commands")
+			}
+		}
+	}
+}
+
+//setMyCommands registers commands described in lang for users of language
+//code, or all users if code is empty. They are for private chat with user
+//chatID, or for all chats if chatID is 0
+func (r *ServeBot) setMyCommands(lang, code string, commands []Command, chatID int64) error {
+	list := make([]botCommand, len(commands))
+	for i, c := range commands {
+		list[i] = botCommand{Command: c.Name, Description: locale.Get(lang, c.Description)}
+	}
+	commandsJSON, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	params := url.Values{}
+	params.Set("commands", string(commandsJSON))
+	if code != "" {
+		params.Set("language_code", code)
+	}
+	if chatID != 0 {
+		params.Set("scope", `{"type":"chat","chat_id":`+strconv.FormatInt(chatID, 10)+`}`)
+	}
+	_, err = r.bot.MakeRequest("setMyCommands", params)
+	return err
+}
@@ -0,0 +1,1289 @@
+//Package backendtest is a conformance test suite for dao.Backend
+//implementations. Each backend test calls Run with a constructor of an empty
+//backend, the suite loads the fixture and checks the contract of every method
+package backendtest
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"equa.link/wongdim/dao"
+)
+
+//Constructor returns an empty backend. The backend must implement
+//dao.Importer so the suite can load fixture into it
+type Constructor func(t *testing.T) dao.Backend
+
+const (
+	//Coordinates are compared with this tolerance, in degrees
+	coordTolerance = 1e-5
+	//Distance computed by backend may differ slightly, in metres
+	distTolerance = 5
+)
+
+//Fixture returns the default dataset. It covers shops in different
+//districts, closed, moved and temporarily closed shops, a shop without
+//location and a network store
+func Fixture() []dao.Shop {
+	return []dao.Shop{
+		{ID: 1, Name: "水門泰式雞飯專門店", Address: "深水埗欽州街37號西九龍中心8樓55號鋪", Type: "泰國菜",
+			District: "深水埗", Position: dao.Coord{Lat: 22.330441, Long: 114.160049}, Tags: []string{"泰國菜", "深水埗"}},
+		{ID: 2, Name: "留白", Address: "荃灣荃昌中心昌寧商場地下12號舖", Type: "咖啡", District: "荃灣",
+			Position: dao.Coord{Lat: 22.371154, Long: 114.112603}, Tags: []string{"咖啡", "荃灣"}, Notes: "星期一休息",
+			Hours: mustParseHours("11:00-22:00 (星期一休息)")},
+		{ID: 3, Name: "阿土伯鹽水雞", Address: "觀塘成業街7號東廣場地下20號舖", Type: "台灣菜", District: "觀塘",
+			Position: dao.Coord{Lat: 22.311650, Long: 114.225310}, Tags: []string{"台灣菜", "觀塘"}},
+		{ID: 4, Name: "白宮咖啡廳", Address: "荃灣享和街24號", Type: "咖啡", District: "荃灣",
+			Position: dao.Coord{Lat: 22.372500, Long: 114.114300}, Tags: []string{"咖啡", "荃灣"},
+			URL: "https://example.com/whitehouse"},
+		{ID: 5, Name: "荃灣咖啡室", Address: "荃灣沙咀道1號", Type: "咖啡", District: "荃灣",
+			Position: dao.Coord{Lat: 22.371200, Long: 114.112700}, Tags: []string{"咖啡", "荃灣"},
+			Status: dao.StatusClosed, StatusSince: time.Date(2020, 6, 30, 16, 0, 0, 0, time.UTC)},
+		{ID: 6, Name: "大一海洋火鍋", Address: "尖沙咀金馬倫道38-40號金龍中心3樓", Type: "火鍋", District: "尖沙咀",
+			Position: dao.Coord{Lat: 22.299270, Long: 114.173610}, Tags: []string{"火鍋", "尖沙咀"},
+			Hours: mustParseHours("星期一至五 18:00-02:00; 星期六、日及公眾假期 12:00-15:00, 18:00-03:00")},
+		{ID: 7, Name: "齊柏林熱狗店", Address: "荃灣河背街80號", Type: "熱狗", District: "荃灣",
+			Position: dao.Coord{Lat: 22.372100, Long: 114.117400}, Tags: []string{"熱狗", "荃灣"},
+			Status: dao.StatusMoved, StatusSince: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), MovedTo: 12},
+		{ID: 8, Name: "御品·千之味", Address: "深水埗荔枝角道390號C舖", Type: "日本菜", District: "深水埗",
+			Position: dao.Coord{Lat: 22.331900, Long: 114.161600}, Tags: []string{"日本菜", "深水埗", "刺身"}},
+		{ID: 9, Name: "侘寂珈琲 WabiSabi", Address: "觀塘觀塘道396號毅力工業中心4樓C室", Type: "咖啡", District: "觀塘",
+			Position: dao.Coord{Lat: 22.312300, Long: 114.221800}, Tags: []string{"咖啡", "觀塘"}},
+		{ID: 10, Name: "Explorer Fusion Restaurant", Address: "沙田石門安群街3號京瑞廣場第一期地下G10號舖",
+			Type: "西式", District: "石門", Tags: []string{"西式", "石門", "沙田"}},
+		{ID: 11, Name: "無名網店", URL: "https://example.com/online", Type: "咖啡", District: "網店",
+			Tags: []string{"咖啡", "網店"}},
+		{ID: 12, Name: "齊柏林熱狗店", Address: "荃灣眾安街55號", Type: "熱狗", District: "荃灣",
+			Position: dao.Coord{Lat: 22.370500, Long: 114.116900}, Tags: []string{"熱狗", "荃灣"}},
+		{ID: 13, Name: "大埔茶餐廳", Address: "觀塘開源道71號", Type: "茶餐廳", District: "觀塘",
+			Position: dao.Coord{Lat: 22.312900, Long: 114.224800}, Tags: []string{"茶餐廳", "觀塘"},
+			Status:      dao.StatusTempClosed,
+			StatusSince: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+			StatusUntil: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+}
+
+func mustParseHours(text string) *dao.OpeningHours {
+	h, err := dao.ParseHours(text)
+	if err != nil {
+		panic(err)
+	}
+	return &h
+}
+
+func hoursString(h *dao.OpeningHours) string {
+	if h == nil {
+		return ""
+	}
+	return h.String()
+}
+
+//Run runs the conformance suite against backends created by newBackend,
+//loaded with shops
+func Run(t *testing.T, newBackend Constructor, shops []dao.Shop) {
+	s := suite{newBackend: newBackend, shops: shops}
+	t.Run("ShopCount", s.testShopCount)
+	t.Run("ShopByID", s.testShopByID)
+	t.Run("ShopsWithKeyword", s.testShopsWithKeyword)
+	t.Run("ShopsWithKeywordSortByDist", s.testShopsWithKeywordSortByDist)
+	t.Run("NearestShops", s.testNearestShops)
+	t.Run("AdvQuery", s.testAdvQuery)
+	t.Run("QueryFacets", s.testQueryFacets)
+	t.Run("Districts", s.testDistricts)
+	t.Run("ShopMissingInfo", s.testShopMissingInfo)
+	t.Run("UpdateShopInfo", s.testUpdateShopInfo)
+	t.Run("SuggestKeyword", s.testSuggestKeyword)
+	t.Run("ShopsWithStatus", s.testShopsWithStatus)
+	t.Run("UpdateShopStatus", s.testUpdateShopStatus)
+	t.Run("CreateShop", s.testCreateShop)
+	t.Run("UpdateShop", s.testUpdateShop)
+	t.Run("DeleteShop", s.testDeleteShop)
+	t.Run("Submissions", s.testSubmissions)
+	t.Run("Reports", s.testReports)
+	t.Run("Favourites", s.testFavourites)
+	t.Run("UserData", s.testUserData)
+	t.Run("PurgeUserData", s.testPurgeUserData)
+	t.Run("Cancelled", s.testCancelled)
+}
+
+type suite struct {
+	newBackend Constructor
+	shops      []dao.Shop
+}
+
+func (s suite) backend(t *testing.T) dao.Backend {
+	t.Helper()
+	b := s.newBackend(t)
+	im, ok := b.(dao.Importer)
+	if !ok {
+		t.Fatalf("%T does not implement dao.Importer", b)
+	}
+	err := im.ImportShops(context.Background(), s.shops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tb, ok := b.(dao.TaggedBackend); ok {
+		_, err = tb.RefreshKeywords(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b
+}
+
+func (s suite) byID(id int) (dao.Shop, bool) {
+	for i := range s.shops {
+		if s.shops[i].ID == id {
+			return s.shops[i], true
+		}
+	}
+	return dao.Shop{}, false
+}
+
+//expected returns IDs of open shops matching pred
+func (s suite) expected(pred func(dao.Shop) bool) []int {
+	ids := make([]int, 0)
+	for i := range s.shops {
+		if !s.shops[i].IsClosed() && pred(s.shops[i]) {
+			ids = append(ids, s.shops[i].ID)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+//expectedAll returns IDs of shops matching pred, including closed ones
+func (s suite) expectedAll(pred func(dao.Shop) bool) []int {
+	ids := make([]int, 0)
+	for i := range s.shops {
+		if pred(s.shops[i]) {
+			ids = append(ids, s.shops[i].ID)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func hasTag(shop dao.Shop, word string) bool {
+	if shop.District == word {
+		return true
+	}
+	for i := range shop.Tags {
+		if shop.Tags[i] == word {
+			return true
+		}
+	}
+	return false
+}
+
+func matchKeyword(word string) func(dao.Shop) bool {
+	return func(shop dao.Shop) bool {
+		return (shop.Address != "" || shop.URL != "") &&
+			(hasTag(shop, word) || strings.Contains(strings.ToLower(shop.Name), strings.ToLower(word)))
+	}
+}
+
+func ids(shops []dao.Shop) []int {
+	r := make([]int, len(shops))
+	for i := range shops {
+		r[i] = shops[i].ID
+	}
+	sort.Ints(r)
+	return r
+}
+
+func sameIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//distance returns great-circle distance in metres
+func distance(lat1, long1, lat2, long2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLong := (long2 - long1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLong/2)*math.Sin(dLong/2)
+	return 2 * 6371000 * math.Asin(math.Sqrt(a))
+}
+
+//checkShop asserts every field of shop returned by backend matches fixture
+func (s suite) checkShop(t *testing.T, got dao.Shop) {
+	t.Helper()
+	want, ok := s.byID(got.ID)
+	if !ok {
+		t.Errorf("Unknown shop ID %d returned", got.ID)
+		return
+	}
+	if got.Name != want.Name || got.Type != want.Type || got.District != want.District ||
+		got.Address != want.Address || got.URL != want.URL || got.Notes != want.Notes {
+		t.Errorf("Shop %d expected: %+v, actual %+v", got.ID, want, got)
+	}
+	if got.Status != want.Status || !got.StatusSince.Equal(want.StatusSince) ||
+		!got.StatusUntil.Equal(want.StatusUntil) || got.MovedTo != want.MovedTo {
+		t.Errorf("Shop %d status expected: %q (%v - %v, moved to %d), actual %q (%v - %v, moved to %d)", got.ID,
+			want.Status, want.StatusSince, want.StatusUntil, want.MovedTo,
+			got.Status, got.StatusSince, got.StatusUntil, got.MovedTo)
+	}
+	if hoursString(got.Hours) != hoursString(want.Hours) {
+		t.Errorf("Shop %d hours expected: %q, actual %q", got.ID, hoursString(want.Hours), hoursString(got.Hours))
+	}
+	wantTags := append([]string{}, want.Tags...)
+	gotTags := append([]string{}, got.Tags...)
+	sort.Strings(wantTags)
+	sort.Strings(gotTags)
+	if strings.Join(wantTags, " ") != strings.Join(gotTags, " ") {
+		t.Errorf("Shop %d tags expected: %v, actual %v", got.ID, wantTags, gotTags)
+	}
+	if got.HasPhyLoc() != want.HasPhyLoc() {
+		t.Errorf("Shop %d location expected: %v, actual %v", got.ID, want.Position, got.Position)
+	} else if want.HasPhyLoc() {
+		wLat, wLong := want.ToCoord()
+		gLat, gLong := got.ToCoord()
+		if math.Abs(wLat-gLat) > coordTolerance || math.Abs(wLong-gLong) > coordTolerance {
+			t.Errorf("Shop %d location expected: (%f, %f), actual (%f, %f)", got.ID, wLat, wLong, gLat, gLong)
+		}
+	}
+}
+
+//checkSorted asserts shops with location are sorted by Distance from (lat,
+//long), have Distance filled and come before shops without location
+func checkSorted(t *testing.T, shops []dao.Shop, lat, long float64) {
+	t.Helper()
+	noLoc := false
+	for i := range shops {
+		if !shops[i].HasPhyLoc() {
+			noLoc = true
+			continue
+		}
+		if noLoc {
+			t.Errorf("Shop %d with location placed after shop without location", shops[i].ID)
+		}
+		sLat, sLong := shops[i].ToCoord()
+		d := distance(lat, long, sLat, sLong)
+		if math.Abs(d-float64(shops[i].Distance)) > distTolerance {
+			t.Errorf("Shop %d distance expected: %.0f, actual %d", shops[i].ID, d, shops[i].Distance)
+		}
+		if i > 0 && shops[i-1].HasPhyLoc() && shops[i].Distance < shops[i-1].Distance {
+			t.Errorf("Shop %d (%dm) placed after shop %d (%dm)", shops[i].ID, shops[i].Distance,
+				shops[i-1].ID, shops[i-1].Distance)
+		}
+	}
+}
+
+func (s suite) testShopCount(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	cnt, err := b.ShopCount(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnt != len(s.shops) {
+		t.Errorf("Size expected: %d, actual %d", len(s.shops), cnt)
+	}
+}
+
+func (s suite) testShopByID(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	for i := range s.shops {
+		shop, err := b.ShopByID(context.Background(), s.shops[i].ID)
+		if err != nil {
+			t.Errorf("Shop %d: %v", s.shops[i].ID, err)
+			continue
+		}
+		if shop.ID != s.shops[i].ID {
+			t.Errorf("ID expected: %d, actual %d", s.shops[i].ID, shop.ID)
+			continue
+		}
+		s.checkShop(t, shop)
+	}
+	_, err := b.ShopByID(context.Background(), -1)
+	if err == nil {
+		t.Error("Expected error for unknown ID")
+	}
+}
+
+//keywords returns every tag and district in fixture
+func (s suite) keywords() []string {
+	seen := make(map[string]struct{})
+	words := make([]string, 0)
+	for i := range s.shops {
+		for _, w := range append([]string{s.shops[i].District}, s.shops[i].Tags...) {
+			if _, ok := seen[w]; !ok {
+				seen[w] = struct{}{}
+				words = append(words, w)
+			}
+		}
+	}
+	sort.Strings(words)
+	return words
+}
+
+func (s suite) testShopsWithKeyword(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	for _, kw := range s.keywords() {
+		shops, err := b.ShopsWithKeyword(context.Background(), kw)
+		if err != nil {
+			t.Errorf("Keyword %s: %v", kw, err)
+			continue
+		}
+		want := s.expected(matchKeyword(kw))
+		if !sameIDs(want, ids(shops)) {
+			t.Errorf("Keyword %s expected: %v, actual %v", kw, want, ids(shops))
+		}
+		for i := range shops {
+			s.checkShop(t, shops[i])
+		}
+	}
+	for _, kw := range []string{"", " 　"} {
+		shops, err := b.ShopsWithKeyword(context.Background(), kw)
+		if err != nil {
+			t.Errorf("Keyword %q: %v", kw, err)
+		} else if len(shops) > 0 {
+			t.Errorf("Keyword %q expected no shops, actual %v", kw, ids(shops))
+		}
+	}
+}
+
+func (s suite) testShopsWithKeywordSortByDist(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	for _, kw := range s.keywords() {
+		for _, c := range s.shops {
+			if !c.HasPhyLoc() {
+				continue
+			}
+			lat, long := c.ToCoord()
+			shops, err := b.ShopsWithKeywordSortByDist(context.Background(), kw, lat, long)
+			if err != nil {
+				t.Errorf("Keyword %s: %v", kw, err)
+				continue
+			}
+			want := s.expected(matchKeyword(kw))
+			if !sameIDs(want, ids(shops)) {
+				t.Errorf("Keyword %s expected: %v, actual %v", kw, want, ids(shops))
+			}
+			checkSorted(t, shops, lat, long)
+			for i := range shops {
+				s.checkShop(t, shops[i])
+			}
+		}
+	}
+}
+
+func (s suite) testNearestShops(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	for _, includeClosed := range []bool{false, true} {
+		expected := s.expected
+		if includeClosed {
+			expected = s.expectedAll
+		}
+		for _, radius := range []string{"70m", "200m", "500m", "1km", "2km", "10km"} {
+			limit := map[string]float64{"70m": 70, "200m": 200, "500m": 500, "1km": 1000, "2km": 2000, "10km": 10000}[radius]
+			for _, c := range s.shops {
+				if !c.HasPhyLoc() {
+					continue
+				}
+				lat, long := c.ToCoord()
+				shops, err := b.NearestShops(context.Background(), lat, long, radius, includeClosed)
+				if err != nil {
+					t.Errorf("Radius %s: %v", radius, err)
+					continue
+				}
+				checkSorted(t, shops, lat, long)
+				got := make(map[int]struct{})
+				for i := range shops {
+					got[shops[i].ID] = struct{}{}
+					s.checkShop(t, shops[i])
+					if shops[i].IsClosed() && !includeClosed {
+						t.Errorf("Closed shop %d returned", shops[i].ID)
+					}
+					if float64(shops[i].Distance) > limit+distTolerance {
+						t.Errorf("Shop %d (%dm) returned beyond %s", shops[i].ID, shops[i].Distance, radius)
+					}
+				}
+				//Backends may approximate the area near its boundary, but
+				//shops well within the radius must be returned
+				for _, id := range expected(func(shop dao.Shop) bool {
+					if !shop.HasPhyLoc() {
+						return false
+					}
+					sLat, sLong := shop.ToCoord()
+					return distance(lat, long, sLat, sLong) <= limit/2
+				}) {
+					if _, ok := got[id]; !ok {
+						t.Errorf("Shop %d within %s of shop %d not returned (include closed %v)", id, radius, c.ID, includeClosed)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (s suite) testAdvQuery(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	cases := []struct {
+		query string
+		pred  func(dao.Shop) bool
+	}{
+		{"咖啡", func(shop dao.Shop) bool { return hasTag(shop, "咖啡") }},
+		{"咖啡 荃灣", func(shop dao.Shop) bool { return hasTag(shop, "咖啡") && hasTag(shop, "荃灣") }},
+		{"咖啡 -荃灣", func(shop dao.Shop) bool { return hasTag(shop, "咖啡") && !hasTag(shop, "荃灣") }},
+		{"火鍋 or 刺身", func(shop dao.Shop) bool { return hasTag(shop, "火鍋") || hasTag(shop, "刺身") }},
+		{"type:咖啡 district:觀塘", func(shop dao.Shop) bool { return shop.Type == "咖啡" && shop.District == "觀塘" }},
+		{"咖啡 -district:荃灣", func(shop dao.Shop) bool { return hasTag(shop, "咖啡") && shop.District != "荃灣" }},
+	}
+	for _, c := range cases {
+		q, err := dao.ParseQuery(c.query)
+		if err != nil {
+			t.Errorf("Query %s: %v", c.query, err)
+			continue
+		}
+		for _, includeClosed := range []bool{false, true} {
+			shops, err := b.AdvQuery(context.Background(), q, includeClosed)
+			if err != nil {
+				t.Errorf("Query %s: %v", c.query, err)
+				continue
+			}
+			want := s.expected(c.pred)
+			if includeClosed {
+				want = s.expectedAll(c.pred)
+			}
+			if !sameIDs(want, ids(shops)) {
+				t.Errorf("Query %s (include closed: %v) expected: %v, actual %v", c.query, includeClosed, want, ids(shops))
+			}
+			for i := range shops {
+				s.checkShop(t, shops[i])
+			}
+		}
+	}
+	_, err := b.AdvQuery(context.Background(), dao.Query{Not: []dao.QueryTerm{{Value: "咖啡"}}}, false)
+	if err == nil {
+		t.Error("Expected error for negative only query")
+	}
+}
+
+func (s suite) testQueryFacets(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	for _, query := range []string{"咖啡", "咖啡 OR 泰國菜", "咖啡 -district:荃灣"} {
+		q, err := dao.ParseQuery(query)
+		if err != nil {
+			t.Errorf("Query %s: %v", query, err)
+			continue
+		}
+		for _, includeClosed := range []bool{false, true} {
+			facets, err := b.QueryFacets(context.Background(), q, includeClosed)
+			if err != nil {
+				t.Errorf("Query %s: %v", query, err)
+				continue
+			}
+			shops, err := b.AdvQuery(context.Background(), q, includeClosed)
+			if err != nil {
+				t.Errorf("Query %s: %v", query, err)
+				continue
+			}
+			want := dao.CountFacets(shops)
+			if !reflect.DeepEqual(want, facets) {
+				t.Errorf("Query %s (include closed: %v) expected: %v, actual %v", query, includeClosed, want, facets)
+			}
+		}
+	}
+	_, err := b.QueryFacets(context.Background(), dao.Query{Not: []dao.QueryTerm{{Value: "咖啡"}}}, false)
+	if err == nil {
+		t.Error("Expected error for negative only query")
+	}
+}
+
+func (s suite) testDistricts(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	districts, err := b.Districts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[string]struct{})
+	for i := range s.shops {
+		want[s.shops[i].District] = struct{}{}
+	}
+	got := make(map[string]struct{})
+	for i := range districts {
+		got[districts[i]] = struct{}{}
+	}
+	if len(got) != len(districts) {
+		t.Errorf("Duplicated districts returned: %v", districts)
+	}
+	if len(got) != len(want) {
+		t.Errorf("Districts expected: %v, actual %v", want, districts)
+	}
+	for d := range want {
+		if _, ok := got[d]; !ok {
+			t.Errorf("District %s not returned", d)
+		}
+	}
+}
+
+func (s suite) missing() []int {
+	return s.expected(func(shop dao.Shop) bool {
+		return !shop.HasPhyLoc() && shop.District != "網店"
+	})
+}
+
+func (s suite) testShopMissingInfo(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	shops, err := b.ShopMissingInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameIDs(s.missing(), ids(shops)) {
+		t.Errorf("Result expected: %v, actual %v", s.missing(), ids(shops))
+	}
+}
+
+func (s suite) testUpdateShopInfo(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	ctx := context.Background()
+	shops, err := b.ShopMissingInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) == 0 {
+		t.Skip("No shop with missing info in fixture")
+	}
+	for i := range shops {
+		shops[i].Address = "香港某處" + shops[i].Name
+		shops[i].Position = dao.Coord{Lat: 22.4 + float64(i)*0.01, Long: 114.0}
+	}
+	err = b.UpdateShopInfo(ctx, shops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range shops {
+		shop, err := b.ShopByID(ctx, shops[i].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lat, long := shop.ToCoord()
+		if shop.Address != shops[i].Address || math.Abs(lat-shops[i].Position.Lat) > coordTolerance ||
+			math.Abs(long-shops[i].Position.Long) > coordTolerance {
+			t.Errorf("Shop %d not updated: %+v", shop.ID, shop)
+		}
+		if shop.Name != shops[i].Name || shop.Type != shops[i].Type {
+			t.Errorf("Shop %d other fields changed: %+v", shop.ID, shop)
+		}
+		nearby, err := b.NearestShops(ctx, shops[i].Position.Lat, shops[i].Position.Long, "70m", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nearby) == 0 || nearby[0].ID != shops[i].ID {
+			t.Errorf("Updated shop %d not found by location, actual %v", shops[i].ID, ids(nearby))
+		}
+	}
+	missing, err := b.ShopMissingInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("Result expected: [], actual %v", ids(missing))
+	}
+}
+
+func (s suite) testSuggestKeyword(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	//Replace one character of a known tag
+	var tag string
+	for _, kw := range s.keywords() {
+		if len([]rune(kw)) > 1 {
+			tag = kw
+			break
+		}
+	}
+	if tag == "" {
+		t.Skip("No multi-character tag in fixture")
+	}
+	r := []rune(tag)
+	r[0] = '錯'
+	sList, err := b.SuggestKeyword(context.Background(), string(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range sList {
+		if sList[i] == tag {
+			return
+		}
+	}
+	t.Errorf("Suggestion for %s expected to contain %s, actual %v", string(r), tag, sList)
+}
+
+func (s suite) testShopsWithStatus(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	for _, status := range []string{dao.StatusTempClosed, dao.StatusClosed, dao.StatusMoved} {
+		shops, err := b.ShopsWithStatus(context.Background(), status)
+		if err != nil {
+			t.Errorf("Status %q: %v", status, err)
+			continue
+		}
+		want := s.expectedAll(func(shop dao.Shop) bool { return shop.Status == status })
+		if !sameIDs(want, ids(shops)) {
+			t.Errorf("Status %q expected: %v, actual %v", status, want, ids(shops))
+		}
+		for i := range shops {
+			s.checkShop(t, shops[i])
+		}
+	}
+}
+
+func (s suite) testUpdateShopStatus(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	ctx := context.Background()
+	open := s.firstOpen(t)
+	changes := []dao.Shop{
+		{ID: open.ID, Status: dao.StatusClosed, StatusSince: time.Date(2021, 2, 3, 4, 0, 0, 0, time.UTC)},
+	}
+	for i := range s.shops {
+		if s.shops[i].IsClosed() {
+			changes = append(changes, dao.Shop{ID: s.shops[i].ID, Status: dao.StatusOpen})
+		}
+	}
+	err := b.UpdateShopStatus(ctx, changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range changes {
+		shop, err := b.ShopByID(ctx, c.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if shop.Status != c.Status || !shop.StatusSince.Equal(c.StatusSince) || !shop.StatusUntil.IsZero() ||
+			shop.MovedTo != 0 {
+			t.Errorf("Shop %d status not updated: %+v", c.ID, shop)
+		}
+		want, _ := s.byID(c.ID)
+		if shop.Name != want.Name || shop.Address != want.Address {
+			t.Errorf("Shop %d other fields changed: %+v", c.ID, shop)
+		}
+	}
+	//Keyword search follows the new status
+	updated := suite{shops: make([]dao.Shop, len(s.shops))}
+	copy(updated.shops, s.shops)
+	for i := range updated.shops {
+		for _, c := range changes {
+			if c.ID == updated.shops[i].ID {
+				updated.shops[i].Status = c.Status
+			}
+		}
+	}
+	kw := open.Tags[0]
+	shops, err := b.ShopsWithKeyword(ctx, kw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := updated.expected(matchKeyword(kw))
+	if !sameIDs(want, ids(shops)) {
+		t.Errorf("Keyword %s expected: %v, actual %v", kw, want, ids(shops))
+	}
+}
+
+//firstOpen returns an open shop with location and tags in fixture
+func (s suite) firstOpen(t *testing.T) dao.Shop {
+	for i := range s.shops {
+		if s.shops[i].Status == dao.StatusOpen && s.shops[i].HasPhyLoc() && len(s.shops[i].Tags) > 0 {
+			return s.shops[i]
+		}
+	}
+	t.Skip("No open shop in fixture")
+	return dao.Shop{}
+}
+
+func (s suite) testCreateShop(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	ctx := context.Background()
+	maxID := 0
+	for i := range s.shops {
+		if s.shops[i].ID > maxID {
+			maxID = s.shops[i].ID
+		}
+	}
+	newShop := dao.Shop{Name: "測試新店", Address: "旺角彌敦道1號", Type: "測試菜", District: "旺角",
+		Position: dao.Coord{Lat: 22.318, Long: 114.170}, Tags: []string{"測試菜", "旺角"}}
+	created, err := b.CreateShop(ctx, newShop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.DeleteShop(ctx, created.ID)
+	if created.ID <= maxID {
+		t.Errorf("Expected new ID after %d, actual %d", maxID, created.ID)
+	}
+	shop, err := b.ShopByID(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shop.Name != newShop.Name || shop.Address != newShop.Address || shop.District != newShop.District {
+		t.Errorf("Created shop not saved: %+v", shop)
+	}
+	shops, err := b.ShopsWithKeyword(ctx, "測試菜")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameIDs([]int{created.ID}, ids(shops)) {
+		t.Errorf("Created shop not found by keyword, actual %v", ids(shops))
+	}
+
+	//Explicit ID, clashing with existing one
+	var ce *dao.ConflictError
+	dup := newShop
+	dup.Name, dup.ID = "另一測試店", created.ID
+	_, err = b.CreateShop(ctx, dup)
+	if !errors.As(err, &ce) || ce.ShopID != created.ID {
+		t.Errorf("Expected conflict on ID %d, actual %v", created.ID, err)
+	}
+	//Same shop entered twice
+	_, err = b.CreateShop(ctx, newShop)
+	if !errors.As(err, &ce) || ce.ShopID != created.ID {
+		t.Errorf("Expected conflict with shop %d, actual %v", created.ID, err)
+	}
+
+	invalid := []dao.Shop{
+		{Type: "測試菜", District: "旺角"},
+		{Name: "測試", District: "旺角"},
+		{Name: "測試", Type: "測試菜"},
+		{Name: "測試", Type: "測試菜", District: "旺角", Position: dao.Coord{Lat: 122.3, Long: 114.1}},
+		{Name: "測試", Type: "測試菜", District: "旺角", Geohash: "wecn!"},
+	}
+	var ve *dao.ValidationError
+	for i := range invalid {
+		_, err = b.CreateShop(ctx, invalid[i])
+		if !errors.As(err, &ve) {
+			t.Errorf("Expected validation error for %+v, actual %v", invalid[i], err)
+		}
+	}
+	cnt, err := b.ShopCount(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnt != len(s.shops)+1 {
+		t.Errorf("Expected %d shops, actual %d", len(s.shops)+1, cnt)
+	}
+}
+
+func (s suite) testUpdateShop(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	ctx := context.Background()
+	open := s.firstOpen(t)
+	hours := mustParseHours("10:00-20:00")
+	err := b.UpdateShop(ctx, dao.Shop{ID: open.ID, Name: "不應更新", Notes: "新備註", Tags: []string{"測試菜"}, Hours: hours},
+		dao.FieldNotes|dao.FieldTags|dao.FieldHours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shop, err := b.ShopByID(ctx, open.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shop.Notes != "新備註" || strings.Join(shop.Tags, " ") != "測試菜" || hoursString(shop.Hours) != hours.String() {
+		t.Errorf("Fields not updated: %+v", shop)
+	}
+	if shop.Name != open.Name || shop.Address != open.Address || shop.District != open.District {
+		t.Errorf("Fields outside mask changed: %+v", shop)
+	}
+	shops, err := b.ShopsWithKeyword(ctx, "測試菜")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameIDs([]int{open.ID}, ids(shops)) {
+		t.Errorf("Updated tags not searchable, actual %v", ids(shops))
+	}
+	//Emptying a required field
+	var ve *dao.ValidationError
+	err = b.UpdateShop(ctx, dao.Shop{ID: open.ID}, dao.FieldDistrict)
+	if !errors.As(err, &ve) || ve.Field != dao.FieldDistrict {
+		t.Errorf("Expected validation error on district, actual %v", err)
+	}
+	//Renaming into another open shop
+	for i := range s.shops {
+		other := s.shops[i]
+		if other.ID == open.ID || other.IsClosed() {
+			continue
+		}
+		var ce *dao.ConflictError
+		err = b.UpdateShop(ctx, dao.Shop{ID: open.ID, Name: other.Name, Address: other.Address},
+			dao.FieldName|dao.FieldAddress)
+		if !errors.As(err, &ce) || ce.ShopID != other.ID {
+			t.Errorf("Expected conflict with shop %d, actual %v", other.ID, err)
+		}
+		break
+	}
+	err = b.UpdateShop(ctx, dao.Shop{ID: 99999, Notes: "無"}, dao.FieldNotes)
+	if !errors.Is(err, dao.ErrShopNotFound) {
+		t.Errorf("Expected not found, actual %v", err)
+	}
+}
+
+func (s suite) testDeleteShop(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	ctx := context.Background()
+	open := s.firstOpen(t)
+	since := time.Date(2021, 5, 6, 0, 0, 0, 0, time.UTC)
+	err := b.ArchiveShop(ctx, open.ID, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shop, err := b.ShopByID(ctx, open.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shop.Status != dao.StatusClosed || !shop.StatusSince.Equal(since) || shop.Name != open.Name {
+		t.Errorf("Shop not archived: %+v", shop)
+	}
+	shops, err := b.ShopsWithKeyword(ctx, open.Tags[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range shops {
+		if shops[i].ID == open.ID {
+			t.Errorf("Archived shop %d returned by keyword search", open.ID)
+		}
+	}
+
+	//Restore so the deleted shop can be checked in searches
+	err = b.UpdateShop(ctx, open, dao.FieldStatus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.DeleteShop(ctx, open.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.(dao.Importer).ImportShops(ctx, []dao.Shop{open})
+	_, err = b.ShopByID(ctx, open.ID)
+	if !errors.Is(err, dao.ErrShopNotFound) {
+		t.Errorf("Expected deleted shop not found, actual %v", err)
+	}
+	lat, long := open.ToCoord()
+	shops, err = b.NearestShops(ctx, lat, long, "200m", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range shops {
+		if shops[i].ID == open.ID {
+			t.Errorf("Deleted shop %d returned by location search", open.ID)
+		}
+	}
+	cnt, err := b.ShopCount(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnt != len(s.shops)-1 {
+		t.Errorf("Expected %d shops, actual %d", len(s.shops)-1, cnt)
+	}
+	if !errors.Is(b.DeleteShop(ctx, open.ID), dao.ErrShopNotFound) {
+		t.Error("Expected not found deleting shop again")
+	}
+	if !errors.Is(b.ArchiveShop(ctx, open.ID, since), dao.ErrShopNotFound) {
+		t.Error("Expected not found archiving deleted shop")
+	}
+}
+
+func (s suite) testSubmissions(t *testing.T) {
+	b := s.backend(t)
+	t.Cleanup(func() { b.Close() })
+	store, ok := b.(dao.SubmissionStore)
+	if !ok {
+		t.Skipf("%T does not implement dao.SubmissionStore", b)
+	}
+	ctx := context.Background()
+	//Databases kept between runs may hold submissions of earlier runs
+	prior, err := store.PendingSubmissions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2021, 7, 8, 9, 10, 0, 0, time.UTC)
+	subs := []dao.Submission{
+		{Shop: dao.Shop{Name: "測試新店", Address: "旺角彌敦道1號", Type: "測試菜", District: "旺角",
+			Hours: mustParseHours("11:00-22:00")}, UserID: 100, UserName: "tester", ChatID: 100, Created: created,
+			Status: dao.SubmissionPending},
+		{Shop: dao.Shop{Name: "測試網店", Type: "網店", District: "網店", URL: "https://example.com"}, UserID: 101,
+			ChatID: -200, Created: created.Add(time.Hour), Status: dao.SubmissionPending},
+	}
+	for i := range subs {
+		sub, err := store.AddSubmission(ctx, subs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sub.ID == 0 {
+			t.Fatal("Submission ID not assigned")
+		}
+		subs[i].ID = sub.ID
+	}
+	//Submissions cannot be deleted, rejecting them keeps them out of pending
+	//list of later runs
+	t.Cleanup(func() {
+		for i := range subs {
+			sub, err := store.SubmissionByID(ctx, subs[i].ID)
+			if err == nil && sub.Status == dao.SubmissionPending {
+				sub.Status = dao.SubmissionRejected
+				err = store.UpdateSubmission(ctx, sub)
+			}
+			if err != nil {
+				t.Errorf("Cannot clean up submission %d: %v", subs[i].ID, err)
+			}
+		}
+	})
+	if subs[0].ID == subs[1].ID {
+		t.Errorf("Duplicated submission ID %d", subs[0].ID)
+	}
+	got, err := store.SubmissionByID(ctx, subs[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Shop.Name != subs[0].Shop.Name || got.Shop.Address != subs[0].Shop.Address ||
+		hoursString(got.Shop.Hours) != hoursString(subs[0].Shop.Hours) || got.UserID != subs[0].UserID ||
+		got.UserName != subs[0].UserName || got.ChatID != subs[0].ChatID || !got.Created.Equal(created) ||
+		got.Status != dao.SubmissionPending {
+		t.Errorf("Submission expected: %+v, actual %+v", subs[0], got)
+	}
+
+	subs[0].Status, subs[0].ReviewedBy, subs[0].ShopID = dao.SubmissionApproved, 1, 99
+	err = store.UpdateSubmission(ctx, subs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = store.SubmissionByID(ctx, subs[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != dao.SubmissionApproved || got.ReviewedBy != 1 || got.ShopID != 99 {
+		t.Errorf("Submission not updated: %+v", got)
+	}
+	pending, err := store.PendingSubmissions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending = newSubmissions(pending, prior)
+	if len(pending) != 1 || pending[0].ID != subs[1].ID || pending[0].Shop.URL != subs[1].Shop.URL {
+		t.Errorf("Expected pending submission %d, actual %+v", subs[1].ID, pending)
+	}
+	_, err = store.SubmissionByID(ctx, 9999)
+	if !errors.Is(err, dao.ErrSubmissionNotFound) {
+		t.Errorf("Expected not found, actual %v", err)
+	}
+	err = store.UpdateSubmission(ctx, dao.Submission{ID: 9999})
+	if !errors.Is(err, dao.ErrSubmissionNotFound) {
+		t.Errorf("Expected not found on update, actual %v", err)
+	}
+}
+
+func (s suite) testReports(t *testing.T) {
+	b := s.backend(t)
+	t.Cleanup(func() { b.Close() })
+	store, ok := b.(dao.ReportStore)
+	if !ok {
+		t.Skipf("%T does not implement dao.ReportStore", b)
+	}
+	ctx := context.Background()
+	//Databases kept between runs may hold reports of earlier runs
+	prior, err := store.OpenReports(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priorShop1 := 0
+	for i := range prior {
+		if prior[i].ShopID == 1 {
+			priorShop1++
+		}
+	}
+	created := time.Date(2021, 7, 8, 9, 10, 0, 0, time.UTC)
+	//Reports cannot be deleted, resolving them keeps them out of open list of
+	//later runs
+	t.Cleanup(func() {
+		for _, shopID := range []int{1, 2} {
+			_, err := store.ResolveReports(ctx, shopID, 1, created.Add(2*time.Hour))
+			if err != nil {
+				t.Errorf("Cannot clean up reports of shop %d: %v", shopID, err)
+			}
+		}
+	})
+	reps := []dao.Report{
+		{ShopID: 1, UserID: 100, Kind: dao.ReportClosed, Created: created},
+		{ShopID: 1, UserID: 101, Kind: dao.ReportClosed, Created: created},
+		{ShopID: 1, UserID: 100, Kind: dao.ReportOther, Text: "電話錯誤", Created: created},
+		{ShopID: 2, UserID: 100, Kind: dao.ReportClosed, Created: created},
+	}
+	for i := range reps {
+		rep, err := store.AddReport(ctx, reps[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		reps[i].ID = rep.ID
+	}
+	dup, err := store.AddReport(ctx, dao.Report{ShopID: 1, UserID: 101, Kind: dao.ReportClosed, Created: created})
+	if !errors.Is(err, dao.ErrDuplicateReport) || dup.ID != reps[1].ID {
+		t.Errorf("Expected duplicate of report %d, actual %d (%v)", reps[1].ID, dup.ID, err)
+	}
+	open, err := store.OpenReports(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open = newReports(open, prior)
+	if len(open) != len(reps) {
+		t.Fatalf("Expected %d open reports, actual %+v", len(reps), open)
+	}
+	for i := range open {
+		if open[i].ID != reps[i].ID || open[i].ShopID != reps[i].ShopID || open[i].UserID != reps[i].UserID ||
+			open[i].Kind != reps[i].Kind || open[i].Text != reps[i].Text || !open[i].Created.Equal(created) {
+			t.Errorf("Report expected: %+v, actual %+v", reps[i], open[i])
+		}
+	}
+	cnt, err := store.ResolveReports(ctx, 1, 1, created.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnt != 3+priorShop1 {
+		t.Errorf("Expected %d reports resolved, actual %d", 3+priorShop1, cnt)
+	}
+	open, err = store.OpenReports(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open = newReports(open, prior)
+	if len(open) != 1 || open[0].ID != reps[3].ID {
+		t.Errorf("Expected open report %d, actual %+v", reps[3].ID, open)
+	}
+	//Reporting again after resolved
+	_, err = store.AddReport(ctx, reps[0])
+	if err != nil {
+		t.Errorf("Expected new report after resolved, actual %v", err)
+	}
+}
+
+//newSubmissions returns submissions not in prior
+func newSubmissions(subs, prior []dao.Submission) []dao.Submission {
+	seen := make(map[int]struct{}, len(prior))
+	for i := range prior {
+		seen[prior[i].ID] = struct{}{}
+	}
+	result := make([]dao.Submission, 0, len(subs))
+	for i := range subs {
+		if _, ok := seen[subs[i].ID]; !ok {
+			result = append(result, subs[i])
+		}
+	}
+	return result
+}
+
+//newReports returns reports not in prior
+func newReports(reps, prior []dao.Report) []dao.Report {
+	seen := make(map[int]struct{}, len(prior))
+	for i := range prior {
+		seen[prior[i].ID] = struct{}{}
+	}
+	result := make([]dao.Report, 0, len(reps))
+	for i := range reps {
+		if _, ok := seen[reps[i].ID]; !ok {
+			result = append(result, reps[i])
+		}
+	}
+	return result
+}
+
+func (s suite) testFavourites(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	store, ok := b.(dao.FavouriteStore)
+	if !ok {
+		t.Skipf("%T does not implement dao.FavouriteStore", b)
+	}
+	ctx := context.Background()
+	shopIDs := []int{s.shops[0].ID, s.shops[1].ID, s.shops[2].ID}
+	for _, id := range []int{shopIDs[0], shopIDs[1], shopIDs[0], shopIDs[2]} {
+		err := store.AddFavourite(ctx, 100, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := store.AddFavourite(ctx, 101, shopIDs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	favIDs := func(userID int) []int {
+		t.Helper()
+		shops, err := store.Favourites(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := make([]int, len(shops))
+		for i := range shops {
+			result[i] = shops[i].ID
+		}
+		return result
+	}
+	if actual, expected := favIDs(100), []int{shopIDs[2], shopIDs[1], shopIDs[0]}; !sameIDs(actual, expected) {
+		t.Errorf("Favourites expected: %v, actual %v", expected, actual)
+	}
+	err = store.RemoveFavourite(ctx, 100, shopIDs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.RemoveFavourite(ctx, 100, shopIDs[1])
+	if err != nil {
+		t.Errorf("Removing shop not favourite: %v", err)
+	}
+	if actual, expected := favIDs(100), []int{shopIDs[2], shopIDs[0]}; !sameIDs(actual, expected) {
+		t.Errorf("Favourites expected: %v, actual %v", expected, actual)
+	}
+	for _, c := range []struct {
+		userID, shopID int
+		expected       bool
+	}{{100, shopIDs[0], true}, {100, shopIDs[1], false}, {101, shopIDs[1], true}, {102, shopIDs[1], false}} {
+		fav, err := store.IsFavourite(ctx, c.userID, c.shopID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fav != c.expected {
+			t.Errorf("IsFavourite(%d, %d) expected: %v, actual %v", c.userID, c.shopID, c.expected, fav)
+		}
+	}
+	if actual := favIDs(102); len(actual) != 0 {
+		t.Errorf("Expected no favourites, actual %v", actual)
+	}
+	//Clean up for databases shared between runs
+	for _, userID := range []int{100, 101} {
+		for _, id := range shopIDs {
+			store.RemoveFavourite(ctx, userID, id)
+		}
+	}
+}
+
+func (s suite) testUserData(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	store, ok := b.(dao.UserStore)
+	if !ok {
+		t.Skipf("%T does not implement dao.UserStore", b)
+	}
+	ctx := context.Background()
+	value, err := store.UserData(ctx, 100, "history")
+	if err != nil || value != nil {
+		t.Errorf("Expected nil for missing value, actual %q (%v)", value, err)
+	}
+	for _, v := range []string{`[1,2]`, `[3]`} {
+		err = store.SetUserData(ctx, 100, "history", []byte(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = store.SetUserData(ctx, 101, "history", []byte(`[4]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	found, err := dao.LoadUserData(ctx, store, 100, "history", &ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || !sameIDs(ids, []int{3}) {
+		t.Errorf("Expected overwritten value [3], actual %v (found %v)", ids, found)
+	}
+	err = store.DeleteUserData(ctx, 100, "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.DeleteUserData(ctx, 100, "history")
+	if err != nil {
+		t.Errorf("Deleting missing value: %v", err)
+	}
+	found, err = dao.LoadUserData(ctx, store, 100, "history", &ids)
+	if err != nil || found {
+		t.Errorf("Expected value deleted, actual found %v (%v)", found, err)
+	}
+	value, err = store.UserData(ctx, 101, "history")
+	if err != nil || string(value) != `[4]` {
+		t.Errorf("Expected value of other user kept, actual %q (%v)", value, err)
+	}
+	//Clean up for databases shared between runs
+	store.DeleteUserData(ctx, 101, "history")
+}
+
+func (s suite) testPurgeUserData(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	purger, ok := b.(dao.UserDataPurger)
+	if !ok {
+		t.Skipf("%T does not implement dao.UserDataPurger", b)
+	}
+	store := b.(dao.UserStore)
+	ctx := context.Background()
+	keys := []string{"query:a", "query:b", "history"}
+	for _, key := range keys {
+		err := store.SetUserData(ctx, 100, key, []byte(`1`))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := store.SetUserData(ctx, 101, "query:a", []byte(`1`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := purger.PurgeUserData(ctx, 100, "query:", time.Now().Add(-time.Hour))
+	if err != nil || n != 0 {
+		t.Errorf("Expected recent values kept, actual %d removed (%v)", n, err)
+	}
+	n, err = purger.PurgeUserData(ctx, 100, "query:", time.Now().Add(time.Hour))
+	if err != nil || n != 2 {
+		t.Errorf("Expected 2 values removed, actual %d (%v)", n, err)
+	}
+	for _, c := range []struct {
+		userID int
+		key    string
+		kept   bool
+	}{{100, "query:a", false}, {100, "query:b", false}, {100, "history", true}, {101, "query:a", true}} {
+		value, err := store.UserData(ctx, c.userID, c.key)
+		if err != nil || (value != nil) != c.kept {
+			t.Errorf("%d %s expected kept %v, actual %q (%v)", c.userID, c.key, c.kept, value, err)
+		}
+	}
+	//Clean up for databases shared between runs
+	store.DeleteUserData(ctx, 100, "history")
+	store.DeleteUserData(ctx, 101, "query:a")
+}
+
+func (s suite) testCancelled(t *testing.T) {
+	b := s.backend(t)
+	defer b.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := b.ShopsWithKeyword(ctx, s.keywords()[0])
+	if err == nil {
+		t.Error("Expected error for cancelled context")
+	}
+	lat, long := 22.3, 114.1
+	_, err = b.NearestShops(ctx, lat, long, "1km", false)
+	if err == nil {
+		t.Error("Expected error for cancelled context")
+	}
+}
@@ -1,23 +1,125 @@
 package dao
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/blevesearch/bleve"
 	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/analysis/lang/cjk"
 	"github.com/blevesearch/bleve/mapping"
 	"github.com/blevesearch/bleve/search"
 	"github.com/blevesearch/bleve/search/query"
-	"strconv"
+	log "github.com/sirupsen/logrus"
 )
 
 const (
 	//Bleve is the type name for Bleve search engine
 	Bleve = "bleve"
+
+	//No. of hits retrieved per search request when collecting full result
+	blevePageSize = 500
+	//No. of values counted per facet, districts and types are far fewer
+	bleveFacetSize = 1000
+
+	//Internal key of submissions, which are kept out of the search index
+	bleveSubmissionsKey = "submissions"
+	//Internal key of reports
+	bleveReportsKey = "reports"
+	//Internal key prefix of favourite shop IDs, followed by user ID
+	bleveFavouritesKey = "favourites:"
+	//Internal key prefix of UserStore values, followed by user ID, ":" and key
+	bleveUserDataKey = "user:"
+	//Internal key prefix of log of UserStore values saved, followed by user
+	//ID. Internal storage cannot be listed, so values are purged along the
+	//log. Entries of the log follow ":" and their sequence number
+	bleveUserLogKey = "userLog:"
+	//Internal key prefix of sequence number of the last save of a UserStore
+	//value, followed by user ID, ":" and key
+	bleveUserSavedKey = "userSaved:"
+	//Internal key of version of mapping index was built with
+	bleveMappingVersionKey = "mappingVersion"
+	//Internal key Bleve keeps index mapping under
+	bleveMappingKey = "_mapping"
+
+	//bleveMappingVersion is increased on changes of newShopIndexMapping, so
+	//indexes built with an older mapping are reindexed on open. Indexes
+	//without version predate bleveShop
+	bleveMappingVersion = 1
 )
 
 // BleveBackend is the data backend powered by Bleve
 type BleveBackend struct {
 	index bleve.Index
+	//mu serializes writes which read before indexing
+	mu sync.Mutex
+}
+
+//bleveShop is the document indexed for each shop. Besides the shop fields, it
+//carries a geopoint derived from Shop.ToCoord and flags used for filtering
+type bleveShop struct {
+	Name        string
+	NameLower   string //Lowercased name for substring search
+	Address     string
+	Type        string
+	District    string
+	URL         string
+	Notes       string
+	Tags        []string
+	Status      string
+	StatusSince string //RFC 3339, empty if unknown
+	StatusUntil string //RFC 3339, empty if unknown
+	MovedTo     int
+	Hours       string
+	Location    []float64 //[long, lat] geopoint
+	Lat         float64
+	Long        float64
+	HasLocation bool
+	Searchable  bool //Has address or URL
+}
+
+//BleveType fulfills bleveType interface
+func (s bleveShop) BleveType() string {
+	return "Shop"
+}
+
+func newBleveShop(shop Shop) bleveShop {
+	doc := bleveShop{
+		Name:        shop.Name,
+		NameLower:   strings.ToLower(shop.Name),
+		Address:     shop.Address,
+		Type:        shop.Type,
+		District:    shop.District,
+		URL:         shop.URL,
+		Notes:       shop.Notes,
+		Tags:        shop.Tags,
+		Status:      shop.Status,
+		StatusSince: bleveTime(shop.StatusSince),
+		StatusUntil: bleveTime(shop.StatusUntil),
+		MovedTo:     shop.MovedTo,
+		Hours:       hoursText(shop.Hours),
+		HasLocation: shop.HasPhyLoc(),
+		Searchable:  shop.Address != "" || shop.URL != "",
+	}
+	if doc.HasLocation {
+		doc.Lat, doc.Long = shop.ToCoord()
+		doc.Location = []float64{doc.Long, doc.Lat}
+	}
+	return doc
+}
+
+//bleveTime formats time for storing, zero time is stored as empty string
+func bleveTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
 }
 
 // NewBleveBackend returns a bleve-based backend
@@ -28,77 +130,171 @@ func NewBleveBackend(path string) (*BleveBackend, error) {
 		if err != nil {
 			return nil, fmt.Errorf("Cannot create store file %w", err)
 		}
+		b := &BleveBackend{index: idx}
+		err = b.setInternal(bleveMappingVersionKey, bleveMappingVersion)
+		if err != nil {
+			idx.Close()
+			return nil, fmt.Errorf("Cannot create store file %w", err)
+		}
+		return b, nil
 	} else if err != nil {
 		return nil, fmt.Errorf("Cannot open store file %w", err)
 	}
 
-	b := BleveBackend{idx}
-	return &b, nil
+	b := &BleveBackend{index: idx}
+	err = b.upgradeMapping(path)
+	if err != nil {
+		b.index.Close()
+		return nil, fmt.Errorf("Cannot upgrade store file %w", err)
+	}
+	return b, nil
+}
+
+//upgradeMapping reindexes shops of index at path if it was built with an
+//older mapping. Mapping of an index cannot be changed, so the new one replaces
+//the stored one before reopening
+func (b *BleveBackend) upgradeMapping(path string) error {
+	version := 0
+	err := b.getInternal(bleveMappingVersionKey, &version)
+	if err != nil || version >= bleveMappingVersion {
+		return err
+	}
+	ctx := context.Background()
+	shops, err := b.AllShops(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(newShopIndexMapping())
+	if err != nil {
+		return err
+	}
+	err = b.index.SetInternal([]byte(bleveMappingKey), data)
+	if err != nil {
+		return err
+	}
+	err = b.index.Close()
+	if err != nil {
+		return err
+	}
+	b.index, err = bleve.Open(path)
+	if err != nil {
+		return err
+	}
+	err = b.ImportShops(ctx, shops)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"from":  version,
+		"to":    bleveMappingVersion,
+		"shops": len(shops),
+	}).Info("Bleve index reindexed with new mapping")
+	return b.setInternal(bleveMappingVersionKey, bleveMappingVersion)
 }
 
 //ShopByID returns shop with provided ID
-func (b *BleveBackend) ShopByID(shopID int) (Shop, error) {
+func (b *BleveBackend) ShopByID(ctx context.Context, shopID int) (Shop, error) {
 	q := bleve.NewDocIDQuery([]string{strconv.Itoa(shopID)})
 	req := bleve.NewSearchRequest(q)
 	req.Fields = []string{"*"}
-	result, err := b.index.Search(req)
+	result, err := b.index.SearchInContext(ctx, req)
 	if err != nil {
 		return Shop{}, err
 	}
-	if result.Size() == 0 {
-		return Shop{}, fmt.Errorf("Shop with %d not found", shopID)
+	if len(result.Hits) == 0 {
+		return Shop{}, shopNotFound(shopID)
 	}
 	return convertSearchResultToShop(*result.Hits[0]), nil
 }
 
 //NearestShops retrieves nearest shops with provided current location and distance
-func (b *BleveBackend) NearestShops(lat, long float64, dist string) ([]Shop, error) {
-	q := bleve.NewGeoDistanceQuery(long, lat, dist)
-	q.SetField("Location")
-	sr := bleve.NewSearchRequest(q)
-	s, err := b.index.Search(sr)
+func (b *BleveBackend) NearestShops(ctx context.Context, lat, long float64, dist string, includeClosed bool) ([]Shop, error) {
+	d, err := disToInt(dist)
 	if err != nil {
 		return nil, err
 	}
-	gSort, err := search.NewSortGeoDistance("Location", "m", long, lat, true)
+	gq := bleve.NewGeoDistanceQuery(long, lat, dist)
+	gq.SetField("Location")
+	var q query.Query = gq
+	if !includeClosed {
+		q = openShops(q)
+	}
+	req := bleve.NewSearchRequest(q)
+	gSort, err := search.NewSortGeoDistance("Location", "m", long, lat, false)
 	if err != nil {
 		return nil, err
 	}
-	s.Request.SortByCustom(search.SortOrder{gSort})
-
-	res := make([]Shop, s.Total)
-	for i := range s.Hits {
-		res[i] = convertSearchResultToShop(*s.Hits[i])
+	req.SortByCustom(search.SortOrder{gSort})
+	shops, err := b.searchAll(ctx, req)
+	if err != nil {
+		return nil, err
 	}
-	return res, nil
+	SortByDistance(shops, lat, long)
+	shoplist := make([]Shop, 0, len(shops))
+	for i := range shops {
+		if shops[i].Distance <= d {
+			shoplist = append(shoplist, shops[i])
+		}
+	}
+	return shoplist, nil
 }
 
 func newShopIndexMapping() mapping.IndexMapping {
 	mapping := bleve.NewIndexMapping()
+	//Chinese text is indexed as bigrams, so that match queries on _all hit
+	//whole tags as well as words within names
+	mapping.DefaultAnalyzer = cjk.AnalyzerName
 	shopMapping := bleve.NewDocumentMapping()
 
 	//Fields
 	shopNameMap := bleve.NewTextFieldMapping()
+	shopNameMap.Analyzer = cjk.AnalyzerName
 	kwordMap := bleve.NewTextFieldMapping()
 	kwordMap.Analyzer = keyword.Name
 	shopMapping.AddFieldMappingsAt("Name", shopNameMap)
 	shopMapping.AddFieldMappingsAt("District", kwordMap)
 	shopMapping.AddFieldMappingsAt("Type", kwordMap)
+	shopMapping.AddFieldMappingsAt("Status", kwordMap)
+
+	nameLowerMap := bleve.NewTextFieldMapping()
+	nameLowerMap.Analyzer = keyword.Name
+	nameLowerMap.Store = false
+	nameLowerMap.IncludeInAll = false
+	shopMapping.AddFieldMappingsAt("NameLower", nameLowerMap)
 
 	shopMapping.AddFieldMappingsAt("Location", bleve.NewGeoPointFieldMapping())
+	//Documents indexed from Shop directly carry geohash only
+	shopMapping.AddFieldMappingsAt("Geohash", bleve.NewGeoPointFieldMapping())
 
 	noSearchMap := bleve.NewTextFieldMapping()
 	noSearchMap.Index = false
 	shopMapping.AddFieldMappingsAt("Address", noSearchMap)
 	shopMapping.AddFieldMappingsAt("URL", noSearchMap)
+	shopMapping.AddFieldMappingsAt("Notes", noSearchMap)
+	shopMapping.AddFieldMappingsAt("StatusSince", noSearchMap)
+	shopMapping.AddFieldMappingsAt("StatusUntil", noSearchMap)
+	shopMapping.AddFieldMappingsAt("Hours", noSearchMap)
 	shopMapping.AddFieldMappingsAt("Tags", kwordMap)
+
+	coordMap := bleve.NewNumericFieldMapping()
+	coordMap.Index = false
+	shopMapping.AddFieldMappingsAt("Lat", coordMap)
+	shopMapping.AddFieldMappingsAt("Long", coordMap)
+	shopMapping.AddFieldMappingsAt("MovedTo", coordMap)
+
+	flagMap := bleve.NewBooleanFieldMapping()
+	flagMap.IncludeInAll = false
+	shopMapping.AddFieldMappingsAt("HasLocation", flagMap)
+	shopMapping.AddFieldMappingsAt("Searchable", flagMap)
+
 	mapping.AddDocumentMapping("Shop", shopMapping)
+	mapping.DefaultMapping = shopMapping
 	mapping.TypeField = "DocType"
 	return mapping
 }
 
 //ShopCount returns total number of shops in system
-func (b *BleveBackend) ShopCount() (int, error) {
+func (b *BleveBackend) ShopCount(ctx context.Context) (int, error) {
 	c, err := b.index.DocCount()
 	if err != nil {
 		return -1, err
@@ -106,65 +302,776 @@ func (b *BleveBackend) ShopCount() (int, error) {
 	return int(c), nil
 }
 
+func fieldString(docMatch search.DocumentMatch, field string) string {
+	s, _ := docMatch.Fields[field].(string)
+	return s
+}
+
+func fieldFloat(docMatch search.DocumentMatch, field string) float64 {
+	f, _ := docMatch.Fields[field].(float64)
+	return f
+}
+
 func convertSearchResultToShop(docMatch search.DocumentMatch) Shop {
 	id, _ := strconv.Atoi(docMatch.ID)
 	s := Shop{
 		ID:       id,
-		Name:     docMatch.Fields["Name"].(string),
-		Type:     docMatch.Fields["Type"].(string),
-		District: docMatch.Fields["District"].(string),
-		Address:  docMatch.Fields["Address"].(string),
-		//Position: docMatch.Locations["Location"],
+		Name:     fieldString(docMatch, "Name"),
+		Type:     fieldString(docMatch, "Type"),
+		District: fieldString(docMatch, "District"),
+		Address:  fieldString(docMatch, "Address"),
+		URL:      fieldString(docMatch, "URL"),
+		Notes:    fieldString(docMatch, "Notes"),
+		Status:   fieldString(docMatch, "Status"),
+		MovedTo:  int(fieldFloat(docMatch, "MovedTo")),
+	}
+	s.StatusSince, _ = time.Parse(time.RFC3339, fieldString(docMatch, "StatusSince"))
+	s.StatusUntil, _ = time.Parse(time.RFC3339, fieldString(docMatch, "StatusUntil"))
+	s.Hours = storedHours(fieldString(docMatch, "Hours"))
+	if hasLoc, _ := docMatch.Fields["HasLocation"].(bool); hasLoc {
+		s.Position = Coord{fieldFloat(docMatch, "Lat"), fieldFloat(docMatch, "Long")}
+	} else if _, ok := docMatch.Fields["HasLocation"]; !ok {
+		//Documents indexed from Shop directly, before bleveShop
+		s.Geohash = fieldString(docMatch, "Geohash")
+		s.Position = Coord{fieldFloat(docMatch, "Position.Lat"), fieldFloat(docMatch, "Position.Long")}
+	}
+	//Stored arrays with single element are returned as single value
+	switch tags := docMatch.Fields["Tags"].(type) {
+	case string:
+		s.Tags = []string{tags}
+	case []interface{}:
+		s.Tags = make([]string, 0, len(tags))
+		for i := range tags {
+			if t, ok := tags[i].(string); ok {
+				s.Tags = append(s.Tags, t)
+			}
+		}
 	}
 
 	return s
 }
 
+//statusQuery matches shops with any of statuses
+func statusQuery(statuses ...string) query.Query {
+	qs := make([]query.Query, len(statuses))
+	for i := range statuses {
+		tq := bleve.NewTermQuery(statuses[i])
+		tq.SetField("Status")
+		qs[i] = tq
+	}
+	return bleve.NewDisjunctionQuery(qs...)
+}
+
+//openShops restricts q to shops not closed or moved
+func openShops(q query.Query) query.Query {
+	bq := bleve.NewBooleanQuery()
+	bq.AddMust(q)
+	bq.AddMustNot(statusQuery(hiddenStatus...))
+	return bq
+}
+
+//tagQuery matches word as a tag or district
+func tagQuery(word string) query.Query {
+	tag := bleve.NewTermQuery(word)
+	tag.SetField("Tags")
+	district := bleve.NewTermQuery(word)
+	district.SetField("District")
+	return bleve.NewDisjunctionQuery(tag, district)
+}
+
+//termQuery matches term of Query
+func termQuery(t QueryTerm) query.Query {
+	var field string
+	switch t.Field {
+	case QueryDistrict:
+		field = "District"
+	case QueryType:
+		field = "Type"
+	default:
+		return tagQuery(t.Value)
+	}
+	tq := bleve.NewTermQuery(t.Value)
+	tq.SetField(field)
+	return tq
+}
+
+//keywordQuery matches shops with address or URL, where the name contains
+//keywords or every word is a tag or district
+func keywordQuery(keywords string) query.Query {
+	words := strings.Fields(keywords)
+	tags := make([]query.Query, len(words))
+	for i := range words {
+		tags[i] = tagQuery(words[i])
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`)
+	name := bleve.NewWildcardQuery("*" + escaper.Replace(strings.ToLower(keywords)) + "*")
+	name.SetField("NameLower")
+	searchable := bleve.NewBoolFieldQuery(true)
+	searchable.SetField("Searchable")
+	var match query.Query = name
+	if len(tags) > 0 {
+		match = bleve.NewDisjunctionQuery(bleve.NewConjunctionQuery(tags...), name)
+	}
+	return openShops(bleve.NewConjunctionQuery(searchable, match))
+}
+
 // ShopsWithKeyword returns shops based on keywords
-func (b *BleveBackend) ShopsWithKeyword(keyword string) ([]Shop, error) {
-	q := bleve.NewMatchPhraseQuery(keyword)
-	return b.queryIndex(q)
+func (b *BleveBackend) ShopsWithKeyword(ctx context.Context, keyword string) ([]Shop, error) {
+	if noKeyword(keyword) {
+		return make([]Shop, 0), nil
+	}
+	req := bleve.NewSearchRequest(keywordQuery(keyword))
+	shops, err := b.searchAll(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return shuffle(shops), nil
 }
 
-// ShopMissingInfo returns shops with missing location or addresses
-func (b *BleveBackend) ShopMissingInfo() ([]Shop, error) {
-	q := bleve.NewBoolFieldQuery(false)
-	q.SetField("AddressFilled")
-	return b.queryIndex(q)
+// ShopMissingInfo returns shops with missing location
+func (b *BleveBackend) ShopMissingInfo(ctx context.Context) ([]Shop, error) {
+	hasLoc := bleve.NewBoolFieldQuery(false)
+	hasLoc.SetField("HasLocation")
+	q := openShops(hasLoc).(*query.BooleanQuery)
+	nonPhy := bleve.NewTermQuery(nonPhyStore)
+	nonPhy.SetField("District")
+	q.AddMustNot(nonPhy)
+	return b.searchAll(ctx, bleve.NewSearchRequest(q))
 }
 
-func (b *BleveBackend) queryIndex(q query.Query) ([]Shop, error) {
-	req := bleve.NewSearchRequest(q)
-	req.IncludeLocations = true
-	res, err := b.index.Search(req)
+//searchAll runs req and collects every hit, page by page
+func (b *BleveBackend) searchAll(ctx context.Context, req *bleve.SearchRequest) ([]Shop, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	req.Fields = []string{"*"}
+	req.Size = blevePageSize
+	shops := make([]Shop, 0)
+	for {
+		res, err := b.index.SearchInContext(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		for i := range res.Hits {
+			shops = append(shops, convertSearchResultToShop(*res.Hits[i]))
+		}
+		req.From += len(res.Hits)
+		if len(res.Hits) == 0 || uint64(req.From) >= res.Total {
+			break
+		}
+	}
+	return shops, nil
+}
+
+// UpdateShopInfo fills address and location into indexed shops
+func (b *BleveBackend) UpdateShopInfo(ctx context.Context, shops []Shop) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	batch := b.index.NewBatch()
+	for i := range shops {
+		shop, err := b.ShopByID(ctx, shops[i].ID)
+		if err != nil {
+			return err
+		}
+		shop.Address = shops[i].Address
+		shop.Position.Lat, shop.Position.Long = shops[i].ToCoord()
+		batch.Index(strconv.Itoa(shop.ID), newBleveShop(shop))
+	}
+	return b.index.Batch(batch)
+}
+
+// ImportShops indexes full shop records, replacing existing ones
+func (b *BleveBackend) ImportShops(ctx context.Context, shops []Shop) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	batch := b.index.NewBatch()
+	for i := range shops {
+		err := batch.Index(strconv.Itoa(shops[i].ID), newBleveShop(shops[i]))
+		if err != nil {
+			return err
+		}
+	}
+	return b.index.Batch(batch)
+}
+
+// AllShops returns all shops in index
+func (b *BleveBackend) AllShops(ctx context.Context) ([]Shop, error) {
+	return b.searchAll(ctx, bleve.NewSearchRequest(bleve.NewMatchAllQuery()))
+}
+
+//AdvQuery returns shops matching q, closed and moved shops are returned only
+//if includeClosed is set
+func (b *BleveBackend) AdvQuery(ctx context.Context, q Query, includeClosed bool) ([]Shop, error) {
+	sq, err := advQuery(q, includeClosed)
 	if err != nil {
 		return nil, err
 	}
-	shops := make([]Shop, len(res.Hits))
-	for i := range res.Hits {
-		shops[i] = convertSearchResultToShop(*res.Hits[i])
+	shops, err := b.searchAll(ctx, bleve.NewSearchRequest(sq))
+	if err != nil {
+		return nil, err
 	}
+	return shuffle(shops), nil
+}
 
-	return shops, nil
+//QueryFacets counts shops matching q by district and type with term facets
+func (b *BleveBackend) QueryFacets(ctx context.Context, q Query, includeClosed bool) (Facets, error) {
+	sq, err := advQuery(q, includeClosed)
+	if err != nil {
+		return nil, err
+	}
+	req := bleve.NewSearchRequestOptions(sq, 0, 0, false)
+	for _, field := range FacetFields {
+		req.AddFacet(field, bleve.NewFacetRequest(bleveFacetFields[field], bleveFacetSize))
+	}
+	res, err := b.index.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	result := make(Facets, len(FacetFields))
+	for _, field := range FacetFields {
+		facets := make([]Facet, 0)
+		if fr, ok := res.Facets[field]; ok {
+			for _, t := range fr.Terms {
+				if t.Term != "" {
+					facets = append(facets, Facet{Value: t.Term, Count: t.Count})
+				}
+			}
+		}
+		result[field] = sortFacets(facets)
+	}
+	return result, nil
+}
+
+//bleveFacetFields are indexed fields of FacetFields
+var bleveFacetFields = map[string]string{QueryDistrict: "District", QueryType: "Type"}
+
+//advQuery compiles q to term queries only, so users cannot craft expensive
+//ones
+func advQuery(q Query, includeClosed bool) (query.Query, error) {
+	err := q.searchable()
+	if err != nil {
+		return nil, err
+	}
+	bq := bleve.NewBooleanQuery()
+	for _, group := range q.Must {
+		alt := make([]query.Query, len(group))
+		for i := range group {
+			alt[i] = termQuery(group[i])
+		}
+		bq.AddMust(bleve.NewDisjunctionQuery(alt...))
+	}
+	for i := range q.Not {
+		bq.AddMustNot(termQuery(q.Not[i]))
+	}
+	if !includeClosed {
+		return openShops(bq), nil
+	}
+	return bq, nil
 }
 
-// UpdateShopInfo fills shops into index
-func (b *BleveBackend) UpdateShopInfo(shops []Shop) error {
+//ShopsWithStatus returns all shops with provided status
+func (b *BleveBackend) ShopsWithStatus(ctx context.Context, status string) ([]Shop, error) {
+	var q query.Query
+	if status == StatusOpen {
+		//Empty status is not indexed, exclude all others instead
+		bq := bleve.NewBooleanQuery()
+		bq.AddMust(bleve.NewMatchAllQuery())
+		bq.AddMustNot(statusQuery(StatusTempClosed, StatusClosed, StatusMoved))
+		q = bq
+	} else {
+		q = statusQuery(status)
+	}
+	return b.searchAll(ctx, bleve.NewSearchRequest(q))
+}
+
+//UpdateShopStatus saves status, its effective dates and new location of shops
+func (b *BleveBackend) UpdateShopStatus(ctx context.Context, shops []Shop) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	batch := b.index.NewBatch()
 	for i := range shops {
-		batch.Index(strconv.Itoa(shops[i].ID), shops[i])
+		shop, err := b.ShopByID(ctx, shops[i].ID)
+		if err != nil {
+			return err
+		}
+		shop.Status = shops[i].Status
+		shop.StatusSince = shops[i].StatusSince
+		shop.StatusUntil = shops[i].StatusUntil
+		shop.MovedTo = shops[i].MovedTo
+		batch.Index(strconv.Itoa(shop.ID), newBleveShop(shop))
+	}
+	return b.index.Batch(batch)
+}
+
+//checkDuplicate returns *ConflictError if another open shop has the same
+//name and address
+func (b *BleveBackend) checkDuplicate(ctx context.Context, shop Shop) error {
+	name := bleve.NewMatchPhraseQuery(shop.Name)
+	name.SetField("Name")
+	candidates, err := b.searchAll(ctx, bleve.NewSearchRequest(openShops(name)))
+	if err != nil {
+		return err
+	}
+	return duplicateOf(shop, candidates)
+}
+
+//maxID returns the largest shop ID in index, 0 if empty
+func (b *BleveBackend) maxID(ctx context.Context) (int, error) {
+	req := bleve.NewSearchRequest(bleve.NewMatchAllQuery())
+	req.Size = blevePageSize
+	max := 0
+	for {
+		res, err := b.index.SearchInContext(ctx, req)
+		if err != nil {
+			return 0, err
+		}
+		for i := range res.Hits {
+			if id, err := strconv.Atoi(res.Hits[i].ID); err == nil && id > max {
+				max = id
+			}
+		}
+		req.From += len(res.Hits)
+		if len(res.Hits) == 0 || uint64(req.From) >= res.Total {
+			return max, nil
+		}
+	}
+}
+
+//CreateShop validates and indexes a new shop. ID is assigned if shop.ID is 0
+func (b *BleveBackend) CreateShop(ctx context.Context, shop Shop) (Shop, error) {
+	if err := ctx.Err(); err != nil {
+		return Shop{}, err
+	}
+	err := shop.Validate()
+	if err != nil {
+		return Shop{}, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err = b.checkDuplicate(ctx, shop)
+	if err != nil {
+		return Shop{}, err
+	}
+	if shop.ID == 0 {
+		shop.ID, err = b.maxID(ctx)
+		if err != nil {
+			return Shop{}, err
+		}
+		shop.ID++
+	} else if _, err := b.ShopByID(ctx, shop.ID); err == nil {
+		return Shop{}, idTaken(shop.ID)
+	} else if !errors.Is(err, ErrShopNotFound) {
+		return Shop{}, err
+	}
+	return shop, b.index.Index(strconv.Itoa(shop.ID), newBleveShop(shop))
+}
+
+//UpdateShop indexes fields of shop again, other fields are kept
+func (b *BleveBackend) UpdateShop(ctx context.Context, shop Shop, fields ShopField) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current, err := b.ShopByID(ctx, shop.ID)
+	if err != nil {
+		return err
+	}
+	updated := applyFields(current, shop, fields)
+	err = updated.Validate()
+	if err != nil {
+		return err
+	}
+	err = b.checkDuplicate(ctx, updated)
+	if err != nil {
+		return err
+	}
+	return b.index.Index(strconv.Itoa(updated.ID), newBleveShop(updated))
+}
+
+//DeleteShop removes shop from index, ArchiveShop keeps the record instead
+func (b *BleveBackend) DeleteShop(ctx context.Context, shopID int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err := b.ShopByID(ctx, shopID)
+	if err != nil {
+		return err
+	}
+	return b.index.Delete(strconv.Itoa(shopID))
+}
+
+//ArchiveShop marks shop closed since at, so it is hidden from searches
+func (b *BleveBackend) ArchiveShop(ctx context.Context, shopID int, at time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	shop, err := b.ShopByID(ctx, shopID)
+	if err != nil {
+		return err
+	}
+	return b.index.Index(strconv.Itoa(shopID), newBleveShop(archived(shop, at)))
+}
+
+//getInternal decodes JSON value of key in internal storage into v, leaving v
+//untouched if key is not set. Must be called with mu held
+func (b *BleveBackend) getInternal(key string, v interface{}) error {
+	data, err := b.index.GetInternal([]byte(key))
+	if err != nil || data == nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+//setInternal saves v as JSON in internal storage. Must be called with mu held
+func (b *BleveBackend) setInternal(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.index.SetInternal([]byte(key), data)
+}
+
+//submissions loads all submissions from internal storage, must be called
+//with mu held
+func (b *BleveBackend) submissions() ([]Submission, error) {
+	subs := make([]Submission, 0)
+	err := b.getInternal(bleveSubmissionsKey, &subs)
+	return subs, err
+}
+
+//saveSubmissions replaces all submissions in internal storage, must be
+//called with mu held
+func (b *BleveBackend) saveSubmissions(subs []Submission) error {
+	return b.setInternal(bleveSubmissionsKey, subs)
+}
+
+//AddSubmission saves a new submission with ID assigned
+func (b *BleveBackend) AddSubmission(ctx context.Context, sub Submission) (Submission, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs, err := b.submissions()
+	if err != nil {
+		return Submission{}, err
+	}
+	sub.ID = len(subs) + 1
+	return sub, b.saveSubmissions(append(subs, sub))
+}
+
+//SubmissionByID returns submission by internal ID
+func (b *BleveBackend) SubmissionByID(ctx context.Context, id int) (Submission, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs, err := b.submissions()
+	if err != nil {
+		return Submission{}, err
+	}
+	if id < 1 || id > len(subs) {
+		return Submission{}, submissionNotFound(id)
+	}
+	return subs[id-1], nil
+}
+
+//PendingSubmissions returns submissions waiting for review, oldest first
+func (b *BleveBackend) PendingSubmissions(ctx context.Context) ([]Submission, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs, err := b.submissions()
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]Submission, 0)
+	for i := range subs {
+		if subs[i].Status == SubmissionPending {
+			pending = append(pending, subs[i])
+		}
+	}
+	return pending, nil
+}
+
+//UpdateSubmission saves changes to submission
+func (b *BleveBackend) UpdateSubmission(ctx context.Context, sub Submission) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs, err := b.submissions()
+	if err != nil {
+		return err
+	}
+	if sub.ID < 1 || sub.ID > len(subs) {
+		return submissionNotFound(sub.ID)
+	}
+	subs[sub.ID-1] = sub
+	return b.saveSubmissions(subs)
+}
+
+//AddReport saves a new report with ID assigned
+func (b *BleveBackend) AddReport(ctx context.Context, rep Report) (Report, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	reps := make([]Report, 0)
+	err := b.getInternal(bleveReportsKey, &reps)
+	if err != nil {
+		return Report{}, err
+	}
+	for i := range reps {
+		if sameReport(rep, reps[i]) {
+			return reps[i], ErrDuplicateReport
+		}
+	}
+	rep.ID = len(reps) + 1
+	return rep, b.setInternal(bleveReportsKey, append(reps, rep))
+}
+
+//OpenReports returns reports not yet resolved, oldest first
+func (b *BleveBackend) OpenReports(ctx context.Context) ([]Report, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	reps := make([]Report, 0)
+	err := b.getInternal(bleveReportsKey, &reps)
+	if err != nil {
+		return nil, err
+	}
+	open := make([]Report, 0)
+	for i := range reps {
+		if reps[i].ResolvedBy == 0 {
+			open = append(open, reps[i])
+		}
+	}
+	return open, nil
+}
+
+//ResolveReports resolves all open reports of shop, returning the number of
+//reports resolved
+func (b *BleveBackend) ResolveReports(ctx context.Context, shopID, by int, at time.Time) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	reps := make([]Report, 0)
+	err := b.getInternal(bleveReportsKey, &reps)
+	if err != nil {
+		return 0, err
+	}
+	cnt := 0
+	for i := range reps {
+		if reps[i].ShopID == shopID && reps[i].ResolvedBy == 0 {
+			reps[i].ResolvedBy, reps[i].Resolved = by, at
+			cnt++
+		}
+	}
+	if cnt == 0 {
+		return 0, nil
+	}
+	return cnt, b.setInternal(bleveReportsKey, reps)
+}
+
+//AddFavourite marks shop as favourite of user
+func (b *BleveBackend) AddFavourite(ctx context.Context, userID, shopID int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := bleveFavouritesKey + strconv.Itoa(userID)
+	ids := make([]int, 0)
+	err := b.getInternal(key, &ids)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id == shopID {
+			return nil
+		}
 	}
-	err := b.index.Batch(batch)
+	return b.setInternal(key, append(ids, shopID))
+}
+
+//RemoveFavourite unmarks favourite shop of user
+func (b *BleveBackend) RemoveFavourite(ctx context.Context, userID, shopID int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := bleveFavouritesKey + strconv.Itoa(userID)
+	ids := make([]int, 0)
+	err := b.getInternal(key, &ids)
 	if err != nil {
 		return err
 	}
+	for i := range ids {
+		if ids[i] == shopID {
+			return b.setInternal(key, append(ids[:i], ids[i+1:]...))
+		}
+	}
 	return nil
 }
 
-//AdvQuery accepts query string syntax (in Bleve format) and returns result
-func (b *BleveBackend) AdvQuery(query string) ([]Shop, error) {
-	q := bleve.NewQueryStringQuery(query)
-	return b.queryIndex(q)
+//favouriteIDs returns favourite shop IDs of user, latest marked last
+func (b *BleveBackend) favouriteIDs(userID int) ([]int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ids := make([]int, 0)
+	err := b.getInternal(bleveFavouritesKey+strconv.Itoa(userID), &ids)
+	return ids, err
+}
+
+//IsFavourite checks if shop is favourite of user
+func (b *BleveBackend) IsFavourite(ctx context.Context, userID, shopID int) (bool, error) {
+	ids, err := b.favouriteIDs(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range ids {
+		if id == shopID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//Favourites returns favourite shops of user, latest marked first
+func (b *BleveBackend) Favourites(ctx context.Context, userID int) ([]Shop, error) {
+	ids, err := b.favouriteIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	shops := make([]Shop, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		shop, err := b.ShopByID(ctx, ids[i])
+		if errors.Is(err, ErrShopNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		shops = append(shops, shop)
+	}
+	return shops, nil
+}
+
+func bleveUserKey(userID int, key string) []byte {
+	return []byte(bleveUserDataKey + strconv.Itoa(userID) + ":" + key)
+}
+
+//UserData returns value saved under key, nil if not found
+func (b *BleveBackend) UserData(ctx context.Context, userID int, key string) ([]byte, error) {
+	return b.index.GetInternal(bleveUserKey(userID, key))
+}
+
+//bleveUserLog is the log of UserStore values saved by a user, entries from
+//First to Next-1 may be left
+type bleveUserLog struct {
+	First int64
+	Next  int64
+}
+
+//bleveUserSave is an entry of bleveUserLog
+type bleveUserSave struct {
+	Key   string
+	Saved int64 //Unix time
+}
+
+func bleveUserLogEntry(userID int, seq int64) string {
+	return bleveUserLogKey + strconv.Itoa(userID) + ":" + strconv.FormatInt(seq, 10)
+}
+
+func bleveUserSaved(userID int, key string) string {
+	return bleveUserSavedKey + strconv.Itoa(userID) + ":" + key
+}
+
+//SetUserData saves value under key, adding the save to the log of user
+func (b *BleveBackend) SetUserData(ctx context.Context, userID int, key string, value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var saves bleveUserLog
+	err := b.getInternal(bleveUserLogKey+strconv.Itoa(userID), &saves)
+	if err != nil {
+		return err
+	}
+	err = b.index.SetInternal(bleveUserKey(userID, key), value)
+	if err != nil {
+		return err
+	}
+	err = b.setInternal(bleveUserLogEntry(userID, saves.Next), bleveUserSave{Key: key, Saved: time.Now().Unix()})
+	if err != nil {
+		return err
+	}
+	err = b.setInternal(bleveUserSaved(userID, key), saves.Next)
+	if err != nil {
+		return err
+	}
+	saves.Next++
+	return b.setInternal(bleveUserLogKey+strconv.Itoa(userID), saves)
+}
+
+//DeleteUserData removes value under key. Its entries in the log are dropped
+//on purge
+func (b *BleveBackend) DeleteUserData(ctx context.Context, userID int, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.deleteUserData(userID, key)
+}
+
+//deleteUserData is DeleteUserData with mu held
+func (b *BleveBackend) deleteUserData(userID int, key string) error {
+	err := b.index.DeleteInternal(bleveUserKey(userID, key))
+	if err != nil {
+		return err
+	}
+	return b.index.DeleteInternal([]byte(bleveUserSaved(userID, key)))
+}
+
+//PurgeUserData removes values under keys beginning with prefix saved before
+//cutoff, going through the log of user from the oldest save. Entries of
+//values saved again or deleted are dropped on the way, while ones of values
+//under other keys are kept and read again on next purge. Values saved
+//before the log are left
+func (b *BleveBackend) PurgeUserData(ctx context.Context, userID int, prefix string, cutoff time.Time) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var saves bleveUserLog
+	err := b.getInternal(bleveUserLogKey+strconv.Itoa(userID), &saves)
+	if err != nil {
+		return 0, err
+	}
+	first := saves.First
+	n := 0
+	for seq := saves.First; seq < saves.Next; seq++ {
+		var save *bleveUserSave
+		err = b.getInternal(bleveUserLogEntry(userID, seq), &save)
+		if err != nil {
+			break
+		}
+		if save != nil {
+			if save.Saved >= cutoff.Unix() {
+				break
+			}
+			last := int64(-1)
+			err = b.getInternal(bleveUserSaved(userID, save.Key), &last)
+			if err != nil {
+				break
+			}
+			if last == seq {
+				if !strings.HasPrefix(save.Key, prefix) {
+					continue
+				}
+				err = b.deleteUserData(userID, save.Key)
+				if err != nil {
+					break
+				}
+				n++
+			}
+			err = b.index.DeleteInternal([]byte(bleveUserLogEntry(userID, seq)))
+			if err != nil {
+				break
+			}
+		}
+		if first == seq {
+			first = seq + 1
+		}
+	}
+	if first == saves.First {
+		return n, err
+	}
+	saves.First = first
+	if saveErr := b.setInternal(bleveUserLogKey+strconv.Itoa(userID), saves); err == nil {
+		err = saveErr
+	}
+	return n, err
 }
 
 // Close Bleve index
@@ -173,61 +1080,64 @@ func (b *BleveBackend) Close() {
 }
 
 //ShopsWithKeywordSortByDist sort position by distance
-func (b *BleveBackend) ShopsWithKeywordSortByDist(keywords string, lat, long float64) ([]Shop, error) {
-	q := bleve.NewMatchPhraseQuery(keywords)
-	req := bleve.NewSearchRequest(q)
-	gs, err := search.NewSortGeoDistance("location", "m", long, lat, true)
+func (b *BleveBackend) ShopsWithKeywordSortByDist(ctx context.Context, keywords string, lat, long float64) ([]Shop, error) {
+	if noKeyword(keywords) {
+		return make([]Shop, 0), nil
+	}
+	req := bleve.NewSearchRequest(keywordQuery(keywords))
+	gs, err := search.NewSortGeoDistance("Location", "m", long, lat, false)
 	if err != nil {
 		return nil, err
 	}
 	req.SortByCustom(search.SortOrder{gs})
-	req.IncludeLocations = true
-	res, err := b.index.Search(req)
+	shops, err := b.searchAll(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-	shops := make([]Shop, len(res.Hits))
-	for i := range res.Hits {
-		shops[i] = convertSearchResultToShop(*res.Hits[i])
+	SortByDistance(shops, lat, long)
+	if len(shops) > 30 {
+		shops = shops[:30]
 	}
-
 	return shops, nil
 }
 
-//SuggestKeyword will take provided keyword to look into the keyword db and search
-//with edit distance <= len(key) - 1
-func (b *BleveBackend) SuggestKeyword(key string) ([]string, error) {
-	q := bleve.NewFuzzyQuery(key)
-	q.SetFuzziness(len(key) - 1)
-	sr := bleve.NewSearchRequest(q)
-	fr := bleve.NewFacetRequest("Tags", 4)
-	sr.AddFacet("shopType", fr)
-	res, err := b.index.Search(sr)
+//termsOf returns all indexed terms of field
+func (b *BleveBackend) termsOf(field string) ([]string, error) {
+	dict, err := b.index.FieldDict(field)
 	if err != nil {
 		return nil, err
 	}
-	terms := make([]string, len(res.Facets["shopType"].Terms))
-	for i := range res.Facets["shopType"].Terms {
-		terms[i] = res.Facets["shopType"].Terms[i].Term
+	defer dict.Close()
+
+	terms := make([]string, 0)
+	for {
+		ety, err := dict.Next()
+		if err != nil || ety == nil {
+			break
+		}
+		terms = append(terms, ety.Term)
 	}
 	return terms, nil
 }
 
-//Districts returns a list of districts
-func (b *BleveBackend) Districts() ([]string, error) {
-	dict, err := b.index.FieldDict("District")
+//SuggestKeyword will take provided keyword to look into indexed tags and search
+//with edit distance <= len(key) - 1
+func (b *BleveBackend) SuggestKeyword(ctx context.Context, key string) ([]string, error) {
+	tags, err := b.termsOf("Tags")
 	if err != nil {
 		return nil, err
 	}
-	defer dict.Close()
-
-	dc := make([]string, 0)
-	for {
-		ety, err := dict.Next()
-		if err != nil {
-			break
+	t := len([]rune(key))
+	suggestList := make([]string, 0)
+	for _, k := range tags {
+		if t == 1 && strings.Contains(k, key) || t > 1 && editDistance(key, k) <= t-1 {
+			suggestList = append(suggestList, k)
 		}
-		dc = append(dc, ety.Term)
 	}
-	return dc, nil
+	return suggestList, nil
+}
+
+//Districts returns a list of districts
+func (b *BleveBackend) Districts(ctx context.Context) ([]string, error) {
+	return b.termsOf("District")
 }
@@ -1,13 +1,18 @@
 package dao
 
 import (
+	"context"
 	"fmt"
 	"github.com/blevesearch/bleve"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func prepareDataset() (bleve.Index, error) {
-	idx, err := bleve.NewMemOnly(newShopIndexMapping())
+	//Scorch as NewBleveBackend, fuzzy queries of the default in-memory index
+	//count edits in bytes rather than characters
+	idx, err := bleve.NewUsing("", newShopIndexMapping(), "scorch", "scorch", nil)
 	if err != nil {
 		return nil, fmt.Errorf("Cannot create store file %w", err)
 	}
@@ -173,11 +178,13 @@ func TestSuggestTerms(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	//Scorch counts edits in characters, fuzziness 2 would match every two
+	//character tag. Type is counted, as tags of matching shops have districts
 	q := bleve.NewFuzzyQuery("珈啡")
-	q.SetFuzziness(2)
+	q.SetFuzziness(1)
 	q.SetField("Tags")
 	sr := bleve.NewSearchRequest(q)
-	fr := bleve.NewFacetRequest("Tags", 4)
+	fr := bleve.NewFacetRequest("Type", 4)
 	sr.AddFacet("shopType", fr)
 	res, err := idx.Search(sr)
 	if err != nil {
@@ -192,6 +199,24 @@ func TestSuggestTerms(t *testing.T) {
 	}
 }
 
+func TestSuggestKeyword(t *testing.T) {
+	idx, err := prepareDataset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := BleveBackend{index: idx}
+	terms, err := b.SuggestKeyword(context.Background(), "珈啡")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(terms) != 1 {
+		t.Fatalf("Size expected: 1, actual %d", len(terms))
+	}
+	if terms[0] != "咖啡" {
+		t.Errorf("Word expected: 咖啡, actual %s", terms[0])
+	}
+}
+
 func TestUpdateIndex(t *testing.T) {
 	idx, _ := prepareDataset()
 	idx.Index("8", Shop{
@@ -253,3 +278,93 @@ func TestGeoSearch(t *testing.T) {
 		t.Errorf("District expected: 荃灣, actual %s", sr.Hits[0].Fields["District"])
 	}
 }
+
+func TestMappingUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wongdim.bleve")
+	idx, err := bleve.NewUsing(path, bleve.NewIndexMapping(), "scorch", "scorch", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Index("2", Shop{
+		ID:       2,
+		Name:     "留白",
+		Address:  "荃灣荃昌中心昌寧商場地下, 12號舖 Tsuen Wan, Hong Kong",
+		Type:     "咖啡",
+		District: "荃灣",
+		Geohash:  "wecpkbeddsmf",
+		Tags:     []string{"荃灣", "咖啡"},
+	})
+	idx.SetInternal([]byte("kept"), []byte(`1`))
+	idx.Close()
+
+	b, err := NewBleveBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	ctx := context.Background()
+	shops, err := b.NearestShops(ctx, 22.371154, 114.112603, "1km", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 1 || shops[0].ID != 2 {
+		t.Errorf("Nearest shops expected: [2], actual %v", shops)
+	}
+	shops, err = b.ShopsWithKeyword(ctx, "荃灣 咖啡")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 1 || shops[0].ID != 2 {
+		t.Errorf("Keyword search expected: [2], actual %v", shops)
+	}
+	v, err := b.index.GetInternal([]byte("kept"))
+	if err != nil || string(v) != "1" {
+		t.Errorf("Internal value expected to be kept, actual %q, %v", v, err)
+	}
+}
+
+func TestPurgeUserLog(t *testing.T) {
+	b, err := NewBleveBackend(filepath.Join(t.TempDir(), "wongdim.bleve"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	ctx := context.Background()
+	for _, key := range []string{"history", "query:a", "query:b", "query:a"} {
+		err = b.SetUserData(ctx, 100, key, []byte(`1`))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = b.DeleteUserData(ctx, 100, "query:b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cutoff := time.Now().Add(time.Hour)
+	for _, c := range []struct {
+		prefix string
+		n      int
+		log    bleveUserLog
+	}{
+		//Entry of history is left ahead of the dropped ones
+		{"query:", 1, bleveUserLog{First: 0, Next: 4}},
+		{"history", 1, bleveUserLog{First: 4, Next: 4}},
+		{"history", 0, bleveUserLog{First: 4, Next: 4}},
+	} {
+		n, err := b.PurgeUserData(ctx, 100, c.prefix, cutoff)
+		if err != nil || n != c.n {
+			t.Errorf("Purge %s expected %d removed, actual %d (%v)", c.prefix, c.n, n, err)
+		}
+		var saves bleveUserLog
+		err = b.getInternal(bleveUserLogKey+"100", &saves)
+		if err != nil || saves != c.log {
+			t.Errorf("Log after purge %s expected %v, actual %v (%v)", c.prefix, c.log, saves, err)
+		}
+	}
+	for _, seq := range []int64{1, 2, 3} {
+		v, err := b.index.GetInternal([]byte(bleveUserLogEntry(100, seq)))
+		if err != nil || v != nil {
+			t.Errorf("Entry %d expected dropped, actual %q (%v)", seq, v, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package dao_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/dao/backendtest"
+)
+
+func TestMemoryConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) dao.Backend {
+		return dao.NewMemoryBackend(nil)
+	}, backendtest.Fixture())
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) dao.Backend {
+		db, err := dao.NewSQLiteBackend(filepath.Join(t.TempDir(), "wongdim.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}, backendtest.Fixture())
+}
+
+func TestBleveConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) dao.Backend {
+		db, err := dao.NewBleveBackend(filepath.Join(t.TempDir(), "wongdim.bleve"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}, backendtest.Fixture())
+}
+
+//Postgres suites need a database with cuisine text search configs and
+//fuzzystrmatch installed, connection string is provided by environment
+func TestPostgresConformance(t *testing.T) {
+	connStr := os.Getenv("WDIM_TEST_PGSQL")
+	if connStr == "" {
+		t.Skip("WDIM_TEST_PGSQL not set")
+	}
+	backendtest.Run(t, func(t *testing.T) dao.Backend {
+		db, err := dao.NewPostgresBackend(connStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFixtureOnly(t, db)
+		return db
+	}, backendtest.Fixture())
+}
+
+func TestPostGISConformance(t *testing.T) {
+	connStr := os.Getenv("WDIM_TEST_POSTGIS")
+	if connStr == "" {
+		t.Skip("WDIM_TEST_POSTGIS not set")
+	}
+	backendtest.Run(t, func(t *testing.T) dao.Backend {
+		db, err := dao.NewPostGISBackend(connStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFixtureOnly(t, db)
+		return db
+	}, backendtest.Fixture())
+}
+
+//checkFixtureOnly refuses to run against database holding other data. Fixture
+//is imported again by each test, which restores any changed shops
+func checkFixtureOnly(t *testing.T, db dao.Exporter) {
+	fixture := make(map[int]struct{})
+	for _, shop := range backendtest.Fixture() {
+		fixture[shop.ID] = struct{}{}
+	}
+	shops, err := db.AllShops(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range shops {
+		if _, ok := fixture[shops[i].ID]; !ok {
+			t.Fatalf("Test database contains shop %d outside fixture, refusing to run", shops[i].ID)
+		}
+	}
+}
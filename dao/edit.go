@@ -0,0 +1,154 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	ghash "github.com/mmcloughlin/geohash"
+)
+
+//ShopField is a bit mask of shop fields, used for partial update
+type ShopField uint
+
+//Fields of shop which can be updated separately
+const (
+	FieldName     ShopField = 1 << iota
+	FieldAddress            //Address only, see FieldLocation for coordinates
+	FieldLocation           //Geohash and Position
+	FieldType
+	FieldDistrict
+	FieldURL
+	FieldTags
+	FieldNotes
+	FieldStatus //Status, StatusSince, StatusUntil and MovedTo
+	FieldHours
+
+	//FieldAll updates every field
+	FieldAll = FieldName | FieldAddress | FieldLocation | FieldType | FieldDistrict | FieldURL | FieldTags |
+		FieldNotes | FieldStatus | FieldHours
+)
+
+//Valid geohash characters
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+//ErrShopNotFound is returned when the shop requested does not exist
+var ErrShopNotFound = errors.New("not found")
+
+//ConflictError is returned when a write would clash with an existing shop
+type ConflictError struct {
+	ShopID int    //ID of the existing shop
+	Reason string //What is clashing
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("Conflict with shop %d: %s", e.ShopID, e.Reason)
+}
+
+//ValidationError is returned when a shop is rejected before writing
+type ValidationError struct {
+	Field  ShopField //Offending field
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return "Invalid shop: " + e.Reason
+}
+
+//Validate checks required fields and coordinates of shop
+func (s Shop) Validate() error {
+	switch {
+	case strings.TrimSpace(s.Name) == "":
+		return &ValidationError{FieldName, "name is required"}
+	case strings.TrimSpace(s.Type) == "":
+		return &ValidationError{FieldType, "type is required"}
+	case strings.TrimSpace(s.District) == "":
+		return &ValidationError{FieldDistrict, "district is required"}
+	}
+	if s.Position != (Coord{}) {
+		if s.Position.Lat < -90 || s.Position.Lat > 90 || s.Position.Long < -180 || s.Position.Long > 180 {
+			return &ValidationError{FieldLocation, fmt.Sprintf("coordinates %v out of range", s.Position)}
+		}
+	}
+	if s.Geohash != "" {
+		if len(s.Geohash) > 12 || strings.Trim(s.Geohash, geohashAlphabet) != "" {
+			return &ValidationError{FieldLocation, fmt.Sprintf("invalid geohash %q", s.Geohash)}
+		}
+		if s.Position != (Coord{}) && !ghash.BoundingBox(s.Geohash).Contains(s.Position.Lat, s.Position.Long) {
+			return &ValidationError{FieldLocation, "geohash and coordinates do not agree"}
+		}
+	}
+	if s.Status != StatusOpen && s.Status != StatusTempClosed && s.Status != StatusClosed &&
+		s.Status != StatusMoved {
+		return &ValidationError{FieldStatus, fmt.Sprintf("unknown status %q", s.Status)}
+	}
+	return nil
+}
+
+//applyFields returns dst with fields copied from src
+func applyFields(dst, src Shop, fields ShopField) Shop {
+	if fields&FieldName != 0 {
+		dst.Name = src.Name
+	}
+	if fields&FieldAddress != 0 {
+		dst.Address = src.Address
+	}
+	if fields&FieldLocation != 0 {
+		dst.Geohash, dst.Position = src.Geohash, src.Position
+	}
+	if fields&FieldType != 0 {
+		dst.Type = src.Type
+	}
+	if fields&FieldDistrict != 0 {
+		dst.District = src.District
+	}
+	if fields&FieldURL != 0 {
+		dst.URL = src.URL
+	}
+	if fields&FieldTags != 0 {
+		dst.Tags = src.Tags
+	}
+	if fields&FieldNotes != 0 {
+		dst.Notes = src.Notes
+	}
+	if fields&FieldStatus != 0 {
+		dst.Status, dst.StatusSince, dst.StatusUntil, dst.MovedTo = src.Status, src.StatusSince, src.StatusUntil, src.MovedTo
+	}
+	if fields&FieldHours != 0 {
+		dst.Hours = src.Hours
+	}
+	return dst
+}
+
+//archived returns shop closed for good since at
+func archived(shop Shop, at time.Time) Shop {
+	shop.Status, shop.StatusSince, shop.StatusUntil = StatusClosed, at, time.Time{}
+	return shop
+}
+
+//duplicateOf returns the conflict if any of candidates is the same shop as
+//shop, i.e. same name and address and both are not closed or moved
+func duplicateOf(shop Shop, candidates []Shop) error {
+	if shop.IsClosed() {
+		return nil
+	}
+	for i := range candidates {
+		c := candidates[i]
+		if c.ID != shop.ID && !c.IsClosed() && strings.EqualFold(strings.TrimSpace(c.Name), strings.TrimSpace(shop.Name)) &&
+			strings.EqualFold(strings.Join(strings.Fields(c.Address), ""), strings.Join(strings.Fields(shop.Address), "")) {
+			return &ConflictError{c.ID, "same name and address"}
+		}
+	}
+	return nil
+}
+
+//idTaken returns the conflict of creating a shop with used ID
+func idTaken(shopID int) error {
+	return &ConflictError{shopID, "ID already used"}
+}
+
+//shopNotFound wraps ErrShopNotFound with the shop ID
+func shopNotFound(shopID int) error {
+	return fmt.Errorf("Shop with %d %w", shopID, ErrShopNotFound)
+}
@@ -0,0 +1,63 @@
+package dao
+
+import (
+	"sort"
+)
+
+//FacetFields are fields shops are counted by in facets, QueryDistrict and
+//QueryType
+var FacetFields = []string{QueryDistrict, QueryType}
+
+//facetColumns are SQL columns of FacetFields
+var facetColumns = map[string]string{QueryDistrict: "district", QueryType: "type"}
+
+//Facet is the number of shops with a value of a field
+type Facet struct {
+	Value string
+	Count int
+}
+
+//Facets are counts of shops by value of each field in FacetFields, most
+//first. Shops without value are not counted
+type Facets map[string][]Facet
+
+//Facet returns value of field of shop, QueryDistrict or QueryType
+func (s Shop) Facet(field string) string {
+	switch field {
+	case QueryDistrict:
+		return s.District
+	case QueryType:
+		return s.Type
+	}
+	return ""
+}
+
+//sortFacets puts most common values first, then by value
+func sortFacets(facets []Facet) []Facet {
+	sort.Slice(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].Value < facets[j].Value
+	})
+	return facets
+}
+
+//CountFacets counts shops by each of FacetFields, for lists not from AdvQuery
+func CountFacets(shops []Shop) Facets {
+	result := make(Facets, len(FacetFields))
+	for _, field := range FacetFields {
+		counts := make(map[string]int)
+		for i := range shops {
+			if v := shops[i].Facet(field); v != "" {
+				counts[v]++
+			}
+		}
+		facets := make([]Facet, 0, len(counts))
+		for v, n := range counts {
+			facets = append(facets, Facet{Value: v, Count: n})
+		}
+		result[field] = sortFacets(facets)
+	}
+	return result
+}
@@ -0,0 +1,15 @@
+package dao
+
+import "context"
+
+//FavouriteStore are datasources keeping shops marked as favourite by users
+type FavouriteStore interface {
+	//AddFavourite marks shop as favourite of user, no error if already marked
+	AddFavourite(ctx context.Context, userID, shopID int) error
+	//RemoveFavourite unmarks shop, no error if not marked
+	RemoveFavourite(ctx context.Context, userID, shopID int) error
+	IsFavourite(ctx context.Context, userID, shopID int) (bool, error)
+	//Favourites returns favourite shops of user, latest marked first. Deleted
+	//shops are skipped
+	Favourites(ctx context.Context, userID int) ([]Shop, error)
+}
@@ -0,0 +1,414 @@
+package dao
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const dayMinutes = 24 * 60
+
+//HKT is the time zone opening hours are given in. Hong Kong has no daylight
+//saving, so a fixed zone works without tzdata installed
+var HKT = time.FixedZone("HKT", 8*60*60)
+
+//Session is an opening session within a day, in minutes from midnight. Close
+//goes beyond 24:00 for sessions ending after midnight
+type Session struct {
+	Open  int
+	Close int
+}
+
+//HolidayRule tells how a shop opens on public holidays
+type HolidayRule int
+
+const (
+	//HolidayAsUsual follows the schedule of the weekday
+	HolidayAsUsual HolidayRule = iota
+	//HolidayClosed is closed on public holidays
+	HolidayClosed
+	//HolidayCustom follows OpeningHours.HolidaySessions
+	HolidayCustom
+)
+
+//OpeningHours is a weekly schedule with a public holiday rule
+type OpeningHours struct {
+	Weekly          [7][]Session //Sessions by time.Weekday
+	Holiday         HolidayRule
+	HolidaySessions []Session
+}
+
+//Holidays is a set of public holidays, keyed by YYYY-MM-DD in Hong Kong time
+type Holidays map[string]struct{}
+
+//NewHolidays returns holidays on provided dates in YYYY-MM-DD
+func NewHolidays(dates ...string) (Holidays, error) {
+	h := make(Holidays, len(dates))
+	for i := range dates {
+		_, err := time.Parse("2006-01-02", dates[i])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid holiday %s: %w", dates[i], err)
+		}
+		h[dates[i]] = struct{}{}
+	}
+	return h, nil
+}
+
+//Contains returns true if the Hong Kong date of t is a holiday
+func (h Holidays) Contains(t time.Time) bool {
+	_, ok := h[t.In(HKT).Format("2006-01-02")]
+	return ok
+}
+
+//SessionsOn returns sessions on the Hong Kong date of t
+func (h OpeningHours) SessionsOn(t time.Time, hol Holidays) []Session {
+	t = t.In(HKT)
+	if hol.Contains(t) {
+		switch h.Holiday {
+		case HolidayClosed:
+			return nil
+		case HolidayCustom:
+			return h.HolidaySessions
+		}
+	}
+	return h.Weekly[t.Weekday()]
+}
+
+//ClosesIn returns time left before closing if the shop is open at t.
+//Sessions running into the next day's first session count as one
+func (h OpeningHours) ClosesIn(t time.Time, hol Holidays) (time.Duration, bool) {
+	t = t.In(HKT)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, HKT)
+	now := int(t.Sub(midnight) / time.Minute)
+	//Sessions of yesterday may run past midnight
+	for _, day := range []int{-1, 0} {
+		date := midnight.AddDate(0, 0, day)
+		offset := -day * dayMinutes
+		for _, s := range h.SessionsOn(date, hol) {
+			if now+offset < s.Open || now+offset >= s.Close {
+				continue
+			}
+			closing := date.Add(time.Duration(s.Close) * time.Minute)
+			if s.Close%dayMinutes == 0 {
+				for _, n := range h.SessionsOn(closing, hol) {
+					if n.Open == 0 {
+						closing = closing.Add(time.Duration(n.Close) * time.Minute)
+					}
+				}
+			}
+			return closing.Sub(t), true
+		}
+	}
+	return 0, false
+}
+
+//IsOpen returns true if the shop is open at t
+func (h OpeningHours) IsOpen(t time.Time, hol Holidays) bool {
+	_, ok := h.ClosesIn(t, hol)
+	return ok
+}
+
+func formatClock(m int) string {
+	if m != dayMinutes {
+		m %= dayMinutes
+	}
+	return fmt.Sprintf("%02d:%02d", m/60, m%60)
+}
+
+//FormatSessions formats sessions like "11:00-15:00, 18:00-02:00"
+func FormatSessions(sessions []Session) string {
+	s := make([]string, len(sessions))
+	for i := range sessions {
+		if sessions[i].Open == 0 && sessions[i].Close == dayMinutes {
+			s[i] = "24小時"
+		} else {
+			s[i] = formatClock(sessions[i].Open) + "-" + formatClock(sessions[i].Close)
+		}
+	}
+	return strings.Join(s, ", ")
+}
+
+var weekdayNames = [7]string{"日", "一", "二", "三", "四", "五", "六"}
+
+func sameSessions(a, b []Session) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//String formats hours in a form accepted by ParseHours, e.g.
+//"星期一至五 11:00-22:00; 星期六至日 10:00-23:00; 公眾假期休息"
+func (h OpeningHours) String() string {
+	clauses := make([]string, 0)
+	everyday := len(h.Weekly[0]) > 0
+	for d := 1; d < 7; d++ {
+		everyday = everyday && sameSessions(h.Weekly[d], h.Weekly[0])
+	}
+	if everyday {
+		clauses = append(clauses, FormatSessions(h.Weekly[0]))
+	} else {
+		//Group consecutive days from Monday to Sunday with same sessions
+		order := []int{1, 2, 3, 4, 5, 6, 0}
+		for i := 0; i < len(order); {
+			j := i
+			for j+1 < len(order) && sameSessions(h.Weekly[order[j+1]], h.Weekly[order[i]]) {
+				j++
+			}
+			if len(h.Weekly[order[i]]) > 0 {
+				days := "星期" + weekdayNames[order[i]]
+				if j > i {
+					days += "至" + weekdayNames[order[j]]
+				}
+				clauses = append(clauses, days+" "+FormatSessions(h.Weekly[order[i]]))
+			}
+			i = j + 1
+		}
+	}
+	switch h.Holiday {
+	case HolidayClosed:
+		clauses = append(clauses, "公眾假期休息")
+	case HolidayCustom:
+		clauses = append(clauses, "公眾假期 "+FormatSessions(h.HolidaySessions))
+	}
+	return strings.Join(clauses, "; ")
+}
+
+//MarshalText fulfills encoding.TextMarshaler, using the String form
+func (h OpeningHours) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+//UnmarshalText fulfills encoding.TextUnmarshaler with ParseHours
+func (h *OpeningHours) UnmarshalText(text []byte) error {
+	p, err := ParseHours(string(text))
+	if err != nil {
+		return err
+	}
+	*h = p
+	return nil
+}
+
+//hoursText returns hours for storing, empty if unknown
+func hoursText(h *OpeningHours) string {
+	if h == nil {
+		return ""
+	}
+	return h.String()
+}
+
+//storedHours restores hours saved with hoursText, nil if empty or invalid
+func storedHours(s string) *OpeningHours {
+	if s == "" {
+		return nil
+	}
+	h, err := ParseHours(s)
+	if err != nil {
+		return nil
+	}
+	return &h
+}
+
+var (
+	hoursNormalizer = strings.NewReplacer(
+		"：", ":", "－", "-", "–", "-", "—", "-", "～", "-", "~", "-", "　", " ",
+		"０", "0", "１", "1", "２", "2", "３", "3", "４", "4",
+		"５", "5", "６", "6", "７", "7", "８", "8", "９", "9",
+		"a.m.", "am", "p.m.", "pm", "公衆假期", "公眾假期",
+	)
+
+	hoursTimeRe = regexp.MustCompile(`^(?:(上午|早上|中午|下午|晚上|凌晨)\s*)?(\d{1,2})[:.](\d{2})\s*(am|pm)?\s*(?:-|至|到|to)\s*` +
+		`(?:(上午|早上|中午|下午|晚上|凌晨)\s*)?(\d{1,2})[:.](\d{2})\s*(am|pm)?`)
+	hoursAllDayRe  = regexp.MustCompile(`^24\s*(?:小時|hours?|hrs?)`)
+	hoursDayCnRe   = regexp.MustCompile(`^(?:逢)?(?:星期|禮拜|週|周)[一二三四五六日天](?:\s*(?:至|到|-|、|及|和|/|,)\s*(?:星期|禮拜|週|周)?[一二三四五六日天])*`)
+	hoursDayEnRe   = regexp.MustCompile(`^(?:mon|tue|wed|thu|fri|sat|sun)[a-z]*\.?(?:\s*(?:-|to|&|,|/|and)\s*(?:mon|tue|wed|thu|fri|sat|sun)[a-z]*\.?)*`)
+	hoursDayPartRe = regexp.MustCompile(`[一二三四五六日天]|mon|tue|wed|thu|fri|sat|sun|至|到|-|to`)
+	hoursDailyRe   = regexp.MustCompile(`^(?:每日|每天|天天|daily|everyday|every day)`)
+	hoursWeekdayRe = regexp.MustCompile(`^(?:平日|weekdays?)`)
+	hoursWeekendRe = regexp.MustCompile(`^(?:週末|周末|weekends?)`)
+	hoursHolidayRe = regexp.MustCompile(`^(?:公眾假期|公假|紅日|public holidays?|ph\b)`)
+	hoursClosedRe  = regexp.MustCompile(`^(?:休息|休業|公休|暫停營業|不營業|closed|休)`)
+	hoursUsualRe   = regexp.MustCompile(`^(?:照常(?:營業)?|as usual)`)
+
+	dayIndex = map[string]int{
+		"日": 0, "天": 0, "一": 1, "二": 2, "三": 3, "四": 4, "五": 5, "六": 6,
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+)
+
+//parseDays returns weekdays of day spec like "星期一至五", "星期六、日" or "mon-fri"
+func parseDays(spec string) []int {
+	days := make([]int, 0)
+	isRange := false
+	for _, part := range hoursDayPartRe.FindAllString(spec, -1) {
+		d, ok := dayIndex[part]
+		if !ok {
+			isRange = len(days) > 0
+			continue
+		}
+		if isRange {
+			for p := (days[len(days)-1] + 1) % 7; p != d; p = (p + 1) % 7 {
+				days = append(days, p)
+			}
+			isRange = false
+		}
+		days = append(days, d)
+	}
+	return days
+}
+
+//parseClock converts clock with optional period marker into minutes
+func parseClock(period, hour, minute, suffix string) (int, error) {
+	h, _ := strconv.Atoi(hour)
+	m, _ := strconv.Atoi(minute)
+	if h > 24 || m > 59 || h == 24 && m > 0 {
+		return 0, fmt.Errorf("Invalid time %s:%s", hour, minute)
+	}
+	switch {
+	case (suffix == "pm" || period == "下午" || period == "晚上") && h < 12:
+		h += 12
+	case (suffix == "am" || period == "上午" || period == "早上" || period == "凌晨") && h == 12:
+		h = 0
+	}
+	return h*60 + m, nil
+}
+
+//hoursTarget is the days and holiday a time or closed mark applies to.
+//Days are collected until a time is applied, a closed mark ends the target
+type hoursTarget struct {
+	days    []int
+	holiday bool
+	applied bool
+	done    bool
+}
+
+func (t *hoursTarget) add(days []int, holiday bool) {
+	if t.applied {
+		*t = hoursTarget{}
+	}
+	t.days = append(t.days, days...)
+	t.holiday = t.holiday || holiday
+}
+
+func (t hoursTarget) empty() bool {
+	return len(t.days) == 0 && !t.holiday
+}
+
+//ParseHours parses opening hours in common Hong Kong formats, e.g.
+//"11:00-22:00 (星期一休息)", "星期一至五 11:00-15:00, 18:00-23:00; 星期六、日及公眾假期 10:00-23:00",
+//"18:00-02:00" or "24小時". Times without days apply to days not mentioned
+//otherwise, days mentioned only for other days are closed
+func ParseHours(text string) (OpeningHours, error) {
+	s := hoursNormalizer.Replace(strings.ToLower(text))
+	var target hoursTarget
+	var defaults []Session
+	var explicit [7][]Session
+	var isExplicit [7]bool
+	h := OpeningHours{}
+	found := false
+
+	addSession := func(sess Session) {
+		found = true
+		if target.done {
+			target = hoursTarget{}
+		}
+		target.applied = true
+		if target.empty() {
+			defaults = append(defaults, sess)
+			return
+		}
+		for _, d := range target.days {
+			explicit[d] = append(explicit[d], sess)
+			isExplicit[d] = true
+		}
+		if target.holiday {
+			h.Holiday = HolidayCustom
+			h.HolidaySessions = append(h.HolidaySessions, sess)
+		}
+	}
+
+	for len(s) > 0 {
+		if m := hoursTimeRe.FindStringSubmatch(s); m != nil {
+			open, err := parseClock(m[1], m[2], m[3], m[4])
+			if err != nil {
+				return OpeningHours{}, err
+			}
+			closing, err := parseClock(m[5], m[6], m[7], m[8])
+			if err != nil {
+				return OpeningHours{}, err
+			}
+			if closing <= open {
+				closing += dayMinutes
+			}
+			addSession(Session{open, closing})
+			s = s[len(m[0]):]
+		} else if m := hoursAllDayRe.FindString(s); m != "" {
+			addSession(Session{0, dayMinutes})
+			s = s[len(m):]
+		} else if m := hoursDayCnRe.FindString(s); m != "" {
+			target.add(parseDays(m), false)
+			s = s[len(m):]
+		} else if m := hoursDayEnRe.FindString(s); m != "" {
+			target.add(parseDays(m), false)
+			s = s[len(m):]
+		} else if m := hoursDailyRe.FindString(s); m != "" {
+			target.add([]int{0, 1, 2, 3, 4, 5, 6}, false)
+			s = s[len(m):]
+		} else if m := hoursWeekdayRe.FindString(s); m != "" {
+			target.add([]int{1, 2, 3, 4, 5}, false)
+			s = s[len(m):]
+		} else if m := hoursWeekendRe.FindString(s); m != "" {
+			target.add([]int{6, 0}, false)
+			s = s[len(m):]
+		} else if m := hoursHolidayRe.FindString(s); m != "" {
+			target.add(nil, true)
+			s = s[len(m):]
+		} else if m := hoursClosedRe.FindString(s); m != "" {
+			for _, d := range target.days {
+				explicit[d], isExplicit[d] = nil, true
+				found = true
+			}
+			if target.holiday {
+				h.Holiday, h.HolidaySessions = HolidayClosed, nil
+			}
+			target.applied, target.done = true, true
+			s = s[len(m):]
+		} else if m := hoursUsualRe.FindString(s); m != "" {
+			if target.holiday {
+				h.Holiday, h.HolidaySessions = HolidayAsUsual, nil
+			}
+			target.applied, target.done = true, true
+			s = s[len(m):]
+		} else {
+			//Skip separators and words not understood
+			_, size := utf8.DecodeRuneInString(s)
+			s = s[size:]
+		}
+	}
+	if !found {
+		return OpeningHours{}, fmt.Errorf("No opening hours found in %q", text)
+	}
+	for d := range h.Weekly {
+		if isExplicit[d] {
+			h.Weekly[d] = explicit[d]
+		} else {
+			h.Weekly[d] = append([]Session(nil), defaults...)
+		}
+		sortSessions(h.Weekly[d])
+	}
+	sortSessions(h.HolidaySessions)
+	return h, nil
+}
+
+func sortSessions(sessions []Session) {
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Open < sessions[j].Open })
+}
@@ -0,0 +1,124 @@
+package dao
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseHours(t *testing.T) {
+	cases := []struct {
+		text string
+		want string
+	}{
+		{"11:00-22:00", "11:00-22:00"},
+		{"11:00-22:00 (星期一休息)", "星期二至日 11:00-22:00"},
+		{"逢星期二休息 上午11:00至晚上10:30", "星期一 11:00-22:30; 星期三至日 11:00-22:30"},
+		{"星期一至五 11:00-15:00, 18:00-23:00; 星期六、日及公眾假期 10:00-23:00",
+			"星期一至五 11:00-15:00, 18:00-23:00; 星期六至日 10:00-23:00; 公眾假期 10:00-23:00"},
+		{"18：00－02：00", "18:00-02:00"},
+		{"24小時營業", "24小時"},
+		{"每日 12:00-22:00 公眾假期休息", "12:00-22:00; 公眾假期休息"},
+		{"Mon-Fri 9:00am-6:00pm, Sat 10:00-14:00; PH closed", "星期一至五 09:00-18:00; 星期六 10:00-14:00; 公眾假期休息"},
+		{"12:00-21:00 公眾假期照常營業", "12:00-21:00"},
+	}
+	for _, c := range cases {
+		h, err := ParseHours(c.text)
+		if err != nil {
+			t.Errorf("%s: %v", c.text, err)
+			continue
+		}
+		if h.String() != c.want {
+			t.Errorf("%s expected: %s, actual %s", c.text, c.want, h.String())
+		}
+		again, err := ParseHours(h.String())
+		if err != nil || again.String() != h.String() {
+			t.Errorf("%s does not parse back: %s, %v", h.String(), again.String(), err)
+		}
+	}
+	for _, text := range []string{"", "請致電查詢", "25:00-26:00"} {
+		_, err := ParseHours(text)
+		if err == nil {
+			t.Errorf("Expected error for %q", text)
+		}
+	}
+}
+
+func hkTime(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, HKT)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestHoursOpen(t *testing.T) {
+	//2020-06-01 is a Monday
+	h, _ := ParseHours("星期一至五 11:00-15:00, 18:00-02:00; 星期六 12:00-24:00; 星期日 00:00-03:00; 公眾假期休息")
+	hol, err := NewHolidays("2020-06-03")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		at       string
+		open     bool
+		closesIn time.Duration
+	}{
+		{"2020-06-01 10:59", false, 0},
+		{"2020-06-01 11:00", true, 4 * time.Hour},
+		{"2020-06-01 16:00", false, 0},
+		{"2020-06-01 23:30", true, 150 * time.Minute},
+		{"2020-06-02 01:45", true, 15 * time.Minute},
+		{"2020-06-02 02:00", false, 0},
+		//Holiday on Wednesday, but Tuesday night session still runs
+		{"2020-06-03 01:00", true, time.Hour},
+		{"2020-06-03 12:00", false, 0},
+		//Saturday session continues into Sunday
+		{"2020-06-06 23:00", true, 4 * time.Hour},
+		{"2020-06-07 02:30", true, 30 * time.Minute},
+	}
+	for _, c := range cases {
+		d, open := h.ClosesIn(hkTime(c.at), hol)
+		if open != c.open || d != c.closesIn {
+			t.Errorf("%s expected: %v (%v), actual %v (%v)", c.at, c.open, c.closesIn, open, d)
+		}
+	}
+	//Same instant in other zones
+	if !h.IsOpen(hkTime("2020-06-01 11:30").UTC(), nil) {
+		t.Error("Expected open at 03:30 UTC")
+	}
+}
+
+func TestShopOpenAt(t *testing.T) {
+	h, _ := ParseHours("11:00-22:00")
+	shop := Shop{Hours: &h, Status: StatusTempClosed, StatusUntil: hkTime("2020-06-02 00:00")}
+	if shop.OpenAt(hkTime("2020-06-01 12:00"), nil) {
+		t.Error("Temporarily closed shop should not be open")
+	}
+	if !shop.OpenAt(hkTime("2020-06-02 12:00"), nil) {
+		t.Error("Shop should be open after temporary closure")
+	}
+	if (Shop{}).OpenAt(hkTime("2020-06-02 12:00"), nil) {
+		t.Error("Shop without hours should not be open")
+	}
+}
+
+func TestHoursJSON(t *testing.T) {
+	shop := Shop{ID: 1}
+	err := json.Unmarshal([]byte(`{"ID": 1, "Hours": "11:00-22:00 (星期一休息)"}`), &shop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shop.Hours == nil || shop.Hours.String() != "星期二至日 11:00-22:00" {
+		t.Errorf("Unexpected hours %v", shop.Hours)
+	}
+	b, err := json.Marshal(shop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Shop
+	err = json.Unmarshal(b, &back)
+	if err != nil || back.Hours == nil || back.Hours.String() != shop.Hours.String() {
+		t.Errorf("Hours not restored from %s: %v", b, err)
+	}
+}
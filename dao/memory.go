@@ -0,0 +1,812 @@
+package dao
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	ghash "github.com/mmcloughlin/geohash"
+)
+
+const (
+	//Memory is the type name for in-memory backend
+	Memory = "memory"
+
+	//Geohash precision used for spatial index, each cell is around 1.2km x 0.6km
+	memGeohashPrecision = 6
+)
+
+//MemoryBackend is a data backend holding all shops in memory, for tests and
+//tiny deployments
+type MemoryBackend struct {
+	mu       sync.RWMutex
+	shops    []Shop
+	byID     map[int]int
+	geoIndex map[string][]int
+	keywords []string
+
+	submissions []Submission
+	reports     []Report
+	//favourites are shop IDs by user ID, latest marked last
+	favourites map[int][]int
+	//userData are values of UserStore by user ID and key
+	userData map[string]memUserValue
+}
+
+//memUserValue is value of UserStore with the time it was saved
+type memUserValue struct {
+	value   []byte
+	updated time.Time
+}
+
+//NewMemoryBackend returns a backend holding provided shops
+func NewMemoryBackend(shops []Shop) *MemoryBackend {
+	m := &MemoryBackend{}
+	m.load(shops)
+	return m
+}
+
+//NewMemoryBackendFromFile returns a backend loaded with JSON or CSV fixture
+//file, depending on file extension
+func NewMemoryBackendFromFile(path string) (*MemoryBackend, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open fixture file %w", err)
+	}
+	defer f.Close()
+	var shops []Shop
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.NewDecoder(f).Decode(&shops)
+	case ".csv":
+		shops, err = readShopsCSV(f)
+	default:
+		err = fmt.Errorf("Unknown fixture format %s", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read fixture file %w", err)
+	}
+	return NewMemoryBackend(shops), nil
+}
+
+//readShopsCSV reads shops from CSV with header row. Recognised columns are
+//id, name, address, lat, long, geohash, type, district, url, tags (space
+//separated), notes, status, status_since, status_until (both RFC 3339 or
+//YYYY-MM-DD), moved_to and hours (in formats accepted by ParseHours)
+func readShopsCSV(r io.Reader) ([]Shop, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := make(map[string]int)
+	for i := range header {
+		col[strings.ToLower(strings.TrimSpace(header[i]))] = i
+	}
+	field := func(rec []string, name string) string {
+		if i, ok := col[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+	shops := make([]Shop, 0)
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		shop := Shop{
+			Name:     field(rec, "name"),
+			Address:  field(rec, "address"),
+			Geohash:  field(rec, "geohash"),
+			Type:     field(rec, "type"),
+			District: field(rec, "district"),
+			URL:      field(rec, "url"),
+			Tags:     strings.Fields(field(rec, "tags")),
+			Notes:    field(rec, "notes"),
+			Status:   field(rec, "status"),
+		}
+		shop.ID, err = strconv.Atoi(field(rec, "id"))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid id on line %d: %w", len(shops)+2, err)
+		}
+		shop.StatusSince, err = parseCSVTime(field(rec, "status_since"))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid status_since on line %d: %w", len(shops)+2, err)
+		}
+		shop.StatusUntil, err = parseCSVTime(field(rec, "status_until"))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid status_until on line %d: %w", len(shops)+2, err)
+		}
+		if movedTo := field(rec, "moved_to"); movedTo != "" {
+			shop.MovedTo, err = strconv.Atoi(movedTo)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid moved_to on line %d: %w", len(shops)+2, err)
+			}
+		}
+		if hours := field(rec, "hours"); hours != "" {
+			h, err := ParseHours(hours)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid hours on line %d: %w", len(shops)+2, err)
+			}
+			shop.Hours = &h
+		}
+		if lat, long := field(rec, "lat"), field(rec, "long"); lat != "" && long != "" {
+			shop.Position.Lat, err = strconv.ParseFloat(lat, 64)
+			if err != nil {
+				return nil, err
+			}
+			shop.Position.Long, err = strconv.ParseFloat(long, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		shops = append(shops, shop)
+	}
+	return shops, nil
+}
+
+//parseCSVTime accepts RFC 3339 timestamps or dates, empty string is zero time
+func parseCSVTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+func (m *MemoryBackend) load(shops []Shop) {
+	m.shops = make([]Shop, len(shops))
+	copy(m.shops, shops)
+	m.byID = make(map[int]int, len(shops))
+	for i := range m.shops {
+		m.byID[m.shops[i].ID] = i
+	}
+	m.reindex()
+	m.refreshKeywords()
+}
+
+//reindex rebuilds the geohash index, must be called with write lock held
+func (m *MemoryBackend) reindex() {
+	m.geoIndex = make(map[string][]int)
+	for i := range m.shops {
+		if m.shops[i].HasPhyLoc() {
+			lat, long := m.shops[i].ToCoord()
+			cell := ghash.EncodeWithPrecision(lat, long, memGeohashPrecision)
+			m.geoIndex[cell] = append(m.geoIndex[cell], i)
+		}
+	}
+}
+
+func (m *MemoryBackend) refreshKeywords() int {
+	words := make(map[string]struct{})
+	for i := range m.shops {
+		for _, t := range m.shops[i].Tags {
+			words[t] = struct{}{}
+		}
+	}
+	m.keywords = make([]string, 0, len(words))
+	for w := range words {
+		m.keywords = append(m.keywords, w)
+	}
+	sort.Strings(m.keywords)
+	return len(m.keywords)
+}
+
+//matchTag returns true if word is the district, the type or one of the tags
+func matchTag(shop Shop, word string) bool {
+	if shop.District == word || shop.Type == word {
+		return true
+	}
+	for i := range shop.Tags {
+		if shop.Tags[i] == word {
+			return true
+		}
+	}
+	return false
+}
+
+//matchWord returns true if word is part of the shop name, or matches a tag
+func matchWord(shop Shop, word string) bool {
+	return strings.Contains(strings.ToLower(shop.Name), strings.ToLower(word)) || matchTag(shop, word)
+}
+
+//filter returns shops matching pred, closed and moved shops are skipped
+//unless includeClosed is set
+func (m *MemoryBackend) filter(includeClosed bool, pred func(Shop) bool) []Shop {
+	shoplist := make([]Shop, 0)
+	for i := range m.shops {
+		if (includeClosed || !m.shops[i].IsClosed()) && pred(m.shops[i]) {
+			shoplist = append(shoplist, m.shops[i])
+		}
+	}
+	return shoplist
+}
+
+func shuffle(shops []Shop) []Shop {
+	rand.Shuffle(len(shops), func(i, j int) { shops[i], shops[j] = shops[j], shops[i] })
+	return shops
+}
+
+//ShopsWithKeyword returns shops with tags provided
+func (m *MemoryBackend) ShopsWithKeyword(ctx context.Context, keywords string) ([]Shop, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if noKeyword(keywords) {
+		return make([]Shop, 0), nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	words := strings.Fields(keywords)
+	return shuffle(m.filter(false, func(s Shop) bool {
+		if s.Address == "" && s.URL == "" {
+			return false
+		}
+		if strings.Contains(strings.ToLower(s.Name), strings.ToLower(keywords)) {
+			return true
+		}
+		for i := range words {
+			if !matchWord(s, words[i]) {
+				return false
+			}
+		}
+		return len(words) > 0
+	})), nil
+}
+
+//AdvQuery returns shops matching q, closed and moved shops are returned only
+//if includeClosed is set
+func (m *MemoryBackend) AdvQuery(ctx context.Context, q Query, includeClosed bool) ([]Shop, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := q.searchable(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return shuffle(m.filter(includeClosed, q.Match)), nil
+}
+
+//QueryFacets counts shops matching q by district and type
+func (m *MemoryBackend) QueryFacets(ctx context.Context, q Query, includeClosed bool) (Facets, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := q.searchable(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return CountFacets(m.filter(includeClosed, q.Match)), nil
+}
+
+//ShopCount returns the number of shops stored
+func (m *MemoryBackend) ShopCount(ctx context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.shops), nil
+}
+
+//ShopByID returns shop by internal ID
+func (m *MemoryBackend) ShopByID(ctx context.Context, shopID int) (Shop, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i, ok := m.byID[shopID]
+	if !ok {
+		return Shop{}, shopNotFound(shopID)
+	}
+	return m.shops[i], nil
+}
+
+//UpdateShopInfo fill missing info into shops
+func (m *MemoryBackend) UpdateShopInfo(ctx context.Context, shops []Shop) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, shop := range shops {
+		i, ok := m.byID[shop.ID]
+		if !ok {
+			continue
+		}
+		m.shops[i].Address = shop.Address
+		m.shops[i].Position.Lat, m.shops[i].Position.Long = shop.ToCoord()
+		m.shops[i].Geohash = shop.ToGeohash()
+	}
+	m.reindex()
+	return nil
+}
+
+//NearestShops returns shops within distance, sorted by distance
+func (m *MemoryBackend) NearestShops(ctx context.Context, lat, long float64, distance string, includeClosed bool) ([]Shop, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	d, err := disToInt(distance)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	candidates := make([]Shop, 0)
+	for _, cell := range coveringCells(lat, long, d, memGeohashPrecision) {
+		for _, i := range m.geoIndex[cell] {
+			if includeClosed || !m.shops[i].IsClosed() {
+				candidates = append(candidates, m.shops[i])
+			}
+		}
+	}
+	SortByDistance(candidates, lat, long)
+	shoplist := make([]Shop, 0, len(candidates))
+	for i := range candidates {
+		if candidates[i].Distance <= d {
+			shoplist = append(shoplist, candidates[i])
+		}
+	}
+	return shoplist, nil
+}
+
+//coveringCells returns geohash cells of precision covering the bounding box
+//of the circle
+func coveringCells(lat, long float64, distance int, precision uint) []string {
+	dLat := float64(distance) / (earthRadius * math.Pi / 180)
+	dLong := dLat / math.Cos(lat*math.Pi/180)
+	box := ghash.BoundingBox(ghash.EncodeWithPrecision(lat, long, precision))
+	stepLat, stepLong := box.MaxLat-box.MinLat, box.MaxLng-box.MinLng
+	seen := make(map[string]struct{})
+	cells := make([]string, 0)
+	for y := lat - dLat; y < lat+dLat+stepLat; y += stepLat {
+		for x := long - dLong; x < long+dLong+stepLong; x += stepLong {
+			cell := ghash.EncodeWithPrecision(math.Min(y, lat+dLat), math.Min(x, long+dLong), precision)
+			if _, ok := seen[cell]; !ok {
+				seen[cell] = struct{}{}
+				cells = append(cells, cell)
+			}
+		}
+	}
+	return cells
+}
+
+//ShopMissingInfo returns shops without location
+func (m *MemoryBackend) ShopMissingInfo(ctx context.Context) ([]Shop, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.filter(false, func(s Shop) bool {
+		return !s.HasPhyLoc() && s.District != nonPhyStore
+	}), nil
+}
+
+//ShopsWithStatus returns all shops with provided status
+func (m *MemoryBackend) ShopsWithStatus(ctx context.Context, status string) ([]Shop, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.filter(true, func(s Shop) bool {
+		return s.Status == status
+	}), nil
+}
+
+//UpdateShopStatus saves status, its effective dates and new location of shops
+func (m *MemoryBackend) UpdateShopStatus(ctx context.Context, shops []Shop) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, shop := range shops {
+		i, ok := m.byID[shop.ID]
+		if !ok {
+			continue
+		}
+		m.shops[i].Status = shop.Status
+		m.shops[i].StatusSince = shop.StatusSince
+		m.shops[i].StatusUntil = shop.StatusUntil
+		m.shops[i].MovedTo = shop.MovedTo
+	}
+	return nil
+}
+
+//CreateShop validates and saves a new shop. ID is assigned if shop.ID is 0
+func (m *MemoryBackend) CreateShop(ctx context.Context, shop Shop) (Shop, error) {
+	if err := ctx.Err(); err != nil {
+		return Shop{}, err
+	}
+	err := shop.Validate()
+	if err != nil {
+		return Shop{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.byID[shop.ID]; ok {
+		return Shop{}, idTaken(shop.ID)
+	}
+	err = duplicateOf(shop, m.shops)
+	if err != nil {
+		return Shop{}, err
+	}
+	if shop.ID == 0 {
+		for id := range m.byID {
+			if id > shop.ID {
+				shop.ID = id
+			}
+		}
+		shop.ID++
+	}
+	m.byID[shop.ID] = len(m.shops)
+	m.shops = append(m.shops, shop)
+	m.reindex()
+	m.refreshKeywords()
+	return shop, nil
+}
+
+//UpdateShop saves fields of shop, other fields are kept
+func (m *MemoryBackend) UpdateShop(ctx context.Context, shop Shop, fields ShopField) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, ok := m.byID[shop.ID]
+	if !ok {
+		return shopNotFound(shop.ID)
+	}
+	updated := applyFields(m.shops[i], shop, fields)
+	err := updated.Validate()
+	if err != nil {
+		return err
+	}
+	err = duplicateOf(updated, m.shops)
+	if err != nil {
+		return err
+	}
+	m.shops[i] = updated
+	m.reindex()
+	m.refreshKeywords()
+	return nil
+}
+
+//DeleteShop removes shop permanently, ArchiveShop keeps the record instead
+func (m *MemoryBackend) DeleteShop(ctx context.Context, shopID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, ok := m.byID[shopID]
+	if !ok {
+		return shopNotFound(shopID)
+	}
+	m.shops = append(m.shops[:i], m.shops[i+1:]...)
+	delete(m.byID, shopID)
+	for id, j := range m.byID {
+		if j > i {
+			m.byID[id] = j - 1
+		}
+	}
+	m.reindex()
+	m.refreshKeywords()
+	return nil
+}
+
+//ArchiveShop marks shop closed since at, so it is hidden from searches
+func (m *MemoryBackend) ArchiveShop(ctx context.Context, shopID int, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, ok := m.byID[shopID]
+	if !ok {
+		return shopNotFound(shopID)
+	}
+	m.shops[i] = archived(m.shops[i], at)
+	return nil
+}
+
+//SuggestKeyword will take provided keyword to look into the keyword list and
+//search with edit distance <= len(key) - 1
+func (m *MemoryBackend) SuggestKeyword(ctx context.Context, key string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t := utf8.RuneCountInString(key)
+	suggestList := make([]string, 0)
+	for _, k := range m.keywords {
+		if t == 1 && strings.Contains(k, key) || t > 1 && editDistance(key, k) <= t-1 {
+			suggestList = append(suggestList, k)
+		}
+	}
+	return suggestList, nil
+}
+
+//Districts returns all districts
+func (m *MemoryBackend) Districts(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	seen := make(map[string]struct{})
+	districts := make([]string, 0)
+	for i := range m.shops {
+		if _, ok := seen[m.shops[i].District]; !ok {
+			seen[m.shops[i].District] = struct{}{}
+			districts = append(districts, m.shops[i].District)
+		}
+	}
+	return districts, nil
+}
+
+//ShopsWithKeywordSortByDist sort position by distance
+func (m *MemoryBackend) ShopsWithKeywordSortByDist(ctx context.Context, keywords string, lat, long float64) ([]Shop, error) {
+	shops, err := m.ShopsWithKeyword(ctx, keywords)
+	if err != nil {
+		return nil, err
+	}
+	SortByDistance(shops, lat, long)
+	if len(shops) > 30 {
+		shops = shops[:30]
+	}
+	return shops, nil
+}
+
+//UpdateTags set shop type as tag for shops without tags
+func (m *MemoryBackend) UpdateTags(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cnt := 0
+	for i := range m.shops {
+		if len(m.shops[i].Tags) == 0 {
+			m.shops[i].Tags = []string{m.shops[i].Type}
+			cnt++
+		}
+	}
+	return cnt, nil
+}
+
+//RefreshKeywords rebuilds keyword list from shop tags
+func (m *MemoryBackend) RefreshKeywords(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.refreshKeywords(), nil
+}
+
+//ImportShops inserts or replaces full shop records
+func (m *MemoryBackend) ImportShops(ctx context.Context, shops []Shop) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, shop := range shops {
+		if i, ok := m.byID[shop.ID]; ok {
+			m.shops[i] = shop
+		} else {
+			m.byID[shop.ID] = len(m.shops)
+			m.shops = append(m.shops, shop)
+		}
+	}
+	m.reindex()
+	m.refreshKeywords()
+	return nil
+}
+
+//AllShops returns all shops held
+func (m *MemoryBackend) AllShops(ctx context.Context) ([]Shop, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	shops := make([]Shop, len(m.shops))
+	copy(shops, m.shops)
+	return shops, nil
+}
+
+//AddSubmission saves a new submission with ID assigned
+func (m *MemoryBackend) AddSubmission(ctx context.Context, sub Submission) (Submission, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub.ID = len(m.submissions) + 1
+	m.submissions = append(m.submissions, sub)
+	return sub, nil
+}
+
+//SubmissionByID returns submission by internal ID
+func (m *MemoryBackend) SubmissionByID(ctx context.Context, id int) (Submission, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if id < 1 || id > len(m.submissions) {
+		return Submission{}, submissionNotFound(id)
+	}
+	return m.submissions[id-1], nil
+}
+
+//PendingSubmissions returns submissions waiting for review, oldest first
+func (m *MemoryBackend) PendingSubmissions(ctx context.Context) ([]Submission, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	subs := make([]Submission, 0)
+	for i := range m.submissions {
+		if m.submissions[i].Status == SubmissionPending {
+			subs = append(subs, m.submissions[i])
+		}
+	}
+	return subs, nil
+}
+
+//UpdateSubmission saves changes to submission
+func (m *MemoryBackend) UpdateSubmission(ctx context.Context, sub Submission) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if sub.ID < 1 || sub.ID > len(m.submissions) {
+		return submissionNotFound(sub.ID)
+	}
+	m.submissions[sub.ID-1] = sub
+	return nil
+}
+
+//AddReport saves a new report with ID assigned
+func (m *MemoryBackend) AddReport(ctx context.Context, rep Report) (Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.reports {
+		if sameReport(rep, m.reports[i]) {
+			return m.reports[i], ErrDuplicateReport
+		}
+	}
+	rep.ID = len(m.reports) + 1
+	m.reports = append(m.reports, rep)
+	return rep, nil
+}
+
+//OpenReports returns reports not yet resolved, oldest first
+func (m *MemoryBackend) OpenReports(ctx context.Context) ([]Report, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	reps := make([]Report, 0)
+	for i := range m.reports {
+		if m.reports[i].ResolvedBy == 0 {
+			reps = append(reps, m.reports[i])
+		}
+	}
+	return reps, nil
+}
+
+//ResolveReports resolves all open reports of shop, returning the number of
+//reports resolved
+func (m *MemoryBackend) ResolveReports(ctx context.Context, shopID, by int, at time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cnt := 0
+	for i := range m.reports {
+		if m.reports[i].ShopID == shopID && m.reports[i].ResolvedBy == 0 {
+			m.reports[i].ResolvedBy, m.reports[i].Resolved = by, at
+			cnt++
+		}
+	}
+	return cnt, nil
+}
+
+//AddFavourite marks shop as favourite of user
+func (m *MemoryBackend) AddFavourite(ctx context.Context, userID, shopID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range m.favourites[userID] {
+		if id == shopID {
+			return nil
+		}
+	}
+	if m.favourites == nil {
+		m.favourites = make(map[int][]int)
+	}
+	m.favourites[userID] = append(m.favourites[userID], shopID)
+	return nil
+}
+
+//RemoveFavourite unmarks favourite shop of user
+func (m *MemoryBackend) RemoveFavourite(ctx context.Context, userID, shopID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := m.favourites[userID]
+	for i := range ids {
+		if ids[i] == shopID {
+			m.favourites[userID] = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+//IsFavourite checks if shop is favourite of user
+func (m *MemoryBackend) IsFavourite(ctx context.Context, userID, shopID int) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, id := range m.favourites[userID] {
+		if id == shopID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//Favourites returns favourite shops of user, latest marked first
+func (m *MemoryBackend) Favourites(ctx context.Context, userID int) ([]Shop, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := m.favourites[userID]
+	shops := make([]Shop, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		if idx, ok := m.byID[ids[i]]; ok {
+			shops = append(shops, m.shops[idx])
+		}
+	}
+	return shops, nil
+}
+
+func memUserKey(userID int, key string) string {
+	return strconv.Itoa(userID) + ":" + key
+}
+
+//UserData returns value saved under key, nil if not found
+func (m *MemoryBackend) UserData(ctx context.Context, userID int, key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.userData[memUserKey(userID, key)]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte{}, value.value...), nil
+}
+
+//SetUserData saves value under key
+func (m *MemoryBackend) SetUserData(ctx context.Context, userID int, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userData == nil {
+		m.userData = make(map[string]memUserValue)
+	}
+	m.userData[memUserKey(userID, key)] = memUserValue{value: append([]byte{}, value...), updated: time.Now()}
+	return nil
+}
+
+//DeleteUserData removes value under key
+func (m *MemoryBackend) DeleteUserData(ctx context.Context, userID int, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.userData, memUserKey(userID, key))
+	return nil
+}
+
+//PurgeUserData removes values under keys beginning with prefix saved before
+//cutoff
+func (m *MemoryBackend) PurgeUserData(ctx context.Context, userID int, prefix string, cutoff time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for k, v := range m.userData {
+		if strings.HasPrefix(k, memUserKey(userID, prefix)) && v.updated.Before(cutoff) {
+			delete(m.userData, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+//Close does nothing for memory backend
+func (m *MemoryBackend) Close() {}
@@ -0,0 +1,207 @@
+package dao
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryFromJSON(t *testing.T) {
+	m, err := NewMemoryBackendFromFile("testdata/shops.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cnt, _ := m.ShopCount(context.Background())
+	if cnt != 8 {
+		t.Errorf("Size expected: 8, actual %d", cnt)
+	}
+	shop, err := m.ShopByID(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shop.Name != "留白" || shop.Notes != "星期一休息" {
+		t.Errorf("Unexpected shop %v", shop)
+	}
+	_, err = m.ShopByID(context.Background(), 100)
+	if err == nil {
+		t.Error("Expected error for unknown ID")
+	}
+}
+
+func TestMemoryFromCSV(t *testing.T) {
+	m, err := NewMemoryBackendFromFile("testdata/shops.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shops, err := m.ShopsWithKeyword(context.Background(), "咖啡")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 2 {
+		t.Fatalf("Size expected: 2, actual %d", len(shops))
+	}
+	shop, _ := m.ShopByID(context.Background(), 4)
+	if shop.URL != "https://example.com/whitehouse" || len(shop.Tags) != 2 || shop.Position.Lat != 22.3725 {
+		t.Errorf("Unexpected shop %v", shop)
+	}
+	shop, _ = m.ShopByID(context.Background(), 5)
+	if shop.Status != StatusClosed || !shop.StatusSince.Equal(time.Date(2020, 6, 30, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected shop status %v", shop)
+	}
+}
+
+func TestMemoryKeyword(t *testing.T) {
+	m, err := NewMemoryBackendFromFile("testdata/shops.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shops, err := m.ShopsWithKeyword(context.Background(), "荃灣 咖啡")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 2 {
+		t.Fatalf("Size expected: 2, actual %d", len(shops))
+	}
+	for i := range shops {
+		if shops[i].ID == 5 {
+			t.Error("Closed shop returned")
+		}
+	}
+	shops, err = m.ShopsWithKeyword(context.Background(), "WabiSabi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 1 || shops[0].ID != 9 {
+		t.Errorf("Result expected: {9}, actual %v", shops)
+	}
+}
+
+func TestMemoryKeywordType(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryBackend([]Shop{
+		{ID: 1, Name: "金華冰廳", Type: "茶餐廳", District: "旺角", Address: "旺角弼街47號", Tags: []string{"旺角", "菠蘿包"}},
+		{ID: 2, Name: "蘭芳園", Type: "茶餐廳", District: "中環", Address: "中環結志街2號", Tags: []string{"中環", "奶茶"}},
+		{ID: 3, Name: "留白", Type: "咖啡", District: "荃灣", Address: "荃灣昌寧商場地下12號舖", Tags: []string{"荃灣"}},
+	})
+	cases := []struct {
+		query string
+		want  int
+		//wantAdv is the size of AdvQuery, which does not match names
+		wantAdv int
+	}{
+		{"茶餐廳", 2, 2},
+		{"茶餐廳 旺角", 1, 1},
+		{"咖啡", 1, 1},
+		{"冰廳", 1, 0},
+		{"餐廳", 0, 0},
+	}
+	for _, c := range cases {
+		shops, err := m.ShopsWithKeyword(ctx, c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(shops) != c.want {
+			t.Errorf("%s size expected: %d, actual %d", c.query, c.want, len(shops))
+		}
+		shops, err = m.AdvQuery(ctx, mustParseQuery(t, c.query), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(shops) != c.wantAdv {
+			t.Errorf("Query %s size expected: %d, actual %d", c.query, c.wantAdv, len(shops))
+		}
+	}
+}
+
+func TestMemoryNearestShops(t *testing.T) {
+	m, err := NewMemoryBackendFromFile("testdata/shops.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shops, err := m.NearestShops(context.Background(), 22.371154, 114.112603, "500m", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 2 {
+		t.Fatalf("Size expected: 2, actual %d", len(shops))
+	}
+	if shops[0].ID != 2 || shops[1].ID != 4 {
+		t.Errorf("Result expected: {2,4}, actual {%d,%d}", shops[0].ID, shops[1].ID)
+	}
+	if shops[0].Distance != 0 || shops[1].Distance <= 0 || shops[1].Distance > 500 {
+		t.Errorf("Unexpected distance {%d,%d}", shops[0].Distance, shops[1].Distance)
+	}
+	shops, err = m.NearestShops(context.Background(), 22.371154, 114.112603, "10km", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 3 || shops[2].ID != 1 {
+		t.Errorf("Result expected: {2,4,1}, actual %v", shops)
+	}
+}
+
+func TestMemoryNearestShopsClosed(t *testing.T) {
+	m, err := NewMemoryBackendFromFile("testdata/shops.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shops, err := m.NearestShops(context.Background(), 22.371154, 114.112603, "500m", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 3 || shops[0].ID != 2 || shops[1].ID != 5 || shops[2].ID != 4 {
+		t.Errorf("Result expected: {2,5,4}, actual %v", shops)
+	}
+	_, err = m.NearestShops(context.Background(), 22.371154, 114.112603, "near", true)
+	if err == nil {
+		t.Error("Expected error for bad distance")
+	}
+}
+
+func TestMemoryAdvQuery(t *testing.T) {
+	m, err := NewMemoryBackendFromFile("testdata/shops.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shops, err := m.AdvQuery(context.Background(), mustParseQuery(t, "咖啡 -荃灣 -網店"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 1 || shops[0].ID != 9 {
+		t.Errorf("Result expected: {9}, actual %v", shops)
+	}
+	_, err = m.AdvQuery(context.Background(), Query{Not: []QueryTerm{{Value: "咖啡"}, {Value: "荃灣"}}}, false)
+	if err == nil {
+		t.Error("Expected error for negative only query")
+	}
+}
+
+func TestMemorySuggestAndMissing(t *testing.T) {
+	m, err := NewMemoryBackendFromFile("testdata/shops.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.SuggestKeyword(context.Background(), "珈啡")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != 1 || s[0] != "咖啡" {
+		t.Errorf("Expected: [咖啡], actual: %v", s)
+	}
+	missing, err := m.ShopMissingInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 || missing[0].ID != 10 {
+		t.Fatalf("Result expected: {10}, actual %v", missing)
+	}
+	missing[0].Position = Coord{22.4260, 114.2440}
+	err = m.UpdateShopInfo(context.Background(), missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shops, _ := m.NearestShops(context.Background(), 22.4260, 114.2440, "70m", false)
+	if len(shops) != 1 || shops[0].ID != 10 {
+		t.Errorf("Result expected: {10}, actual %v", shops)
+	}
+}
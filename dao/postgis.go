@@ -4,14 +4,21 @@ import (
 	"context"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
 	//PostGIS is a PostgreSQL database with PostGIS module installed
 	PostGIS = "postgis"
+
+	//Columns selected for every shop query, must match collectGISShops
+	postGISShopColumns = `shop_id, name, type, coalesce(address, ''), coalesce(url, ''),
+	coalesce(ST_Y(geog::geometry), 0) lat, coalesce(ST_X(geog::geometry), 0) long, district, coalesce(notes, ''),
+	string_to_array(coalesce(search_text, ''), ' '), coalesce(status, ''),
+	status_since, status_until, coalesce(moved_to, 0), coalesce(hours, '')`
 )
 
 //PostGISBackend is a PostGIS-enabled PostgreSQL database
@@ -20,8 +27,8 @@ type PostGISBackend struct {
 }
 
 //CreateTable create necessary table for storing shop records
-func (pg *PostGISBackend) CreateTable() error {
-	_, err := pg.conn.Exec(context.Background(), `CREATE TABLE public.shops
+func (pg *PostGISBackend) CreateTable(ctx context.Context) error {
+	_, err := pg.conn.Exec(ctx, `CREATE TABLE public.shops
 	(
 		shop_id SERIAL NOT NULL,
 		name TEXT NOT NULL,
@@ -31,40 +38,61 @@ func (pg *PostGISBackend) CreateTable() error {
 		url TEXT,
 		district TEXT,
 		search_text TEXT,
+		notes TEXT,
+		status TEXT NOT NULL DEFAULT '',
+		status_since TIMESTAMPTZ,
+		status_until TIMESTAMPTZ,
+		moved_to INTEGER,
+		hours TEXT,
 		CONSTRAINT shops_pkey PRIMARY KEY (shop_id)
 	)`)
 	if err != nil {
 		return err
 	}
 
-	_, err = pg.conn.Exec(context.Background(), `CREATE TABLE public.keyword (
+	_, err = pg.conn.Exec(ctx, `CREATE TABLE public.keyword (
 		word TEXT NOT NULL,
 		CONSTRAINT keyword_pkey PRIMARY KEY (word)
 		)`)
-	return err
-}
+	if err != nil {
+		return err
+	}
 
-// AllShops returns all records from the database
-func (pg *PostGISBackend) AllShops() ([]Shop, error) {
-	rows, err := pg.conn.Query(context.Background(),
-		`SELECT shop_id, name, type, coalesce(address, ''), coalesce(url,''), 
-		geog, district, string_to_array(coalesce(search_text, ''), ' ') FROM shops`)
+	_, err = pg.conn.Exec(ctx, pgSubmissionTable)
 	if err != nil {
-		return nil, err
+		return err
 	}
+
+	_, err = pg.conn.Exec(ctx, pgReportTable)
+	if err != nil {
+		return err
+	}
+
+	_, err = pg.conn.Exec(ctx, pgFavouriteTable)
+	if err != nil {
+		return err
+	}
+
+	_, err = pg.conn.Exec(ctx, pgUserDataTable)
+	return err
+}
+
+//collectGISShops scans rows selected with postGISShopColumns
+func collectGISShops(rows pgx.Rows) ([]Shop, error) {
 	defer rows.Close()
 	shoplist := make([]Shop, 0)
 	for rows.Next() {
 		shop := Shop{}
-		var pos pgtype.Point
-		err := rows.Scan(&shop.ID, &shop.Name, &shop.Type, &shop.Address, &shop.URL, &pos, &shop.District, &shop.Tags)
+		var since, until *time.Time
+		var hours string
+		err := rows.Scan(&shop.ID, &shop.Name, &shop.Type, &shop.Address, &shop.URL, &shop.Position.Lat,
+			&shop.Position.Long, &shop.District, &shop.Notes, &shop.Tags, &shop.Status, &since, &until,
+			&shop.MovedTo, &hours)
 		if err != nil {
 			return nil, err
 		}
-		if pos.Status == pgtype.Present {
-			shop.Position.Lat = pos.P.X
-			shop.Position.Long = pos.P.Y
-		}
+		shop.StatusSince, shop.StatusUntil = fromNullTime(since), fromNullTime(until)
+		shop.Hours = storedHours(hours)
 		shoplist = append(shoplist, shop)
 	}
 	if rows.Err() != nil {
@@ -73,6 +101,49 @@ func (pg *PostGISBackend) AllShops() ([]Shop, error) {
 	return shoplist, nil
 }
 
+// AllShops returns all records from the database
+func (pg *PostGISBackend) AllShops(ctx context.Context) ([]Shop, error) {
+	rows, err := pg.conn.Query(ctx, `SELECT `+postGISShopColumns+` FROM shops`)
+	if err != nil {
+		return nil, err
+	}
+	return collectGISShops(rows)
+}
+
+//ImportShops inserts or replaces full shop records, including tags
+func (pg *PostGISBackend) ImportShops(ctx context.Context, shops []Shop) error {
+	tx, err := pg.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	for _, shop := range shops {
+		lat, long := gisPoint(shop)
+		_, err := tx.Exec(ctx,
+			`INSERT INTO shops(shop_id, name, address, geog, type, url, district, search_text, notes, status,
+			status_since, status_until, moved_to, hours)
+			VALUES ($1, $2, $3, ST_MakePoint($4, $5)::geography, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+			ON CONFLICT (shop_id) DO UPDATE SET name = excluded.name, address = excluded.address,
+			geog = excluded.geog, type = excluded.type, url = excluded.url, district = excluded.district,
+			search_text = excluded.search_text, notes = excluded.notes, status = excluded.status,
+			status_since = excluded.status_since, status_until = excluded.status_until, moved_to = excluded.moved_to,
+			hours = excluded.hours`,
+			shop.ID, shop.Name, nullString(shop.Address), long, lat, shop.Type,
+			nullString(shop.URL), shop.District, nullString(strings.Join(shop.Tags, " ")),
+			nullString(shop.Notes), shop.Status, nullTime(shop.StatusSince), nullTime(shop.StatusUntil),
+			nullInt(shop.MovedTo), nullString(hoursText(shop.Hours)))
+		if err != nil {
+			return err
+		}
+	}
+	//Keep serial in sync with imported IDs
+	_, err = tx.Exec(ctx, "SELECT setval(pg_get_serial_sequence('shops', 'shop_id'), coalesce(max(shop_id), 1)) FROM shops")
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
 //NewPostGISBackend returns new PostGIS backend
 func NewPostGISBackend(connStr string) (*PostGISBackend, error) {
 	db, err := NewPostgresBackend(connStr)
@@ -80,34 +151,28 @@ func NewPostGISBackend(connStr string) (*PostGISBackend, error) {
 }
 
 //ShopMissingInfo get data with missing info
-func (pg *PostGISBackend) ShopMissingInfo() ([]Shop, error) {
+func (pg *PostGISBackend) ShopMissingInfo(ctx context.Context) ([]Shop, error) {
 	exTypes := []string{nonPhyStore}
-	rows, err := pg.conn.Query(context.Background(),
-		`SELECT shop_id, name, district, coalesce(address, ''), 
-		 type FROM shops WHERE geog IS NULL and district <> all($1) and status <> $2`, exTypes, closedStore)
+	rows, err := pg.conn.Query(ctx,
+		`SELECT `+postGISShopColumns+` FROM shops WHERE geog IS NULL and district <> all($1) and status <> all($2)`,
+		exTypes, hiddenStatus)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	shoplist := make([]Shop, 0)
-	for rows.Next() {
-		shop := Shop{}
-		rows.Scan(&shop.ID, &shop.Name, &shop.District, &shop.Address, &shop.Type)
-		shoplist = append(shoplist, shop)
-	}
-	return shoplist, nil
+	return collectGISShops(rows)
 }
 
 //UpdateShopInfo fill missing info into shops
-func (pg *PostGISBackend) UpdateShopInfo(shops []Shop) error {
-	tx, err := pg.conn.Begin(context.Background())
+func (pg *PostGISBackend) UpdateShopInfo(ctx context.Context, shops []Shop) error {
+	tx, err := pg.conn.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 	var rowsAffected int64 = 0
 	for _, shop := range shops {
 		lat, long := shop.ToCoord()
-		cmdTag, err := pg.conn.Exec(context.Background(),
+		cmdTag, err := tx.Exec(ctx,
 			"UPDATE shops SET address = $1, geog = ST_MakePoint($2, $3)::geography WHERE shop_id = $4",
 			shop.Address, long, lat, shop.ID)
 		if err != nil {
@@ -116,121 +181,215 @@ func (pg *PostGISBackend) UpdateShopInfo(shops []Shop) error {
 		}
 		rowsAffected += cmdTag.RowsAffected()
 	}
-	tx.Commit(context.Background())
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
 	log.WithField("rowsAffected", rowsAffected).Info("Shop info updated")
-	return err
+	return nil
 }
 
-//NearestShops returns nearby shops
-func (pg *PostGISBackend) NearestShops(lat, long float64, distance string) ([]Shop, error) {
-	d, err := disToInt(distance)
+//ShopsWithStatus returns all shops with provided status
+func (pg *PostGISBackend) ShopsWithStatus(ctx context.Context, status string) ([]Shop, error) {
+	rows, err := pg.conn.Query(ctx, `SELECT `+postGISShopColumns+` FROM shops WHERE status = $1`, status)
 	if err != nil {
 		return nil, err
 	}
+	return collectGISShops(rows)
+}
 
-	rows, err := pg.conn.Query(context.Background(),
-		`SELECT shop_id, name, type, coalesce(address, ''), 
-		coalesce(url, ''), district, ST_X(geog::geometry) long, ST_Y(geog::geometry) lat,
-		round(ST_Distance(geog, ST_MakePoint($1, $2)::geography, false)) as dist, coalesce(notes, '')
-		FROM shops
-		WHERE ST_DWithin(geog, ST_MakePoint($1, $2), $3, false) and status <> $4 order by dist`,
-		long, lat, d, closedStore)
+//CreateShop validates and saves a new shop. ID is assigned if shop.ID is 0
+func (pg *PostGISBackend) CreateShop(ctx context.Context, shop Shop) (Shop, error) {
+	err := shop.Validate()
+	if err != nil {
+		return Shop{}, err
+	}
+	tx, err := pg.conn.Begin(ctx)
+	if err != nil {
+		return Shop{}, err
+	}
+	defer tx.Rollback(ctx)
+	err = pgCheckDuplicate(ctx, tx, shop)
+	if err != nil {
+		return Shop{}, err
+	}
+	shop.ID, err = pgNextID(ctx, tx, shop.ID)
+	if err != nil {
+		return Shop{}, err
+	}
+	lat, long := gisPoint(shop)
+	_, err = tx.Exec(ctx,
+		`INSERT INTO shops(shop_id, name, address, geog, type, url, district, search_text, notes, status,
+		status_since, status_until, moved_to, hours)
+		VALUES ($1, $2, $3, ST_MakePoint($4, $5)::geography, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		shop.ID, shop.Name, nullString(shop.Address), long, lat, shop.Type,
+		nullString(shop.URL), shop.District, nullString(strings.Join(shop.Tags, " ")),
+		nullString(shop.Notes), shop.Status, nullTime(shop.StatusSince), nullTime(shop.StatusUntil),
+		nullInt(shop.MovedTo), nullString(hoursText(shop.Hours)))
+	if err != nil {
+		log.WithError(err).Error("Create shop error")
+		return Shop{}, err
+	}
+	return shop, tx.Commit(ctx)
+}
 
+//UpdateShop saves fields of shop, other fields are kept
+func (pg *PostGISBackend) UpdateShop(ctx context.Context, shop Shop, fields ShopField) error {
+	tx, err := pg.conn.Begin(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer tx.Rollback(ctx)
+	rows, err := tx.Query(ctx, `SELECT `+postGISShopColumns+` FROM shops WHERE shop_id = $1 FOR UPDATE`, shop.ID)
+	if err != nil {
+		return err
+	}
+	current, err := collectGISShops(rows)
+	if err != nil {
+		return err
+	}
+	if len(current) == 0 {
+		return shopNotFound(shop.ID)
+	}
+	updated := applyFields(current[0], shop, fields)
+	err = updated.Validate()
+	if err != nil {
+		return err
+	}
+	err = pgCheckDuplicate(ctx, tx, updated)
+	if err != nil {
+		return err
+	}
+	lat, long := gisPoint(updated)
+	_, err = tx.Exec(ctx,
+		`UPDATE shops SET name = $2, address = $3, geog = ST_MakePoint($4, $5)::geography, type = $6, url = $7,
+		district = $8, search_text = $9, notes = $10, status = $11, status_since = $12, status_until = $13,
+		moved_to = $14, hours = $15 WHERE shop_id = $1`,
+		updated.ID, updated.Name, nullString(updated.Address), long, lat, updated.Type,
+		nullString(updated.URL), updated.District, nullString(strings.Join(updated.Tags, " ")),
+		nullString(updated.Notes), updated.Status, nullTime(updated.StatusSince), nullTime(updated.StatusUntil),
+		nullInt(updated.MovedTo), nullString(hoursText(updated.Hours)))
+	if err != nil {
+		log.WithError(err).Error("Update shop error")
+		return err
+	}
+	return tx.Commit(ctx)
+}
 
-	defer rows.Close()
-	shoplist := make([]Shop, 0)
-	for rows.Next() {
-		shop := Shop{}
-		rows.Scan(&shop.ID, &shop.Name, &shop.Type, &shop.Address,
-			&shop.URL, &shop.District, &shop.Position.Long, &shop.Position.Lat, &shop.Distance, &shop.Notes)
+//gisPoint returns coordinates of shop for ST_MakePoint, NULL if the shop has
+//no location
+func gisPoint(shop Shop) (lat, long *float64) {
+	if shop.HasPhyLoc() {
+		la, lo := shop.ToCoord()
+		lat, long = &la, &lo
+	}
+	return lat, long
+}
 
-		shoplist = append(shoplist, shop)
+//NearestShops returns nearby shops
+func (pg *PostGISBackend) NearestShops(ctx context.Context, lat, long float64, distance string, includeClosed bool) ([]Shop, error) {
+	d, err := disToInt(distance)
+	if err != nil {
+		return nil, err
 	}
 
-	return shoplist, nil
+	rows, err := pg.conn.Query(ctx,
+		`SELECT `+postGISShopColumns+`
+		FROM shops
+		WHERE ST_DWithin(geog, ST_MakePoint($1, $2), $3, false) and status <> all($4)
+		order by ST_Distance(geog, ST_MakePoint($1, $2)::geography, false)`,
+		long, lat, d, excludedStatus(includeClosed))
+	if err != nil {
+		return nil, err
+	}
+	shops, err := collectGISShops(rows)
+	if err != nil {
+		return nil, err
+	}
+	SortByDistance(shops, lat, long)
+	return shops, nil
 }
 
 //ShopByID returns shop by internal ID
-func (pg *PostGISBackend) ShopByID(shopID int) (Shop, error) {
-	r := pg.conn.QueryRow(context.Background(),
-		`SELECT name, type, coalesce(address, ''), coalesce(url,''), coalesce(ST_X(geog::geometry), 0) long, 
-		coalesce(ST_Y(geog::geometry), 0) lat, district, coalesce(notes, '') FROM shops WHERE shop_id = $1`, shopID)
-	shop := Shop{}
-	err := r.Scan(&shop.Name, &shop.Type, &shop.Address, &shop.URL, &shop.Position.Long,
-		&shop.Position.Lat, &shop.District, &shop.Notes)
+func (pg *PostGISBackend) ShopByID(ctx context.Context, shopID int) (Shop, error) {
+	rows, err := pg.conn.Query(ctx, `SELECT `+postGISShopColumns+` FROM shops WHERE shop_id = $1`, shopID)
+	if err != nil {
+		return Shop{}, err
+	}
+	shops, err := collectGISShops(rows)
 	if err != nil {
-		return shop, err
+		return Shop{}, err
 	}
-	return shop, nil
+	if len(shops) == 0 {
+		return Shop{}, shopNotFound(shopID)
+	}
+	return shops[0], nil
 }
 
-//ShopsWithKeyword returns shops with tags provided
-func (pg *PostGISBackend) ShopsWithKeyword(keywords string) ([]Shop, error) {
-	rows, err := pg.conn.Query(context.Background(),
-		`SELECT shop_id, name, type, coalesce(address, ''), 
-	coalesce(url,''), coalesce(ST_X(geog::geometry), 0) long, coalesce(ST_Y(geog::geometry), 0) lat, district, coalesce(notes, '') 
-	FROM shops WHERE (to_tsvector('cuisine', search_text || ' ' || district) @@ plainto_tsquery('cuisine_syn', $1) AND status <> $2 OR name ILIKE '%'||$1||'%') 
-	and (address IS NOT NULL OR url IS NOT NULL) order by random()`,
-		keywords, closedStore)
-
+//Favourites returns favourite shops of user, latest marked first
+func (pg *PostGISBackend) Favourites(ctx context.Context, userID int) ([]Shop, error) {
+	rows, err := pg.conn.Query(ctx, `SELECT `+postGISShopColumns+pgFavouriteQuery, userID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	shoplist := make([]Shop, 0)
-	for rows.Next() {
-		shop := Shop{}
-		rows.Scan(&shop.ID,
-			&shop.Name,
-			&shop.Type,
-			&shop.Address,
-			&shop.URL,
-			&shop.Position.Long,
-			&shop.Position.Lat,
-			&shop.District,
-			&shop.Notes,
-		)
-		shoplist = append(shoplist, shop)
+	return collectGISShops(rows)
+}
+
+//ShopsWithKeyword returns shops with tags provided
+func (pg *PostGISBackend) ShopsWithKeyword(ctx context.Context, keywords string) ([]Shop, error) {
+	if noKeyword(keywords) {
+		return make([]Shop, 0), nil
 	}
-	return shoplist, nil
+	rows, err := pg.conn.Query(ctx,
+		`SELECT `+postGISShopColumns+`
+	FROM shops WHERE (to_tsvector('cuisine', search_text || ' ' || district) @@ plainto_tsquery('cuisine_syn', $1) OR name ILIKE '%'||$1||'%')
+	and (address IS NOT NULL OR url IS NOT NULL) and status <> all($2) order by random()`,
+		keywords, hiddenStatus)
+	if err != nil {
+		return nil, err
+	}
+	return collectGISShops(rows)
 }
 
 //ShopsWithKeywordSortByDist sort position by distance
-func (pg *PostGISBackend) ShopsWithKeywordSortByDist(keywords string, lat, long float64) ([]Shop, error) {
-	rows, err := pg.conn.Query(context.Background(),
-		`SELECT shop_id, name, type, coalesce(address, ''), 
-	coalesce(url,''), coalesce(ST_X(geog::geometry), 0) long, coalesce(ST_Y(geog::geometry), 0) lat, 
-	district, coalesce(notes, '') 
-	FROM shops WHERE (to_tsvector('cuisine', search_text || ' ' || district) @@ plainto_tsquery('cuisine_syn', $1) 
-	AND status <> $4
-	OR name ILIKE '%'||$1||'%') 
-	and (address IS NOT NULL OR url IS NOT NULL)
+func (pg *PostGISBackend) ShopsWithKeywordSortByDist(ctx context.Context, keywords string, lat, long float64) ([]Shop, error) {
+	if noKeyword(keywords) {
+		return make([]Shop, 0), nil
+	}
+	rows, err := pg.conn.Query(ctx,
+		`SELECT `+postGISShopColumns+`
+	FROM shops WHERE (to_tsvector('cuisine', search_text || ' ' || district) @@ plainto_tsquery('cuisine_syn', $1)
+	OR name ILIKE '%'||$1||'%')
+	and (address IS NOT NULL OR url IS NOT NULL) and status <> all($4)
 	order by ST_MakePoint($2, $3) <-> geog LIMIT 30`,
-		keywords, long, lat, closedStore)
+		keywords, long, lat, hiddenStatus)
+	if err != nil {
+		return nil, err
+	}
+	shops, err := collectGISShops(rows)
+	if err != nil {
+		return nil, err
+	}
+	SortByDistance(shops, lat, long)
+	return shops, nil
+}
 
+//AdvQuery returns shops matching q, closed and moved shops are returned only
+//if includeClosed is set
+func (pg *PostGISBackend) AdvQuery(ctx context.Context, q Query, includeClosed bool) ([]Shop, error) {
+	err := q.searchable()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	shoplist := make([]Shop, 0)
-	for rows.Next() {
-		shop := Shop{}
-		rows.Scan(&shop.ID,
-			&shop.Name,
-			&shop.Type,
-			&shop.Address,
-			&shop.URL,
-			&shop.Position.Long,
-			&shop.Position.Lat,
-			&shop.District,
-			&shop.Notes,
-		)
-		shoplist = append(shoplist, shop)
+	where, args := pgWhere(q, excludedStatus(includeClosed))
+	rows, err := pg.conn.Query(ctx,
+		`SELECT `+postGISShopColumns+` from shops
+	    where `+where+` and status <> all($1) order by random()`,
+		args...)
+	if err != nil {
+		return nil, err
 	}
-	return shoplist, nil
+	return collectGISShops(rows)
 }
 
 func disToInt(distance string) (int, error) {
@@ -2,8 +2,10 @@ package dao
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
+	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/jackc/pgx/v4"
@@ -15,8 +17,81 @@ import (
 const (
 	//PostgreSQL is the type name for PostgreSQL DB
 	PostgreSQL = "pgsql"
+
+	//Columns selected for every shop query, must match collectShops
+	pgShopColumns = `shop_id, name, type, coalesce(address, ''), coalesce(url, ''), coalesce(geohash, ''),
+	district, coalesce(notes, ''), string_to_array(coalesce(search_text, ''), ' '), coalesce(status, ''),
+	status_since, status_until, coalesce(moved_to, 0), coalesce(hours, '')`
+
+	//Columns selected for every submission query, must match collectSubmissions
+	pgSubmissionColumns = `submission_id, shop::text, user_id, coalesce(user_name, ''), chat_id, created, status,
+	coalesce(reviewed_by, 0), coalesce(shop_id, 0)`
+
+	//Table for shops submitted by users, same for PostGIS
+	pgSubmissionTable = `CREATE TABLE IF NOT EXISTS public.submissions
+	(
+		submission_id SERIAL NOT NULL,
+		shop JSONB NOT NULL,
+		user_id BIGINT NOT NULL,
+		user_name TEXT,
+		chat_id BIGINT NOT NULL,
+		created TIMESTAMPTZ NOT NULL,
+		status TEXT NOT NULL,
+		reviewed_by BIGINT,
+		shop_id INTEGER,
+		CONSTRAINT submissions_pkey PRIMARY KEY (submission_id)
+	)`
+
+	//Table for problems of shops reported by users, same for PostGIS
+	pgReportTable = `CREATE TABLE IF NOT EXISTS public.reports
+	(
+		report_id SERIAL NOT NULL,
+		shop_id INTEGER NOT NULL,
+		user_id BIGINT NOT NULL,
+		kind TEXT NOT NULL,
+		text TEXT,
+		created TIMESTAMPTZ NOT NULL,
+		resolved_by BIGINT NOT NULL DEFAULT 0,
+		resolved TIMESTAMPTZ,
+		CONSTRAINT reports_pkey PRIMARY KEY (report_id)
+	)`
+
+	//Table for favourite shops of users, same for PostGIS
+	pgFavouriteTable = `CREATE TABLE IF NOT EXISTS public.favourites
+	(
+		user_id BIGINT NOT NULL,
+		shop_id INTEGER NOT NULL,
+		created TIMESTAMPTZ NOT NULL,
+		CONSTRAINT favourites_pkey PRIMARY KEY (user_id, shop_id)
+	)`
+
+	//Table for values of UserStore, same for PostGIS
+	pgUserDataTable = `CREATE TABLE IF NOT EXISTS public.user_data
+	(
+		user_id BIGINT NOT NULL,
+		key TEXT NOT NULL,
+		value BYTEA NOT NULL,
+		updated TIMESTAMPTZ NOT NULL,
+		CONSTRAINT user_data_pkey PRIMARY KEY (user_id, key)
+	)`
+
+	//Query of favourite shops of user, latest first, columns are selected
+	//before it
+	pgFavouriteQuery = ` FROM shops JOIN favourites USING (shop_id) WHERE user_id = $1 ORDER BY favourites.created DESC`
 )
 
+//pgUpgrades add what databases created by earlier versions lack, run on
+//connect. Same for PostGIS
+var pgUpgrades = []string{
+	`ALTER TABLE IF EXISTS public.shops ADD COLUMN IF NOT EXISTS status_since TIMESTAMPTZ,
+	ADD COLUMN IF NOT EXISTS status_until TIMESTAMPTZ, ADD COLUMN IF NOT EXISTS moved_to INTEGER`,
+	`ALTER TABLE IF EXISTS public.shops ADD COLUMN IF NOT EXISTS hours TEXT`,
+	pgSubmissionTable,
+	pgReportTable,
+	pgFavouriteTable,
+	pgUserDataTable,
+}
+
 //PostgresBackend is the data backend supported by PostgresSQL database
 type PostgresBackend struct {
 	//Conn is the database connection
@@ -29,12 +104,29 @@ func NewPostgresBackend(connStr string) (*PostgresBackend, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &PostgresBackend{db}, nil
+	pg := &PostgresBackend{db}
+	err = pg.upgrade(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return pg, nil
+}
+
+//upgrade brings database up to date with pgUpgrades
+func (pg *PostgresBackend) upgrade(ctx context.Context) error {
+	for i := range pgUpgrades {
+		_, err := pg.conn.Exec(ctx, pgUpgrades[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 //CreateTable create necessary table for storing shop records
-func (pg *PostgresBackend) CreateTable() error {
-	_, err := pg.conn.Exec(context.Background(), `CREATE TABLE public.shops
+func (pg *PostgresBackend) CreateTable(ctx context.Context) error {
+	_, err := pg.conn.Exec(ctx, `CREATE TABLE public.shops
 	(
 		shop_id SERIAL NOT NULL,
 		name TEXT NOT NULL,
@@ -44,47 +136,155 @@ func (pg *PostgresBackend) CreateTable() error {
 		url TEXT,
 		district TEXT,
 		search_text TEXT,
+		notes TEXT,
+		status TEXT NOT NULL DEFAULT '',
+		status_since TIMESTAMPTZ,
+		status_until TIMESTAMPTZ,
+		moved_to INTEGER,
+		hours TEXT,
 		CONSTRAINT shops_pkey PRIMARY KEY (shop_id)
 	)`)
 	if err != nil {
 		return err
 	}
 
-	_, err = pg.conn.Exec(context.Background(), `CREATE TABLE public.keyword (
+	_, err = pg.conn.Exec(ctx, `CREATE TABLE public.keyword (
 		word TEXT NOT NULL,
 		CONSTRAINT keyword_pkey PRIMARY KEY (word)
 		)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = pg.conn.Exec(ctx, pgSubmissionTable)
+	if err != nil {
+		return err
+	}
+
+	_, err = pg.conn.Exec(ctx, pgReportTable)
+	if err != nil {
+		return err
+	}
+
+	_, err = pg.conn.Exec(ctx, pgFavouriteTable)
+	if err != nil {
+		return err
+	}
+
+	_, err = pg.conn.Exec(ctx, pgUserDataTable)
 	return err
 }
 
 //ShopMissingInfo get data with missing info
-func (pg *PostgresBackend) ShopMissingInfo() ([]Shop, error) {
+func (pg *PostgresBackend) ShopMissingInfo(ctx context.Context) ([]Shop, error) {
 	exTypes := []string{nonPhyStore}
-	rows, err := pg.conn.Query(context.Background(),
-		`SELECT shop_id, name, district, coalesce(address, ''), coalesce(geohash, ''),
-		 type FROM shops WHERE geohash IS NULL and district <> all($1) and status <> $2`, exTypes, closedStore)
+	rows, err := pg.conn.Query(ctx,
+		`SELECT `+pgShopColumns+` FROM shops WHERE geohash IS NULL and district <> all($1) and status <> all($2)`,
+		exTypes, hiddenStatus)
 	if err != nil {
 		return nil, err
 	}
+	return collectShops(rows)
+}
+
+//collectShops scans rows selected with pgShopColumns
+func collectShops(rows pgx.Rows) ([]Shop, error) {
 	defer rows.Close()
 	shoplist := make([]Shop, 0)
 	for rows.Next() {
 		shop := Shop{}
-		rows.Scan(&shop.ID, &shop.Name, &shop.District, &shop.Address, &shop.Geohash, &shop.Type)
+		var since, until *time.Time
+		var hours string
+		err := rows.Scan(&shop.ID, &shop.Name, &shop.Type, &shop.Address, &shop.URL, &shop.Geohash,
+			&shop.District, &shop.Notes, &shop.Tags, &shop.Status, &since, &until, &shop.MovedTo, &hours)
+		if err != nil {
+			return nil, err
+		}
+		shop.StatusSince, shop.StatusUntil = fromNullTime(since), fromNullTime(until)
+		shop.Hours = storedHours(hours)
 		shoplist = append(shoplist, shop)
 	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
 	return shoplist, nil
 }
 
+//nullString converts empty string to NULL
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+//nullTime converts zero time to NULL
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+//fromNullTime converts NULL to zero time
+func fromNullTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+//nullInt converts 0 to NULL
+func nullInt(i int) *int {
+	if i == 0 {
+		return nil
+	}
+	return &i
+}
+
+//ImportShops inserts or replaces full shop records, including tags
+func (pg *PostgresBackend) ImportShops(ctx context.Context, shops []Shop) error {
+	tx, err := pg.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	for _, shop := range shops {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO shops(shop_id, name, address, geohash, type, url, district, search_text, notes, status,
+			status_since, status_until, moved_to, hours)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			ON CONFLICT (shop_id) DO UPDATE SET name = excluded.name, address = excluded.address,
+			geohash = excluded.geohash, type = excluded.type, url = excluded.url, district = excluded.district,
+			search_text = excluded.search_text, notes = excluded.notes, status = excluded.status,
+			status_since = excluded.status_since, status_until = excluded.status_until, moved_to = excluded.moved_to,
+			hours = excluded.hours`,
+			shop.ID, shop.Name, nullString(shop.Address), nullString(shop.ToGeohash()), shop.Type,
+			nullString(shop.URL), shop.District, nullString(strings.Join(shop.Tags, " ")),
+			nullString(shop.Notes), shop.Status, nullTime(shop.StatusSince), nullTime(shop.StatusUntil),
+			nullInt(shop.MovedTo), nullString(hoursText(shop.Hours)))
+		if err != nil {
+			return err
+		}
+	}
+	//Keep serial in sync with imported IDs
+	_, err = tx.Exec(ctx, "SELECT setval(pg_get_serial_sequence('shops', 'shop_id'), coalesce(max(shop_id), 1)) FROM shops")
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
 //UpdateShopInfo fill missing info into shops
-func (pg *PostgresBackend) UpdateShopInfo(shops []Shop) error {
-	tx, err := pg.conn.Begin(context.Background())
+func (pg *PostgresBackend) UpdateShopInfo(ctx context.Context, shops []Shop) error {
+	tx, err := pg.conn.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 	var rowsAffected int64 = 0
 	for _, shop := range shops {
-		cmdTag, err := pg.conn.Exec(context.Background(),
+		cmdTag, err := tx.Exec(ctx,
 			"UPDATE shops SET address = $1, geohash = $2 WHERE shop_id = $3",
 			shop.Address, shop.ToGeohash(), shop.ID)
 		if err != nil {
@@ -94,62 +294,241 @@ func (pg *PostgresBackend) UpdateShopInfo(shops []Shop) error {
 		rowsAffected += cmdTag.RowsAffected()
 	}
 
-	tx.Commit(context.Background())
-	return err
+	return tx.Commit(ctx)
 }
 
-//NearestShops retrieves nearest shops with provided geohash
-func (pg *PostgresBackend) NearestShops(lat, long float64, distance string) ([]Shop, error) {
-	gHashArr := area(ghash.EncodeWithPrecision(lat, long, 7), distance)
-	rows, err := pg.conn.Query(context.Background(),
-		"SELECT shop_id, name, type, coalesce(address, ''), coalesce(url,''), geohash, district FROM shops WHERE LEFT(geohash, 7) = ANY($1) and status <> $2 order by random()",
-		gHashArr, closedStore)
+//ShopsWithStatus returns all shops with provided status
+func (pg *PostgresBackend) ShopsWithStatus(ctx context.Context, status string) ([]Shop, error) {
+	rows, err := pg.conn.Query(ctx, `SELECT `+pgShopColumns+` FROM shops WHERE status = $1`, status)
 	if err != nil {
 		return nil, err
 	}
+	return collectShops(rows)
+}
+
+//UpdateShopStatus saves status, its effective dates and new location of shops
+func (pg *PostgresBackend) UpdateShopStatus(ctx context.Context, shops []Shop) error {
+	tx, err := pg.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	for _, shop := range shops {
+		_, err := tx.Exec(ctx,
+			"UPDATE shops SET status = $1, status_since = $2, status_until = $3, moved_to = $4 WHERE shop_id = $5",
+			shop.Status, nullTime(shop.StatusSince), nullTime(shop.StatusUntil), nullInt(shop.MovedTo), shop.ID)
+		if err != nil {
+			log.WithError(err).Error("Update shop status error")
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+//pgCheckDuplicate returns *ConflictError if another open shop has the same
+//name and address
+func pgCheckDuplicate(ctx context.Context, tx pgx.Tx, shop Shop) error {
+	rows, err := tx.Query(ctx,
+		"SELECT shop_id, name, coalesce(address, '') FROM shops WHERE name = $1 AND shop_id <> $2 AND status <> all($3)",
+		shop.Name, shop.ID, hiddenStatus)
+	if err != nil {
+		return err
+	}
 	defer rows.Close()
-	shoplist := make([]Shop, 0)
+	candidates := make([]Shop, 0)
 	for rows.Next() {
-		shop := Shop{}
-		rows.Scan(&shop.ID, &shop.Name, &shop.Type, &shop.Address, &shop.URL, &shop.Geohash, &shop.District)
-		shoplist = append(shoplist, shop)
+		c := Shop{}
+		err := rows.Scan(&c.ID, &c.Name, &c.Address)
+		if err != nil {
+			return err
+		}
+		candidates = append(candidates, c)
 	}
-	return shoplist, nil
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	return duplicateOf(shop, candidates)
 }
 
-//ShopsWithKeyword returns shops with tags provided
-func (pg *PostgresBackend) ShopsWithKeyword(keywords string) ([]Shop, error) {
-	rows, err := pg.conn.Query(context.Background(),
-		`SELECT shop_id, name, type, coalesce(address, ''), 
-	coalesce(url,''), coalesce(geohash, ''), district, coalesce(notes, '') 
-	FROM shops WHERE (to_tsvector('cuisine', search_text || ' ' || district) @@ plainto_tsquery('cuisine_syn', $1) OR name ILIKE '%'||$1||'%') 
-	and (address IS NOT NULL OR url IS NOT NULL) and status <> $2 order by random()`,
-		keywords, closedStore)
+//pgCheckNewID returns *ConflictError if shopID is used
+func pgCheckNewID(ctx context.Context, tx pgx.Tx, shopID int) error {
+	var cnt int
+	err := tx.QueryRow(ctx, "SELECT count(*) FROM shops WHERE shop_id = $1", shopID).Scan(&cnt)
+	if err != nil {
+		return err
+	}
+	if cnt > 0 {
+		return idTaken(shopID)
+	}
+	return nil
+}
+
+//pgNextID returns the ID for shop to be created, syncing the serial if ID is
+//chosen by caller
+func pgNextID(ctx context.Context, tx pgx.Tx, shopID int) (int, error) {
+	if shopID == 0 {
+		err := tx.QueryRow(ctx, "SELECT nextval(pg_get_serial_sequence('shops', 'shop_id'))").Scan(&shopID)
+		return shopID, err
+	}
+	err := pgCheckNewID(ctx, tx, shopID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(ctx,
+		"SELECT setval(pg_get_serial_sequence('shops', 'shop_id'), greatest($1, coalesce(max(shop_id), 1))) FROM shops",
+		shopID)
+	return shopID, err
+}
+
+//CreateShop validates and saves a new shop. ID is assigned if shop.ID is 0
+func (pg *PostgresBackend) CreateShop(ctx context.Context, shop Shop) (Shop, error) {
+	err := shop.Validate()
+	if err != nil {
+		return Shop{}, err
+	}
+	tx, err := pg.conn.Begin(ctx)
+	if err != nil {
+		return Shop{}, err
+	}
+	defer tx.Rollback(ctx)
+	err = pgCheckDuplicate(ctx, tx, shop)
+	if err != nil {
+		return Shop{}, err
+	}
+	shop.ID, err = pgNextID(ctx, tx, shop.ID)
+	if err != nil {
+		return Shop{}, err
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO shops(shop_id, name, address, geohash, type, url, district, search_text, notes, status,
+		status_since, status_until, moved_to, hours)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		shop.ID, shop.Name, nullString(shop.Address), nullString(shop.ToGeohash()), shop.Type,
+		nullString(shop.URL), shop.District, nullString(strings.Join(shop.Tags, " ")),
+		nullString(shop.Notes), shop.Status, nullTime(shop.StatusSince), nullTime(shop.StatusUntil),
+		nullInt(shop.MovedTo), nullString(hoursText(shop.Hours)))
+	if err != nil {
+		log.WithError(err).Error("Create shop error")
+		return Shop{}, err
+	}
+	return shop, tx.Commit(ctx)
+}
+
+//UpdateShop saves fields of shop, other fields are kept
+func (pg *PostgresBackend) UpdateShop(ctx context.Context, shop Shop, fields ShopField) error {
+	tx, err := pg.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	rows, err := tx.Query(ctx, `SELECT `+pgShopColumns+` FROM shops WHERE shop_id = $1 FOR UPDATE`, shop.ID)
+	if err != nil {
+		return err
+	}
+	current, err := collectShops(rows)
+	if err != nil {
+		return err
+	}
+	if len(current) == 0 {
+		return shopNotFound(shop.ID)
+	}
+	updated := applyFields(current[0], shop, fields)
+	err = updated.Validate()
+	if err != nil {
+		return err
+	}
+	err = pgCheckDuplicate(ctx, tx, updated)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE shops SET name = $2, address = $3, geohash = $4, type = $5, url = $6, district = $7,
+		search_text = $8, notes = $9, status = $10, status_since = $11, status_until = $12, moved_to = $13,
+		hours = $14 WHERE shop_id = $1`,
+		updated.ID, updated.Name, nullString(updated.Address), nullString(updated.ToGeohash()), updated.Type,
+		nullString(updated.URL), updated.District, nullString(strings.Join(updated.Tags, " ")),
+		nullString(updated.Notes), updated.Status, nullTime(updated.StatusSince), nullTime(updated.StatusUntil),
+		nullInt(updated.MovedTo), nullString(hoursText(updated.Hours)))
+	if err != nil {
+		log.WithError(err).Error("Update shop error")
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+//DeleteShop removes shop permanently, ArchiveShop keeps the record instead
+func (pg *PostgresBackend) DeleteShop(ctx context.Context, shopID int) error {
+	cmdTag, err := pg.conn.Exec(ctx, "DELETE FROM shops WHERE shop_id = $1", shopID)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return shopNotFound(shopID)
+	}
+	return nil
+}
+
+//ArchiveShop marks shop closed since at, so it is hidden from searches
+func (pg *PostgresBackend) ArchiveShop(ctx context.Context, shopID int, at time.Time) error {
+	cmdTag, err := pg.conn.Exec(ctx,
+		"UPDATE shops SET status = $1, status_since = $2, status_until = NULL WHERE shop_id = $3",
+		StatusClosed, nullTime(at), shopID)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return shopNotFound(shopID)
+	}
+	return nil
+}
 
+//NearestShops retrieves nearest shops with provided geohash
+func (pg *PostgresBackend) NearestShops(ctx context.Context, lat, long float64, distance string, includeClosed bool) ([]Shop, error) {
+	d, err := disToInt(distance)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	shoplist := make([]Shop, 0)
-	for rows.Next() {
-		shop := Shop{}
-		rows.Scan(&shop.ID,
-			&shop.Name,
-			&shop.Type,
-			&shop.Address,
-			&shop.URL,
-			&shop.Geohash,
-			&shop.District,
-			&shop.Notes,
-		)
-		shoplist = append(shoplist, shop)
+	precision := areaPrecision(d)
+	rows, err := pg.conn.Query(ctx,
+		`SELECT `+pgShopColumns+` FROM shops WHERE LEFT(geohash, $3) = ANY($1) and status <> all($2)`,
+		coveringCells(lat, long, d, precision), excludedStatus(includeClosed), int(precision))
+	if err != nil {
+		return nil, err
+	}
+	shops, err := collectShops(rows)
+	if err != nil {
+		return nil, err
+	}
+	//Geohash cells are only an approximation of the area
+	SortByDistance(shops, lat, long)
+	shoplist := make([]Shop, 0, len(shops))
+	for i := range shops {
+		if shops[i].Distance <= d {
+			shoplist = append(shoplist, shops[i])
+		}
 	}
 	return shoplist, nil
 }
 
+//ShopsWithKeyword returns shops with tags provided
+func (pg *PostgresBackend) ShopsWithKeyword(ctx context.Context, keywords string) ([]Shop, error) {
+	if noKeyword(keywords) {
+		return make([]Shop, 0), nil
+	}
+	rows, err := pg.conn.Query(ctx,
+		`SELECT `+pgShopColumns+`
+	FROM shops WHERE (to_tsvector('cuisine', search_text || ' ' || district) @@ plainto_tsquery('cuisine_syn', $1) OR name ILIKE '%'||$1||'%') 
+	and (address IS NOT NULL OR url IS NOT NULL) and status <> all($2) order by random()`,
+		keywords, hiddenStatus)
+	if err != nil {
+		return nil, err
+	}
+	return collectShops(rows)
+}
+
 //ShopCount returns the number of shops stored in system
-func (pg *PostgresBackend) ShopCount() (int, error) {
-	r := pg.conn.QueryRow(context.Background(), "SELECT count(*) FROM shops")
+func (pg *PostgresBackend) ShopCount(ctx context.Context) (int, error) {
+	r := pg.conn.QueryRow(ctx, "SELECT count(*) FROM shops")
 	var cnt int
 	err := r.Scan(&cnt)
 	if err != nil {
@@ -159,8 +538,8 @@ func (pg *PostgresBackend) ShopCount() (int, error) {
 }
 
 //UpdateTags set keywords for searching for the shops
-func (pg *PostgresBackend) UpdateTags() (int, error) {
-	ctag, err := pg.conn.Exec(context.Background(), "update shops set search_text = type where coalesce(TRIM(search_text), '') = ''")
+func (pg *PostgresBackend) UpdateTags(ctx context.Context) (int, error) {
+	ctag, err := pg.conn.Exec(ctx, "update shops set search_text = type where coalesce(TRIM(search_text), '') = ''")
 	if err != nil {
 		return -1, err
 	}
@@ -168,13 +547,13 @@ func (pg *PostgresBackend) UpdateTags() (int, error) {
 }
 
 //RefreshKeywords flush existing keywords saved in table keyword and select new ones from shops.search_text
-func (pg *PostgresBackend) RefreshKeywords() (int, error) {
-	_, err := pg.conn.Exec(context.Background(), "TRUNCATE keyword")
+func (pg *PostgresBackend) RefreshKeywords(ctx context.Context) (int, error) {
+	_, err := pg.conn.Exec(ctx, "TRUNCATE keyword")
 	if err != nil {
 		return -1, err
 	}
 
-	t, err := pg.conn.Exec(context.Background(), `insert into keyword(
+	t, err := pg.conn.Exec(ctx, `insert into keyword(
 		SELECT word from ts_stat('select to_tsvector(''cuisine'', search_text) from shops'))`)
 	if err != nil {
 		return -1, err
@@ -184,94 +563,333 @@ func (pg *PostgresBackend) RefreshKeywords() (int, error) {
 }
 
 //ShopByID returns shop by internal ID
-func (pg *PostgresBackend) ShopByID(shopID int) (Shop, error) {
-	r := pg.conn.QueryRow(context.Background(),
-		"SELECT name, type, coalesce(address, ''), coalesce(url,''), coalesce(geohash, ''), district, coalesce(notes, '') FROM shops WHERE shop_id = $1", shopID)
-	shop := Shop{}
-	err := r.Scan(&shop.Name, &shop.Type, &shop.Address, &shop.URL, &shop.Geohash, &shop.District, &shop.Notes)
+func (pg *PostgresBackend) ShopByID(ctx context.Context, shopID int) (Shop, error) {
+	rows, err := pg.conn.Query(ctx, `SELECT `+pgShopColumns+` FROM shops WHERE shop_id = $1`, shopID)
 	if err != nil {
-		return shop, err
+		return Shop{}, err
 	}
-	return shop, nil
-}
-
-//Close close DB connection
-func (pg *PostgresBackend) Close() {
-	pg.conn.Close()
-}
-
-// AllShops returns all records from the database
-func (pg *PostgresBackend) AllShops() ([]Shop, error) {
-	rows, err := pg.conn.Query(context.Background(),
-		`SELECT shop_id, name, type, coalesce(address, ''), coalesce(url,''), 
-		coalesce(geohash, ''), district, string_to_array(coalesce(search_text, ''), ' ') FROM shops`)
+	shops, err := collectShops(rows)
 	if err != nil {
-		return nil, err
+		return Shop{}, err
+	}
+	if len(shops) == 0 {
+		return Shop{}, shopNotFound(shopID)
 	}
+	return shops[0], nil
+}
+
+//collectSubmissions scans rows selected with pgSubmissionColumns
+func collectSubmissions(rows pgx.Rows) ([]Submission, error) {
 	defer rows.Close()
-	shoplist := make([]Shop, 0)
+	subs := make([]Submission, 0)
 	for rows.Next() {
-		shop := Shop{}
-		err := rows.Scan(&shop.ID, &shop.Name, &shop.Type, &shop.Address, &shop.URL, &shop.Geohash, &shop.District, &shop.Tags)
+		sub := Submission{}
+		var shop string
+		err := rows.Scan(&sub.ID, &shop, &sub.UserID, &sub.UserName, &sub.ChatID, &sub.Created, &sub.Status,
+			&sub.ReviewedBy, &sub.ShopID)
 		if err != nil {
 			return nil, err
 		}
-		shoplist = append(shoplist, shop)
+		err = json.Unmarshal([]byte(shop), &sub.Shop)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
 	}
 	if rows.Err() != nil {
 		return nil, rows.Err()
 	}
-	return shoplist, nil
+	return subs, nil
 }
 
-//AdvQuery accepts web search query from user
-func (pg *PostgresBackend) AdvQuery(query string) ([]Shop, error) {
-	//Filter out to avoid returning every entry
-	words := strings.Split(query, " ")
-	onlyHasNeg := true
-	for i := range words {
-		if !strings.HasPrefix(words[i], "-") && strings.ToLower(words[i]) != "or" {
-			onlyHasNeg = false
-		}
+//AddSubmission saves a new submission with ID assigned
+func (pg *PostgresBackend) AddSubmission(ctx context.Context, sub Submission) (Submission, error) {
+	shop, err := json.Marshal(sub.Shop)
+	if err != nil {
+		return Submission{}, err
+	}
+	err = pg.conn.QueryRow(ctx,
+		`INSERT INTO submissions(shop, user_id, user_name, chat_id, created, status, reviewed_by, shop_id)
+		VALUES ($1::jsonb, $2, $3, $4, $5, $6, $7, $8) RETURNING submission_id`,
+		string(shop), sub.UserID, nullString(sub.UserName), sub.ChatID, sub.Created, sub.Status,
+		nullInt(sub.ReviewedBy), nullInt(sub.ShopID)).Scan(&sub.ID)
+	if err != nil {
+		return Submission{}, err
+	}
+	return sub, nil
+}
+
+//SubmissionByID returns submission by internal ID
+func (pg *PostgresBackend) SubmissionByID(ctx context.Context, id int) (Submission, error) {
+	rows, err := pg.conn.Query(ctx, `SELECT `+pgSubmissionColumns+` FROM submissions WHERE submission_id = $1`, id)
+	if err != nil {
+		return Submission{}, err
+	}
+	subs, err := collectSubmissions(rows)
+	if err != nil {
+		return Submission{}, err
+	}
+	if len(subs) == 0 {
+		return Submission{}, submissionNotFound(id)
+	}
+	return subs[0], nil
+}
+
+//PendingSubmissions returns submissions waiting for review, oldest first
+func (pg *PostgresBackend) PendingSubmissions(ctx context.Context) ([]Submission, error) {
+	rows, err := pg.conn.Query(ctx,
+		`SELECT `+pgSubmissionColumns+` FROM submissions WHERE status = $1 ORDER BY submission_id`, SubmissionPending)
+	if err != nil {
+		return nil, err
+	}
+	return collectSubmissions(rows)
+}
+
+//UpdateSubmission saves changes to submission
+func (pg *PostgresBackend) UpdateSubmission(ctx context.Context, sub Submission) error {
+	shop, err := json.Marshal(sub.Shop)
+	if err != nil {
+		return err
+	}
+	cmdTag, err := pg.conn.Exec(ctx,
+		`UPDATE submissions SET shop = $1::jsonb, status = $2, reviewed_by = $3, shop_id = $4 WHERE submission_id = $5`,
+		string(shop), sub.Status, nullInt(sub.ReviewedBy), nullInt(sub.ShopID), sub.ID)
+	if err != nil {
+		return err
 	}
-	if onlyHasNeg {
-		return nil, fmt.Errorf("%s returns too many results", query)
+	if cmdTag.RowsAffected() == 0 {
+		return submissionNotFound(sub.ID)
 	}
-	rows, err := pg.conn.Query(context.Background(),
-		`SELECT shop_id, name, type, coalesce(address, ''), 
-		coalesce(url,''), coalesce(geohash, ''), district, coalesce(notes, '') from shops 
-	    where to_tsvector('cuisine', search_text || ' ' || district) @@ websearch_to_tsquery('cuisine_syn', $1) and status <> $2 order by random()`, query, closedStore)
+	return nil
+}
 
+//AddReport saves a new report with ID assigned
+func (pg *PostgresBackend) AddReport(ctx context.Context, rep Report) (Report, error) {
+	tx, err := pg.conn.Begin(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+	defer tx.Rollback(ctx)
+	var id int
+	err = tx.QueryRow(ctx,
+		"SELECT report_id FROM reports WHERE shop_id = $1 AND user_id = $2 AND kind = $3 AND resolved_by = 0",
+		rep.ShopID, rep.UserID, rep.Kind).Scan(&id)
+	if err == nil {
+		rep.ID = id
+		return rep, ErrDuplicateReport
+	} else if err != pgx.ErrNoRows {
+		return Report{}, err
+	}
+	err = tx.QueryRow(ctx,
+		"INSERT INTO reports(shop_id, user_id, kind, text, created) VALUES ($1, $2, $3, $4, $5) RETURNING report_id",
+		rep.ShopID, rep.UserID, rep.Kind, nullString(rep.Text), rep.Created).Scan(&rep.ID)
+	if err != nil {
+		return Report{}, err
+	}
+	return rep, tx.Commit(ctx)
+}
+
+//OpenReports returns reports not yet resolved, oldest first
+func (pg *PostgresBackend) OpenReports(ctx context.Context) ([]Report, error) {
+	rows, err := pg.conn.Query(ctx,
+		`SELECT report_id, shop_id, user_id, kind, coalesce(text, ''), created FROM reports
+		WHERE resolved_by = 0 ORDER BY report_id`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	shoplist := make([]Shop, 0)
+	reps := make([]Report, 0)
 	for rows.Next() {
-		shop := Shop{}
-		err := rows.Scan(&shop.ID, &shop.Name, &shop.Type, &shop.Address, &shop.URL, &shop.Geohash, &shop.District, &shop.Notes)
+		rep := Report{}
+		err := rows.Scan(&rep.ID, &rep.ShopID, &rep.UserID, &rep.Kind, &rep.Text, &rep.Created)
 		if err != nil {
 			return nil, err
 		}
-		shoplist = append(shoplist, shop)
+		reps = append(reps, rep)
 	}
 	if rows.Err() != nil {
 		return nil, rows.Err()
 	}
-	return shoplist, nil
+	return reps, nil
+}
+
+//ResolveReports resolves all open reports of shop, returning the number of
+//reports resolved
+func (pg *PostgresBackend) ResolveReports(ctx context.Context, shopID, by int, at time.Time) (int, error) {
+	cmdTag, err := pg.conn.Exec(ctx,
+		"UPDATE reports SET resolved_by = $1, resolved = $2 WHERE shop_id = $3 AND resolved_by = 0",
+		by, at, shopID)
+	if err != nil {
+		return 0, err
+	}
+	return int(cmdTag.RowsAffected()), nil
+}
+
+//AddFavourite marks shop as favourite of user
+func (pg *PostgresBackend) AddFavourite(ctx context.Context, userID, shopID int) error {
+	_, err := pg.conn.Exec(ctx,
+		"INSERT INTO favourites(user_id, shop_id, created) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+		userID, shopID, time.Now())
+	return err
+}
+
+//RemoveFavourite unmarks favourite shop of user
+func (pg *PostgresBackend) RemoveFavourite(ctx context.Context, userID, shopID int) error {
+	_, err := pg.conn.Exec(ctx, "DELETE FROM favourites WHERE user_id = $1 AND shop_id = $2", userID, shopID)
+	return err
+}
+
+//IsFavourite checks if shop is favourite of user
+func (pg *PostgresBackend) IsFavourite(ctx context.Context, userID, shopID int) (bool, error) {
+	var found bool
+	err := pg.conn.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM favourites WHERE user_id = $1 AND shop_id = $2)", userID, shopID).Scan(&found)
+	return found, err
+}
+
+//Favourites returns favourite shops of user, latest marked first
+func (pg *PostgresBackend) Favourites(ctx context.Context, userID int) ([]Shop, error) {
+	rows, err := pg.conn.Query(ctx, `SELECT `+pgShopColumns+pgFavouriteQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	return collectShops(rows)
+}
+
+//UserData returns value saved under key, nil if not found
+func (pg *PostgresBackend) UserData(ctx context.Context, userID int, key string) ([]byte, error) {
+	var value []byte
+	err := pg.conn.QueryRow(ctx, "SELECT value FROM user_data WHERE user_id = $1 AND key = $2",
+		userID, key).Scan(&value)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return value, err
+}
+
+//SetUserData saves value under key
+func (pg *PostgresBackend) SetUserData(ctx context.Context, userID int, key string, value []byte) error {
+	_, err := pg.conn.Exec(ctx, `INSERT INTO user_data(user_id, key, value, updated) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (user_id, key) DO UPDATE SET value = excluded.value, updated = excluded.updated`,
+		userID, key, value, time.Now())
+	return err
+}
+
+//DeleteUserData removes value under key
+func (pg *PostgresBackend) DeleteUserData(ctx context.Context, userID int, key string) error {
+	_, err := pg.conn.Exec(ctx, "DELETE FROM user_data WHERE user_id = $1 AND key = $2", userID, key)
+	return err
+}
+
+//PurgeUserData removes values under keys beginning with prefix saved before
+//cutoff
+func (pg *PostgresBackend) PurgeUserData(ctx context.Context, userID int, prefix string, cutoff time.Time) (int, error) {
+	//left instead of LIKE, prefix may contain % or _
+	tag, err := pg.conn.Exec(ctx, `DELETE FROM user_data
+	WHERE user_id = $1 AND left(key, length($2)) = $2 AND updated < $3`, userID, prefix, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+//Close close DB connection
+func (pg *PostgresBackend) Close() {
+	pg.conn.Close()
+}
+
+// AllShops returns all records from the database
+func (pg *PostgresBackend) AllShops(ctx context.Context) ([]Shop, error) {
+	rows, err := pg.conn.Query(ctx, `SELECT `+pgShopColumns+` FROM shops`)
+	if err != nil {
+		return nil, err
+	}
+	return collectShops(rows)
+}
+
+//AdvQuery returns shops matching q, closed and moved shops are returned only
+//if includeClosed is set
+func (pg *PostgresBackend) AdvQuery(ctx context.Context, q Query, includeClosed bool) ([]Shop, error) {
+	err := q.searchable()
+	if err != nil {
+		return nil, err
+	}
+	where, args := pgWhere(q, excludedStatus(includeClosed))
+	rows, err := pg.conn.Query(ctx,
+		`SELECT `+pgShopColumns+` from shops
+	    where `+where+` and status <> all($1) order by random()`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectShops(rows)
+}
+
+//QueryFacets counts shops matching q by district and type
+func (pg *PostgresBackend) QueryFacets(ctx context.Context, q Query, includeClosed bool) (Facets, error) {
+	err := q.searchable()
+	if err != nil {
+		return nil, err
+	}
+	where, args := pgWhere(q, excludedStatus(includeClosed))
+	result := make(Facets, len(FacetFields))
+	for _, field := range FacetFields {
+		col := facetColumns[field]
+		rows, err := pg.conn.Query(ctx,
+			`SELECT `+col+`, count(*) FROM shops
+			where `+where+` and status <> all($1) and coalesce(`+col+`, '') <> '' GROUP BY `+col,
+			args...)
+		if err != nil {
+			return nil, err
+		}
+		facets := make([]Facet, 0)
+		for rows.Next() {
+			var f Facet
+			err = rows.Scan(&f.Value, &f.Count)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			facets = append(facets, f)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		result[field] = sortFacets(facets)
+	}
+	return result, nil
+}
+
+//pgWhere builds condition of q, following args already numbered. Words are
+//matched by full text search, so synonyms of cuisine_syn apply
+func pgWhere(q Query, args ...interface{}) (string, []interface{}) {
+	where := sqlWhere(q, func(t QueryTerm) string {
+		args = append(args, t.Value)
+		param := "$" + strconv.Itoa(len(args))
+		if t.Field != QueryAny {
+			return "coalesce(" + facetColumns[t.Field] + ", '') = " + param
+		}
+		tsquery := "plainto_tsquery"
+		if t.Phrase {
+			tsquery = "phraseto_tsquery"
+		}
+		return "to_tsvector('cuisine', coalesce(search_text, '') || ' ' || coalesce(district, '')) @@ " + tsquery + "('cuisine_syn', " + param + ")"
+	})
+	return where, args
 }
 
 //SuggestKeyword will take provided keyword to look into the keyword db and search
 //with edit distance <= len(key) - 1
-func (pg *PostgresBackend) SuggestKeyword(key string) ([]string, error) {
+func (pg *PostgresBackend) SuggestKeyword(ctx context.Context, key string) ([]string, error) {
 	t := utf8.RuneCountInString(key)
 	var rows pgx.Rows
 	var err error
 	if t == 1 {
-		rows, err = pg.conn.Query(context.Background(),
-			`select word from keyword where word like '%'||%1||'%'`, key)
+		rows, err = pg.conn.Query(ctx,
+			`select word from keyword where word like '%'||$1||'%'`, key)
 	} else {
-		rows, err = pg.conn.Query(context.Background(),
+		rows, err = pg.conn.Query(ctx,
 			`select word from keyword
 			where levenshtein_less_equal($1, word, $2) <=$2`, key, t-1)
 	}
@@ -293,8 +911,8 @@ func (pg *PostgresBackend) SuggestKeyword(key string) ([]string, error) {
 }
 
 //Districts returns all districts
-func (pg *PostgresBackend) Districts() ([]string, error) {
-	rows, err := pg.conn.Query(context.Background(), "select distinct district from shops")
+func (pg *PostgresBackend) Districts(ctx context.Context) ([]string, error) {
+	rows, err := pg.conn.Query(ctx, "select distinct district from shops")
 	if err != nil {
 		return nil, err
 	}
@@ -313,66 +931,39 @@ func (pg *PostgresBackend) Districts() ([]string, error) {
 }
 
 //ShopsWithKeywordSortByDist sort position by distance
-func (pg *PostgresBackend) ShopsWithKeywordSortByDist(keywords string, lat, long float64) ([]Shop, error) {
+func (pg *PostgresBackend) ShopsWithKeywordSortByDist(ctx context.Context, keywords string, lat, long float64) ([]Shop, error) {
+	if noKeyword(keywords) {
+		return make([]Shop, 0), nil
+	}
 	gHash := ghash.EncodeWithPrecision(lat, long, 7)
-	rows, err := pg.conn.Query(context.Background(),
-		`SELECT shop_id, name, type, coalesce(address, ''), 
-	coalesce(url,''), coalesce(geohash, ''), district, coalesce(notes, '') 
+	rows, err := pg.conn.Query(ctx,
+		`SELECT `+pgShopColumns+`
 	FROM shops WHERE (to_tsvector('cuisine', search_text || ' ' || district) @@ plainto_tsquery('cuisine_syn', $1) OR name ILIKE '%'||$1||'%') 
-	and (address IS NOT NULL OR url IS NOT NULL) and status <> $3 order by levenshtein_less_equal($2, geohash, 4)`,
-		keywords, gHash, closedStore)
-
+	and (address IS NOT NULL OR url IS NOT NULL) and status <> all($3) order by levenshtein_less_equal($2, geohash, 4)`,
+		keywords, gHash, hiddenStatus)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	shoplist := make([]Shop, 0)
-	for rows.Next() {
-		shop := Shop{}
-		rows.Scan(&shop.ID,
-			&shop.Name,
-			&shop.Type,
-			&shop.Address,
-			&shop.URL,
-			&shop.Geohash,
-			&shop.District,
-			&shop.Notes,
-		)
-		shoplist = append(shoplist, shop)
+	shops, err := collectShops(rows)
+	if err != nil {
+		return nil, err
 	}
-	return shoplist, nil
+	//Geohash edit distance is only a rough ordering
+	SortByDistance(shops, lat, long)
+	if len(shops) > 30 {
+		shops = shops[:30]
+	}
+	return shops, nil
 }
 
-func area(hash, distance string) []string {
-	var result []string
-	switch distance {
-	case "70m":
-		result = []string{hash}
-	case "150m":
-		result = append(ghash.Neighbors(hash), hash)
-	case "1km":
-	default:
-		result = ghash.Neighbors(hash)
-		extended := []string{
-			ghash.Neighbor(result[0], ghash.North),
-			ghash.Neighbor(result[1], ghash.North),
-			ghash.Neighbor(result[1], ghash.NorthEast),
-			ghash.Neighbor(result[1], ghash.East),
-			ghash.Neighbor(result[2], ghash.East),
-			ghash.Neighbor(result[3], ghash.East),
-			ghash.Neighbor(result[3], ghash.SouthEast),
-			ghash.Neighbor(result[3], ghash.South),
-			ghash.Neighbor(result[4], ghash.South),
-			ghash.Neighbor(result[5], ghash.South),
-			ghash.Neighbor(result[5], ghash.SouthWest),
-			ghash.Neighbor(result[5], ghash.West),
-			ghash.Neighbor(result[6], ghash.West),
-			ghash.Neighbor(result[7], ghash.West),
-			ghash.Neighbor(result[7], ghash.NorthWest),
-			ghash.Neighbor(result[7], ghash.North),
-		}
-		result = append([]string{hash}, result...)
-		result = append(result, extended...)
+//areaPrecision returns geohash precision for covering circle of distance in
+//metres with a few dozen cells
+func areaPrecision(distance int) uint {
+	switch {
+	case distance <= 500:
+		return 7
+	case distance <= 5000:
+		return 6
 	}
-	return result
+	return 5
 }
@@ -1,6 +1,7 @@
 package dao
 
 import (
+	"context"
 	"testing"
 	"fmt"
 )
@@ -10,7 +11,7 @@ const (
 )
 func BenchmarkNeighouring(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-        area("wecpk8t", "150m")
+        coveringCells(22.2819, 114.1580, 500, areaPrecision(500))
     }
 }
 
@@ -20,7 +21,7 @@ func TestSuggestKeywords(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer db.Close()
-	s, err := db.SuggestKeyword("珈啡")
+	s, err := db.SuggestKeyword(context.Background(), "珈啡")
 
 	if err != nil {
 		t.Fatal(err)
@@ -40,7 +41,7 @@ func TestShopMissingInfo(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer db.Close()
-	s, err := db.ShopMissingInfo()
+	s, err := db.ShopMissingInfo(context.Background())
 
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,336 @@
+package dao
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+//Fields of query terms
+const (
+	//QueryAny matches a tag or the district
+	QueryAny = ""
+	//QueryDistrict matches the district only
+	QueryDistrict = "district"
+	//QueryType matches the shop type only
+	QueryType = "type"
+
+	queryNear = "near"
+	queryOpen = "open"
+)
+
+const (
+	//NearHere is the near: value for location last shared by user, which
+	//callers replace by its geohash
+	NearHere = "here"
+	//MaxQueryTerms is the number of terms allowed in a query, keeping it
+	//cheap for backends
+	MaxQueryTerms = 10
+)
+
+//Reasons of QueryError
+const (
+	QueryUnknownField  = "unknownField"
+	QueryEmptyValue    = "emptyValue"
+	QueryUnclosedQuote = "unclosedQuote"
+	QueryMisplacedOr   = "misplacedOr"
+	QueryBadValue      = "badValue"
+	QueryDuplicate     = "duplicate"
+	QueryTooLong       = "tooLong"
+	QueryTooBroad      = "tooBroad"
+)
+
+//nearValue is a geohash with optional radius, as in location search keys
+var nearValue = regexp.MustCompile(`^[0-9b-hjkmnp-z]{1,12}(@[0-9]+k?m)?$`)
+
+//quoteClose is the closing quote of each opening quote. Phones may turn
+//straight quotes into curly ones
+var quoteClose = map[rune]rune{'"': '"', '“': '”'}
+
+//QueryTerm is a condition of Query
+type QueryTerm struct {
+	//Field is QueryAny, QueryDistrict or QueryType
+	Field string
+	Value string
+	//Phrase is set if value was quoted, which may contain spaces
+	Phrase bool
+}
+
+//Query is a /query parsed from syntax like
+//  district:旺角 type:拉麵 OR 叉燒 -咖啡 "exact phrase" near:here open:now
+//Terms must all match, OR joins alternatives and - excludes a term.
+//Backends compile it to their own query language
+type Query struct {
+	//Must are groups of alternatives, a term of each group must match
+	Must [][]QueryTerm
+	//Not are terms which must not match
+	Not []QueryTerm
+	//Near is NearHere or geohash with optional @radius, empty for anywhere.
+	//It is left to callers
+	Near string
+	//OpenNow keeps only shops open now, left to callers
+	OpenNow bool
+}
+
+//QueryError is a syntax error or a query too broad. Pos is the offset in
+//runes of the bad token, -1 if it is the whole query
+type QueryError struct {
+	Query  string
+	Pos    int
+	Token  string
+	Reason string
+}
+
+func (e *QueryError) Error() string {
+	if e.Pos < 0 {
+		return fmt.Sprintf("Query %q: %s", e.Query, e.Reason)
+	}
+	return fmt.Sprintf("Query %q: %s at %d %q", e.Query, e.Reason, e.Pos, e.Token)
+}
+
+//queryToken is a space separated word of query
+type queryToken struct {
+	//pos is the offset in runes, text is the token as typed
+	pos  int
+	text string
+	neg  bool
+	//field is the lower case name before colon, empty if none
+	field  string
+	value  string
+	quoted bool
+}
+
+//isOr returns true if t joins alternatives
+func (t queryToken) isOr() bool {
+	return !t.neg && !t.quoted && t.field == "" && strings.EqualFold(t.value, "or")
+}
+
+//isMust returns true if t is a term which must match
+func (t queryToken) isMust() bool {
+	return !t.neg && !t.isOr() && (t.field == QueryAny || t.field == QueryDistrict || t.field == QueryType)
+}
+
+func isFieldRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+//lexQuery splits query into tokens, keeping quoted phrases together
+func lexQuery(query string) ([]queryToken, error) {
+	runes := []rune(query)
+	tokens := make([]queryToken, 0)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		t := queryToken{pos: i}
+		j := i
+		if runes[j] == '-' {
+			t.neg = true
+			j++
+		}
+		//Field names are ASCII letters, so times like 12:30 are words
+		k := j
+		for k < len(runes) && isFieldRune(runes[k]) {
+			k++
+		}
+		if k > j && k < len(runes) && (runes[k] == ':' || runes[k] == '：') {
+			t.field = strings.ToLower(string(runes[j:k]))
+			j = k + 1
+		}
+		if close, ok := quoteClose[runeAt(runes, j)]; ok {
+			end := j + 1
+			for end < len(runes) && runes[end] != close && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &QueryError{Query: query, Pos: j, Token: string(runes[j:]), Reason: QueryUnclosedQuote}
+			}
+			t.value, t.quoted = strings.TrimSpace(string(runes[j+1:end])), true
+			j = end + 1
+		} else {
+			end := j
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+			t.value = string(runes[j:end])
+			j = end
+		}
+		t.text = string(runes[i:j])
+		tokens = append(tokens, t)
+		i = j
+	}
+	return tokens, nil
+}
+
+func runeAt(runes []rune, i int) rune {
+	if i < len(runes) {
+		return runes[i]
+	}
+	return 0
+}
+
+//ParseQuery parses query syntax, returning *QueryError pointing to the bad
+//token if it is invalid. Queries need a term which must match or near:,
+//since others would return every shop
+func ParseQuery(query string) (Query, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return Query{}, err
+	}
+	var q Query
+	fail := func(t queryToken, reason string) (Query, error) {
+		return Query{}, &QueryError{Query: query, Pos: t.pos, Token: t.text, Reason: reason}
+	}
+	//prevMust is set after a term which must match, the only place for OR
+	joinOr, prevMust := false, false
+	terms := 0
+	for i, t := range tokens {
+		if t.isOr() {
+			if !prevMust || i+1 == len(tokens) || !tokens[i+1].isMust() {
+				return fail(t, QueryMisplacedOr)
+			}
+			joinOr, prevMust = true, false
+			continue
+		}
+		switch t.field {
+		case QueryAny, QueryDistrict, QueryType, queryNear, queryOpen:
+		default:
+			return fail(t, QueryUnknownField)
+		}
+		if t.value == "" {
+			return fail(t, QueryEmptyValue)
+		}
+		switch t.field {
+		case queryNear:
+			near := strings.ToLower(t.value)
+			if t.neg || (near != NearHere && !nearValue.MatchString(near)) {
+				return fail(t, QueryBadValue)
+			}
+			if q.Near != "" {
+				return fail(t, QueryDuplicate)
+			}
+			q.Near, prevMust = near, false
+			continue
+		case queryOpen:
+			if t.neg || !strings.EqualFold(t.value, "now") {
+				return fail(t, QueryBadValue)
+			}
+			if q.OpenNow {
+				return fail(t, QueryDuplicate)
+			}
+			q.OpenNow, prevMust = true, false
+			continue
+		}
+		terms++
+		if terms > MaxQueryTerms {
+			return fail(t, QueryTooLong)
+		}
+		term := QueryTerm{Field: t.field, Value: t.value, Phrase: t.quoted}
+		switch {
+		case t.neg:
+			q.Not = append(q.Not, term)
+		case joinOr:
+			q.Must[len(q.Must)-1] = append(q.Must[len(q.Must)-1], term)
+		default:
+			q.Must = append(q.Must, []QueryTerm{term})
+		}
+		joinOr, prevMust = false, !t.neg
+	}
+	if len(q.Must) == 0 && q.Near == "" {
+		return Query{}, &QueryError{Query: query, Pos: -1, Reason: QueryTooBroad}
+	}
+	return q, nil
+}
+
+//String formats t in query syntax
+func (t QueryTerm) String() string {
+	v := t.Value
+	if t.Phrase {
+		v = `"` + v + `"`
+	}
+	if t.Field != QueryAny {
+		v = t.Field + ":" + v
+	}
+	return v
+}
+
+//String formats q in query syntax, which is parsed back to the same query
+func (q Query) String() string {
+	words := make([]string, 0, len(q.Must)+len(q.Not)+2)
+	for _, group := range q.Must {
+		alt := make([]string, len(group))
+		for i := range group {
+			alt[i] = group[i].String()
+		}
+		words = append(words, strings.Join(alt, " OR "))
+	}
+	for i := range q.Not {
+		words = append(words, "-"+q.Not[i].String())
+	}
+	if q.Near != "" {
+		words = append(words, queryNear+":"+q.Near)
+	}
+	if q.OpenNow {
+		words = append(words, queryOpen+":now")
+	}
+	return strings.Join(words, " ")
+}
+
+//Match returns true if shop matches t
+func (t QueryTerm) Match(shop Shop) bool {
+	if t.Field == QueryAny {
+		return matchTag(shop, t.Value)
+	}
+	return shop.Facet(t.Field) == t.Value
+}
+
+//Match returns true if shop matches terms of q, Near and OpenNow are not
+//checked
+func (q Query) Match(shop Shop) bool {
+	for i := range q.Not {
+		if q.Not[i].Match(shop) {
+			return false
+		}
+	}
+	for _, group := range q.Must {
+		found := false
+		for i := range group {
+			if group[i].Match(shop) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+//searchable rejects queries without terms which must match, which backends
+//would answer with every shop
+func (q Query) searchable() error {
+	if len(q.Must) == 0 {
+		return &QueryError{Query: q.String(), Pos: -1, Reason: QueryTooBroad}
+	}
+	return nil
+}
+
+//sqlWhere builds SQL condition of q, term builds the condition of a single
+//term and keeps its arguments
+func sqlWhere(q Query, term func(QueryTerm) string) string {
+	conds := make([]string, 0, len(q.Must)+len(q.Not))
+	for _, group := range q.Must {
+		alt := make([]string, len(group))
+		for i := range group {
+			alt[i] = term(group[i])
+		}
+		conds = append(conds, "("+strings.Join(alt, " OR ")+")")
+	}
+	for i := range q.Not {
+		conds = append(conds, "NOT "+term(q.Not[i]))
+	}
+	return strings.Join(conds, " AND ")
+}
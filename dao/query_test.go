@@ -0,0 +1,94 @@
+package dao
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mustParseQuery(t *testing.T, query string) Query {
+	t.Helper()
+	q, err := ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestParseQuery(t *testing.T) {
+	cases := []struct {
+		query string
+		want  string
+	}{
+		{"咖啡", "咖啡"},
+		{"  咖啡　荃灣 ", "咖啡 荃灣"},
+		{"district:旺角 type:拉麵 -咖啡", "district:旺角 type:拉麵 -咖啡"},
+		{"火鍋 or 刺身 觀塘", "火鍋 OR 刺身 觀塘"},
+		{`"exact phrase" -"no phrase"`, `"exact phrase" -"no phrase"`},
+		{"“咖啡 室” District：荃灣", `"咖啡 室" district:荃灣`},
+		{"open:now 12:30 near:here", "12:30 near:here open:now"},
+		{"near:wecnvgm2r@1km -咖啡", "-咖啡 near:wecnvgm2r@1km"},
+	}
+	for _, c := range cases {
+		q, err := ParseQuery(c.query)
+		if err != nil {
+			t.Errorf("%s: %v", c.query, err)
+			continue
+		}
+		if q.String() != c.want {
+			t.Errorf("%s expected: %s, actual %s", c.query, c.want, q.String())
+		}
+		again, err := ParseQuery(q.String())
+		if err != nil || !reflect.DeepEqual(again, q) {
+			t.Errorf("%s does not parse back: %v, %v", q.String(), again, err)
+		}
+	}
+}
+
+func TestParseQueryError(t *testing.T) {
+	cases := []struct {
+		query  string
+		pos    int
+		token  string
+		reason string
+	}{
+		{"咖啡 price:cheap", 3, "price:cheap", QueryUnknownField},
+		{"咖啡 type:", 3, "type:", QueryEmptyValue},
+		{`咖啡 "荃灣`, 3, `"荃灣`, QueryUnclosedQuote},
+		{"or 咖啡", 0, "or", QueryMisplacedOr},
+		{"咖啡 OR -荃灣", 3, "OR", QueryMisplacedOr},
+		{"咖啡 open:later", 3, "open:later", QueryBadValue},
+		{"咖啡 -near:here", 3, "-near:here", QueryBadValue},
+		{"near:here near:here", 10, "near:here", QueryDuplicate},
+		{"a b c d e f g h i j k", 20, "k", QueryTooLong},
+		{"-咖啡 -荃灣", -1, "", QueryTooBroad},
+		{"open:now", -1, "", QueryTooBroad},
+	}
+	for _, c := range cases {
+		_, err := ParseQuery(c.query)
+		qe, ok := err.(*QueryError)
+		if !ok {
+			t.Errorf("%s expected QueryError, actual %v", c.query, err)
+			continue
+		}
+		if qe.Pos != c.pos || qe.Token != c.token || qe.Reason != c.reason {
+			t.Errorf("%s expected: %s at %d %q, actual %s at %d %q", c.query, c.reason, c.pos, c.token, qe.Reason, qe.Pos, qe.Token)
+		}
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	shop := Shop{Type: "咖啡", District: "荃灣", Tags: []string{"咖啡", "甜品"}}
+	cases := map[string]bool{
+		"咖啡":                true,
+		"甜品 荃灣":             true,
+		"district:荃灣 -甜品":   false,
+		"type:甜品":           false,
+		"type:甜品 OR 甜品":     true,
+		"district:觀塘 OR 荃灣": true,
+	}
+	for query, want := range cases {
+		if got := mustParseQuery(t, query).Match(shop); got != want {
+			t.Errorf("%s expected: %v, actual %v", query, want, got)
+		}
+	}
+}
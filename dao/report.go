@@ -0,0 +1,48 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+//Report kinds
+const (
+	//ReportClosed is a shop reported closed for good
+	ReportClosed = "C"
+	//ReportAddress is a shop with wrong address
+	ReportAddress = "A"
+	//ReportLocation is a shop with wrong pin on map
+	ReportLocation = "L"
+	//ReportOther is described in report text
+	ReportOther = "O"
+)
+
+//ErrDuplicateReport is returned when user reports the same problem of a shop
+//again before it is resolved
+var ErrDuplicateReport = errors.New("Problem already reported by user")
+
+//Report is a problem of shop reported by user
+type Report struct {
+	ID         int       //Internal ID
+	ShopID     int       //Shop reported
+	UserID     int       //Telegram user ID of reporter
+	Kind       string    //One of the Report* constants
+	Text       string    //Description entered by user
+	Created    time.Time //When the report was made
+	ResolvedBy int       //Telegram user ID of admin resolving, 0 if open
+	Resolved   time.Time //When the report was resolved
+}
+
+//ReportStore are datasources keeping problem reports for review. Each user
+//has at most one open report of each kind for a shop
+type ReportStore interface {
+	AddReport(ctx context.Context, rep Report) (Report, error)
+	OpenReports(ctx context.Context) ([]Report, error)
+	ResolveReports(ctx context.Context, shopID, by int, at time.Time) (int, error)
+}
+
+//sameReport returns true if b is an open report of same problem by same user
+func sameReport(a, b Report) bool {
+	return b.ResolvedBy == 0 && a.ShopID == b.ShopID && a.UserID == b.UserID && a.Kind == b.Kind
+}
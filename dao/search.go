@@ -0,0 +1,73 @@
+package dao
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	//Radius of Earth in metres, for distance calculation
+	earthRadius = 6371000
+)
+
+//distanceBetween returns great-circle distance between two points in metres
+func distanceBetween(lat1, long1, lat2, long2 float64) int {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLong := (long2 - long1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLong/2)*math.Sin(dLong/2)
+	return int(math.Round(2 * earthRadius * math.Asin(math.Sqrt(a))))
+}
+
+//SortByDistance fills Distance of shops from (lat, long) and sorts them nearest
+//first. Shops without physical location are placed last
+func SortByDistance(shops []Shop, lat, long float64) {
+	for i := range shops {
+		if shops[i].HasPhyLoc() {
+			sLat, sLong := shops[i].ToCoord()
+			shops[i].Distance = distanceBetween(lat, long, sLat, sLong)
+		}
+	}
+	sort.SliceStable(shops, func(i, j int) bool {
+		if shops[i].HasPhyLoc() != shops[j].HasPhyLoc() {
+			return shops[i].HasPhyLoc()
+		}
+		return shops[i].Distance < shops[j].Distance
+	})
+}
+
+//noKeyword checks if keywords has no word to search. Backends return no
+//shops for it, as the name match would otherwise match every shop
+func noKeyword(keywords string) bool {
+	return strings.TrimSpace(keywords) == ""
+}
+
+//editDistance returns Levenshtein distance between a and b, counted by runes
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
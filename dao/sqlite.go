@@ -0,0 +1,985 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+	// Pure-Go SQLite driver, keeps CGO_ENABLED=0 builds working
+	_ "modernc.org/sqlite"
+)
+
+const (
+	//SQLite is the type name for embedded SQLite database
+	SQLite = "sqlite"
+
+	//Columns selected for every shop query, must match queryShops
+	sqliteShopColumns = `s.shop_id, s.name, s.type, coalesce(s.address, ''), coalesce(s.url, ''),
+	coalesce(s.lat, 0), coalesce(s.long, 0), s.district, coalesce(s.notes, ''), coalesce(s.search_text, ''), s.status,
+	s.status_since, s.status_until, coalesce(s.moved_to, 0), coalesce(s.hours, '')`
+
+	//Condition excluding shops with hiddenStatus
+	sqliteNotHidden = `s.status NOT IN ('` + StatusClosed + `', '` + StatusMoved + `')`
+	//Condition of ShopsWithKeyword, taking FTS5 query and the keywords
+	sqliteKeywordMatch = `(s.shop_id IN (SELECT rowid FROM shops_fts WHERE shops_fts MATCH ?) OR s.name LIKE '%'||?||'%')
+		and (s.address IS NOT NULL OR s.url IS NOT NULL) and ` + sqliteNotHidden
+
+	//No. of shops returned by ShopsWithKeywordSortByDist
+	sqliteNearestLimit = 30
+	//Half side in metres of the first box searched for nearest shops, doubled
+	//until enough shops match
+	sqliteNearestStart = 1000
+)
+
+//SQLiteBackend is a single file data backend powered by SQLite with FTS5 for
+//keyword search and R*Tree for spatial search
+type SQLiteBackend struct {
+	db *sql.DB
+}
+
+//NewSQLiteBackend opens (or creates) the SQLite database at path
+func NewSQLiteBackend(path string) (*SQLiteBackend, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open database file %w", err)
+	}
+	b := &SQLiteBackend{db}
+	err = b.CreateTable(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Cannot create tables %w", err)
+	}
+	return b, nil
+}
+
+//CreateTable create necessary tables and indexes if they do not exist
+func (sl *SQLiteBackend) CreateTable(ctx context.Context) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS shops (
+			shop_id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			address TEXT,
+			lat REAL,
+			long REAL,
+			type TEXT NOT NULL,
+			url TEXT,
+			district TEXT,
+			search_text TEXT,
+			notes TEXT,
+			status TEXT NOT NULL DEFAULT '',
+			status_since INTEGER,
+			status_until INTEGER,
+			moved_to INTEGER,
+			hours TEXT
+		)`,
+		`CREATE VIRTUAL TABLE IF NOT EXISTS shops_fts USING fts5(search_text, district, tokenize='unicode61')`,
+		`CREATE VIRTUAL TABLE IF NOT EXISTS shops_geo USING rtree(id, min_lat, max_lat, min_long, max_long)`,
+		`CREATE TABLE IF NOT EXISTS keyword (word TEXT NOT NULL PRIMARY KEY)`,
+		`CREATE TABLE IF NOT EXISTS submissions (
+			submission_id INTEGER PRIMARY KEY,
+			shop TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			user_name TEXT,
+			chat_id INTEGER NOT NULL,
+			created INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			reviewed_by INTEGER,
+			shop_id INTEGER
+		)`,
+		`CREATE TABLE IF NOT EXISTS reports (
+			report_id INTEGER PRIMARY KEY,
+			shop_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			text TEXT,
+			created INTEGER NOT NULL,
+			resolved_by INTEGER NOT NULL DEFAULT 0,
+			resolved INTEGER
+		)`,
+		`CREATE TABLE IF NOT EXISTS favourites (
+			user_id INTEGER NOT NULL,
+			shop_id INTEGER NOT NULL,
+			created INTEGER NOT NULL,
+			PRIMARY KEY (user_id, shop_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS user_data (
+			user_id INTEGER NOT NULL,
+			key TEXT NOT NULL,
+			value BLOB NOT NULL,
+			updated INTEGER NOT NULL,
+			PRIMARY KEY (user_id, key)
+		)`,
+	}
+	for i := range stmts {
+		_, err := sl.db.ExecContext(ctx, stmts[i])
+		if err != nil {
+			return err
+		}
+	}
+	//Columns missing in databases created by earlier versions
+	added := []string{"status_since INTEGER", "status_until INTEGER", "moved_to INTEGER", "hours TEXT"}
+	for i := range added {
+		_, err := sl.db.ExecContext(ctx, "ALTER TABLE shops ADD COLUMN "+added[i])
+		if err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			return err
+		}
+	}
+	return nil
+}
+
+//ImportShops inserts or replaces full shop records, including tags
+func (sl *SQLiteBackend) ImportShops(ctx context.Context, shops []Shop) error {
+	tx, err := sl.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i := range shops {
+		err = sqliteWriteShop(ctx, tx, shops[i])
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func sqliteWriteShop(ctx context.Context, tx *sql.Tx, shop Shop) error {
+	var lat, long sql.NullFloat64
+	if shop.HasPhyLoc() {
+		lat.Float64, long.Float64 = shop.ToCoord()
+		lat.Valid, long.Valid = true, true
+	}
+	searchText := strings.Join(shop.Tags, " ")
+	_, err := tx.ExecContext(ctx,
+		`INSERT OR REPLACE INTO shops(shop_id, name, address, lat, long, type, url, district, search_text, notes, status,
+		status_since, status_until, moved_to, hours)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		shop.ID, shop.Name, sqliteNullString(shop.Address), lat, long, shop.Type, sqliteNullString(shop.URL),
+		shop.District, searchText, shop.Notes, shop.Status, sqliteUnix(shop.StatusSince),
+		sqliteUnix(shop.StatusUntil), sql.NullInt64{Int64: int64(shop.MovedTo), Valid: shop.MovedTo != 0},
+		sqliteNullString(hoursText(shop.Hours)))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM shops_fts WHERE rowid = ?", shop.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO shops_fts(rowid, search_text, district) VALUES (?, ?, ?)",
+		shop.ID, searchText, shop.District)
+	if err != nil {
+		return err
+	}
+	return sqliteWriteGeo(ctx, tx, shop.ID, lat, long)
+}
+
+//sqliteNullString converts empty string to NULL
+func sqliteNullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+//sqliteUnix stores time as unix seconds, zero time as NULL
+func sqliteUnix(t time.Time) sql.NullInt64 {
+	return sql.NullInt64{Int64: t.Unix(), Valid: !t.IsZero()}
+}
+
+//fromSQLiteUnix converts unix seconds back to time, NULL to zero time
+func fromSQLiteUnix(t sql.NullInt64) time.Time {
+	if !t.Valid {
+		return time.Time{}
+	}
+	return time.Unix(t.Int64, 0)
+}
+
+func sqliteWriteGeo(ctx context.Context, tx *sql.Tx, shopID int, lat, long sql.NullFloat64) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM shops_geo WHERE id = ?", shopID)
+	if err != nil || !lat.Valid {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO shops_geo VALUES (?, ?, ?, ?, ?)",
+		shopID, lat.Float64, lat.Float64, long.Float64, long.Float64)
+	return err
+}
+
+//sqliteQuerier is either the database or a transaction
+type sqliteQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (sl *SQLiteBackend) queryShops(ctx context.Context, query string, args ...interface{}) ([]Shop, error) {
+	return sqliteQueryShops(ctx, sl.db, query, args...)
+}
+
+//sqliteQueryShops runs query selecting sqliteShopColumns
+func sqliteQueryShops(ctx context.Context, q sqliteQuerier, query string, args ...interface{}) ([]Shop, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	shoplist := make([]Shop, 0)
+	for rows.Next() {
+		shop := Shop{}
+		var searchText string
+		var since, until sql.NullInt64
+		var hours string
+		err := rows.Scan(&shop.ID, &shop.Name, &shop.Type, &shop.Address, &shop.URL,
+			&shop.Position.Lat, &shop.Position.Long, &shop.District, &shop.Notes, &searchText, &shop.Status,
+			&since, &until, &shop.MovedTo, &hours)
+		if err != nil {
+			return nil, err
+		}
+		shop.Tags = strings.Fields(searchText)
+		shop.StatusSince, shop.StatusUntil = fromSQLiteUnix(since), fromSQLiteUnix(until)
+		shop.Hours = storedHours(hours)
+		shoplist = append(shoplist, shop)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return shoplist, nil
+}
+
+//ShopMissingInfo get data with missing info
+func (sl *SQLiteBackend) ShopMissingInfo(ctx context.Context) ([]Shop, error) {
+	return sl.queryShops(ctx,
+		`SELECT `+sqliteShopColumns+` FROM shops s WHERE s.lat IS NULL and s.district <> ? and `+sqliteNotHidden,
+		nonPhyStore)
+}
+
+//UpdateShopInfo fill missing info into shops
+func (sl *SQLiteBackend) UpdateShopInfo(ctx context.Context, shops []Shop) error {
+	tx, err := sl.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var rowsAffected int64 = 0
+	for _, shop := range shops {
+		var lat, long sql.NullFloat64
+		if shop.HasPhyLoc() {
+			lat.Float64, long.Float64 = shop.ToCoord()
+			lat.Valid, long.Valid = true, true
+		}
+		res, err := tx.ExecContext(ctx,
+			"UPDATE shops SET address = ?, lat = ?, long = ? WHERE shop_id = ?",
+			shop.Address, lat, long, shop.ID)
+		if err != nil {
+			log.WithError(err).Error("Update shop info error")
+			return err
+		}
+		n, _ := res.RowsAffected()
+		rowsAffected += n
+		err = sqliteWriteGeo(ctx, tx, shop.ID, lat, long)
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	log.WithField("rowsAffected", rowsAffected).Info("Shop info updated")
+	return nil
+}
+
+//NearestShops returns shops within distance, sorted by distance
+func (sl *SQLiteBackend) NearestShops(ctx context.Context, lat, long float64, distance string, includeClosed bool) ([]Shop, error) {
+	d, err := disToInt(distance)
+	if err != nil {
+		return nil, err
+	}
+	//Exact distance is filtered from the bounding box
+	shops, err := sl.queryShops(ctx,
+		`SELECT `+sqliteShopColumns+` FROM shops s JOIN shops_geo g ON s.shop_id = g.id
+		WHERE `+sqliteInBox+` and (? OR `+sqliteNotHidden+`)`,
+		append(sqliteBox(lat, long, d), includeClosed)...)
+	if err != nil {
+		return nil, err
+	}
+	return withinSorted(shops, lat, long, d), nil
+}
+
+//sqliteInBox is the condition of shops_geo g within box of sqliteBox
+const sqliteInBox = `g.min_lat >= ? AND g.max_lat <= ? AND g.min_long >= ? AND g.max_long <= ?`
+
+//sqliteBox returns arguments of sqliteInBox for the bounding box of circle
+//of distance metres around (lat, long)
+func sqliteBox(lat, long float64, distance int) []interface{} {
+	dLat := float64(distance) / (earthRadius * math.Pi / 180)
+	dLong := dLat / math.Cos(lat*math.Pi/180)
+	return []interface{}{lat - dLat, lat + dLat, long - dLong, long + dLong}
+}
+
+//withinSorted returns shops within distance metres of (lat, long), nearest
+//first
+func withinSorted(shops []Shop, lat, long float64, distance int) []Shop {
+	SortByDistance(shops, lat, long)
+	shoplist := make([]Shop, 0, len(shops))
+	for i := range shops {
+		if shops[i].Distance <= distance {
+			shoplist = append(shoplist, shops[i])
+		}
+	}
+	return shoplist
+}
+
+//ShopsWithKeyword returns shops with tags provided
+func (sl *SQLiteBackend) ShopsWithKeyword(ctx context.Context, keywords string) ([]Shop, error) {
+	//FTS5 rejects an empty MATCH
+	if noKeyword(keywords) {
+		return make([]Shop, 0), nil
+	}
+	return sl.queryShops(ctx,
+		`SELECT `+sqliteShopColumns+` FROM shops s WHERE `+sqliteKeywordMatch+` order by random()`,
+		ftsAllTerms(keywords), keywords)
+}
+
+//ShopsWithKeywordSortByDist returns shops with tags provided nearest to
+//(lat, long). The box searched in the R*Tree doubles until enough shops are
+//within it, shops without location are placed last
+func (sl *SQLiteBackend) ShopsWithKeywordSortByDist(ctx context.Context, keywords string, lat, long float64) ([]Shop, error) {
+	if noKeyword(keywords) {
+		return make([]Shop, 0), nil
+	}
+	var located int
+	err := sl.db.QueryRowContext(ctx,
+		`SELECT count(*) FROM shops s JOIN shops_geo g ON s.shop_id = g.id WHERE `+sqliteKeywordMatch,
+		ftsAllTerms(keywords), keywords).Scan(&located)
+	if err != nil {
+		return nil, err
+	}
+	//Box of half the circumference covers the whole Earth
+	maxDistance := int(math.Ceil(earthRadius * math.Pi))
+	d := sqliteNearestStart
+	if located <= sqliteNearestLimit {
+		d = maxDistance
+	}
+	var nearest []Shop
+	for ; ; d *= 2 {
+		if d > maxDistance {
+			d = maxDistance
+		}
+		args := append(sqliteBox(lat, long, d), ftsAllTerms(keywords), keywords)
+		shops, err := sl.queryShops(ctx,
+			`SELECT `+sqliteShopColumns+` FROM shops s JOIN shops_geo g ON s.shop_id = g.id
+			WHERE `+sqliteInBox+` and `+sqliteKeywordMatch,
+			args...)
+		if err != nil {
+			return nil, err
+		}
+		if len(shops) == located {
+			nearest = withinSorted(shops, lat, long, maxDistance)
+			break
+		}
+		//Shops in corners of the box may be farther than ones outside
+		nearest = withinSorted(shops, lat, long, d)
+		if len(nearest) >= sqliteNearestLimit {
+			break
+		}
+	}
+	if len(nearest) >= sqliteNearestLimit {
+		return nearest[:sqliteNearestLimit], nil
+	}
+	others, err := sl.queryShops(ctx,
+		`SELECT `+sqliteShopColumns+` FROM shops s
+		WHERE s.shop_id NOT IN (SELECT id FROM shops_geo) and `+sqliteKeywordMatch+` LIMIT ?`,
+		ftsAllTerms(keywords), keywords, sqliteNearestLimit-len(nearest))
+	if err != nil {
+		return nil, err
+	}
+	return append(nearest, others...), nil
+}
+
+//AdvQuery returns shops matching q, closed and moved shops are returned only
+//if includeClosed is set
+func (sl *SQLiteBackend) AdvQuery(ctx context.Context, q Query, includeClosed bool) ([]Shop, error) {
+	err := q.searchable()
+	if err != nil {
+		return nil, err
+	}
+	where, args := sqliteWhere(q)
+	return sl.queryShops(ctx,
+		`SELECT `+sqliteShopColumns+` FROM shops s
+		WHERE `+where+` and (? OR `+sqliteNotHidden+`)
+		order by random()`,
+		append(args, includeClosed)...)
+}
+
+//QueryFacets counts shops matching q by district and type
+func (sl *SQLiteBackend) QueryFacets(ctx context.Context, q Query, includeClosed bool) (Facets, error) {
+	err := q.searchable()
+	if err != nil {
+		return nil, err
+	}
+	where, args := sqliteWhere(q)
+	args = append(args, includeClosed)
+	result := make(Facets, len(FacetFields))
+	for _, field := range FacetFields {
+		col := "s." + facetColumns[field]
+		rows, err := sl.db.QueryContext(ctx,
+			`SELECT `+col+`, count(*) FROM shops s
+			WHERE `+where+` and (? OR `+sqliteNotHidden+`) and coalesce(`+col+`, '') <> ''
+			GROUP BY `+col, args...)
+		if err != nil {
+			return nil, err
+		}
+		facets := make([]Facet, 0)
+		for rows.Next() {
+			var f Facet
+			err = rows.Scan(&f.Value, &f.Count)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			facets = append(facets, f)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		result[field] = sortFacets(facets)
+	}
+	return result, nil
+}
+
+//sqliteWhere builds condition of q and its arguments. Words are matched by
+//full text search
+func sqliteWhere(q Query) (string, []interface{}) {
+	args := make([]interface{}, 0)
+	where := sqlWhere(q, func(t QueryTerm) string {
+		if t.Field != QueryAny {
+			args = append(args, t.Value)
+			return "s." + facetColumns[t.Field] + " = ?"
+		}
+		args = append(args, ftsQuote(t.Value))
+		return "s.shop_id IN (SELECT rowid FROM shops_fts WHERE shops_fts MATCH ?)"
+	})
+	return where, args
+}
+
+//ShopsWithStatus returns all shops with provided status
+func (sl *SQLiteBackend) ShopsWithStatus(ctx context.Context, status string) ([]Shop, error) {
+	return sl.queryShops(ctx, `SELECT `+sqliteShopColumns+` FROM shops s WHERE s.status = ?`, status)
+}
+
+//UpdateShopStatus saves status, its effective dates and new location of shops
+func (sl *SQLiteBackend) UpdateShopStatus(ctx context.Context, shops []Shop) error {
+	tx, err := sl.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, shop := range shops {
+		_, err := tx.ExecContext(ctx,
+			"UPDATE shops SET status = ?, status_since = ?, status_until = ?, moved_to = ? WHERE shop_id = ?",
+			shop.Status, sqliteUnix(shop.StatusSince), sqliteUnix(shop.StatusUntil),
+			sql.NullInt64{Int64: int64(shop.MovedTo), Valid: shop.MovedTo != 0}, shop.ID)
+		if err != nil {
+			log.WithError(err).Error("Update shop status error")
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+//sqliteCheckDuplicate returns *ConflictError if another open shop has the
+//same name and address
+func sqliteCheckDuplicate(ctx context.Context, tx *sql.Tx, shop Shop) error {
+	candidates, err := sqliteQueryShops(ctx, tx,
+		`SELECT `+sqliteShopColumns+` FROM shops s WHERE s.name = ? AND s.shop_id <> ? AND `+sqliteNotHidden,
+		shop.Name, shop.ID)
+	if err != nil {
+		return err
+	}
+	return duplicateOf(shop, candidates)
+}
+
+//CreateShop validates and saves a new shop. ID is assigned if shop.ID is 0
+func (sl *SQLiteBackend) CreateShop(ctx context.Context, shop Shop) (Shop, error) {
+	err := shop.Validate()
+	if err != nil {
+		return Shop{}, err
+	}
+	tx, err := sl.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Shop{}, err
+	}
+	defer tx.Rollback()
+	err = sqliteCheckDuplicate(ctx, tx, shop)
+	if err != nil {
+		return Shop{}, err
+	}
+	if shop.ID == 0 {
+		err = tx.QueryRowContext(ctx, "SELECT coalesce(max(shop_id), 0) + 1 FROM shops").Scan(&shop.ID)
+	} else {
+		var cnt int
+		err = tx.QueryRowContext(ctx, "SELECT count(*) FROM shops WHERE shop_id = ?", shop.ID).Scan(&cnt)
+		if err == nil && cnt > 0 {
+			err = idTaken(shop.ID)
+		}
+	}
+	if err != nil {
+		return Shop{}, err
+	}
+	err = sqliteWriteShop(ctx, tx, shop)
+	if err != nil {
+		log.WithError(err).Error("Create shop error")
+		return Shop{}, err
+	}
+	return shop, tx.Commit()
+}
+
+//UpdateShop saves fields of shop, other fields are kept
+func (sl *SQLiteBackend) UpdateShop(ctx context.Context, shop Shop, fields ShopField) error {
+	tx, err := sl.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	current, err := sqliteQueryShops(ctx, tx, `SELECT `+sqliteShopColumns+` FROM shops s WHERE s.shop_id = ?`, shop.ID)
+	if err != nil {
+		return err
+	}
+	if len(current) == 0 {
+		return shopNotFound(shop.ID)
+	}
+	updated := applyFields(current[0], shop, fields)
+	err = updated.Validate()
+	if err != nil {
+		return err
+	}
+	err = sqliteCheckDuplicate(ctx, tx, updated)
+	if err != nil {
+		return err
+	}
+	err = sqliteWriteShop(ctx, tx, updated)
+	if err != nil {
+		log.WithError(err).Error("Update shop error")
+		return err
+	}
+	return tx.Commit()
+}
+
+//DeleteShop removes shop permanently, ArchiveShop keeps the record instead
+func (sl *SQLiteBackend) DeleteShop(ctx context.Context, shopID int) error {
+	tx, err := sl.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "DELETE FROM shops WHERE shop_id = ?", shopID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return shopNotFound(shopID)
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM shops_fts WHERE rowid = ?", shopID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM shops_geo WHERE id = ?", shopID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//ArchiveShop marks shop closed since at, so it is hidden from searches
+func (sl *SQLiteBackend) ArchiveShop(ctx context.Context, shopID int, at time.Time) error {
+	res, err := sl.db.ExecContext(ctx,
+		"UPDATE shops SET status = ?, status_since = ?, status_until = NULL WHERE shop_id = ?",
+		StatusClosed, sqliteUnix(at), shopID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return shopNotFound(shopID)
+	}
+	return nil
+}
+
+//ShopCount returns the number of shops stored in system
+func (sl *SQLiteBackend) ShopCount(ctx context.Context) (int, error) {
+	var cnt int
+	err := sl.db.QueryRowContext(ctx, "SELECT count(*) FROM shops").Scan(&cnt)
+	if err != nil {
+		return -1, err
+	}
+	return cnt, nil
+}
+
+//ShopByID returns shop by internal ID
+func (sl *SQLiteBackend) ShopByID(ctx context.Context, shopID int) (Shop, error) {
+	shops, err := sl.queryShops(ctx, `SELECT `+sqliteShopColumns+` FROM shops s WHERE s.shop_id = ?`, shopID)
+	if err != nil {
+		return Shop{}, err
+	}
+	if len(shops) == 0 {
+		return Shop{}, shopNotFound(shopID)
+	}
+	return shops[0], nil
+}
+
+//AllShops returns all records from the database
+func (sl *SQLiteBackend) AllShops(ctx context.Context) ([]Shop, error) {
+	return sl.queryShops(ctx, `SELECT `+sqliteShopColumns+` FROM shops s`)
+}
+
+//UpdateTags set keywords for searching for the shops
+func (sl *SQLiteBackend) UpdateTags(ctx context.Context) (int, error) {
+	tx, err := sl.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "UPDATE shops SET search_text = type WHERE coalesce(TRIM(search_text), '') = ''")
+	if err != nil {
+		return -1, err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM shops_fts")
+	if err != nil {
+		return -1, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO shops_fts(rowid, search_text, district) SELECT shop_id, search_text, district FROM shops")
+	if err != nil {
+		return -1, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), tx.Commit()
+}
+
+//RefreshKeywords flush existing keywords saved in table keyword and select new ones from shops.search_text
+func (sl *SQLiteBackend) RefreshKeywords(ctx context.Context) (int, error) {
+	rows, err := sl.db.QueryContext(ctx, "SELECT coalesce(search_text, '') FROM shops")
+	if err != nil {
+		return -1, err
+	}
+	words := make(map[string]struct{})
+	for rows.Next() {
+		var searchText string
+		err = rows.Scan(&searchText)
+		if err != nil {
+			rows.Close()
+			return -1, err
+		}
+		for _, w := range strings.Fields(searchText) {
+			words[w] = struct{}{}
+		}
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return -1, rows.Err()
+	}
+
+	tx, err := sl.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "DELETE FROM keyword")
+	if err != nil {
+		return -1, err
+	}
+	for w := range words {
+		_, err = tx.ExecContext(ctx, "INSERT INTO keyword(word) VALUES (?)", w)
+		if err != nil {
+			return -1, err
+		}
+	}
+	return len(words), tx.Commit()
+}
+
+//SuggestKeyword will take provided keyword to look into the keyword db and search
+//with edit distance <= len(key) - 1
+func (sl *SQLiteBackend) SuggestKeyword(ctx context.Context, key string) ([]string, error) {
+	rows, err := sl.db.QueryContext(ctx, "SELECT word FROM keyword")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	t := utf8.RuneCountInString(key)
+	suggestList := make([]string, 0)
+	for rows.Next() {
+		k := ""
+		err := rows.Scan(&k)
+		if err != nil {
+			return nil, err
+		}
+		if t == 1 && strings.Contains(k, key) || t > 1 && editDistance(key, k) <= t-1 {
+			suggestList = append(suggestList, k)
+		}
+	}
+	return suggestList, rows.Err()
+}
+
+//Districts returns all districts
+func (sl *SQLiteBackend) Districts(ctx context.Context) ([]string, error) {
+	rows, err := sl.db.QueryContext(ctx, "SELECT DISTINCT district FROM shops")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	districts := make([]string, 0)
+	for rows.Next() {
+		k := ""
+		err := rows.Scan(&k)
+		if err != nil {
+			return nil, err
+		}
+		districts = append(districts, k)
+	}
+	return districts, rows.Err()
+}
+
+//Columns selected for every submission query, must match querySubmissions
+const sqliteSubmissionColumns = `submission_id, shop, user_id, coalesce(user_name, ''), chat_id, created, status,
+	coalesce(reviewed_by, 0), coalesce(shop_id, 0)`
+
+func (sl *SQLiteBackend) querySubmissions(ctx context.Context, query string, args ...interface{}) ([]Submission, error) {
+	rows, err := sl.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	subs := make([]Submission, 0)
+	for rows.Next() {
+		sub := Submission{}
+		var shop string
+		var created int64
+		err := rows.Scan(&sub.ID, &shop, &sub.UserID, &sub.UserName, &sub.ChatID, &created, &sub.Status,
+			&sub.ReviewedBy, &sub.ShopID)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal([]byte(shop), &sub.Shop)
+		if err != nil {
+			return nil, err
+		}
+		sub.Created = time.Unix(created, 0)
+		subs = append(subs, sub)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return subs, nil
+}
+
+//AddSubmission saves a new submission with ID assigned
+func (sl *SQLiteBackend) AddSubmission(ctx context.Context, sub Submission) (Submission, error) {
+	shop, err := json.Marshal(sub.Shop)
+	if err != nil {
+		return Submission{}, err
+	}
+	res, err := sl.db.ExecContext(ctx,
+		`INSERT INTO submissions(shop, user_id, user_name, chat_id, created, status, reviewed_by, shop_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		string(shop), sub.UserID, sqliteNullString(sub.UserName), sub.ChatID, sub.Created.Unix(), sub.Status,
+		sub.ReviewedBy, sub.ShopID)
+	if err != nil {
+		return Submission{}, err
+	}
+	id, err := res.LastInsertId()
+	sub.ID = int(id)
+	return sub, err
+}
+
+//SubmissionByID returns submission by internal ID
+func (sl *SQLiteBackend) SubmissionByID(ctx context.Context, id int) (Submission, error) {
+	subs, err := sl.querySubmissions(ctx, `SELECT `+sqliteSubmissionColumns+` FROM submissions WHERE submission_id = ?`, id)
+	if err != nil {
+		return Submission{}, err
+	}
+	if len(subs) == 0 {
+		return Submission{}, submissionNotFound(id)
+	}
+	return subs[0], nil
+}
+
+//PendingSubmissions returns submissions waiting for review, oldest first
+func (sl *SQLiteBackend) PendingSubmissions(ctx context.Context) ([]Submission, error) {
+	return sl.querySubmissions(ctx,
+		`SELECT `+sqliteSubmissionColumns+` FROM submissions WHERE status = ? ORDER BY submission_id`, SubmissionPending)
+}
+
+//UpdateSubmission saves changes to submission
+func (sl *SQLiteBackend) UpdateSubmission(ctx context.Context, sub Submission) error {
+	shop, err := json.Marshal(sub.Shop)
+	if err != nil {
+		return err
+	}
+	res, err := sl.db.ExecContext(ctx,
+		`UPDATE submissions SET shop = ?, status = ?, reviewed_by = ?, shop_id = ? WHERE submission_id = ?`,
+		string(shop), sub.Status, sub.ReviewedBy, sub.ShopID, sub.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return submissionNotFound(sub.ID)
+	}
+	return nil
+}
+
+//AddReport saves a new report with ID assigned
+func (sl *SQLiteBackend) AddReport(ctx context.Context, rep Report) (Report, error) {
+	tx, err := sl.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Report{}, err
+	}
+	defer tx.Rollback()
+	var id int
+	err = tx.QueryRowContext(ctx,
+		"SELECT report_id FROM reports WHERE shop_id = ? AND user_id = ? AND kind = ? AND resolved_by = 0",
+		rep.ShopID, rep.UserID, rep.Kind).Scan(&id)
+	if err == nil {
+		rep.ID = id
+		return rep, ErrDuplicateReport
+	} else if err != sql.ErrNoRows {
+		return Report{}, err
+	}
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO reports(shop_id, user_id, kind, text, created) VALUES (?, ?, ?, ?, ?)",
+		rep.ShopID, rep.UserID, rep.Kind, sqliteNullString(rep.Text), rep.Created.Unix())
+	if err != nil {
+		return Report{}, err
+	}
+	id64, err := res.LastInsertId()
+	if err != nil {
+		return Report{}, err
+	}
+	rep.ID = int(id64)
+	return rep, tx.Commit()
+}
+
+//OpenReports returns reports not yet resolved, oldest first
+func (sl *SQLiteBackend) OpenReports(ctx context.Context) ([]Report, error) {
+	rows, err := sl.db.QueryContext(ctx,
+		`SELECT report_id, shop_id, user_id, kind, coalesce(text, ''), created FROM reports
+		WHERE resolved_by = 0 ORDER BY report_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reps := make([]Report, 0)
+	for rows.Next() {
+		rep := Report{}
+		var created int64
+		err := rows.Scan(&rep.ID, &rep.ShopID, &rep.UserID, &rep.Kind, &rep.Text, &created)
+		if err != nil {
+			return nil, err
+		}
+		rep.Created = time.Unix(created, 0)
+		reps = append(reps, rep)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return reps, nil
+}
+
+//ResolveReports resolves all open reports of shop, returning the number of
+//reports resolved
+func (sl *SQLiteBackend) ResolveReports(ctx context.Context, shopID, by int, at time.Time) (int, error) {
+	res, err := sl.db.ExecContext(ctx,
+		"UPDATE reports SET resolved_by = ?, resolved = ? WHERE shop_id = ? AND resolved_by = 0",
+		by, at.Unix(), shopID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+//AddFavourite marks shop as favourite of user
+func (sl *SQLiteBackend) AddFavourite(ctx context.Context, userID, shopID int) error {
+	_, err := sl.db.ExecContext(ctx,
+		"INSERT OR IGNORE INTO favourites(user_id, shop_id, created) VALUES (?, ?, ?)",
+		userID, shopID, time.Now().Unix())
+	return err
+}
+
+//RemoveFavourite unmarks favourite shop of user
+func (sl *SQLiteBackend) RemoveFavourite(ctx context.Context, userID, shopID int) error {
+	_, err := sl.db.ExecContext(ctx, "DELETE FROM favourites WHERE user_id = ? AND shop_id = ?", userID, shopID)
+	return err
+}
+
+//IsFavourite checks if shop is favourite of user
+func (sl *SQLiteBackend) IsFavourite(ctx context.Context, userID, shopID int) (bool, error) {
+	var cnt int
+	err := sl.db.QueryRowContext(ctx, "SELECT count(*) FROM favourites WHERE user_id = ? AND shop_id = ?",
+		userID, shopID).Scan(&cnt)
+	return cnt > 0, err
+}
+
+//Favourites returns favourite shops of user, latest marked first
+func (sl *SQLiteBackend) Favourites(ctx context.Context, userID int) ([]Shop, error) {
+	return sl.queryShops(ctx, `SELECT `+sqliteShopColumns+` FROM shops s
+	JOIN favourites f ON f.shop_id = s.shop_id WHERE f.user_id = ? ORDER BY f.rowid DESC`, userID)
+}
+
+//UserData returns value saved under key, nil if not found
+func (sl *SQLiteBackend) UserData(ctx context.Context, userID int, key string) ([]byte, error) {
+	var value []byte
+	err := sl.db.QueryRowContext(ctx, "SELECT value FROM user_data WHERE user_id = ? AND key = ?",
+		userID, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return value, err
+}
+
+//SetUserData saves value under key
+func (sl *SQLiteBackend) SetUserData(ctx context.Context, userID int, key string, value []byte) error {
+	_, err := sl.db.ExecContext(ctx, `INSERT INTO user_data(user_id, key, value, updated) VALUES (?, ?, ?, ?)
+	ON CONFLICT (user_id, key) DO UPDATE SET value = excluded.value, updated = excluded.updated`,
+		userID, key, value, time.Now().Unix())
+	return err
+}
+
+//DeleteUserData removes value under key
+func (sl *SQLiteBackend) DeleteUserData(ctx context.Context, userID int, key string) error {
+	_, err := sl.db.ExecContext(ctx, "DELETE FROM user_data WHERE user_id = ? AND key = ?", userID, key)
+	return err
+}
+
+//PurgeUserData removes values under keys beginning with prefix saved before
+//cutoff
+func (sl *SQLiteBackend) PurgeUserData(ctx context.Context, userID int, prefix string, cutoff time.Time) (int, error) {
+	//substr instead of LIKE, prefix may contain % or _
+	res, err := sl.db.ExecContext(ctx, `DELETE FROM user_data
+	WHERE user_id = ? AND substr(key, 1, length(?)) = ? AND updated < ?`,
+		userID, prefix, prefix, cutoff.Unix())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+//Close closes the database file
+func (sl *SQLiteBackend) Close() {
+	sl.db.Close()
+}
+
+//ftsQuote quotes a single term as FTS5 string
+func ftsQuote(term string) string {
+	return `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+}
+
+//ftsAllTerms builds FTS5 query matching all space separated words
+func ftsAllTerms(keywords string) string {
+	words := strings.Fields(keywords)
+	for i := range words {
+		words[i] = ftsQuote(words[i])
+	}
+	return strings.Join(words, " AND ")
+}
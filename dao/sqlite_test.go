@@ -0,0 +1,180 @@
+package dao
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func prepareSQLite(t *testing.T) *SQLiteBackend {
+	db, err := NewSQLiteBackend(filepath.Join(t.TempDir(), "wongdim.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shops := []Shop{
+		{ID: 1, Name: "水門泰式雞飯專門店", Address: "深水埗欽州街37號西九龍中心8樓55號鋪", Type: "泰國菜",
+			District: "深水埗", Position: Coord{22.330441, 114.160049}, Tags: []string{"泰國菜", "深水埗"}},
+		{ID: 2, Name: "留白", Address: "荃灣荃昌中心昌寧商場地下12號舖", Type: "咖啡",
+			District: "荃灣", Position: Coord{22.371154, 114.112603}, Tags: []string{"荃灣", "咖啡"}},
+		{ID: 4, Name: "白宮咖啡廳", Address: "荃灣享和街24號", Type: "咖啡",
+			District: "荃灣", Position: Coord{22.372500, 114.114300}, Tags: []string{"咖啡", "荃灣"}},
+		{ID: 9, Name: "侘寂珈琲 WabiSabi", Address: "觀塘觀塘道396號毅力工業中心4樓C室", Type: "咖啡",
+			District: "觀塘", Position: Coord{22.312300, 114.221800}, Tags: []string{"咖啡", "觀塘"}},
+		{ID: 11, Name: "無名網店", URL: "https://example.com", Type: "咖啡", District: nonPhyStore,
+			Tags: []string{"咖啡", "網店"}},
+	}
+	err = db.ImportShops(context.Background(), shops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSQLiteKeyword(t *testing.T) {
+	db := prepareSQLite(t)
+	defer db.Close()
+	shops, err := db.ShopsWithKeyword(context.Background(), "荃灣 咖啡")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 2 {
+		t.Fatalf("Size expected: 2, actual %d", len(shops))
+	}
+	shops, err = db.ShopsWithKeyword(context.Background(), "留白")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 1 || shops[0].ID != 2 {
+		t.Errorf("Result expected: {2}, actual %v", shops)
+	}
+}
+
+func TestSQLiteNearestShops(t *testing.T) {
+	db := prepareSQLite(t)
+	defer db.Close()
+	shops, err := db.NearestShops(context.Background(), 22.371154, 114.112603, "500m", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 2 {
+		t.Fatalf("Size expected: 2, actual %d", len(shops))
+	}
+	if shops[0].ID != 2 || shops[1].ID != 4 {
+		t.Errorf("Result expected: {2,4}, actual {%d,%d}", shops[0].ID, shops[1].ID)
+	}
+	if shops[0].Distance != 0 || shops[1].Distance <= 0 || shops[1].Distance > 500 {
+		t.Errorf("Unexpected distance {%d,%d}", shops[0].Distance, shops[1].Distance)
+	}
+}
+
+func TestSQLiteSortByDist(t *testing.T) {
+	db := prepareSQLite(t)
+	defer db.Close()
+	shops, err := db.ShopsWithKeywordSortByDist(context.Background(), "咖啡", 22.312300, 114.221800)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 4 {
+		t.Fatalf("Size expected: 4, actual %d", len(shops))
+	}
+	if shops[0].ID != 9 || shops[3].ID != 11 {
+		t.Errorf("Result expected: {9,...,11}, actual {%d,...,%d}", shops[0].ID, shops[3].ID)
+	}
+}
+
+func TestSQLiteSortByDistNearest(t *testing.T) {
+	db := prepareSQLite(t)
+	defer db.Close()
+	//Shops about 1km apart, farther than the first box searched
+	shops := []Shop{{ID: 200, Name: "網上麵包", URL: "https://example.com/bread", Type: "麵包",
+		District: nonPhyStore, Tags: []string{"麵包"}}}
+	for i := 0; i < 40; i++ {
+		shops = append(shops, Shop{ID: 100 + i, Name: "麵包店", Address: "旺角", Type: "麵包", District: "旺角",
+			Position: Coord{22.3193, 114.1694 + 0.01*float64(i+1)}, Tags: []string{"麵包"}})
+	}
+	err := db.ImportShops(context.Background(), shops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shops, err = db.ShopsWithKeywordSortByDist(context.Background(), "麵包", 22.3193, 114.1694)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 30 {
+		t.Fatalf("Size expected: 30, actual %d", len(shops))
+	}
+	for i := range shops {
+		if shops[i].ID != 100+i {
+			t.Errorf("Shop %d expected: %d, actual %d", i, 100+i, shops[i].ID)
+		}
+	}
+}
+
+func TestSQLiteAdvQuery(t *testing.T) {
+	db := prepareSQLite(t)
+	defer db.Close()
+	shops, err := db.AdvQuery(context.Background(), mustParseQuery(t, "咖啡 -荃灣"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 2 {
+		t.Fatalf("Size expected: 2, actual %d", len(shops))
+	}
+	shops, err = db.AdvQuery(context.Background(), mustParseQuery(t, "泰國菜 or 觀塘"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 2 {
+		t.Fatalf("Size expected: 2, actual %d", len(shops))
+	}
+	_, err = db.AdvQuery(context.Background(), Query{Not: []QueryTerm{{Value: "咖啡"}}}, false)
+	if err == nil {
+		t.Error("Expected error for negative only query")
+	}
+}
+
+func TestSQLiteSuggestKeyword(t *testing.T) {
+	db := prepareSQLite(t)
+	defer db.Close()
+	_, err := db.RefreshKeywords(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := db.SuggestKeyword(context.Background(), "珈啡")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != 1 || s[0] != "咖啡" {
+		t.Errorf("Expected: [咖啡], actual: %v", s)
+	}
+}
+
+func TestSQLiteUpdateShopInfo(t *testing.T) {
+	db := prepareSQLite(t)
+	defer db.Close()
+	ctx := context.Background()
+	err := db.ImportShops(ctx, []Shop{{ID: 12, Name: "新店", Type: "拉麵", District: "旺角", Tags: []string{"拉麵"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, err := db.ShopMissingInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 || missing[0].ID != 12 {
+		t.Fatalf("Result expected: {12}, actual %v", missing)
+	}
+	missing[0].Address = "旺角彌敦道1號"
+	missing[0].Position = Coord{22.319300, 114.169400}
+	err = db.UpdateShopInfo(ctx, missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shops, err := db.NearestShops(ctx, 22.319300, 114.169400, "70m", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 1 || shops[0].Address != "旺角彌敦道1號" {
+		t.Errorf("Result expected: {12}, actual %v", shops)
+	}
+}
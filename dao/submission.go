@@ -0,0 +1,47 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//Submission status values
+const (
+	//SubmissionPending is waiting for admin review
+	SubmissionPending = "P"
+	//SubmissionApproved is written to backend as a shop
+	SubmissionApproved = "A"
+	//SubmissionRejected is dropped by admin
+	SubmissionRejected = "R"
+)
+
+//ErrSubmissionNotFound is returned when the submission requested does not exist
+var ErrSubmissionNotFound = errors.New("not found")
+
+//Submission is a new shop proposed by user, waiting for admin review
+type Submission struct {
+	ID         int       //Internal ID
+	Shop       Shop      //Proposed shop, ID is not used
+	UserID     int       //Telegram user ID of submitter
+	UserName   string    //Telegram user name of submitter
+	ChatID     int64     //Chat notified of the review result
+	Created    time.Time //When the submission was made
+	Status     string    //One of the Submission* constants
+	ReviewedBy int       //Telegram user ID of reviewing admin, 0 if pending
+	ShopID     int       //ID of shop created on approval
+}
+
+//SubmissionStore are datasources keeping submissions for review
+type SubmissionStore interface {
+	AddSubmission(ctx context.Context, sub Submission) (Submission, error)
+	SubmissionByID(ctx context.Context, id int) (Submission, error)
+	PendingSubmissions(ctx context.Context) ([]Submission, error)
+	UpdateSubmission(ctx context.Context, sub Submission) error
+}
+
+//submissionNotFound wraps ErrSubmissionNotFound with the submission ID
+func submissionNotFound(id int) error {
+	return fmt.Errorf("Submission %d %w", id, ErrSubmissionNotFound)
+}
@@ -1,7 +1,9 @@
 package dao
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	ghash "github.com/mmcloughlin/geohash"
 )
@@ -9,9 +11,32 @@ import (
 const (
 	//Type for non-physical (network) store
 	nonPhyStore = "網店"
-	closedStore = "C"
 )
 
+//Shop status values
+const (
+	//StatusOpen is a shop in normal operation
+	StatusOpen = ""
+	//StatusTempClosed is a shop closed until StatusUntil, or until further
+	//notice if StatusUntil is zero
+	StatusTempClosed = "T"
+	//StatusClosed is a shop closed for good
+	StatusClosed = "C"
+	//StatusMoved is a shop relocated, to shop MovedTo if known
+	StatusMoved = "M"
+)
+
+//hiddenStatus are statuses excluded from searches
+var hiddenStatus = []string{StatusClosed, StatusMoved}
+
+//excludedStatus returns statuses excluded from a search
+func excludedStatus(includeClosed bool) []string {
+	if includeClosed {
+		return []string{}
+	}
+	return hiddenStatus
+}
+
 //Shop is a struct for storing shop info
 type Shop struct {
 	ID       int      //Internal ID
@@ -25,6 +50,13 @@ type Shop struct {
 	Tags     []string //Tags used
 	Notes    string   //Notes for the shop
 	Distance int      //Distance in metres
+
+	Status      string    //Shop status, one of the Status* constants
+	StatusSince time.Time //When the status took effect, zero if unknown
+	StatusUntil time.Time //When temporary closure ends, zero if unknown
+	MovedTo     int       //ID of the shop at new location, 0 if unknown
+
+	Hours *OpeningHours //Opening hours, nil if unknown
 }
 
 //Coord represents a point on Earth
@@ -62,36 +94,74 @@ func (s Shop) ToCoord() (lat, long float64) {
 	return 0, 0
 }
 
+//IsClosed returns true if the shop is closed or moved and should not be
+//returned in searches
+func (s Shop) IsClosed() bool {
+	return s.Status == StatusClosed || s.Status == StatusMoved
+}
+
+//StatusAt returns the status of shop at time t. Temporary closure ended
+//before t counts as open even if it is not yet updated in the backend
+func (s Shop) StatusAt(t time.Time) string {
+	if s.Status == StatusTempClosed && !s.StatusUntil.IsZero() && !t.Before(s.StatusUntil) {
+		return StatusOpen
+	}
+	return s.Status
+}
+
+//OpenAt returns true if the shop is known to be open at time t
+func (s Shop) OpenAt(t time.Time, hol Holidays) bool {
+	return s.Hours != nil && s.StatusAt(t) == StatusOpen && s.Hours.IsOpen(t, hol)
+}
+
 //HasPhyLoc returns true if the shop has a physical location, i.e. either Geohash or coordinates
 func (s Shop) HasPhyLoc() bool {
 	return s.Geohash != "" || s.Position != (Coord{})
 }
 
 //Backend represents an adstract data backend, which can have different
-//implementation underlying
+//implementation underlying. All methods accept a context so callers can
+//abort long-running queries. Writes return *ValidationError for invalid
+//shops, *ConflictError on clashes and ErrShopNotFound for missing shops
 type Backend interface {
-	AdvQuery(query string) ([]Shop, error)
-	ShopsWithKeyword(keywords string) ([]Shop, error)
-	ShopCount() (int, error)
-	ShopByID(shopID int) (Shop, error)
-	UpdateShopInfo(shops []Shop) error
-	NearestShops(lat, long float64, distance string) ([]Shop, error)
-	ShopMissingInfo() ([]Shop, error)
-	SuggestKeyword(key string) ([]string, error)
-	Districts() ([]string, error)
-	ShopsWithKeywordSortByDist(keywords string, lat, long float64) ([]Shop, error)
+	AdvQuery(ctx context.Context, q Query, includeClosed bool) ([]Shop, error)
+	QueryFacets(ctx context.Context, q Query, includeClosed bool) (Facets, error)
+	ShopsWithKeyword(ctx context.Context, keywords string) ([]Shop, error)
+	ShopCount(ctx context.Context) (int, error)
+	ShopByID(ctx context.Context, shopID int) (Shop, error)
+	UpdateShopInfo(ctx context.Context, shops []Shop) error
+	//NearestShops returns shops within distance, nearest first. Closed and
+	//moved shops are returned only if includeClosed is set
+	NearestShops(ctx context.Context, lat, long float64, distance string, includeClosed bool) ([]Shop, error)
+	ShopMissingInfo(ctx context.Context) ([]Shop, error)
+	SuggestKeyword(ctx context.Context, key string) ([]string, error)
+	Districts(ctx context.Context) ([]string, error)
+	ShopsWithKeywordSortByDist(ctx context.Context, keywords string, lat, long float64) ([]Shop, error)
+	ShopsWithStatus(ctx context.Context, status string) ([]Shop, error)
+	UpdateShopStatus(ctx context.Context, shops []Shop) error
+	CreateShop(ctx context.Context, shop Shop) (Shop, error)
+	UpdateShop(ctx context.Context, shop Shop, fields ShopField) error
+	DeleteShop(ctx context.Context, shopID int) error
+	ArchiveShop(ctx context.Context, shopID int, at time.Time) error
 	Close()
 }
 
 //TaggedBackend are datasources with separate function to update tags after input
 type TaggedBackend interface {
 	Backend
-	UpdateTags() (int, error)
-	RefreshKeywords() (int, error)
+	UpdateTags(ctx context.Context) (int, error)
+	RefreshKeywords(ctx context.Context) (int, error)
 }
 
 //Exporter is for backend to export all data
 type Exporter interface {
-	AllShops() ([]Shop, error)
+	AllShops(ctx context.Context) ([]Shop, error)
+	Close()
+}
+
+//Importer is for backend to import full shop records, replacing existing
+//records with the same ID
+type Importer interface {
+	ImportShops(ctx context.Context, shops []Shop) error
 	Close()
 }
@@ -0,0 +1,44 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+//UserStore are datasources keeping small records of each user, such as view
+//history and preferences, under a key. Values are opaque to the backend
+type UserStore interface {
+	//UserData returns value saved under key, nil if not found
+	UserData(ctx context.Context, userID int, key string) ([]byte, error)
+	SetUserData(ctx context.Context, userID int, key string, value []byte) error
+	//DeleteUserData removes value under key, no error if not found
+	DeleteUserData(ctx context.Context, userID int, key string) error
+}
+
+//UserDataPurger are UserStore able to remove values no longer in use, such
+//as expired records under systemUserID of the bot
+type UserDataPurger interface {
+	//PurgeUserData removes values of user under keys beginning with prefix
+	//last saved before cutoff, returning the number removed
+	PurgeUserData(ctx context.Context, userID int, prefix string, cutoff time.Time) (int, error)
+}
+
+//LoadUserData decodes JSON value saved under key into v. It returns false if
+//nothing is saved, leaving v unchanged
+func LoadUserData(ctx context.Context, store UserStore, userID int, key string, v interface{}) (bool, error) {
+	data, err := store.UserData(ctx, userID, key)
+	if err != nil || data == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+//SaveUserData saves v as JSON under key
+func SaveUserData(ctx context.Context, store UserStore, userID int, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return store.SetUserData(ctx, userID, key, data)
+}
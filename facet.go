@@ -0,0 +1,179 @@
+package wongdim
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//facetPrefix is put before search key to keep shops with a district or
+	//type, followed by field:value| and the key
+	facetPrefix = "<FT>"
+	//facetMenu is callback data of the filter button, followed by query token
+	facetMenu = "FT"
+	//maxFacetButtons is the number of values shown per field, most common
+	//first
+	maxFacetButtons = 9
+	//facetButtonsPerRow is the number of value buttons in a row
+	facetButtonsPerRow = 3
+)
+
+//facetKey returns key of list of key narrowed to shops with value of field.
+//The open now filter stays outermost so it can be toggled
+func facetKey(key, field, value string) string {
+	if strings.HasPrefix(key, openNowPrefix) {
+		return openNowPrefix + facetKey(strings.TrimPrefix(key, openNowPrefix), field, value)
+	}
+	return facetPrefix + field + ":" + value + "|" + key
+}
+
+//splitFacetKey returns field, value and the narrowed key of facet key
+func splitFacetKey(key string) (string, string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(key, facetPrefix), "|", 2)
+	fv := strings.SplitN(parts[0], ":", 2)
+	if len(parts) < 2 || len(fv) < 2 {
+		return "", "", strings.TrimPrefix(key, facetPrefix)
+	}
+	return fv[0], fv[1], parts[1]
+}
+
+//facetShops returns shops of facet key
+func (r ServeBot) facetShops(ctx context.Context, key string) ([]dao.Shop, error) {
+	field, value, inner := splitFacetKey(key)
+	shops, err := r.shopsByKey(ctx, inner)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]dao.Shop, 0, len(shops))
+	for i := range shops {
+		if shops[i].Facet(field) == value {
+			result = append(result, shops[i])
+		}
+	}
+	return result, nil
+}
+
+//facetQuery returns /query of key with its filters added as terms. It
+//returns false for other searches, and for near: or open now which backends
+//leave to the bot
+func facetQuery(key string) (dao.Query, bool, bool) {
+	terms := make([]dao.QueryTerm, 0)
+	for strings.HasPrefix(key, facetPrefix) {
+		field, value, inner := splitFacetKey(key)
+		terms = append(terms, dao.QueryTerm{Field: field, Value: value})
+		key = inner
+	}
+	includeClosed := false
+	switch {
+	case strings.HasPrefix(key, advAllSearchPrefix):
+		key, includeClosed = strings.TrimPrefix(key, advAllSearchPrefix), true
+	case strings.HasPrefix(key, advSearchPrefix):
+		key = strings.TrimPrefix(key, advSearchPrefix)
+	default:
+		return dao.Query{}, false, false
+	}
+	q, err := dao.ParseQuery(key)
+	if err != nil || q.Near != "" {
+		return dao.Query{}, false, false
+	}
+	for i := range terms {
+		q.Must = append(q.Must, []dao.QueryTerm{terms[i]})
+	}
+	return q, includeClosed, true
+}
+
+//keyFacets counts shops of list of key by district and type. /query lists
+//are counted by backend, others from shops
+func (r ServeBot) keyFacets(ctx context.Context, key string, shops []dao.Shop) (dao.Facets, error) {
+	if q, includeClosed, ok := facetQuery(key); ok {
+		return r.da.QueryFacets(ctx, q, includeClosed)
+	}
+	return dao.CountFacets(shops), nil
+}
+
+//canNarrow checks if facets have a field with more than one value to choose
+func canNarrow(facets dao.Facets) bool {
+	for _, field := range dao.FacetFields {
+		if len(facets[field]) > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+//facetRow returns the filter button of lists longer than a page, and a
+//button removing the last filter of filtered lists
+func facetRow(lang, key string, shops []dao.Shop, token func(string) string) []tgbotapi.InlineKeyboardButton {
+	row := make([]tgbotapi.InlineKeyboardButton, 0, 2)
+	if len(shops) > EntriesPerPage && canNarrow(dao.CountFacets(shops)) {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(locale.Get(lang, "button.filter"), facetMenu+token(key)))
+	}
+	openNow := ""
+	if strings.HasPrefix(key, openNowPrefix) {
+		openNow = openNowPrefix
+	}
+	if inner := strings.TrimPrefix(key, openNowPrefix); strings.HasPrefix(inner, facetPrefix) {
+		_, _, inner = splitFacetKey(inner)
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(locale.Get(lang, "button.clearFilter"), "P0|"+token(openNow+inner)))
+	}
+	return row
+}
+
+//facetCallback handles the filter button, showing districts and types of
+//list with counts in place of its buttons. Choosing one shows the first page
+//of shops with it
+func (r *ServeBot) facetCallback(ctx context.Context, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	defer r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(cb.ID, ""))
+	key, ok := r.queryKey(ctx, strings.TrimPrefix(cb.Data, facetMenu))
+	if !ok {
+		r.SendMsg(chatID, locale.T(ctx, "search.expired"))
+		return
+	}
+	shops, err := r.shopsByKey(ctx, key)
+	if err == nil {
+		var facets dao.Facets
+		facets, err = r.keyFacets(ctx, key, shops)
+		if err == nil {
+			err = r.sendFacets(ctx, cb.Message, key, facets)
+		}
+	}
+	if err != nil {
+		log.WithError(err).WithField("query", key).Error("Cannot show filters")
+		r.SendMsg(chatID, locale.T(ctx, "error.database"))
+	}
+}
+
+//sendFacets replaces buttons of list message with values of facets
+func (r *ServeBot) sendFacets(ctx context.Context, msg *tgbotapi.Message, key string, facets dao.Facets) error {
+	token := r.tokenFunc(ctx)
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0)
+	for _, field := range dao.FacetFields {
+		values := facets[field]
+		if len(values) < 2 {
+			//Choosing the only value changes nothing
+			continue
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(locale.T(ctx, "facet."+field), "---")))
+		values = values[:min(len(values), maxFacetButtons)]
+		for i := 0; i < len(values); i += facetButtonsPerRow {
+			row := make([]tgbotapi.InlineKeyboardButton, 0, facetButtonsPerRow)
+			for _, f := range values[i:min(len(values), i+facetButtonsPerRow)] {
+				row = append(row, tgbotapi.NewInlineKeyboardButtonData(
+					fmt.Sprintf("%s (%d)", f.Value, f.Count), "P0|"+token(facetKey(key, field, f.Value))))
+			}
+			rows = append(rows, row)
+		}
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(locale.T(ctx, "button.backToList"), "P0|"+token(key))))
+	_, err := r.bot.Send(tgbotapi.NewEditMessageReplyMarkup(msg.Chat.ID, msg.MessageID, tgbotapi.NewInlineKeyboardMarkup(rows...)))
+	return err
+}
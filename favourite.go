@@ -0,0 +1,140 @@
+package wongdim
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	ghash "github.com/mmcloughlin/geohash"
+	gcache "github.com/patrickmn/go-cache"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//LocationTimeout is how long a location shared by user is used for
+	//sorting favourites by distance
+	LocationTimeout = time.Hour
+
+	//favPrefix is callback data of favourite toggle, followed by shop ID
+	favPrefix = "FV"
+	//favSearchPrefix is followed by user ID, and optionally "@" and geohash
+	//for sorting by distance
+	favSearchPrefix = "<F>"
+)
+
+//userLocations holds geohash of location last shared by user, by user ID
+var userLocations = gcache.New(LocationTimeout, 2*LocationTimeout)
+
+//rememberLocation keeps location shared by user for sorting favourites
+func rememberLocation(userID int, lat, long float64) {
+	userLocations.SetDefault(strconv.Itoa(userID), ghash.EncodeWithPrecision(lat, long, GeohashPrecision))
+}
+
+//favButton toggles shop as favourite of the user pressing it, nil if
+//favourites are not supported
+func (r ServeBot) favButton(ctx context.Context, shop dao.Shop) []tgbotapi.InlineKeyboardButton {
+	if r.favourites == nil {
+		return nil
+	}
+	return []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData(locale.T(ctx, "button.favourite"), favPrefix+strconv.Itoa(shop.ID)),
+	}
+}
+
+//favKey returns search key of favourites of user, sorted by distance if user
+//shared location recently
+func favKey(userID int) string {
+	key := favSearchPrefix + strconv.Itoa(userID)
+	if geohash, ok := userLocations.Get(strconv.Itoa(userID)); ok {
+		key += "@" + geohash.(string)
+	}
+	return key
+}
+
+//favShops returns shops of favourites search key
+func (r ServeBot) favShops(ctx context.Context, key string) ([]dao.Shop, error) {
+	if r.favourites == nil {
+		return nil, nil
+	}
+	parts := strings.SplitN(key, "@", 2)
+	userID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	shops, err := r.favourites.Favourites(ctx, userID)
+	if err != nil || len(parts) < 2 {
+		return shops, err
+	}
+	lat, long := ghash.DecodeCenter(parts[1])
+	dao.SortByDistance(shops, lat, long)
+	return shops, nil
+}
+
+//favCallback toggles favourite of the user pressing the button. The button
+//is also in inline results posted to other chats, so callback may come
+//without message
+func (r *ServeBot) favCallback(ctx context.Context, cb *tgbotapi.CallbackQuery) {
+	answer := tgbotapi.NewCallback(cb.ID, "")
+	defer func() {
+		_, err := r.bot.AnswerCallbackQuery(answer)
+		if err != nil {
+			log.WithError(err).Error("Telegram error")
+		}
+	}()
+	if r.favourites == nil {
+		return
+	}
+	shopID, err := strconv.Atoi(strings.TrimPrefix(cb.Data, favPrefix))
+	if err != nil {
+		log.WithError(err).WithField("callbackData", cb.Data).Error("Unexpected callback data")
+		return
+	}
+	logger := log.WithFields(log.Fields{
+		"shopID": shopID,
+		"userID": cb.From.ID,
+	})
+	fav, err := r.favourites.IsFavourite(ctx, cb.From.ID, shopID)
+	if err == nil {
+		if fav {
+			err = r.favourites.RemoveFavourite(ctx, cb.From.ID, shopID)
+			answer.Text = locale.T(ctx, "fav.removed")
+		} else {
+			err = r.favourites.AddFavourite(ctx, cb.From.ID, shopID)
+			answer.Text = locale.T(ctx, "fav.added")
+		}
+	}
+	if err != nil {
+		logger.WithError(err).Error("Database error")
+		answer.Text = locale.T(ctx, "error.database")
+		return
+	}
+	logger.WithField("favourite", !fav).Info("Favourite toggled")
+}
+
+//favsCommand lists favourites of user
+func (r *ServeBot) favsCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	if r.favourites == nil {
+		return r.SendMsg(msg.Chat.ID, locale.T(ctx, "fav.unsupported"))
+	}
+	key := favKey(msg.From.ID)
+	shops, err := r.favShops(ctx, strings.TrimPrefix(key, favSearchPrefix))
+	if err != nil {
+		log.WithError(err).Error("Database error")
+		return r.SendMsg(msg.Chat.ID, locale.T(ctx, "error.database"))
+	}
+	log.WithFields(log.Fields{
+		"userID":    msg.From.ID,
+		"resultCnt": len(shops),
+	}).Info("Favourites listed")
+	switch len(shops) {
+	case 0:
+		return r.SendMsg(msg.Chat.ID, locale.T(ctx, "fav.empty"))
+	case 1:
+		return r.SendSingleShop(ctx, msg.Chat.ID, shops[0])
+	}
+	return r.SendList(ctx, msg.Chat.ID, shops, key, EntriesPerPage, 0)
+}
@@ -19,14 +19,12 @@ require (
 	github.com/glycerine/go-unsnap-stream v0.0.0-20190901134440-81cf024a9e0a // indirect
 	github.com/go-telegram-bot-api/telegram-bot-api v4.6.4+incompatible
 	github.com/golang/protobuf v1.3.2 // indirect
-	github.com/google/uuid v1.1.1 // indirect
 	github.com/jackc/pgtype v1.0.2
 	github.com/jackc/pgx/v4 v4.1.2
 	github.com/jmhodges/levigo v1.0.0 // indirect
 	github.com/mmcloughlin/geohash v0.9.0
 	github.com/orandin/lumberjackrus v1.0.1
 	github.com/patrickmn/go-cache v2.1.0+incompatible
-	github.com/remyoudompheng/bigfft v0.0.0-20190728182440-6a916e37a237 // indirect
 	github.com/sergi/go-diff v1.0.0 // indirect
 	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/viper v1.4.0
@@ -35,10 +33,10 @@ require (
 	github.com/tecbot/gorocksdb v0.0.0-20191019123150-400c56251341 // indirect
 	github.com/technoweenie/multipartstreamer v1.0.1 // indirect
 	github.com/tinylib/msgp v1.1.1 // indirect
-	golang.org/x/sync v0.0.0-20190423024810-112230192c58
-	golang.org/x/sys v0.0.0-20191224085550-c709ea063b76 // indirect
+	golang.org/x/sync v0.0.0-20201020160332-67f06af15bc9
 	googlemaps.github.io/maps v0.0.0-20190909213747-3c037358a0f0
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
+	modernc.org/sqlite v1.20.4
 )
 
 replace github.com/go-telegram-bot-api/telegram-bot-api => github.com/mkishere/telegram-bot-api v4.6.5-0.20200106162813-1f98cd2e4700+incompatible
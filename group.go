@@ -0,0 +1,110 @@
+package wongdim
+
+import (
+	"context"
+	"strings"
+
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	log "github.com/sirupsen/logrus"
+)
+
+//isGroup checks if chat is a group or supergroup
+func isGroup(chat *tgbotapi.Chat) bool {
+	return chat != nil && (chat.IsGroup() || chat.IsSuperGroup())
+}
+
+//isBot checks if user is this bot
+func (r *ServeBot) isBot(user *tgbotapi.User) bool {
+	return user != nil && user.ID == r.bot.Self.ID
+}
+
+//stripCommandTarget removes "@botname" from command of msg, so the command
+//and its arguments are parsed the same as in private chat. It returns false
+//if the command is meant for another bot
+func (r *ServeBot) stripCommandTarget(msg *tgbotapi.Message) bool {
+	if !msg.IsCommand() {
+		return true
+	}
+	cmd := msg.CommandWithAt()
+	i := strings.Index(cmd, "@")
+	if i == -1 {
+		return true
+	}
+	if !strings.EqualFold(cmd[i+1:], r.bot.Self.UserName) {
+		return false
+	}
+	entity := &(*msg.Entities)[0]
+	msg.Text = msg.Text[:i+1] + msg.Text[entity.Length:]
+	entity.Length = i + 1
+	return true
+}
+
+//stripMention removes mentions of the bot from text of msg. It returns false
+//if the bot is not mentioned
+func (r *ServeBot) stripMention(msg *tgbotapi.Message) bool {
+	mention := "@" + r.bot.Self.UserName
+	words := strings.Fields(msg.Text)
+	rest := make([]string, 0, len(words))
+	for _, w := range words {
+		if !strings.EqualFold(w, mention) {
+			rest = append(rest, w)
+		}
+	}
+	if len(rest) == len(words) {
+		return false
+	}
+	msg.Text = strings.Join(rest, " ")
+	return true
+}
+
+//addressed checks if message is meant for the bot. Every message in private
+//chat is, while in groups only commands, mentions, replies to the bot and
+//input of active sessions are served. Mentions are removed from text of msg
+func (r *ServeBot) addressed(ctx context.Context, msg *tgbotapi.Message) bool {
+	if !r.stripCommandTarget(msg) {
+		return false
+	}
+	if !isGroup(msg.Chat) {
+		return true
+	}
+	logger := log.WithField("chatID", msg.Chat.ID)
+	switch {
+	case msg.MigrateToChatID != 0:
+		//Group upgraded to supergroup, later updates come with the new ID
+		logger.WithField("newChatID", msg.MigrateToChatID).Info("Group migrated to supergroup")
+		return false
+	case msg.NewChatMembers != nil:
+		for i := range *msg.NewChatMembers {
+			if r.isBot(&(*msg.NewChatMembers)[i]) {
+				logger.WithField("title", msg.Chat.Title).Info("Joined group")
+				//With privacy mode on, Telegram only delivers commands and
+				//replies to the bot in groups
+				r.SendText(msg.Chat.ID, locale.T(ctx, "group.intro"))
+			}
+		}
+		return false
+	case msg.IsCommand():
+		return true
+	case msg.ReplyToMessage != nil && r.isBot(msg.ReplyToMessage.From):
+		r.stripMention(msg)
+		return true
+	case r.stripMention(msg):
+		return strings.TrimSpace(msg.Text) != ""
+	case msg.From != nil:
+		_, _, ok := r.activeSession(ctx, msg.Chat.ID, msg.From.ID)
+		return ok
+	}
+	return false
+}
+
+//onlyAddressed drops messages not meant for the bot ahead of next, so chatter
+//in groups is neither served nor counted against the rate limit
+func (r *ServeBot) onlyAddressed(next updateHandler) updateHandler {
+	return func(ctx context.Context, update tgbotapi.Update) {
+		if update.Message != nil && !r.addressed(ctx, update.Message) {
+			return
+		}
+		next(ctx, update)
+	}
+}
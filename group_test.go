@@ -0,0 +1,73 @@
+package wongdim
+
+import (
+	"context"
+	"testing"
+
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestAddressed(t *testing.T) {
+	ctx := context.Background()
+	r, tg := newTestBot(t)
+	r.registerFlow(Flow{Name: "wait", Start: "wait", Steps: map[string]Step{"wait": {}}})
+	bot := &tgbotapi.User{ID: testBotID, UserName: "wongdim_bot"}
+	other := &tgbotapi.User{ID: testUserID + 1}
+	reply := func(text string, to *tgbotapi.User) *tgbotapi.Message {
+		msg := groupMessage(text)
+		msg.ReplyToMessage = &tgbotapi.Message{From: to}
+		return msg
+	}
+	joined := func(users ...tgbotapi.User) *tgbotapi.Message {
+		msg := groupMessage("join")
+		msg.Text = ""
+		msg.NewChatMembers = &users
+		return msg
+	}
+	migrated := groupMessage("migrate")
+	migrated.MigrateToChatID = -1001
+	cases := []struct {
+		name string
+		msg  *tgbotapi.Message
+		//session is started in the group before msg
+		session bool
+		want    bool
+		//text of msg after the bot is stripped
+		text string
+		sent []string
+	}{
+		{"private", privateMessage("咖啡"), false, true, "咖啡", nil},
+		{"private command of other bot", privateMessage("/help@other_bot"), false, false, "/help@other_bot", nil},
+		{"chatter", groupMessage("咖啡"), false, false, "咖啡", nil},
+		{"command", groupMessage("/help"), false, true, "/help", nil},
+		{"command of bot", groupMessage("/search@WongDim_Bot 咖啡"), false, true, "/search 咖啡", nil},
+		{"command of other bot", groupMessage("/search@other_bot 咖啡"), false, false, "/search@other_bot 咖啡", nil},
+		{"mention", groupMessage("@wongdim_bot 咖啡"), false, true, "咖啡", nil},
+		{"mention only", groupMessage("@wongdim_bot"), false, false, "", nil},
+		{"reply to bot", reply("咖啡 @wongdim_bot", bot), false, true, "咖啡", nil},
+		{"reply to other", reply("咖啡", other), false, false, "咖啡", nil},
+		{"session input", groupMessage("咖啡"), true, true, "咖啡", nil},
+		{"joined", joined(*other, *bot), false, false, "", []string{locale.Get(locale.Default, "group.intro")}},
+		{"other joined", joined(*other), false, false, "", nil},
+		{"migrated", migrated, false, false, "migrate", nil},
+	}
+	for _, c := range cases {
+		r.sessions.DeleteSession(ctx, c.msg.Chat.ID, testUserID)
+		if c.session {
+			err := r.StartSession(ctx, c.msg.Chat.ID, testUserID, "wait", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := r.addressed(ctx, c.msg); got != c.want {
+			t.Errorf("%s expected %v, actual %v", c.name, c.want, got)
+		}
+		if c.msg.Text != c.text {
+			t.Errorf("%s: text expected %q, actual %q", c.name, c.text, c.msg.Text)
+		}
+		if sent := tg.texts(); len(sent) != len(c.sent) || len(sent) > 0 && sent[0] != c.sent[0] {
+			t.Errorf("%s: sent expected %q, actual %q", c.name, c.sent, sent)
+		}
+	}
+}
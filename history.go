@@ -0,0 +1,177 @@
+package wongdim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	gcache "github.com/patrickmn/go-cache"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//MaxHistory is the number of shops kept in view history of each user
+	MaxHistory = 50
+	//ListKeyTimeout is how long the search of a list message is remembered
+	//for recording the source of shops picked from it
+	ListKeyTimeout = 24 * time.Hour
+
+	//historyKey is the UserStore key of view history
+	historyKey = "history"
+	//historySearchPrefix is followed by user ID
+	historySearchPrefix = "<H>"
+	//historyClear is callback data of clear history button
+	historyClear = "HC"
+)
+
+//viewRecord is a shop viewed by user
+type viewRecord struct {
+	ShopID int
+	Viewed time.Time
+	//Source is the search showing the shop
+	Source string
+}
+
+//listKeys holds search key of list messages, by chat ID and message ID
+var listKeys = gcache.New(ListKeyTimeout, 2*ListKeyTimeout)
+
+//historyMu serializes updates of view history, which read before write
+var historyMu sync.Mutex
+
+func listMessageKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("%d:%d", chatID, messageID)
+}
+
+//listSource returns the search of list message, empty if unknown
+func listSource(msg *tgbotapi.Message) string {
+	if key, ok := listKeys.Get(listMessageKey(msg.Chat.ID, msg.MessageID)); ok {
+		return keySource(key.(string))
+	}
+	return ""
+}
+
+//keySource describes search key for user
+func keySource(key string) string {
+	if strings.HasPrefix(key, openNowPrefix) {
+		return keySource(strings.TrimPrefix(key, openNowPrefix)) + " " + openNowWord
+	}
+	switch {
+	case strings.HasPrefix(key, facetPrefix):
+		field, value, inner := splitFacetKey(key)
+		return keySource(inner) + " " + field + ":" + value
+	case strings.HasPrefix(key, favSearchPrefix):
+		return "/favs"
+	case strings.HasPrefix(key, historySearchPrefix):
+		return "/history"
+	case strings.HasPrefix(key, geoSearchPrefix):
+		_, radius := splitGeoKey(strings.TrimPrefix(key, geoSearchPrefix))
+		return "📍座標搜尋 " + radius
+	case strings.HasPrefix(key, advAllSearchPrefix):
+		return "/queryall " + strings.TrimPrefix(key, advAllSearchPrefix)
+	case strings.HasPrefix(key, advSearchPrefix):
+		return "/query " + strings.TrimPrefix(key, advSearchPrefix)
+	}
+	return strings.TrimPrefix(key, simpleSearchPrefix)
+}
+
+//recordView puts shop on top of view history of user
+func (r *ServeBot) recordView(ctx context.Context, user *tgbotapi.User, shopID int, source string) {
+	if user == nil {
+		return
+	}
+	logger := log.WithFields(log.Fields{
+		"userID": user.ID,
+		"shopID": shopID,
+	})
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	records := make([]viewRecord, 0)
+	_, err := dao.LoadUserData(ctx, r.users, user.ID, historyKey, &records)
+	if err != nil {
+		logger.WithError(err).Error("Cannot load view history")
+		return
+	}
+	history := make([]viewRecord, 1, min(len(records)+1, MaxHistory))
+	history[0] = viewRecord{ShopID: shopID, Viewed: time.Now(), Source: source}
+	for i := range records {
+		if len(history) == MaxHistory {
+			break
+		}
+		if records[i].ShopID != shopID {
+			history = append(history, records[i])
+		}
+	}
+	err = dao.SaveUserData(ctx, r.users, user.ID, historyKey, history)
+	if err != nil {
+		logger.WithError(err).Error("Cannot save view history")
+	}
+}
+
+//historyShops returns shops viewed by user in key, latest first
+func (r ServeBot) historyShops(ctx context.Context, key string) ([]dao.Shop, error) {
+	userID, err := strconv.Atoi(key)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]viewRecord, 0)
+	_, err = dao.LoadUserData(ctx, r.users, userID, historyKey, &records)
+	if err != nil {
+		return nil, err
+	}
+	shops := make([]dao.Shop, 0, len(records))
+	for i := range records {
+		shop, err := r.da.ShopByID(ctx, records[i].ShopID)
+		if errors.Is(err, dao.ErrShopNotFound) {
+			//Deleted after viewed
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		shops = append(shops, shop)
+	}
+	return shops, nil
+}
+
+//historyCommand lists shops viewed by user
+func (r *ServeBot) historyCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	key := historySearchPrefix + strconv.Itoa(msg.From.ID)
+	shops, err := r.historyShops(ctx, strings.TrimPrefix(key, historySearchPrefix))
+	if err != nil {
+		log.WithError(err).Error("Database error")
+		return r.SendMsg(msg.Chat.ID, locale.T(ctx, "error.database"))
+	}
+	log.WithFields(log.Fields{
+		"userID":    msg.From.ID,
+		"resultCnt": len(shops),
+	}).Info("History listed")
+	if len(shops) == 0 {
+		return r.SendMsg(msg.Chat.ID, locale.T(ctx, "history.empty"))
+	}
+	//Always a list for the clear button
+	return r.SendList(ctx, msg.Chat.ID, shops, key, EntriesPerPage, 0)
+}
+
+//clearHistory deletes view history of the user pressing the button
+func (r *ServeBot) clearHistory(ctx context.Context, cb *tgbotapi.CallbackQuery) {
+	defer r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(cb.ID, ""))
+	historyMu.Lock()
+	err := r.users.DeleteUserData(ctx, cb.From.ID, historyKey)
+	historyMu.Unlock()
+	if err != nil {
+		log.WithError(err).Error("Database error")
+		r.SendMsg(cb.Message.Chat.ID, locale.T(ctx, "error.database"))
+		return
+	}
+	log.WithField("userID", cb.From.ID).Info("History cleared")
+	_, err = r.bot.Send(tgbotapi.NewEditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, locale.T(ctx, "history.cleared")))
+	if err != nil {
+		log.WithError(err).Error("Telegram error")
+	}
+}
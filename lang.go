@@ -0,0 +1,119 @@
+package wongdim
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	gcache "github.com/patrickmn/go-cache"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//langKey is the UserStore key of language chosen by /lang
+	langKey = "lang"
+	//langPrefix is callback data of language buttons, followed by language
+	langPrefix = "LG"
+)
+
+//storedLangs holds languages chosen by users by ID, in front of UserStore.
+//Users without a choice are held too, as every update looks it up
+var storedLangs = gcache.New(time.Hour, 2*time.Hour)
+
+//storedLang returns language chosen by user with /lang, empty if none
+func (r *ServeBot) storedLang(ctx context.Context, userID int) string {
+	key := strconv.Itoa(userID)
+	if lang, ok := storedLangs.Get(key); ok {
+		return lang.(string)
+	}
+	var lang string
+	_, err := dao.LoadUserData(ctx, r.users, userID, langKey, &lang)
+	if err != nil {
+		log.WithError(err).WithField("userID", userID).Error("Cannot load language")
+		return ""
+	}
+	if !locale.Supported(lang) {
+		lang = ""
+	}
+	storedLangs.SetDefault(key, lang)
+	return lang
+}
+
+//userLang returns language chosen by user, or the one of Telegram client
+func (r *ServeBot) userLang(ctx context.Context, user *tgbotapi.User) string {
+	if user == nil {
+		return locale.Default
+	}
+	if lang := r.storedLang(ctx, user.ID); lang != "" {
+		return lang
+	}
+	return locale.Match(user.LanguageCode)
+}
+
+//langOf returns language of user known by ID only, such as the submitter
+//of a submission
+func (r *ServeBot) langOf(ctx context.Context, userID int) string {
+	if lang := r.storedLang(ctx, userID); lang != "" {
+		return lang
+	}
+	return locale.Default
+}
+
+//help returns help message in language of ctx
+func (r *ServeBot) help(ctx context.Context) string {
+	if msg, ok := r.helpMsg[locale.FromContext(ctx)]; ok {
+		return msg
+	}
+	return r.helpMsg[locale.Default]
+}
+
+//langCommand shows languages to choose from
+func (r *ServeBot) langCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	row := make([]tgbotapi.InlineKeyboardButton, len(locale.Langs))
+	for i, lang := range locale.Langs {
+		row[i] = tgbotapi.NewInlineKeyboardButtonData(locale.Get(lang, "lang.name"), langPrefix+lang)
+	}
+	reply := tgbotapi.NewMessage(msg.Chat.ID, locale.T(ctx, "lang.current", locale.T(ctx, "lang.name")))
+	reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(row)
+	_, err := r.bot.Send(reply)
+	return err
+}
+
+//langCallback saves language chosen by the user pressing the button
+func (r *ServeBot) langCallback(ctx context.Context, cb *tgbotapi.CallbackQuery) {
+	lang := strings.TrimPrefix(cb.Data, langPrefix)
+	answer := tgbotapi.NewCallback(cb.ID, "")
+	defer func() {
+		_, err := r.bot.AnswerCallbackQuery(answer)
+		if err != nil {
+			log.WithError(err).Error("Telegram error")
+		}
+	}()
+	if !locale.Supported(lang) {
+		log.WithField("callbackData", cb.Data).Error("Unexpected callback data")
+		return
+	}
+	err := dao.SaveUserData(ctx, r.users, cb.From.ID, langKey, lang)
+	if err != nil {
+		log.WithError(err).Error("Database error")
+		answer.Text = locale.T(ctx, "error.database")
+		return
+	}
+	storedLangs.Delete(strconv.Itoa(cb.From.ID))
+	log.WithFields(log.Fields{
+		"userID": cb.From.ID,
+		"lang":   lang,
+	}).Info("Language set")
+	r.SendMsg(cb.Message.Chat.ID, locale.Get(lang, "lang.set"))
+	if cb.Message.Chat.IsPrivate() {
+		//Command list follows the choice, for languages Telegram cannot tell
+		err = r.setMyCommands(lang, "", r.listed(r.isAdmin(cb.From.ID)), cb.Message.Chat.ID)
+		if err != nil {
+			log.WithError(err).WithField("userID", cb.From.ID).Error("Cannot register commands")
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package wongdim
+
+import (
+	"context"
+	"testing"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestStoredLang(t *testing.T) {
+	ctx := context.Background()
+	r, tg := newTestBot(t)
+	const userID = testUserID + 100
+	err := dao.SaveUserData(ctx, r.users, userID, langKey, locale.LangEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	press := func(lang string) {
+		r.langCallback(ctx, &tgbotapi.CallbackQuery{
+			ID:      "1",
+			From:    &tgbotapi.User{ID: userID},
+			Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: -100, Type: "group"}},
+			Data:    langPrefix + lang,
+		})
+	}
+	cases := []struct {
+		name string
+		//change is run before the language is looked up
+		change func()
+		want   string
+	}{
+		{"saved", func() {}, locale.LangEN},
+		{"cached", func() { dao.SaveUserData(ctx, r.users, userID, langKey, locale.LangCN) }, locale.LangEN},
+		{"chosen", func() { press(locale.LangCN) }, locale.LangCN},
+		{"unsupported", func() { press("fr") }, locale.LangCN},
+		{"chosen again", func() { press(locale.LangHK) }, locale.LangHK},
+	}
+	for _, c := range cases {
+		c.change()
+		if got := r.storedLang(ctx, userID); got != c.want {
+			t.Errorf("%s expected: %s, actual %s", c.name, c.want, got)
+		}
+	}
+	if texts := tg.texts(); len(texts) != 2 || texts[1] != locale.Get(locale.LangHK, "lang.set") {
+		t.Errorf("Choices expected to be confirmed, actual %q", texts)
+	}
+}
@@ -0,0 +1,329 @@
+package wongdim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//DefaultRateInterval is the time for a user to regain one request
+	DefaultRateInterval = 2 * time.Second
+	//DefaultRateBurst is the number of requests a user may make at once
+	DefaultRateBurst = 20
+
+	//banKey is the UserStore key of banned users, under systemUserID
+	banKey = "bans"
+)
+
+//updateHandler serves an update. Middleware such as limitUpdates wraps
+//another to run ahead of it
+type updateHandler func(ctx context.Context, update tgbotapi.Update)
+
+//bucket is the token bucket of a user
+type bucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	//throttled is set once the user is told to slow down, so it is told only
+	//once until a request is allowed again
+	throttled bool
+}
+
+//ban is a ban of user by an admin. Zero Until bans permanently
+type ban struct {
+	By    int
+	Since time.Time
+	Until time.Time
+}
+
+//banList holds banned users by ID, in front of UserStore
+type banList struct {
+	mu    sync.Mutex
+	users map[int]ban
+}
+
+// WithRateLimit configures requests a user may make, one more every interval
+// up to burst at once. Zero burst disables the limit
+func WithRateLimit(every time.Duration, burst int) Option {
+	return func(s *ServeBot) error {
+		if every <= 0 || burst < 0 {
+			return fmt.Errorf("Invalid rate limit: %d every %v", burst, every)
+		}
+		s.rateEvery, s.rateBurst = every, burst
+		return nil
+	}
+}
+
+//take spends a request of b, regained one every interval up to burst. It
+//returns false if none is left
+func (b *bucket) take(now time.Time, every time.Duration, burst int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(float64(burst), b.tokens+float64(now.Sub(b.last))/float64(every))
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	b.throttled = false
+	return true
+}
+
+//warn returns true if the user has not been told to slow down since running
+//out of requests
+func (b *bucket) warn() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.throttled {
+		return false
+	}
+	b.throttled = true
+	return true
+}
+
+//updateUser returns sender of update, nil if none such as channel posts
+func updateUser(update tgbotapi.Update) *tgbotapi.User {
+	switch {
+	case update.InlineQuery != nil:
+		return update.InlineQuery.From
+	case update.CallbackQuery != nil:
+		return update.CallbackQuery.From
+	case update.Message != nil:
+		return update.Message.From
+	}
+	return nil
+}
+
+//bucketOf returns token bucket of user. Buckets idle long enough to be full
+//again expire, as new ones are full too
+func (r *ServeBot) bucketOf(userID int) *bucket {
+	key := strconv.Itoa(userID)
+	b, ok := r.buckets.Get(key)
+	if !ok {
+		//Concurrent first updates may each get a bucket, allowing a few more
+		b = &bucket{tokens: float64(r.rateBurst), last: time.Now()}
+	}
+	r.buckets.SetDefault(key, b)
+	return b.(*bucket)
+}
+
+//withLang puts language of sender into ctx for next
+func (r *ServeBot) withLang(next updateHandler) updateHandler {
+	return func(ctx context.Context, update tgbotapi.Update) {
+		next(locale.WithLang(ctx, r.userLang(ctx, updateUser(update))), update)
+	}
+}
+
+//limitUpdates drops updates of banned users and users over the rate limit
+//ahead of next. Admins are never limited
+func (r *ServeBot) limitUpdates(next updateHandler) updateHandler {
+	return func(ctx context.Context, update tgbotapi.Update) {
+		user := updateUser(update)
+		if user == nil || r.isAdmin(user.ID) {
+			next(ctx, update)
+			return
+		}
+		if r.banned(user.ID, time.Now()) {
+			log.WithField("userID", user.ID).Debug("Update of banned user dropped")
+			return
+		}
+		if r.rateBurst == 0 {
+			next(ctx, update)
+			return
+		}
+		b := r.bucketOf(user.ID)
+		if b.take(time.Now(), r.rateEvery, r.rateBurst) {
+			next(ctx, update)
+			return
+		}
+		r.throttle(ctx, update, user, b.warn())
+	}
+}
+
+//throttle asks user to slow down in language of ctx, in a message only the
+//first time since running out of requests. Pressed buttons are always
+//answered to stop the loading indicator, inline queries are left unanswered
+func (r *ServeBot) throttle(ctx context.Context, update tgbotapi.Update, user *tgbotapi.User, first bool) {
+	if first {
+		log.WithFields(log.Fields{
+			"userID":   user.ID,
+			"userName": user.UserName,
+		}).Warn("User throttled")
+	}
+	switch {
+	case update.CallbackQuery != nil:
+		r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, locale.T(ctx, "limit.throttled")))
+	case update.Message != nil && first:
+		err := r.SendMsg(update.Message.Chat.ID, locale.T(ctx, "limit.throttled"))
+		if err != nil {
+			log.WithError(err).Error("Telegram error")
+		}
+	}
+}
+
+//loadBans reads users banned by admins
+func (r *ServeBot) loadBans(ctx context.Context) error {
+	users := make(map[int]ban)
+	_, err := dao.LoadUserData(ctx, r.users, systemUserID, banKey, &users)
+	if err != nil {
+		return err
+	}
+	r.bans.mu.Lock()
+	r.bans.users = users
+	r.bans.mu.Unlock()
+	return nil
+}
+
+//banned checks if user is banned at time now
+func (r *ServeBot) banned(userID int, now time.Time) bool {
+	r.bans.mu.Lock()
+	defer r.bans.mu.Unlock()
+	b, ok := r.bans.users[userID]
+	return ok && (b.Until.IsZero() || now.Before(b.Until))
+}
+
+//updateBans changes banned users by f and saves them, dropping expired bans.
+//Nothing is changed if they cannot be saved
+func (r *ServeBot) updateBans(ctx context.Context, f func(users map[int]ban)) error {
+	r.bans.mu.Lock()
+	defer r.bans.mu.Unlock()
+	users := make(map[int]ban, len(r.bans.users)+1)
+	for id, b := range r.bans.users {
+		users[id] = b
+	}
+	f(users)
+	now := time.Now()
+	for id, b := range users {
+		if !b.Until.IsZero() && !now.Before(b.Until) {
+			delete(users, id)
+		}
+	}
+	err := dao.SaveUserData(ctx, r.users, systemUserID, banKey, users)
+	if err != nil {
+		return err
+	}
+	r.bans.users = users
+	return nil
+}
+
+//banUserArg returns user ID in first argument
+func banUserArg(ctx context.Context, args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, errors.New(locale.T(ctx, "ban.noUserID"))
+	}
+	userID, err := strconv.Atoi(args[0])
+	if err != nil || userID <= systemUserID {
+		return 0, errors.New(locale.T(ctx, "ban.badUserID", args[0]))
+	}
+	return userID, nil
+}
+
+//banText describes how long user is banned
+func banText(ctx context.Context, userID int, b ban) string {
+	if b.Until.IsZero() {
+		return locale.T(ctx, "ban.permanent", userID)
+	}
+	return locale.T(ctx, "ban.until", userID, b.Until.In(dao.HKT).Format("2006-01-02 15:04"))
+}
+
+//banUser bans user in first argument, for the duration in second argument
+//or permanently
+func (r *ServeBot) banUser(ctx context.Context, msg *tgbotapi.Message) (string, error) {
+	args := strings.Fields(msg.CommandArguments())
+	userID, err := banUserArg(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	if r.isAdmin(userID) {
+		return "", errors.New(locale.T(ctx, "ban.admin"))
+	}
+	b := ban{By: msg.From.ID, Since: time.Now()}
+	if len(args) > 1 {
+		d, err := time.ParseDuration(args[1])
+		if err != nil || d <= 0 {
+			return "", errors.New(locale.T(ctx, "ban.badDuration", args[1]))
+		}
+		b.Until = b.Since.Add(d)
+	}
+	err = r.updateBans(ctx, func(users map[int]ban) {
+		users[userID] = b
+	})
+	if err != nil {
+		return "", err
+	}
+	log.WithFields(log.Fields{
+		"userID":  userID,
+		"adminID": msg.From.ID,
+		"until":   b.Until,
+	}).Info("User banned")
+	if b.Until.IsZero() {
+		return locale.T(ctx, "ban.bannedForever", userID), nil
+	}
+	return locale.T(ctx, "ban.bannedUntil", userID, b.Until.In(dao.HKT).Format("2006-01-02 15:04")), nil
+}
+
+//unbanUser lifts ban of user in first argument
+func (r *ServeBot) unbanUser(ctx context.Context, msg *tgbotapi.Message) (string, error) {
+	userID, err := banUserArg(ctx, strings.Fields(msg.CommandArguments()))
+	if err != nil {
+		return "", err
+	}
+	found := false
+	err = r.updateBans(ctx, func(users map[int]ban) {
+		_, found = users[userID]
+		delete(users, userID)
+	})
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return locale.T(ctx, "ban.notBanned", userID), nil
+	}
+	log.WithFields(log.Fields{
+		"userID":  userID,
+		"adminID": msg.From.ID,
+	}).Info("User unbanned")
+	return locale.T(ctx, "ban.unbanned", userID), nil
+}
+
+//listBans lists banned users, permanent bans first
+func (r *ServeBot) listBans(ctx context.Context) (string, error) {
+	now := time.Now()
+	r.bans.mu.Lock()
+	ids := make([]int, 0, len(r.bans.users))
+	users := make(map[int]ban, len(r.bans.users))
+	for id, b := range r.bans.users {
+		if b.Until.IsZero() || now.Before(b.Until) {
+			ids = append(ids, id)
+			users[id] = b
+		}
+	}
+	r.bans.mu.Unlock()
+	if len(ids) == 0 {
+		return locale.T(ctx, "ban.none"), nil
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := users[ids[i]].Until, users[ids[j]].Until
+		if a.Equal(b) {
+			return ids[i] < ids[j]
+		}
+		return a.IsZero() || (!b.IsZero() && a.Before(b))
+	})
+	lines := make([]string, len(ids))
+	for i, id := range ids {
+		lines[i] = banText(ctx, id, users[id])
+	}
+	return locale.T(ctx, "ban.list", strings.Join(lines, "\n")), nil
+}
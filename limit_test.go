@@ -0,0 +1,124 @@
+package wongdim
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	gcache "github.com/patrickmn/go-cache"
+)
+
+//groupMessage returns message of testUserID with text in a group
+func groupMessage(text string) *tgbotapi.Message {
+	msg := &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: -100, Type: "group"},
+		From: &tgbotapi.User{ID: testUserID},
+		Text: text,
+	}
+	if text[0] == '/' {
+		msg.Entities = &[]tgbotapi.MessageEntity{{Type: "bot_command", Length: len(strings.Fields(text)[0])}}
+	}
+	return msg
+}
+
+func TestLimitOnlyAddressed(t *testing.T) {
+	r, _ := newTestBot(t)
+	r.rateEvery, r.rateBurst = time.Hour, 1
+	r.buckets = gcache.New(time.Hour, time.Hour)
+	r.bans = &banList{users: make(map[int]ban)}
+	served := 0
+	handle := r.onlyAddressed(r.limitUpdates(func(ctx context.Context, update tgbotapi.Update) {
+		served++
+	}))
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		handle(ctx, tgbotapi.Update{Message: groupMessage("食乜好")})
+	}
+	if served != 0 {
+		t.Errorf("Chatter expected to be dropped, %d served", served)
+	}
+	if _, ok := r.buckets.Get(strconv.Itoa(testUserID)); ok {
+		t.Error("Chatter expected not to spend requests")
+	}
+	handle(ctx, tgbotapi.Update{Message: groupMessage("/help")})
+	if served != 1 {
+		t.Errorf("Command expected to be served, %d served", served)
+	}
+}
+
+func TestBucketTake(t *testing.T) {
+	start := time.Now()
+	b := &bucket{tokens: 2, last: start}
+	cases := []struct {
+		after time.Duration
+		want  bool
+		warn  bool
+	}{
+		{0, true, false},
+		{0, true, false},
+		{0, false, true},
+		{500 * time.Millisecond, false, false},
+		{time.Second, true, false},
+		{time.Second, false, true},
+		//Refilled up to burst only
+		{time.Minute, true, false},
+		{time.Minute, true, false},
+		{time.Minute, false, true},
+	}
+	for i, c := range cases {
+		if got := b.take(start.Add(c.after), time.Second, 2); got != c.want {
+			t.Errorf("Request %d after %v expected %v, actual %v", i, c.after, c.want, got)
+		}
+		if !c.want {
+			if warn := b.warn(); warn != c.warn {
+				t.Errorf("Request %d expected warning %v, actual %v", i, c.warn, warn)
+			}
+		}
+	}
+}
+
+func TestBans(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestBot(t)
+	r.bans = &banList{users: make(map[int]ban)}
+	now := time.Now()
+	err := r.updateBans(ctx, func(users map[int]ban) {
+		users[1] = ban{Since: now}
+		users[2] = ban{Since: now, Until: now.Add(time.Hour)}
+		users[3] = ban{Since: now.Add(-time.Hour), Until: now.Add(-time.Minute)}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Bans survive restart, without the expired one
+	restarted, _ := newTestBot(t)
+	restarted.users = r.users
+	restarted.bans = &banList{}
+	err = restarted.loadBans(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restarted.bans.users[3]; ok || len(restarted.bans.users) != 2 {
+		t.Errorf("Expired ban expected to be dropped, actual %v", restarted.bans.users)
+	}
+	cases := []struct {
+		userID int
+		at     time.Time
+		want   bool
+	}{
+		{1, now, true},
+		{1, now.Add(24 * 365 * time.Hour), true},
+		{2, now, true},
+		{2, now.Add(time.Hour), false},
+		{3, now, false},
+		{testUserID, now, false},
+	}
+	for _, c := range cases {
+		if got := restarted.banned(c.userID, c.at); got != c.want {
+			t.Errorf("User %d at %v expected banned %v, actual %v", c.userID, c.at.Sub(now), c.want, got)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package locale
+
+var en = Catalog{
+	"lang.name":    "English",
+	"lang.current": "Current language: %s\nPlease choose a language",
+	"lang.set":     "Language set to English",
+
+	"error.database":     "Database error! Please try again later",
+	"error.shopNotFound": "Database error! Shop not found",
+	"error.system":       "System error, please try again later",
+
+	"search.expired":     "This search has expired, please enter keywords or share a location again",
+	"search.noneOpen":    "No shops are open at the moment",
+	"search.noneNearby":  "No shops found within %s!",
+	"search.noResult":    "No results for these keywords",
+	"search.suggest":     "No results for these keywords\nTry these keywords:\n%s",
+	"search.tryLocation": "No results for these keywords\nTry sharing a location (📎>Location) to search nearby shops",
+
+	"query.error":         "Invalid search: %s",
+	"query.errorAt":       "Invalid search: %s\n%s",
+	"query.unknownField":  "unsupported field, use district: type: near:here open:now",
+	"query.emptyValue":    "a value is needed after the field, e.g. district:旺角",
+	"query.unclosedQuote": "the quote is not closed",
+	"query.misplacedOr":   "OR goes between two keywords",
+	"query.badValue":      "invalid value, use near:here or open:now",
+	"query.duplicate":     "repeated condition",
+	"query.tooLong":       "too many keywords, at most 10",
+	"query.tooBroad":      "give at least one keyword, or near:here to search nearby",
+	"query.noLocation":    "Please share a location (📎>Location) first to search near:here",
+
+	"button.website":      "🏠Website",
+	"button.google":       "🔍Google it",
+	"button.movedTo":      "➡️New address",
+	"button.showAll":      "🕒Show all",
+	"button.openNow":      "🕒Open now only",
+	"button.clearHistory": "🗑Clear history",
+	"button.favourite":    "⭐Favourite",
+	"button.report":       "⚠️Report problem",
+	"button.random":       "🎲Random",
+	"button.randomAgain":  "🎲Draw again",
+	"button.refresh":      "🔄Results changed, reload",
+	"button.closePoll":    "🏁Close poll",
+	"button.back":         "⬅️Back",
+	"button.submit":       "✅Submit",
+	"button.skip":         "⏭️Skip",
+	"button.cancel":       "❌Cancel",
+	"button.filter":       "🔎Filter",
+	"button.clearFilter":  "✖️Clear filter",
+	"button.backToList":   "⬅️Back to list",
+	"button.approve":      "✅Approve",
+	"button.reject":       "❌Reject",
+	"button.edit":         "✏️Edit",
+	"button.resolved":     "✅Resolved",
+	"button.markClosed":   "⛔Mark closed",
+
+	"facet.district": "📍District",
+	"facet.type":     "🍽Type",
+
+	"hours.closedToday":      "🕒Closed today",
+	"hours.today":            "🕒Opening hours today: %s",
+	"hours.closingSoon":      " ⚠️Closing soon",
+	"status.tempClosed":      "⏸️Temporarily closed",
+	"status.tempClosedUntil": "⏸️Temporarily closed until %s",
+	"status.closed":          "⛔Closed",
+	"status.closedSince":     "⛔Closed since %s",
+	"status.moved":           "🚚Relocated",
+
+	"fav.added":       "⭐Added to favourites, see /favs",
+	"fav.removed":     "Removed from favourites",
+	"fav.unsupported": "Favourites are not supported",
+	"fav.empty":       "You have no favourite shops yet, press \"⭐Favourite\" below a shop to add one",
+
+	"history.empty":   "No viewing history",
+	"history.cleared": "Viewing history cleared",
+
+	"group.intro": "Hello everyone! Please use commands in groups, e.g.:\n" +
+		"/query Central coffee - search shops\n" +
+		"/lunch Central - vote for lunch\n" +
+		"You can also reply to my messages or mention me with keywords",
+
+	"radius.current": "Current location search radius: %s\nEnter \"/radius <radius>\" to change it, choices: %s",
+	"radius.invalid": "Radius must be one of: %s",
+	"radius.set":     "Location search radius set to %s",
+
+	"random.usage":     "Please enter \"/random <keywords>\", or share a location (📎>Location) first",
+	"random.exhausted": "All shops have been drawn",
+	"random.progress":  "🎲%d drawn, %d left",
+	"random.expired":   "This draw has expired, please search again",
+
+	"session.groupReply": "\n\n(Please reply to this message in groups)",
+	"session.none":       "Nothing in progress",
+	"session.cancelled":  "Cancelled",
+	"session.useButtons": "Please press a button, or enter /cancel to cancel",
+	"session.expired":    "This has timed out, please start again",
+	"session.textOnly":   "Please answer in text",
+
+	"limit.throttled": "You are sending requests too fast, please try again later",
+
+	"lunch.notEnough":   "Not enough shops for a poll\nPlease enter /lunch <keywords>, or reply to a location with /lunch",
+	"lunch.question":    "What's for lunch? (closes in %d minutes)",
+	"lunch.creatorOnly": "Only the creator can close the poll",
+	"lunch.noVotes":     "Poll closed, nobody voted",
+	"lunch.result":      "🏆Poll result: %s (%d votes)",
+
+	"report.kind.C":    "Closed",
+	"report.kind.A":    "Wrong address",
+	"report.kind.L":    "Wrong location",
+	"report.kind.O":    "Other",
+	"report.askKind":   "Please choose the kind of problem",
+	"report.askText":   "Please describe the problem, or enter /cancel to cancel",
+	"report.duplicate": "You have reported this problem already, thanks!",
+	"report.thanks":    "Thanks for reporting! Admins will verify it soon",
+
+	"submit.askName":     "Please enter the shop name",
+	"submit.askDistrict": "Please enter the district (e.g. 旺角, 荃灣), or \"網店\" for online shops",
+	"submit.askType":     "Please enter the type (e.g. 咖啡, 日本菜)",
+	"submit.askAddress":  "Please enter the address, or share a location (📎>Location)",
+	"submit.askURL":      "Please enter the website",
+	"submit.askNotes":    "Please enter notes",
+	"submit.current":     "\nCurrent: %s",
+	"submit.confirm":     "Please confirm:\n\n%s",
+	"submit.name":        "Name: %s",
+	"submit.district":    "District: %s",
+	"submit.type":        "Type: %s",
+	"submit.address":     "Address: %s",
+	"submit.url":         "Website: %s",
+	"submit.notes":       "Notes: %s",
+	"submit.useButtons":  "Please press \"Submit\" to confirm, or \"Back\" to edit",
+	"submit.incomplete":  "Incomplete: %s",
+	"submit.needAddress": "Incomplete: address, location or website is required",
+	"submit.thanks":      "Thanks for submitting! You will be notified after review",
+	"submit.rejected":    "Sorry, \"%s\" you submitted was not accepted",
+	"submit.approved":    "\"%s\" you submitted has been accepted, thanks!",
+
+	"review.title":        "New shop submission #%d (by %s %d)\n\n%s",
+	"review.notFound":     "Submission not found",
+	"review.done":         "Submission #%d already handled by %d",
+	"review.rejected":     "Submission #%d rejected",
+	"review.conflict":     "Submission #%d duplicates shop %d, please edit or reject it",
+	"review.invalid":      "Submission #%d is invalid: %s",
+	"review.approved":     "Submission #%d approved, shop %d created",
+	"review.geocodeLater": ", coordinates will be filled in by batch",
+
+	"reports.title":       "Shop %d %s (%s)",
+	"reports.flagged":     "🚩%s needs verification",
+	"reports.none":        "No open reports",
+	"reports.more":        "Reports of %d more shops not listed",
+	"reports.deletedShop": "(deleted)",
+	"reports.resolved":    "Shop %d: %d reports resolved",
+
+	"admin.error":             "Error: %s",
+	"admin.shopCount":         "Total shops: %d",
+	"admin.byStatus":          "Open %d, temporarily closed %d, closed %d, moved %d",
+	"admin.byDistrict":        "Shops by district:",
+	"admin.cacheItems":        "Cache items: %d",
+	"admin.pending":           "Pending submissions: %d",
+	"admin.noMapClient":       "No map service configured",
+	"admin.fillInfoRunning":   "Fill info batch is already running",
+	"admin.fillInfoStart":     "Filling in shop info",
+	"admin.fillInfoProgress":  "Filling in shop info: %d/%d",
+	"admin.fillInfoDone":      "Shop info filled in, %d errors",
+	"admin.noKeywords":        "Database cannot refresh keywords",
+	"admin.keywordsRefreshed": "%d keywords refreshed",
+	"admin.noShopID":          "Please provide a shop ID",
+	"admin.badShopID":         "Invalid shop ID: %s",
+	"admin.badDate":           "Invalid date: %s",
+	"admin.closed":            "Shop %d (%s) marked closed",
+	"admin.reopened":          "Shop %d (%s) marked open",
+	"admin.editUsage":         "Usage: /edit <shop ID> <field> <value>\nFields: %s",
+	"admin.unknownField":      "Unknown field: %s",
+	"admin.badLocation":       "Coordinates should be <lat>,<long>: %s",
+	"admin.editConflict":      "Duplicates shop %d, not updated",
+	"admin.edited":            "Shop %d (%s) %s updated",
+	"admin.flushed":           "Cache cleared",
+
+	"ban.noUserID":      "Please provide a user ID",
+	"ban.badUserID":     "Invalid user ID: %s",
+	"ban.admin":         "Admins cannot be banned",
+	"ban.badDuration":   "Invalid duration: %s",
+	"ban.permanent":     "%d banned permanently",
+	"ban.until":         "%d banned until %s",
+	"ban.bannedForever": "User %d banned permanently",
+	"ban.bannedUntil":   "User %d banned until %s",
+	"ban.notBanned":     "User %d is not banned",
+	"ban.unbanned":      "User %d unbanned",
+	"ban.none":          "No banned users",
+	"ban.list":          "Banned users:\n%s",
+
+	"help.commands": "Commands:",
+	"help.details":  "Enter \"/help <command>\" for details, e.g. /help random",
+	"help.unknown":  "There is no command /%s, enter /help to list commands",
+
+	"cmd.help":          "List commands and their usage",
+	"cmd.help.help":     "/help lists all commands\n/help <command> - show details of a command",
+	"cmd.query":         "Advanced search",
+	"cmd.query.help":    "/query <keywords>\nShops whose tags or district match all keywords\nA OR B - either matches\n-keyword - exclude\n\"exact phrase\"\ndistrict:旺角 - district only\ntype:拉麵 - type only\nnear:here - near the location shared within an hour\nopen:now or \"營業中\" - only shops open now",
+	"cmd.queryall":      "Advanced search including closed shops",
+	"cmd.queryall.help": "/queryall <keywords>\nSame as /query, including closed or relocated shops",
+	"cmd.random":        "Draw a random shop",
+	"cmd.random.help":   "/random <keywords>\nDraw a random shop matching keywords, press \"🎲Draw again\" for another\nWithout keywords, draw one near the location shared within an hour",
+	"cmd.radius":        "Location search radius",
+	"cmd.radius.help":   "/radius shows the current radius\n/radius 1km - change the default location search radius, choices: 200m 500m 1km 2km",
+	"cmd.favs":          "Favourite shops",
+	"cmd.favs.help":     "List shops saved with \"⭐Favourite\", sorted by distance if a location was shared within an hour",
+	"cmd.history":       "Recently viewed shops",
+	"cmd.history.help":  "List shops viewed recently, press \"🗑Clear history\" to clear",
+	"cmd.lunch":         "Vote for lunch in groups",
+	"cmd.lunch.help":    "/lunch <keywords>\nStart a poll of shops matching keywords, or reply to a location with /lunch\nThe result is announced when time is up or the creator presses \"🏁Close poll\"",
+	"cmd.submit":        "Submit a shop not listed",
+	"cmd.submit.help":   "Enter shop details step by step, the shop is added after review by admins. Enter /cancel to cancel",
+	"cmd.cancel":        "Cancel what is in progress",
+	"cmd.cancel.help":   "Cancel submitting a shop, reporting a problem or other steps in progress",
+	"cmd.lang":          "Choose language",
+	"cmd.lang.help":     "Choose the language of replies: 繁體中文, 简体中文 or English",
+
+	"cmd.stats":                "Statistics",
+	"cmd.stats.help":           "Show shop counts, shops by district, cache items and pending submissions",
+	"cmd.reports":              "Open reports",
+	"cmd.reports.help":         "List problems reported by users, shops to verify first",
+	"cmd.edit":                 "Edit a shop",
+	"cmd.edit.help":            "/edit <shop ID> <field> <value>\nFields: name address location type district url tags notes hours",
+	"cmd.close":                "Mark a shop closed",
+	"cmd.close.help":           "/close <shop ID> [YYYY-MM-DD]\nClosed today if no date is given",
+	"cmd.reopen":               "Reopen a shop",
+	"cmd.reopen.help":          "/reopen <shop ID>\nClear the closed or temporarily closed mark of a shop",
+	"cmd.fillinfo":             "Fill in shop coordinates",
+	"cmd.fillinfo.help":        "Run the fillinfo batch in background, filling in coordinates with the map service",
+	"cmd.refreshkeywords":      "Refresh keywords",
+	"cmd.refreshkeywords.help": "Rebuild the list of suggested keywords",
+	"cmd.flush":                "Flush cache",
+	"cmd.flush.help":           "Flush cached search results so edits take effect at once",
+	"cmd.ban":                  "Ban a user",
+	"cmd.ban.help":             "/ban <user ID> [duration]\nDuration such as 30m or 24h, permanent if not given\nMessages, buttons and inline queries of banned users are ignored",
+	"cmd.unban":                "Lift a ban",
+	"cmd.unban.help":           "/unban <user ID>",
+	"cmd.bans":                 "Banned users",
+	"cmd.bans.help":            "List banned users and when their bans end",
+}
@@ -0,0 +1,88 @@
+//Package locale holds catalogs of messages shown to users. Messages are
+//fmt formats looked up by key, falling back to the default language
+package locale
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	//LangHK is Traditional Chinese (Hong Kong), the default language
+	LangHK = "zh-HK"
+	//LangCN is Simplified Chinese
+	LangCN = "zh-CN"
+	//LangEN is English
+	LangEN = "en"
+	//Default is the language of users without preference, and of messages
+	//missing in other catalogs
+	Default = LangHK
+)
+
+//Catalog is messages of a language by key
+type Catalog map[string]string
+
+//Langs are the supported languages, in the order shown to users
+var Langs = []string{LangHK, LangCN, LangEN}
+
+var catalogs = map[string]Catalog{
+	LangHK: zhHK,
+	LangCN: zhCN,
+	LangEN: en,
+}
+
+type langKey struct{}
+
+//Supported checks if lang has a catalog
+func Supported(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+//Match returns the supported language of Telegram language code, which is an
+//IETF language tag such as "en-US" or "zh-hans"
+func Match(code string) string {
+	code = strings.ToLower(code)
+	switch {
+	case strings.HasPrefix(code, "en"):
+		return LangEN
+	case code == "zh-cn" || code == "zh-sg" || strings.HasPrefix(code, "zh-hans"):
+		return LangCN
+	}
+	return Default
+}
+
+//WithLang returns ctx carrying language of the user served
+func WithLang(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, langKey{}, lang)
+}
+
+//FromContext returns language carried by ctx, Default if none
+func FromContext(ctx context.Context) string {
+	if lang, ok := ctx.Value(langKey{}).(string); ok && Supported(lang) {
+		return lang
+	}
+	return Default
+}
+
+//Get returns message of key in lang, formatted with args. Key is returned if
+//no catalog has it
+func Get(lang, key string, args ...interface{}) string {
+	format, ok := catalogs[lang][key]
+	if !ok {
+		format, ok = catalogs[Default][key]
+	}
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+//T returns message of key in language of ctx, formatted with args
+func T(ctx context.Context, key string, args ...interface{}) string {
+	return Get(FromContext(ctx), key, args...)
+}
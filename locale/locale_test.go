@@ -0,0 +1,69 @@
+package locale
+
+import (
+	"context"
+	"regexp"
+	"testing"
+)
+
+var verb = regexp.MustCompile(`%[a-z]`)
+
+func TestCatalogsComplete(t *testing.T) {
+	for _, lang := range Langs {
+		c := catalogs[lang]
+		for key, format := range catalogs[Default] {
+			translated, ok := c[key]
+			if !ok {
+				t.Errorf("%s missing %s", lang, key)
+				continue
+			}
+			want, got := verb.FindAllString(format, -1), verb.FindAllString(translated, -1)
+			if len(want) != len(got) {
+				t.Errorf("%s %s expected verbs %v, actual %v", lang, key, want, got)
+				continue
+			}
+			for i := range want {
+				if want[i] != got[i] {
+					t.Errorf("%s %s expected verbs %v, actual %v", lang, key, want, got)
+					break
+				}
+			}
+		}
+		for key := range c {
+			if _, ok := catalogs[Default][key]; !ok {
+				t.Errorf("%s has unknown key %s", lang, key)
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	cases := map[string]string{
+		"":        LangHK,
+		"zh-hant": LangHK,
+		"zh-HK":   LangHK,
+		"zh-hans": LangCN,
+		"zh-CN":   LangCN,
+		"en":      LangEN,
+		"en-GB":   LangEN,
+		"ja":      LangHK,
+	}
+	for code, want := range cases {
+		if got := Match(code); got != want {
+			t.Errorf("%q expected: %s, actual %s", code, want, got)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	ctx := WithLang(context.Background(), LangEN)
+	if got := T(ctx, "random.progress", 1, 2); got != "🎲1 drawn, 2 left" {
+		t.Errorf("Unexpected message: %s", got)
+	}
+	if got := T(context.Background(), "session.cancelled"); got != "已取消" {
+		t.Errorf("Default language expected, actual %s", got)
+	}
+	if got := Get("fr", "unknown.key"); got != "unknown.key" {
+		t.Errorf("Key expected for unknown message, actual %s", got)
+	}
+}
@@ -0,0 +1,238 @@
+package locale
+
+var zhCN = Catalog{
+	"lang.name":    "简体中文",
+	"lang.current": "当前语言: %s\n请选择语言",
+	"lang.set":     "语言已设为简体中文",
+
+	"error.database":     "数据库错误！请稍后再试",
+	"error.shopNotFound": "数据库错误! 找不到店铺",
+	"error.system":       "系统错误，请稍后重试",
+
+	"search.expired":     "搜索已过期，请重新输入关键字或提供坐标",
+	"search.noneOpen":    "暂时没有营业中的店铺",
+	"search.noneNearby":  "附近 %s 范围内找不到店铺！",
+	"search.noResult":    "关键字找不到任何结果",
+	"search.suggest":     "关键字找不到任何结果\n可尝试以下关键字:\n%s",
+	"search.tryLocation": "关键字找不到任何结果\n可尝试直接提供坐标 (📎>Location) 搜索坐标附近店铺",
+
+	"query.error":         "搜索语法错误: %s",
+	"query.errorAt":       "搜索语法错误: %s\n%s",
+	"query.unknownField":  "不支持的字段，可用 district: type: near:here open:now",
+	"query.emptyValue":    "字段后需要内容，例如 district:旺角",
+	"query.unclosedQuote": "引号未关闭",
+	"query.misplacedOr":   "OR 需放在两个关键字之间",
+	"query.badValue":      "内容不正确，可用 near:here 或 open:now",
+	"query.duplicate":     "重复的条件",
+	"query.tooLong":       "关键字太多，最多 10 个",
+	"query.tooBroad":      "请提供最少一个关键字，或以 near:here 搜索附近",
+	"query.noLocation":    "请先分享位置 (📎>Location)，再以 near:here 搜索附近",
+
+	"button.website":      "🏠店铺网站",
+	"button.google":       "🔍Google 店名",
+	"button.movedTo":      "➡️新店址",
+	"button.showAll":      "🕒显示全部",
+	"button.openNow":      "🕒只看营业中",
+	"button.clearHistory": "🗑清除浏览记录",
+	"button.favourite":    "⭐收藏",
+	"button.report":       "⚠️报告错误",
+	"button.random":       "🎲随机",
+	"button.randomAgain":  "🎲再抽一次",
+	"button.refresh":      "🔄结果已更新，重新加载",
+	"button.closePoll":    "🏁结束投票",
+	"button.back":         "⬅️上一步",
+	"button.submit":       "✅提交",
+	"button.skip":         "⏭️跳过",
+	"button.cancel":       "❌取消",
+	"button.filter":       "🔎筛选",
+	"button.clearFilter":  "✖️取消筛选",
+	"button.backToList":   "⬅️返回列表",
+	"button.approve":      "✅接纳",
+	"button.reject":       "❌拒绝",
+	"button.edit":         "✏️修改",
+	"button.resolved":     "✅已处理",
+	"button.markClosed":   "⛔标示结业",
+
+	"facet.district": "📍地区",
+	"facet.type":     "🍽类型",
+
+	"hours.closedToday":      "🕒今日休息",
+	"hours.today":            "🕒今日营业时间: %s",
+	"hours.closingSoon":      " ⚠️即将关门",
+	"status.tempClosed":      "⏸️暂停营业",
+	"status.tempClosedUntil": "⏸️暂停营业至 %s",
+	"status.closed":          "⛔已结业",
+	"status.closedSince":     "⛔已于 %s 结业",
+	"status.moved":           "🚚已搬迁",
+
+	"fav.added":       "⭐已加入收藏，输入 /favs 查看",
+	"fav.removed":     "已从收藏移除",
+	"fav.unsupported": "暂不支持收藏店铺",
+	"fav.empty":       "你还没有收藏的店铺，可按店铺资料下方的「⭐收藏」加入",
+
+	"history.empty":   "没有浏览记录",
+	"history.cleared": "已清除浏览记录",
+
+	"group.intro": "大家好！在群组中请使用指令，例如:\n" +
+		"/query 中环 咖啡 - 搜索店铺\n" +
+		"/lunch 中环 - 投票决定吃什么\n" +
+		"也可以回复我的消息或提及我再加上关键字",
+
+	"radius.current": "当前坐标搜索范围: %s\n输入「/radius 范围」更改，可选: %s",
+	"radius.invalid": "范围只可以是: %s",
+	"radius.set":     "坐标搜索范围已设为 %s",
+
+	"random.usage":     "请输入「/random 关键字」，或先提供坐标 (📎>Location)",
+	"random.exhausted": "已经抽完所有店铺",
+	"random.progress":  "🎲已抽 %d 间，还有 %d 间",
+	"random.expired":   "抽选已过期，请重新搜索",
+
+	"session.groupReply": "\n\n(群组中请直接回复此消息)",
+	"session.none":       "没有进行中的操作",
+	"session.cancelled":  "已取消",
+	"session.useButtons": "请按按钮选择，或输入 /cancel 取消",
+	"session.expired":    "操作已超时，请重新开始",
+	"session.textOnly":   "请以文字回答",
+
+	"limit.throttled": "你的请求太频繁，请稍后再试",
+
+	"lunch.notEnough":   "找不到足够的店铺投票\n请输入 /lunch 关键字，或以 /lunch 回复一个位置",
+	"lunch.question":    "吃什么好？ (%d 分钟后结束)",
+	"lunch.creatorOnly": "只有发起人可以结束投票",
+	"lunch.noVotes":     "投票结束，没有人投票",
+	"lunch.result":      "🏆投票结果: %s (%d 票)",
+
+	"report.kind.C":    "已结业",
+	"report.kind.A":    "地址错误",
+	"report.kind.L":    "位置错误",
+	"report.kind.O":    "其他",
+	"report.askKind":   "请选择问题类型",
+	"report.askText":   "请简述问题，或输入 /cancel 取消",
+	"report.duplicate": "你已报告过这个问题，谢谢！",
+	"report.thanks":    "谢谢报告！管理员会尽快核实",
+
+	"submit.askName":     "请输入店名",
+	"submit.askDistrict": "请输入地区 (例如: 旺角、荃湾)，网店请输入「網店」",
+	"submit.askType":     "请输入类型 (例如: 咖啡、日本菜)",
+	"submit.askAddress":  "请输入地址，或分享位置 (📎>Location)",
+	"submit.askURL":      "请输入网址",
+	"submit.askNotes":    "请输入备注",
+	"submit.current":     "\n当前: %s",
+	"submit.confirm":     "请确认以下资料:\n\n%s",
+	"submit.name":        "店名: %s",
+	"submit.district":    "地区: %s",
+	"submit.type":        "类型: %s",
+	"submit.address":     "地址: %s",
+	"submit.url":         "网址: %s",
+	"submit.notes":       "备注: %s",
+	"submit.useButtons":  "请按「提交」确认，或按「上一步」修改",
+	"submit.incomplete":  "资料不完整: %s",
+	"submit.needAddress": "资料不完整: 需要地址、位置或网址",
+	"submit.thanks":      "谢谢提交！管理员审核后会通知你",
+	"submit.rejected":    "很抱歉，你提交的「%s」未获接纳",
+	"submit.approved":    "你提交的「%s」已被接纳，谢谢！",
+
+	"review.title":        "新店铺提交 #%d (由 %s %d)\n\n%s",
+	"review.notFound":     "找不到提交",
+	"review.done":         "提交 #%d 已由 %d 处理",
+	"review.rejected":     "已拒绝提交 #%d",
+	"review.conflict":     "提交 #%d 与店铺 %d 重复，请修改或拒绝",
+	"review.invalid":      "提交 #%d 资料不正确: %s",
+	"review.approved":     "已接纳提交 #%d，新增店铺 %d",
+	"review.geocodeLater": "，坐标将由批次补上",
+
+	"reports.title":       "店铺 %d %s (%s)",
+	"reports.flagged":     "🚩%s 需要核实",
+	"reports.none":        "没有待处理的回报",
+	"reports.more":        "尚有 %d 间店铺的回报未列出",
+	"reports.deletedShop": "(已删除)",
+	"reports.resolved":    "已处理店铺 %d 的 %d 个回报",
+
+	"admin.error":             "错误: %s",
+	"admin.shopCount":         "店铺总数: %d",
+	"admin.byStatus":          "营业中 %d，暂停营业 %d，已结业 %d，已搬迁 %d",
+	"admin.byDistrict":        "各区店铺:",
+	"admin.cacheItems":        "缓存项目: %d",
+	"admin.pending":           "待审核提交: %d",
+	"admin.noMapClient":       "未设定地图服务",
+	"admin.fillInfoRunning":   "补充资料批次正在执行",
+	"admin.fillInfoStart":     "开始补充店铺资料",
+	"admin.fillInfoProgress":  "补充店铺资料中: %d/%d",
+	"admin.fillInfoDone":      "补充店铺资料完成，%d 个错误",
+	"admin.noKeywords":        "数据库不支持更新关键字",
+	"admin.keywordsRefreshed": "已更新 %d 个关键字",
+	"admin.noShopID":          "请提供店铺编号",
+	"admin.badShopID":         "店铺编号不正确: %s",
+	"admin.badDate":           "日期不正确: %s",
+	"admin.closed":            "已将店铺 %d (%s) 标示为结业",
+	"admin.reopened":          "已将店铺 %d (%s) 标示为营业中",
+	"admin.editUsage":         "用法: /edit <店铺编号> <字段> <内容>\n字段: %s",
+	"admin.unknownField":      "不明字段: %s",
+	"admin.badLocation":       "坐标格式为 <纬度>,<经度>: %s",
+	"admin.editConflict":      "与店铺 %d 重复，未有更新",
+	"admin.edited":            "已更新店铺 %d (%s) 的 %s",
+	"admin.flushed":           "已清除缓存",
+
+	"ban.noUserID":      "请提供用户编号",
+	"ban.badUserID":     "用户编号不正确: %s",
+	"ban.admin":         "不能封锁管理员",
+	"ban.badDuration":   "时长不正确: %s",
+	"ban.permanent":     "%d 永久封锁",
+	"ban.until":         "%d 封锁至 %s",
+	"ban.bannedForever": "已永久封锁用户 %d",
+	"ban.bannedUntil":   "已封锁用户 %d 至 %s",
+	"ban.notBanned":     "用户 %d 没有被封锁",
+	"ban.unbanned":      "已解除封锁用户 %d",
+	"ban.none":          "没有被封锁的用户",
+	"ban.list":          "被封锁的用户:\n%s",
+
+	"help.commands": "指令列表:",
+	"help.details":  "输入「/help 指令」查看详情，例如 /help random",
+	"help.unknown":  "没有 /%s 这个指令，输入 /help 查看指令列表",
+
+	"cmd.help":          "指令列表及说明",
+	"cmd.help.help":     "/help 列出所有指令\n/help 指令 - 显示指令的详细说明",
+	"cmd.query":         "高级搜索",
+	"cmd.query.help":    "/query 关键字\n所有关键字须符合店铺的标签或地区\nA OR B - 符合其中之一\n-关键字 - 排除\n\"完整词组\"\ndistrict:旺角 - 只比对地区\ntype:拉麵 - 只比对类型\nnear:here - 一小时内分享过的位置附近\nopen:now 或加上「營業中」- 只显示现正营业的店铺",
+	"cmd.queryall":      "高级搜索，包括已结业店铺",
+	"cmd.queryall.help": "/queryall 关键字\n同 /query，但一并搜索已结业或已搬迁的店铺",
+	"cmd.random":        "随机抽一间店铺",
+	"cmd.random.help":   "/random 关键字\n随机抽一间符合关键字的店铺，可按「🎲再抽一次」\n不加关键字则抽一小时内分享过坐标附近的店铺",
+	"cmd.radius":        "坐标搜索范围",
+	"cmd.radius.help":   "/radius 显示当前范围\n/radius 1km - 更改默认坐标搜索范围，可选 200m 500m 1km 2km",
+	"cmd.favs":          "收藏的店铺",
+	"cmd.favs.help":     "列出按「⭐收藏」收藏的店铺，一小时内分享过坐标会以距离排序",
+	"cmd.history":       "最近浏览的店铺",
+	"cmd.history.help":  "列出最近浏览过的店铺，可按「🗑清除浏览记录」清除",
+	"cmd.lunch":         "群组投票决定吃什么",
+	"cmd.lunch.help":    "/lunch 关键字\n以符合关键字的店铺发起投票，或以 /lunch 回复一个位置\n投票时限过后或发起人按「🏁结束投票」公布结果",
+	"cmd.submit":        "提交未收录的店铺",
+	"cmd.submit.help":   "逐步输入店铺资料，经管理员审核后加入，输入 /cancel 可取消",
+	"cmd.cancel":        "取消进行中的操作",
+	"cmd.cancel.help":   "取消提交店铺或报告错误等进行中的操作",
+	"cmd.lang":          "选择语言",
+	"cmd.lang.help":     "选择回复所用的语言: 繁體中文、简体中文或 English",
+
+	"cmd.stats":                "统计资料",
+	"cmd.stats.help":           "显示店铺数目、各区店铺、缓存项目及待审核提交",
+	"cmd.reports":              "待处理的报告",
+	"cmd.reports.help":         "列出用户报告的问题，需要核实的店铺先列出",
+	"cmd.edit":                 "修改店铺资料",
+	"cmd.edit.help":            "/edit <店铺编号> <栏位> <内容>\n栏位: name address location type district url tags notes hours",
+	"cmd.close":                "标示店铺已结业",
+	"cmd.close.help":           "/close <店铺编号> [YYYY-MM-DD]\n不提供日期则以今日结业",
+	"cmd.reopen":               "重新开业",
+	"cmd.reopen.help":          "/reopen <店铺编号>\n取消店铺已结业或暂停营业的标示",
+	"cmd.fillinfo":             "补充店铺坐标",
+	"cmd.fillinfo.help":        "在后台执行补充资料批处理，以地图服务补上店铺坐标",
+	"cmd.refreshkeywords":      "更新关键字",
+	"cmd.refreshkeywords.help": "重新整理建议关键字列表",
+	"cmd.flush":                "清除缓存",
+	"cmd.flush.help":           "清除搜索结果缓存，修改资料后立即生效",
+	"cmd.ban":                  "封禁用户",
+	"cmd.ban.help":             "/ban <用户编号> [时长]\n时长例如 30m 或 24h，不提供则永久封禁\n被封禁用户的消息、按钮及行内搜索一概不处理",
+	"cmd.unban":                "解除封禁用户",
+	"cmd.unban.help":           "/unban <用户编号>",
+	"cmd.bans":                 "被封禁的用户",
+	"cmd.bans.help":            "列出被封禁的用户及封禁期限",
+}
@@ -0,0 +1,238 @@
+package locale
+
+var zhHK = Catalog{
+	"lang.name":    "繁體中文",
+	"lang.current": "現時語言: %s\n請選擇語言",
+	"lang.set":     "語言已設為繁體中文",
+
+	"error.database":     "資料庫錯誤！請稍後再試",
+	"error.shopNotFound": "資料庫錯誤! 找不到店舖",
+	"error.system":       "系統錯誤，請稍後重試",
+
+	"search.expired":     "搜尋已過期，請重新輸入關鍵字或提供座標",
+	"search.noneOpen":    "暫時沒有營業中的店舖",
+	"search.noneNearby":  "附近 %s 範圍內找不到店舖！",
+	"search.noResult":    "關鍵字找不到任何結果",
+	"search.suggest":     "關鍵字找不到任何結果\n可嘗試以下關鍵字:\n%s",
+	"search.tryLocation": "關鍵字找不到任何結果\n可嘗試直接提供座標 (📎>Location) 搜尋座標附近店舖",
+
+	"query.error":         "搜尋語法錯誤: %s",
+	"query.errorAt":       "搜尋語法錯誤: %s\n%s",
+	"query.unknownField":  "不支援的欄位，可用 district: type: near:here open:now",
+	"query.emptyValue":    "欄位後需要內容，例如 district:旺角",
+	"query.unclosedQuote": "引號未關閉",
+	"query.misplacedOr":   "OR 需放在兩個關鍵字之間",
+	"query.badValue":      "內容不正確，可用 near:here 或 open:now",
+	"query.duplicate":     "重複的條件",
+	"query.tooLong":       "關鍵字太多，最多 10 個",
+	"query.tooBroad":      "請提供最少一個關鍵字，或以 near:here 搜尋附近",
+	"query.noLocation":    "請先分享位置 (📎>Location)，再以 near:here 搜尋附近",
+
+	"button.website":      "🏠店舖網站",
+	"button.google":       "🔍Google 店名",
+	"button.movedTo":      "➡️新店址",
+	"button.showAll":      "🕒顯示全部",
+	"button.openNow":      "🕒只看營業中",
+	"button.clearHistory": "🗑清除瀏覽記錄",
+	"button.favourite":    "⭐收藏",
+	"button.report":       "⚠️回報錯誤",
+	"button.random":       "🎲隨機",
+	"button.randomAgain":  "🎲再抽一次",
+	"button.refresh":      "🔄結果已更新，重新載入",
+	"button.closePoll":    "🏁結束投票",
+	"button.back":         "⬅️上一步",
+	"button.submit":       "✅提交",
+	"button.skip":         "⏭️略過",
+	"button.cancel":       "❌取消",
+	"button.filter":       "🔎篩選",
+	"button.clearFilter":  "✖️取消篩選",
+	"button.backToList":   "⬅️返回列表",
+	"button.approve":      "✅接納",
+	"button.reject":       "❌拒絕",
+	"button.edit":         "✏️修改",
+	"button.resolved":     "✅已處理",
+	"button.markClosed":   "⛔標示結業",
+
+	"facet.district": "📍地區",
+	"facet.type":     "🍽類型",
+
+	"hours.closedToday":      "🕒今日休息",
+	"hours.today":            "🕒今日營業時間: %s",
+	"hours.closingSoon":      " ⚠️即將關門",
+	"status.tempClosed":      "⏸️暫停營業",
+	"status.tempClosedUntil": "⏸️暫停營業至 %s",
+	"status.closed":          "⛔已結業",
+	"status.closedSince":     "⛔已於 %s 結業",
+	"status.moved":           "🚚已搬遷",
+
+	"fav.added":       "⭐已加入收藏，輸入 /favs 查看",
+	"fav.removed":     "已從收藏移除",
+	"fav.unsupported": "暫不支援收藏店舖",
+	"fav.empty":       "你未有收藏的店舖，可按店舖資料下方的「⭐收藏」加入",
+
+	"history.empty":   "未有瀏覽記錄",
+	"history.cleared": "已清除瀏覽記錄",
+
+	"group.intro": "大家好！在群組中請使用指令，例如:\n" +
+		"/query 中環 咖啡 - 搜尋店舖\n" +
+		"/lunch 中環 - 投票決定食乜好\n" +
+		"亦可回覆我的訊息或提及我再加上關鍵字",
+
+	"radius.current": "現時座標搜尋範圍: %s\n輸入「/radius 範圍」更改，可選: %s",
+	"radius.invalid": "範圍只可以是: %s",
+	"radius.set":     "座標搜尋範圍已設為 %s",
+
+	"random.usage":     "請輸入「/random 關鍵字」，或先提供座標 (📎>Location)",
+	"random.exhausted": "已經抽完所有店舖",
+	"random.progress":  "🎲已抽 %d 間，尚餘 %d 間",
+	"random.expired":   "抽選已過期，請重新搜尋",
+
+	"session.groupReply": "\n\n(群組中請直接回覆此訊息)",
+	"session.none":       "沒有進行中的操作",
+	"session.cancelled":  "已取消",
+	"session.useButtons": "請按按鈕選擇，或輸入 /cancel 取消",
+	"session.expired":    "操作已逾時，請重新開始",
+	"session.textOnly":   "請以文字回答",
+
+	"limit.throttled": "你的請求太頻繁，請稍後再試",
+
+	"lunch.notEnough":   "找不到足夠的店舖投票\n請輸入 /lunch 關鍵字，或以 /lunch 回覆一個位置",
+	"lunch.question":    "食乜好？ (%d 分鐘後結束)",
+	"lunch.creatorOnly": "只有發起人可以結束投票",
+	"lunch.noVotes":     "投票結束，沒有人投票",
+	"lunch.result":      "🏆投票結果: %s (%d 票)",
+
+	"report.kind.C":    "已結業",
+	"report.kind.A":    "地址錯誤",
+	"report.kind.L":    "位置錯誤",
+	"report.kind.O":    "其他",
+	"report.askKind":   "請選擇問題類型",
+	"report.askText":   "請簡述問題，或輸入 /cancel 取消",
+	"report.duplicate": "你已回報過這個問題，多謝！",
+	"report.thanks":    "多謝回報！管理員會盡快核實",
+
+	"submit.askName":     "請輸入店名",
+	"submit.askDistrict": "請輸入地區 (例如: 旺角、荃灣)，網店請輸入「網店」",
+	"submit.askType":     "請輸入類型 (例如: 咖啡、日本菜)",
+	"submit.askAddress":  "請輸入地址，或分享位置 (📎>Location)",
+	"submit.askURL":      "請輸入網址",
+	"submit.askNotes":    "請輸入備註",
+	"submit.current":     "\n目前: %s",
+	"submit.confirm":     "請確認以下資料:\n\n%s",
+	"submit.name":        "店名: %s",
+	"submit.district":    "地區: %s",
+	"submit.type":        "類型: %s",
+	"submit.address":     "地址: %s",
+	"submit.url":         "網址: %s",
+	"submit.notes":       "備註: %s",
+	"submit.useButtons":  "請按「提交」確認，或按「上一步」修改",
+	"submit.incomplete":  "資料不完整: %s",
+	"submit.needAddress": "資料不完整: 需要地址、位置或網址",
+	"submit.thanks":      "多謝提交！管理員審核後會通知你",
+	"submit.rejected":    "很抱歉，你提交的「%s」未獲接納",
+	"submit.approved":    "你提交的「%s」已被接納，多謝！",
+
+	"review.title":        "新店舖提交 #%d (由 %s %d)\n\n%s",
+	"review.notFound":     "找不到提交",
+	"review.done":         "提交 #%d 已由 %d 處理",
+	"review.rejected":     "已拒絕提交 #%d",
+	"review.conflict":     "提交 #%d 與店舖 %d 重複，請修改或拒絕",
+	"review.invalid":      "提交 #%d 資料不正確: %s",
+	"review.approved":     "已接納提交 #%d，新增店舖 %d",
+	"review.geocodeLater": "，座標將由批次補上",
+
+	"reports.title":       "店舖 %d %s (%s)",
+	"reports.flagged":     "🚩%s 需要核實",
+	"reports.none":        "沒有待處理的回報",
+	"reports.more":        "尚有 %d 間店舖的回報未列出",
+	"reports.deletedShop": "(已刪除)",
+	"reports.resolved":    "已處理店舖 %d 的 %d 個回報",
+
+	"admin.error":             "錯誤: %s",
+	"admin.shopCount":         "店舖總數: %d",
+	"admin.byStatus":          "營業中 %d，暫停營業 %d，已結業 %d，已搬遷 %d",
+	"admin.byDistrict":        "各區店舖:",
+	"admin.cacheItems":        "快取項目: %d",
+	"admin.pending":           "待審核提交: %d",
+	"admin.noMapClient":       "未設定地圖服務",
+	"admin.fillInfoRunning":   "補充資料批次正在執行",
+	"admin.fillInfoStart":     "開始補充店舖資料",
+	"admin.fillInfoProgress":  "補充店舖資料中: %d/%d",
+	"admin.fillInfoDone":      "補充店舖資料完成，%d 個錯誤",
+	"admin.noKeywords":        "資料庫不支援更新關鍵字",
+	"admin.keywordsRefreshed": "已更新 %d 個關鍵字",
+	"admin.noShopID":          "請提供店舖編號",
+	"admin.badShopID":         "店舖編號不正確: %s",
+	"admin.badDate":           "日期不正確: %s",
+	"admin.closed":            "已將店舖 %d (%s) 標示為結業",
+	"admin.reopened":          "已將店舖 %d (%s) 標示為營業中",
+	"admin.editUsage":         "用法: /edit <店舖編號> <欄位> <內容>\n欄位: %s",
+	"admin.unknownField":      "不明欄位: %s",
+	"admin.badLocation":       "座標格式為 <緯度>,<經度>: %s",
+	"admin.editConflict":      "與店舖 %d 重複，未有更新",
+	"admin.edited":            "已更新店舖 %d (%s) 的 %s",
+	"admin.flushed":           "已清除快取",
+
+	"ban.noUserID":      "請提供用戶編號",
+	"ban.badUserID":     "用戶編號不正確: %s",
+	"ban.admin":         "不能封鎖管理員",
+	"ban.badDuration":   "時長不正確: %s",
+	"ban.permanent":     "%d 永久封鎖",
+	"ban.until":         "%d 封鎖至 %s",
+	"ban.bannedForever": "已永久封鎖用戶 %d",
+	"ban.bannedUntil":   "已封鎖用戶 %d 至 %s",
+	"ban.notBanned":     "用戶 %d 沒有被封鎖",
+	"ban.unbanned":      "已解除封鎖用戶 %d",
+	"ban.none":          "沒有被封鎖的用戶",
+	"ban.list":          "被封鎖的用戶:\n%s",
+
+	"help.commands": "指令列表:",
+	"help.details":  "輸入「/help 指令」查看詳情，例如 /help random",
+	"help.unknown":  "沒有 /%s 這個指令，輸入 /help 查看指令列表",
+
+	"cmd.help":          "指令列表及說明",
+	"cmd.help.help":     "/help 列出所有指令\n/help 指令 - 顯示指令的詳細說明",
+	"cmd.query":         "進階搜尋",
+	"cmd.query.help":    "/query 關鍵字\n所有關鍵字須符合店舖的標籤或地區\nA OR B - 符合其中之一\n-關鍵字 - 排除\n\"完整詞組\"\ndistrict:旺角 - 只比對地區\ntype:拉麵 - 只比對類型\nnear:here - 一小時內分享過的位置附近\nopen:now 或加上「營業中」- 只顯示現正營業的店舖",
+	"cmd.queryall":      "進階搜尋，包括已結業店舖",
+	"cmd.queryall.help": "/queryall 關鍵字\n同 /query，但一併搜尋已結業或已搬遷的店舖",
+	"cmd.random":        "隨機抽一間店舖",
+	"cmd.random.help":   "/random 關鍵字\n隨機抽一間符合關鍵字的店舖，可按「🎲再抽一次」\n不加關鍵字則抽一小時內分享過座標附近的店舖",
+	"cmd.radius":        "座標搜尋範圍",
+	"cmd.radius.help":   "/radius 顯示現時範圍\n/radius 1km - 更改預設座標搜尋範圍，可選 200m 500m 1km 2km",
+	"cmd.favs":          "收藏的店舖",
+	"cmd.favs.help":     "列出按「⭐收藏」收藏的店舖，一小時內分享過座標會以距離排序",
+	"cmd.history":       "最近瀏覽的店舖",
+	"cmd.history.help":  "列出最近瀏覽過的店舖，可按「🗑清除瀏覽記錄」清除",
+	"cmd.lunch":         "群組投票決定食乜好",
+	"cmd.lunch.help":    "/lunch 關鍵字\n以符合關鍵字的店舖發起投票，或以 /lunch 回覆一個位置\n投票時限過後或發起人按「🏁結束投票」公佈結果",
+	"cmd.submit":        "提交未收錄的店舖",
+	"cmd.submit.help":   "逐步輸入店舖資料，經管理員審核後加入，輸入 /cancel 可取消",
+	"cmd.cancel":        "取消進行中的操作",
+	"cmd.cancel.help":   "取消提交店舖或回報錯誤等進行中的操作",
+	"cmd.lang":          "選擇語言",
+	"cmd.lang.help":     "選擇回覆所用的語言: 繁體中文、简体中文或 English",
+
+	"cmd.stats":                "統計資料",
+	"cmd.stats.help":           "顯示店舖數目、各區店舖、快取項目及待審核提交",
+	"cmd.reports":              "待處理的回報",
+	"cmd.reports.help":         "列出用戶回報的問題，需要核實的店舖先列出",
+	"cmd.edit":                 "修改店舖資料",
+	"cmd.edit.help":            "/edit <店舖編號> <欄位> <內容>\n欄位: name address location type district url tags notes hours",
+	"cmd.close":                "標示店舖已結業",
+	"cmd.close.help":           "/close <店舖編號> [YYYY-MM-DD]\n不提供日期則以今日結業",
+	"cmd.reopen":               "重新開業",
+	"cmd.reopen.help":          "/reopen <店舖編號>\n取消店舖已結業或暫停營業的標示",
+	"cmd.fillinfo":             "補充店舖座標",
+	"cmd.fillinfo.help":        "在背景執行補充資料批次，以地圖服務補上店舖座標",
+	"cmd.refreshkeywords":      "更新關鍵字",
+	"cmd.refreshkeywords.help": "重新整理建議關鍵字列表",
+	"cmd.flush":                "清除快取",
+	"cmd.flush.help":           "清除搜尋結果快取，修改資料後立即生效",
+	"cmd.ban":                  "封鎖用戶",
+	"cmd.ban.help":             "/ban <用戶編號> [時長]\n時長例如 30m 或 24h，不提供則永久封鎖\n被封鎖用戶的訊息、按鈕及行內搜尋一概不處理",
+	"cmd.unban":                "解除封鎖用戶",
+	"cmd.unban.help":           "/unban <用戶編號>",
+	"cmd.bans":                 "被封鎖的用戶",
+	"cmd.bans.help":            "列出被封鎖的用戶及封鎖期限",
+}
@@ -0,0 +1,345 @@
+package wongdim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//LunchCandidates is the maximum number of shops in a lunch poll
+	LunchCandidates = 5
+	//DefaultLunchPollDuration is the time before a lunch poll is closed
+	DefaultLunchPollDuration = 15 * time.Minute
+
+	//lunchPrefix is callback data of the close poll button, followed by user
+	//ID of the poll creator
+	lunchPrefix = "LP"
+	//lunchKey is the UserStore key prefix of polls of creator, followed by
+	//chat ID and message ID
+	lunchKey = "lunch:"
+	//openLunchKey is the UserStore key of open polls by poll ID, under
+	//systemUserID
+	openLunchKey = "lunchPolls"
+	//maxPollOption is the length limit of poll options
+	maxPollOption = 100
+)
+
+//lunchPoll is an open lunch poll
+type lunchPoll struct {
+	ShopIDs []int //Shops in order of options
+}
+
+//openLunch finds an open poll by poll ID, and closes it on time after restart
+type openLunch struct {
+	ChatID    int64
+	MessageID int
+	Creator   int
+	Deadline  time.Time
+	//Lang is the language of the creator, which the result is in
+	Lang string
+}
+
+//pollResult is the part of Telegram Poll used, which is not supported by
+//the bot library
+type pollResult struct {
+	ID       string `json:"id"`
+	IsClosed bool   `json:"is_closed"`
+	Options  []struct {
+		Text       string `json:"text"`
+		VoterCount int    `json:"voter_count"`
+	} `json:"options"`
+}
+
+//sentPoll is the part of message of a poll sent used
+type sentPoll struct {
+	MessageID int        `json:"message_id"`
+	Poll      pollResult `json:"poll"`
+}
+
+//lunchMu serializes closing of polls by timer, button and Telegram, and
+//changes of open polls
+var lunchMu sync.Mutex
+
+// WithLunchPollDuration configures the time before a lunch poll is closed
+func WithLunchPollDuration(d time.Duration) Option {
+	return func(s *ServeBot) error {
+		if d <= 0 {
+			return fmt.Errorf("Lunch poll duration must be positive: %v", d)
+		}
+		s.lunchDuration = d
+		return nil
+	}
+}
+
+func lunchPollKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("%s%d:%d", lunchKey, chatID, messageID)
+}
+
+//lunchCandidates returns shops open now if possible, shuffled, near the
+//location replied to or shared recently when no keywords are given
+func (r *ServeBot) lunchCandidates(ctx context.Context, msg *tgbotapi.Message) ([]dao.Shop, error) {
+	keywords := strings.TrimSpace(msg.CommandArguments())
+	var shops []dao.Shop
+	var err error
+	switch {
+	case keywords != "":
+		shops, err = r.shopWithTags(ctx, keywords)
+	case msg.ReplyToMessage != nil && msg.ReplyToMessage.Location != nil:
+		shops, err = r.shopWithCoord(ctx, msg.ReplyToMessage.Location.Latitude,
+			msg.ReplyToMessage.Location.Longitude, r.userRadius(ctx, msg.From))
+	default:
+		geohash, ok := userLocations.Get(strconv.Itoa(msg.From.ID))
+		if !ok {
+			return nil, nil
+		}
+		shops, err = r.shopWithGeohash(ctx, geohash.(string), r.userRadius(ctx, msg.From), false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]dao.Shop, 0, len(shops))
+	for i := range shops {
+		if shops[i].HasPhyLoc() {
+			candidates = append(candidates, shops[i])
+		}
+	}
+	if open := r.openNow(candidates, time.Now()); len(open) >= 2 {
+		candidates = open
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	return candidates[:min(len(candidates), LunchCandidates)], nil
+}
+
+//lunchCommand posts a poll of candidate shops, closed after lunchDuration or
+//by the creator
+func (r *ServeBot) lunchCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	shops, err := r.lunchCandidates(ctx, msg)
+	if err != nil {
+		log.WithError(err).Error("Database error")
+		return r.SendMsg(msg.Chat.ID, locale.T(ctx, "error.database"))
+	}
+	if len(shops) < 2 {
+		return r.SendMsg(msg.Chat.ID, locale.T(ctx, "lunch.notEnough"))
+	}
+	options := make([]string, len(shops))
+	ids := make([]int, len(shops))
+	for i := range shops {
+		option := []rune(fmt.Sprintf("%s (%s)", shops[i].Name, shops[i].District))
+		options[i] = string(option[:min(len(option), maxPollOption)])
+		ids[i] = shops[i].ID
+	}
+	optionsJSON, _ := json.Marshal(options)
+	markup, _ := json.Marshal(tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(locale.T(ctx, "button.closePoll"), lunchPrefix+strconv.Itoa(msg.From.ID)))))
+	params := url.Values{}
+	params.Set("chat_id", strconv.FormatInt(msg.Chat.ID, 10))
+	params.Set("question", locale.T(ctx, "lunch.question", int(r.lunchDuration.Minutes())))
+	params.Set("options", string(optionsJSON))
+	params.Set("is_anonymous", "false")
+	params.Set("reply_markup", string(markup))
+	resp, err := r.bot.MakeRequest("sendPoll", params)
+	if err != nil {
+		return err
+	}
+	var sent sentPoll
+	err = json.Unmarshal(resp.Result, &sent)
+	if err != nil {
+		return err
+	}
+	err = dao.SaveUserData(ctx, r.users, msg.From.ID, lunchPollKey(msg.Chat.ID, sent.MessageID), lunchPoll{ids})
+	if err != nil {
+		return err
+	}
+	//Result is in language of the creator, same as closing by button
+	open := openLunch{
+		ChatID:    msg.Chat.ID,
+		MessageID: sent.MessageID,
+		Creator:   msg.From.ID,
+		Deadline:  time.Now().Add(r.lunchDuration),
+		Lang:      locale.FromContext(ctx),
+	}
+	err = r.updateOpenLunches(ctx, func(polls map[string]openLunch) {
+		polls[sent.Poll.ID] = open
+	})
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"chatID":  msg.Chat.ID,
+		"userID":  msg.From.ID,
+		"shopIDs": ids,
+	}).Info("Lunch poll started")
+	r.scheduleLunch(open)
+	return nil
+}
+
+//updateOpenLunches changes open polls by f and saves them
+func (r *ServeBot) updateOpenLunches(ctx context.Context, f func(polls map[string]openLunch)) error {
+	lunchMu.Lock()
+	defer lunchMu.Unlock()
+	return r.updateOpenLunchesLocked(ctx, f)
+}
+
+//updateOpenLunchesLocked is updateOpenLunches with lunchMu held
+func (r *ServeBot) updateOpenLunchesLocked(ctx context.Context, f func(polls map[string]openLunch)) error {
+	polls := make(map[string]openLunch)
+	_, err := dao.LoadUserData(ctx, r.users, systemUserID, openLunchKey, &polls)
+	if err != nil {
+		return err
+	}
+	f(polls)
+	return dao.SaveUserData(ctx, r.users, systemUserID, openLunchKey, polls)
+}
+
+//scheduleLunch closes poll at its deadline, at once if it has passed
+func (r *ServeBot) scheduleLunch(open openLunch) {
+	time.AfterFunc(time.Until(open.Deadline), func() {
+		ctx, cancel := context.WithTimeout(context.Background(), UpdateTimeout)
+		defer cancel()
+		r.closeLunch(locale.WithLang(ctx, open.Lang), open.ChatID, open.MessageID, open.Creator, nil)
+	})
+}
+
+//restoreLunches schedules closing of polls left open by last run
+func (r *ServeBot) restoreLunches(ctx context.Context) error {
+	polls := make(map[string]openLunch)
+	_, err := dao.LoadUserData(ctx, r.users, systemUserID, openLunchKey, &polls)
+	if err != nil {
+		return err
+	}
+	for _, open := range polls {
+		r.scheduleLunch(open)
+	}
+	if len(polls) > 0 {
+		log.WithField("pollCount", len(polls)).Info("Lunch polls restored")
+	}
+	return nil
+}
+
+//lunchPollClosed announces result of poll closed in Telegram, such as by
+//an admin of the chat. Polls closed by the bot are not open any more
+func (r *ServeBot) lunchPollClosed(ctx context.Context, poll pollResult) {
+	polls := make(map[string]openLunch)
+	_, err := dao.LoadUserData(ctx, r.users, systemUserID, openLunchKey, &polls)
+	if err != nil {
+		log.WithError(err).Error("Cannot load lunch polls")
+		return
+	}
+	open, ok := polls[poll.ID]
+	if !ok {
+		return
+	}
+	r.closeLunch(locale.WithLang(ctx, open.Lang), open.ChatID, open.MessageID, open.Creator, &poll)
+}
+
+//lunchCallback handles the close poll button, which only the creator may
+//press
+func (r *ServeBot) lunchCallback(ctx context.Context, cb *tgbotapi.CallbackQuery) {
+	answer := tgbotapi.NewCallback(cb.ID, "")
+	defer func() {
+		r.bot.AnswerCallbackQuery(answer)
+	}()
+	creator, err := strconv.Atoi(strings.TrimPrefix(cb.Data, lunchPrefix))
+	if err != nil {
+		log.WithError(err).WithField("callbackData", cb.Data).Error("Unexpected callback data")
+		return
+	}
+	if cb.From.ID != creator {
+		answer.Text = locale.T(ctx, "lunch.creatorOnly")
+		return
+	}
+	r.closeLunch(ctx, cb.Message.Chat.ID, cb.Message.MessageID, creator, nil)
+}
+
+//closeLunch stops the poll and announces the shop with most votes. Ties are
+//broken randomly. result is the closed poll if it was closed in Telegram
+func (r *ServeBot) closeLunch(ctx context.Context, chatID int64, messageID, creator int, result *pollResult) {
+	logger := log.WithFields(log.Fields{
+		"chatID":    chatID,
+		"messageID": messageID,
+	})
+	lunchMu.Lock()
+	defer lunchMu.Unlock()
+	key := lunchPollKey(chatID, messageID)
+	var poll lunchPoll
+	found, err := dao.LoadUserData(ctx, r.users, creator, key, &poll)
+	if err != nil {
+		logger.WithError(err).Error("Cannot load lunch poll")
+		return
+	}
+	if !found {
+		//Closed already
+		return
+	}
+	err = r.users.DeleteUserData(ctx, creator, key)
+	if err != nil {
+		logger.WithError(err).Error("Cannot delete lunch poll")
+	}
+	err = r.updateOpenLunchesLocked(ctx, func(polls map[string]openLunch) {
+		for id, open := range polls {
+			if open.ChatID == chatID && open.MessageID == messageID {
+				delete(polls, id)
+			}
+		}
+	})
+	if err != nil {
+		logger.WithError(err).Error("Cannot delete lunch poll")
+	}
+	if result == nil {
+		params := url.Values{}
+		params.Set("chat_id", strconv.FormatInt(chatID, 10))
+		params.Set("message_id", strconv.Itoa(messageID))
+		resp, err := r.bot.MakeRequest("stopPoll", params)
+		result = &pollResult{}
+		if err == nil {
+			err = json.Unmarshal(resp.Result, result)
+		}
+		if err != nil {
+			logger.WithError(err).Error("Cannot stop poll")
+			return
+		}
+	}
+	winners := make([]int, 0)
+	most := 0
+	for i := range result.Options {
+		if i >= len(poll.ShopIDs) {
+			break
+		}
+		switch votes := result.Options[i].VoterCount; {
+		case votes > most:
+			winners, most = []int{poll.ShopIDs[i]}, votes
+		case votes == most && votes > 0:
+			winners = append(winners, poll.ShopIDs[i])
+		}
+	}
+	if len(winners) == 0 {
+		r.SendMsg(chatID, locale.T(ctx, "lunch.noVotes"))
+		return
+	}
+	shop, err := r.da.ShopByID(ctx, winners[rand.Intn(len(winners))])
+	if err != nil {
+		logger.WithError(err).Error("Shop not found")
+		r.SendMsg(chatID, locale.T(ctx, "error.shopNotFound"))
+		return
+	}
+	logger.WithFields(log.Fields{
+		"shopID": shop.ID,
+		"votes":  most,
+	}).Info("Lunch poll closed")
+	r.SendText(chatID, locale.T(ctx, "lunch.result", shop.Name, most))
+	r.SendSingleShop(ctx, chatID, shop)
+}
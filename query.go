@@ -0,0 +1,94 @@
+package wongdim
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+//errNoLocation is returned for near:here if user has not shared a location
+//recently
+var errNoLocation = errors.New("No location shared recently")
+
+//parseQuery parses /query text of user. near:here is replaced by location
+//shared recently and radius of user, so the search can be rerun for paging
+func (r *ServeBot) parseQuery(ctx context.Context, user *tgbotapi.User, text string) (dao.Query, error) {
+	q, err := dao.ParseQuery(text)
+	if err != nil {
+		return dao.Query{}, err
+	}
+	if q.Near == dao.NearHere {
+		geohash, ok := userLocations.Get(strconv.Itoa(user.ID))
+		if !ok {
+			return dao.Query{}, errNoLocation
+		}
+		q.Near = geohash.(string) + "@" + r.userRadius(ctx, user)
+	}
+	return q, nil
+}
+
+//queryErrorText explains err of parseQuery or advSearch to user, pointing to
+//the bad token. It returns false for other errors
+func queryErrorText(ctx context.Context, err error) (string, bool) {
+	if err == errNoLocation {
+		return locale.T(ctx, "query.noLocation"), true
+	}
+	var qe *dao.QueryError
+	if !errors.As(err, &qe) {
+		return "", false
+	}
+	reason := locale.T(ctx, "query."+qe.Reason)
+	if qe.Pos < 0 {
+		return locale.T(ctx, "query.error", reason), true
+	}
+	runes := []rune(qe.Query)
+	return locale.T(ctx, "query.errorAt", reason, string(runes[:qe.Pos])+"👉"+string(runes[qe.Pos:])), true
+}
+
+//advSearchKey reruns /query in paging key
+func (r *ServeBot) advSearchKey(ctx context.Context, query string, includeClosed bool) ([]dao.Shop, error) {
+	q, err := dao.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return r.advSearch(ctx, q, includeClosed)
+}
+
+//advSearchNear returns shops matching q within its near: radius, nearest
+//first. Queries with near: only filter the shops nearby, which include
+//closed shops if includeClosed is set
+func (r *ServeBot) advSearchNear(ctx context.Context, q dao.Query, includeClosed bool) ([]dao.Shop, error) {
+	geohash, radius := splitGeoKey(q.Near)
+	nearby, err := r.shopWithGeohash(ctx, geohash, radius, includeClosed)
+	if err != nil {
+		return nil, err
+	}
+	match := q.Match
+	if len(q.Must) > 0 {
+		terms := q
+		terms.Near = ""
+		shops, err := r.advSearch(ctx, terms, includeClosed)
+		if err != nil {
+			return nil, err
+		}
+		ids := make(map[int]struct{}, len(shops))
+		for i := range shops {
+			ids[shops[i].ID] = struct{}{}
+		}
+		match = func(shop dao.Shop) bool {
+			_, ok := ids[shop.ID]
+			return ok
+		}
+	}
+	result := make([]dao.Shop, 0, len(nearby))
+	for i := range nearby {
+		if match(nearby[i]) {
+			result = append(result, nearby[i])
+		}
+	}
+	return result, nil
+}
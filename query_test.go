@@ -0,0 +1,36 @@
+package wongdim
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+)
+
+func TestQueryErrorText(t *testing.T) {
+	ctx := locale.WithLang(context.Background(), locale.LangEN)
+	parseError := func(query string) error {
+		_, err := dao.ParseQuery(query)
+		return err
+	}
+	cases := []struct {
+		name string
+		err  error
+		want string
+		ok   bool
+	}{
+		{"no location", errNoLocation, locale.Get(locale.LangEN, "query.noLocation"), true},
+		{"bad token", parseError("咖啡 color:紅"), "Invalid search: " + locale.Get(locale.LangEN, "query.unknownField") + "\n咖啡 👉color:紅", true},
+		{"unclosed quote", parseError(`旺角 "咖啡`), "Invalid search: " + locale.Get(locale.LangEN, "query.unclosedQuote") + "\n旺角 👉\"咖啡", true},
+		{"whole query", &dao.QueryError{Query: "open:now", Pos: -1, Reason: dao.QueryTooBroad}, "Invalid search: " + locale.Get(locale.LangEN, "query.tooBroad"), true},
+		{"other", errors.New("connection refused"), "", false},
+	}
+	for _, c := range cases {
+		got, ok := queryErrorText(ctx, c.err)
+		if got != c.want || ok != c.ok {
+			t.Errorf("%s expected: %q %v, actual %q %v", c.name, c.want, c.ok, got, ok)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package wongdim
+
+import (
+	"context"
+	"strings"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	log "github.com/sirupsen/logrus"
+)
+
+//radiusKey is the UserStore key of default search radius
+const radiusKey = "radius"
+
+//searchRadii are the radii of location search users can choose
+var searchRadii = []string{"200m", "500m", "1km", "2km"}
+
+func validRadius(radius string) bool {
+	for _, r := range searchRadii {
+		if r == radius {
+			return true
+		}
+	}
+	return false
+}
+
+//geoKey returns search key of shops within radius of geohash
+func geoKey(geohash, radius string) string {
+	return geoSearchPrefix + geohash + "@" + radius
+}
+
+//splitGeoKey returns geohash and radius of location search key without
+//prefix. Keys made before radius is selectable have DistanceLimit
+func splitGeoKey(key string) (string, string) {
+	parts := strings.SplitN(key, "@", 2)
+	if len(parts) < 2 || !validRadius(parts[1]) {
+		return parts[0], DistanceLimit
+	}
+	return parts[0], parts[1]
+}
+
+//radiusRow re-runs location search of key with other radii, keeping the open
+//now filter
+func radiusRow(key string, token func(string) string) []tgbotapi.InlineKeyboardButton {
+	prefix := ""
+	if strings.HasPrefix(key, openNowPrefix) {
+		prefix = openNowPrefix
+	}
+	geohash, current := splitGeoKey(strings.TrimPrefix(strings.TrimPrefix(key, prefix), geoSearchPrefix))
+	row := make([]tgbotapi.InlineKeyboardButton, len(searchRadii))
+	for i, radius := range searchRadii {
+		text := radius
+		if radius == current {
+			text = "✅" + radius
+		}
+		row[i] = tgbotapi.NewInlineKeyboardButtonData(text, "P0|"+token(prefix+geoKey(geohash, radius)))
+	}
+	return row
+}
+
+//userRadius returns default search radius of user
+func (r *ServeBot) userRadius(ctx context.Context, user *tgbotapi.User) string {
+	if user == nil {
+		return DistanceLimit
+	}
+	var radius string
+	_, err := dao.LoadUserData(ctx, r.users, user.ID, radiusKey, &radius)
+	if err != nil {
+		log.WithError(err).WithField("userID", user.ID).Error("Cannot load search radius")
+	}
+	if !validRadius(radius) {
+		return DistanceLimit
+	}
+	return radius
+}
+
+//radiusCommand shows or sets default search radius of user
+func (r *ServeBot) radiusCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	radius := strings.ToLower(strings.TrimSpace(msg.CommandArguments()))
+	if radius == "" {
+		return r.SendMsg(msg.Chat.ID, locale.T(ctx, "radius.current",
+			r.userRadius(ctx, msg.From), strings.Join(searchRadii, " ")))
+	}
+	if !validRadius(radius) {
+		return r.SendMsg(msg.Chat.ID, locale.T(ctx, "radius.invalid", strings.Join(searchRadii, " ")))
+	}
+	err := dao.SaveUserData(ctx, r.users, msg.From.ID, radiusKey, radius)
+	if err != nil {
+		log.WithError(err).Error("Database error")
+		return r.SendMsg(msg.Chat.ID, locale.T(ctx, "error.database"))
+	}
+	log.WithFields(log.Fields{
+		"userID": msg.From.ID,
+		"radius": radius,
+	}).Info("Search radius set")
+	return r.SendMsg(msg.Chat.ID, locale.T(ctx, "radius.set", radius))
+}
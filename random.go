@@ -0,0 +1,146 @@
+package wongdim
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	gcache "github.com/patrickmn/go-cache"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//RandomDrawTimeout is how long shops drawn are remembered for drawing again
+	RandomDrawTimeout = time.Hour
+
+	//randomPrefix is callback data of random button on lists, followed by
+	//query token
+	randomPrefix = "RN"
+	//randomAgain is callback data of draw again button
+	randomAgain = "RA"
+)
+
+//randomDraw is the state of random picks from a search
+type randomDraw struct {
+	Key string
+	//Shown are IDs of shops drawn already
+	Shown []int
+}
+
+//randomDraws holds draws by chat ID and message ID of draw again button
+var randomDraws = gcache.New(RandomDrawTimeout, 2*RandomDrawTimeout)
+
+//randomButton draws a shop from search of query token
+func randomButton(lang, token string) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(locale.Get(lang, "button.random"), randomPrefix+token)
+}
+
+//randomKey returns search key of /random, searching near the location shared
+//recently when no keywords are given. It is empty if there is neither
+func (r *ServeBot) randomKey(ctx context.Context, msg *tgbotapi.Message) string {
+	keywords := strings.TrimSpace(msg.CommandArguments())
+	if keywords == "" {
+		if geohash, ok := userLocations.Get(strconv.Itoa(msg.From.ID)); ok {
+			return geoKey(geohash.(string), r.userRadius(ctx, msg.From))
+		}
+		return ""
+	}
+	query, openNow := splitOpenNow(keywords)
+	if openNow {
+		return openNowPrefix + simpleSearchPrefix + query
+	}
+	return simpleSearchPrefix + query
+}
+
+//randomCommand sends a random shop matching keywords
+func (r *ServeBot) randomCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	key := r.randomKey(ctx, msg)
+	if key == "" {
+		return r.SendMsg(msg.Chat.ID, locale.T(ctx, "random.usage"))
+	}
+	return r.drawShop(ctx, msg.Chat.ID, msg.From, randomDraw{Key: key})
+}
+
+//drawShop sends a shop of search not shown yet, followed by the draw again
+//button. Shops not open for business are skipped
+func (r *ServeBot) drawShop(ctx context.Context, chatID int64, user *tgbotapi.User, draw randomDraw) error {
+	shops, err := r.shopsByKey(ctx, draw.Key)
+	if err != nil {
+		log.WithError(err).Error("Database error")
+		return r.SendMsg(chatID, locale.T(ctx, "error.database"))
+	}
+	shown := make(map[int]struct{}, len(draw.Shown))
+	for _, id := range draw.Shown {
+		shown[id] = struct{}{}
+	}
+	now := time.Now()
+	candidates := make([]dao.Shop, 0, len(shops))
+	for i := range shops {
+		if _, ok := shown[shops[i].ID]; !ok && shops[i].StatusAt(now) == dao.StatusOpen {
+			candidates = append(candidates, shops[i])
+		}
+	}
+	log.WithFields(log.Fields{
+		"query":        keySource(draw.Key),
+		"shownCnt":     len(draw.Shown),
+		"candidateCnt": len(candidates),
+	}).Info("Random draw")
+	switch {
+	case len(candidates) == 0 && len(draw.Shown) > 0:
+		return r.SendMsg(chatID, locale.T(ctx, "random.exhausted"))
+	case len(candidates) == 0 && strings.HasPrefix(draw.Key, openNowPrefix):
+		return r.SendMsg(chatID, locale.T(ctx, "search.noneOpen"))
+	case len(candidates) == 0:
+		return r.SendMsg(chatID, locale.T(ctx, "search.noResult"))
+	}
+	shop := candidates[rand.Intn(len(candidates))]
+	err = r.SendSingleShop(ctx, chatID, shop)
+	if err != nil {
+		return err
+	}
+	r.recordView(ctx, user, shop.ID, keySource(draw.Key))
+	draw.Shown = append(draw.Shown, shop.ID)
+	if len(candidates) == 1 {
+		return nil
+	}
+	msg := tgbotapi.NewMessage(chatID, locale.T(ctx, "random.progress", len(draw.Shown), len(candidates)-1))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(locale.T(ctx, "button.randomAgain"), randomAgain)))
+	sent, err := r.bot.Send(msg)
+	if err != nil {
+		return err
+	}
+	randomDraws.SetDefault(listMessageKey(chatID, sent.MessageID), draw)
+	return nil
+}
+
+//randomCallback handles random button on lists and draw again button
+func (r *ServeBot) randomCallback(ctx context.Context, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	var err error
+	if cb.Data == randomAgain {
+		drawKey := listMessageKey(chatID, cb.Message.MessageID)
+		v, ok := randomDraws.Get(drawKey)
+		if !ok {
+			err = r.SendMsg(chatID, locale.T(ctx, "random.expired"))
+		} else {
+			//Button is used once, the next one comes with the new shop
+			randomDraws.Delete(drawKey)
+			r.bot.Send(tgbotapi.NewEditMessageText(chatID, cb.Message.MessageID, cb.Message.Text))
+			err = r.drawShop(ctx, chatID, cb.From, v.(randomDraw))
+		}
+	} else if key, ok := r.queryKey(ctx, strings.TrimPrefix(cb.Data, randomPrefix)); ok {
+		err = r.drawShop(ctx, chatID, cb.From, randomDraw{Key: key})
+	} else {
+		err = r.SendMsg(chatID, locale.T(ctx, "search.expired"))
+	}
+	if err != nil {
+		log.WithError(err).Error("Telegram error")
+	}
+	r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(cb.ID, ""))
+}
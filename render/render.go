@@ -0,0 +1,213 @@
+//Package render formats shops into Telegram messages. Shop data is escaped
+//for the parse mode before templates see it, so templates only carry markup
+package render
+
+import (
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"equa.link/wongdim/dao"
+)
+
+const (
+	//ModeHTML renders messages with Telegram HTML
+	ModeHTML = "HTML"
+	//ModeMarkdownV2 renders messages with Telegram MarkdownV2
+	ModeMarkdownV2 = "MarkdownV2"
+	//MaxMessageLen is the length limit of Telegram text messages
+	MaxMessageLen = 4096
+
+	//TmplList is the template of shop lists, executed with []ListItem
+	TmplList = "list"
+	//TmplDetail is the template of shops without location, executed with
+	//ShopView
+	TmplDetail = "detail"
+	//TmplNotes is the template of notes of shop, executed with ShopView
+	TmplNotes = "notes"
+	//TmplInline is the template of inline results of shops without location,
+	//executed with ShopView
+	TmplInline = "inline"
+)
+
+//templateNames are templates a Renderer has, and may be overridden by files
+//with ".tmpl" appended in template directory
+var templateNames = []string{TmplList, TmplDetail, TmplNotes, TmplInline}
+
+var defaultTemplates = map[string]map[string]string{
+	ModeHTML: {
+		TmplList: `{{range .}}({{.Index}}) <b>{{.Name}}</b> ({{.Type}}) - {{.District}}` +
+			`{{if .Status}} {{.Status}}{{end}}{{if .URL}} <a href="{{.URL}}">連結</a>{{end}}` +
+			`{{if .Notes}}` + "\n" + `📝{{.Notes}}{{end}}` + "\n" + `{{end}}`,
+		TmplDetail: `<b>{{.Name}}</b> ({{.Type}}) - ` + "\n" + `<a href="{{.URL}}">連結</a>`,
+		TmplNotes:  `📝備註: {{.Notes}}`,
+		TmplInline: `{{.Name}} ({{.Type}})` + "\n" + `{{.Address}} - ({{.District}}){{.URL}}`,
+	},
+	ModeMarkdownV2: {
+		TmplList: `{{range .}}\({{.Index}}\) *{{.Name}}* \({{.Type}}\) \- {{.District}}` +
+			`{{if .Status}} {{.Status}}{{end}}{{if .URL}} [連結]({{.URL}}){{end}}` +
+			`{{if .Notes}}` + "\n" + `📝{{.Notes}}{{end}}` + "\n" + `{{end}}`,
+		TmplDetail: `*{{.Name}}* \({{.Type}}\) \- ` + "\n" + `[連結]({{.URL}})`,
+		TmplNotes:  `📝備註: {{.Notes}}`,
+		TmplInline: `{{.Name}} \({{.Type}}\)` + "\n" + `{{.Address}} \- \({{.District}}\){{.URL}}`,
+	},
+}
+
+//markdownV2Escaper escapes characters reserved in MarkdownV2 text
+var markdownV2Escaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+//markdownV2URLEscaper escapes characters reserved in MarkdownV2 link targets
+var markdownV2URLEscaper = strings.NewReplacer(`\`, `\\`, ")", `\)`)
+
+//ShopView is shop data escaped for the parse mode
+type ShopView struct {
+	ID       int
+	Name     string
+	Type     string
+	District string
+	Address  string
+	//URL is escaped for use as link target
+	URL   string
+	Notes string
+	//Status describes status of shop, empty if open
+	Status string
+}
+
+//ListItem is a shop in list, numbered from 1 on each page
+type ListItem struct {
+	Index int
+	ShopView
+}
+
+//Renderer renders messages in a parse mode
+type Renderer struct {
+	mode string
+	tmpl *template.Template
+}
+
+//New returns Renderer of mode. Templates in dir override the defaults, dir
+//may be empty for none
+func New(mode, dir string) (*Renderer, error) {
+	defaults, ok := defaultTemplates[mode]
+	if !ok {
+		return nil, fmt.Errorf("Unknown parse mode: %s", mode)
+	}
+	tmpl := template.New(mode)
+	for _, name := range templateNames {
+		text := defaults[name]
+		if dir != "" {
+			content, err := ioutil.ReadFile(filepath.Join(dir, name+".tmpl"))
+			if err == nil {
+				text = string(content)
+			} else if !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		_, err := tmpl.New(name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("Template %s: %w", name, err)
+		}
+	}
+	return &Renderer{mode: mode, tmpl: tmpl}, nil
+}
+
+//Default returns Renderer of HTML with default templates
+func Default() *Renderer {
+	r, err := New(ModeHTML, "")
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+//Mode returns parse mode of messages rendered
+func (r *Renderer) Mode() string {
+	return r.mode
+}
+
+//Escape escapes text for the parse mode
+func (r *Renderer) Escape(text string) string {
+	if r.mode == ModeMarkdownV2 {
+		return markdownV2Escaper.Replace(text)
+	}
+	return html.EscapeString(text)
+}
+
+//escapeURL escapes url for use as link target
+func (r *Renderer) escapeURL(url string) string {
+	if r.mode == ModeMarkdownV2 {
+		return markdownV2URLEscaper.Replace(url)
+	}
+	return html.EscapeString(url)
+}
+
+//View escapes shop for templates, with status describing it
+func (r *Renderer) View(shop dao.Shop, status string) ShopView {
+	return ShopView{
+		ID:       shop.ID,
+		Name:     r.Escape(shop.Name),
+		Type:     r.Escape(shop.Type),
+		District: r.Escape(shop.District),
+		Address:  r.Escape(shop.Address),
+		URL:      r.escapeURL(shop.URL),
+		Notes:    r.Escape(shop.Notes),
+		Status:   r.Escape(status),
+	}
+}
+
+//Render executes template name with data
+func (r *Renderer) Render(name string, data interface{}) (string, error) {
+	var b strings.Builder
+	err := r.tmpl.ExecuteTemplate(&b, name, data)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+//Split breaks text into messages within limit characters. Text is split
+//between lines, so markup of templates should not span lines. Lines longer
+//than limit are split anywhere
+func Split(text string, limit int) []string {
+	if len([]rune(text)) <= limit {
+		return []string{text}
+	}
+	parts := make([]string, 0)
+	var b strings.Builder
+	size := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		runes := []rune(line)
+		if size+len(runes) > limit && size > 0 {
+			parts = append(parts, strings.TrimSuffix(b.String(), "\n"))
+			b.Reset()
+			size = 0
+		}
+		for len(runes) > limit {
+			parts = append(parts, string(runes[:limit]))
+			runes = runes[limit:]
+		}
+		b.WriteString(string(runes))
+		size += len(runes)
+	}
+	if size > 0 {
+		parts = append(parts, b.String())
+	}
+	return parts
+}
+
+//Truncate cuts text to the first message of Split, marking the cut
+func Truncate(text string, limit int) string {
+	parts := Split(text, limit-1)
+	if len(parts) == 1 {
+		return text
+	}
+	return parts[0] + "…"
+}
@@ -0,0 +1,103 @@
+package render
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"equa.link/wongdim/dao"
+)
+
+var testShop = dao.Shop{
+	ID:       1,
+	Name:     "*Cafe_[A]* & <B>",
+	Type:     "咖啡",
+	District: "中環",
+	URL:      "https://example.com/a_(b)?c=1&d=2",
+	Notes:    "1.5折 (限時)!",
+}
+
+func TestRenderList(t *testing.T) {
+	cases := []struct {
+		mode string
+		want string
+	}{
+		{ModeHTML, `(1) <b>*Cafe_[A]* &amp; &lt;B&gt;</b> (咖啡) - 中環 <a href="https://example.com/a_(b)?c=1&amp;d=2">連結</a>` +
+			"\n📝1.5折 (限時)!\n"},
+		{ModeMarkdownV2, `\(1\) *\*Cafe\_\[A\]\* & <B\>* \(咖啡\) \- 中環 [連結](https://example.com/a_(b\)?c=1&d=2)` +
+			"\n📝1\\.5折 \\(限時\\)\\!\n"},
+	}
+	for _, c := range cases {
+		r, err := New(c.mode, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, err := r.Render(TmplList, []ListItem{{Index: 1, ShopView: r.View(testShop, "")}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text != c.want {
+			t.Errorf("%s expected: %q, actual %q", c.mode, c.want, text)
+		}
+	}
+}
+
+func TestTemplateOverride(t *testing.T) {
+	dir, err := ioutil.TempDir("", "render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, TmplNotes+".tmpl"), []byte("備註 {{.Notes}}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(ModeHTML, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := r.Render(TmplNotes, r.View(dao.Shop{Notes: "a<b"}, ""))
+	if err != nil || text != "備註 a&lt;b" {
+		t.Errorf("Overridden template expected: %q, actual %q, %v", "備註 a&lt;b", text, err)
+	}
+	//Templates without override files keep the defaults
+	text, err = r.Render(TmplDetail, r.View(testShop, ""))
+	if err != nil || !strings.HasPrefix(text, "<b>") {
+		t.Errorf("Default template expected, actual %q, %v", text, err)
+	}
+	if _, err := New("Markdown", ""); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	lines := make([]string, 0)
+	for i := 0; i < 100; i++ {
+		lines = append(lines, strings.Repeat("店", 99))
+	}
+	text := strings.Join(lines, "\n")
+	parts := Split(text, MaxMessageLen)
+	if len(parts) != 3 {
+		t.Fatalf("Expected 3 parts, actual %d", len(parts))
+	}
+	for _, p := range parts {
+		if n := len([]rune(p)); n > MaxMessageLen {
+			t.Errorf("Part of %d characters over limit", n)
+		}
+		if strings.HasPrefix(p, "\n") || strings.HasSuffix(p, "\n") {
+			t.Error("Part not split between lines")
+		}
+	}
+	if strings.Join(parts, "\n") != text {
+		t.Error("Parts do not join back to text")
+	}
+	long := strings.Repeat("a", 10)
+	if parts := Split(long, 4); len(parts) != 3 || parts[2] != "aa" {
+		t.Errorf("Long line expected split anywhere, actual %q", parts)
+	}
+	if text := Truncate(long, 4); text != "aaa…" {
+		t.Errorf("Truncate expected: %q, actual %q", "aaa…", text)
+	}
+}
@@ -0,0 +1,308 @@
+package wongdim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//ReportTimeout is the time allowed for describing a problem after
+	//choosing 其他
+	ReportTimeout = 10 * time.Minute
+	//reportFlow is the session flow describing a problem
+	reportFlow = "report"
+	//DefaultReportThreshold is the number of closed reports before a shop is
+	//flagged for verification
+	DefaultReportThreshold = 3
+	//MaxReportsListed is the number of shops listed by /reports
+	MaxReportsListed = 10
+
+	//reportPrefix is callback data of report buttons, followed by kind (none
+	//for choosing) and shop ID
+	reportPrefix = "RP"
+	//reportReviewPrefix is callback data of admin buttons, followed by action
+	//and shop ID
+	reportReviewPrefix = "RV"
+
+	reportDismiss = "D"
+	reportArchive = "C"
+)
+
+//reportKinds are the choices of report, in the order shown
+var reportKinds = []string{dao.ReportClosed, dao.ReportAddress, dao.ReportLocation, dao.ReportOther}
+
+// WithReportThreshold configures the number of closed reports before a shop is
+// flagged for verification
+func WithReportThreshold(n int) Option {
+	return func(s *ServeBot) error {
+		if n < 1 {
+			return fmt.Errorf("Report threshold must be positive: %d", n)
+		}
+		s.reportThreshold = n
+		return nil
+	}
+}
+
+func reportKindName(lang, kind string) string {
+	for i := range reportKinds {
+		if reportKinds[i] == kind {
+			return locale.Get(lang, "report.kind."+kind)
+		}
+	}
+	return kind
+}
+
+//reportButton is for reporting problem of shop
+func reportButton(lang string, shop dao.Shop) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(locale.Get(lang, "button.report"), reportPrefix+strconv.Itoa(shop.ID))
+}
+
+//reportCallback handles report buttons of shop
+func (r *ServeBot) reportCallback(ctx context.Context, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	defer r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(cb.ID, ""))
+	data := strings.TrimPrefix(cb.Data, reportPrefix)
+	kind := ""
+	if data != "" && (data[0] < '0' || data[0] > '9') {
+		kind, data = data[:1], data[1:]
+	}
+	shopID, err := strconv.Atoi(data)
+	if err != nil {
+		log.WithError(err).WithField("callbackData", cb.Data).Error("Unexpected callback data")
+		return
+	}
+	switch kind {
+	case "":
+		//Ask for kind of problem
+		rows := make([][]tgbotapi.InlineKeyboardButton, len(reportKinds))
+		lang := locale.FromContext(ctx)
+		for i, kind := range reportKinds {
+			rows[i] = tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(reportKindName(lang, kind),
+				reportPrefix+kind+strconv.Itoa(shopID)))
+		}
+		msg := tgbotapi.NewMessage(chatID, locale.Get(lang, "report.askKind"))
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+		_, err = r.bot.Send(msg)
+	case dao.ReportOther:
+		err = r.StartSession(ctx, chatID, cb.From.ID, reportFlow, shopID)
+	default:
+		err = r.saveReport(ctx, chatID, dao.Report{ShopID: shopID, UserID: cb.From.ID, Kind: kind, Created: time.Now()})
+	}
+	if err != nil {
+		log.WithError(err).Error("Telegram error")
+	}
+}
+
+//reportFlowDef returns the flow describing a problem, with shop ID as state
+func (r *ServeBot) reportFlowDef() Flow {
+	return Flow{
+		Name:    reportFlow,
+		Start:   "text",
+		Timeout: ReportTimeout,
+		Steps: map[string]Step{
+			"text": {
+				Prompt: func(s *Session) tgbotapi.Chattable {
+					return tgbotapi.NewMessage(s.ChatID, locale.Get(s.Lang, "report.askText"))
+				},
+				Input: r.reportInput,
+			},
+		},
+	}
+}
+
+//reportInput saves description of problem sent by user
+func (r *ServeBot) reportInput(ctx context.Context, s *Session, msg *tgbotapi.Message) (string, error) {
+	text := strings.TrimSpace(msg.Text)
+	if text == "" {
+		return "", &RetryError{locale.T(ctx, "session.textOnly")}
+	}
+	var shopID int
+	err := s.Load(&shopID)
+	if err != nil {
+		return "", err
+	}
+	return StepEnd, r.saveReport(ctx, s.ChatID, dao.Report{ShopID: shopID, UserID: msg.From.ID,
+		Kind: dao.ReportOther, Text: text, Created: time.Now()})
+}
+
+//saveReport saves report and flags the shop once it has enough closed reports
+func (r *ServeBot) saveReport(ctx context.Context, chatID int64, rep dao.Report) error {
+	logger := log.WithFields(log.Fields{
+		"shopID": rep.ShopID,
+		"userID": rep.UserID,
+		"kind":   rep.Kind,
+	})
+	shop, err := r.da.ShopByID(ctx, rep.ShopID)
+	if err != nil {
+		logger.WithError(err).Error("Shop not found")
+		return r.SendMsg(chatID, locale.T(ctx, "error.shopNotFound"))
+	}
+	_, err = r.reports.AddReport(ctx, rep)
+	if errors.Is(err, dao.ErrDuplicateReport) {
+		return r.SendMsg(chatID, locale.T(ctx, "report.duplicate"))
+	} else if err != nil {
+		logger.WithError(err).Error("Database error")
+		return r.SendMsg(chatID, locale.T(ctx, "error.database"))
+	}
+	logger.Info("Shop reported")
+	if rep.Kind == dao.ReportClosed {
+		reps, err := r.reports.OpenReports(ctx)
+		if err != nil {
+			logger.WithError(err).Error("Database error")
+		}
+		closed := 0
+		for i := range reps {
+			if reps[i].ShopID == rep.ShopID && reps[i].Kind == dao.ReportClosed {
+				closed++
+			}
+		}
+		//Notify once when the threshold is reached
+		if closed == r.reportThreshold {
+			logger.WithField("reportCount", closed).Warn("Shop flagged for verification")
+			for id := range r.admins {
+				err := r.sendShopReports(r.langOf(ctx, id), int64(id), shop, filterReports(reps, rep.ShopID))
+				if err != nil {
+					log.WithError(err).WithField("adminID", id).Error("Cannot notify admin")
+				}
+			}
+		}
+	}
+	return r.SendMsg(chatID, locale.T(ctx, "report.thanks"))
+}
+
+//filterReports returns reports of shop
+func filterReports(reps []dao.Report, shopID int) []dao.Report {
+	result := make([]dao.Report, 0)
+	for i := range reps {
+		if reps[i].ShopID == shopID {
+			result = append(result, reps[i])
+		}
+	}
+	return result
+}
+
+//closedCount returns the number of closed reports
+func closedCount(reps []dao.Report) int {
+	cnt := 0
+	for i := range reps {
+		if reps[i].Kind == dao.ReportClosed {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+//sendShopReports sends open reports of a shop with buttons for admin
+func (r *ServeBot) sendShopReports(lang string, chatID int64, shop dao.Shop, reps []dao.Report) error {
+	lines := make([]string, 0, len(reps)+1)
+	title := locale.Get(lang, "reports.title", shop.ID, shop.Name, shop.District)
+	if closedCount(reps) >= r.reportThreshold {
+		title = locale.Get(lang, "reports.flagged", title)
+	}
+	lines = append(lines, title)
+	for i := range reps {
+		line := fmt.Sprintf("- %s (%d, %s)", reportKindName(lang, reps[i].Kind), reps[i].UserID,
+			reps[i].Created.In(dao.HKT).Format("2006-01-02"))
+		if reps[i].Text != "" {
+			line += ": " + reps[i].Text
+		}
+		lines = append(lines, line)
+	}
+	id := strconv.Itoa(shop.ID)
+	msg := tgbotapi.NewMessage(chatID, strings.Join(lines, "\n"))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(locale.Get(lang, "button.resolved"), reportReviewPrefix+reportDismiss+id),
+		tgbotapi.NewInlineKeyboardButtonData(locale.Get(lang, "button.markClosed"), reportReviewPrefix+reportArchive+id),
+	))
+	_, err := r.bot.Send(msg)
+	return err
+}
+
+//listReports sends open reports grouped by shop, flagged shops first
+func (r *ServeBot) listReports(ctx context.Context, chatID int64) (string, error) {
+	reps, err := r.reports.OpenReports(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(reps) == 0 {
+		return locale.T(ctx, "reports.none"), nil
+	}
+	byShop := make(map[int][]dao.Report)
+	shopIDs := make([]int, 0)
+	for i := range reps {
+		if _, ok := byShop[reps[i].ShopID]; !ok {
+			shopIDs = append(shopIDs, reps[i].ShopID)
+		}
+		byShop[reps[i].ShopID] = append(byShop[reps[i].ShopID], reps[i])
+	}
+	sort.SliceStable(shopIDs, func(i, j int) bool {
+		return closedCount(byShop[shopIDs[i]]) >= r.reportThreshold && closedCount(byShop[shopIDs[j]]) < r.reportThreshold
+	})
+	for i, id := range shopIDs {
+		if i == MaxReportsListed {
+			return locale.T(ctx, "reports.more", len(shopIDs)-i), nil
+		}
+		shop, err := r.da.ShopByID(ctx, id)
+		if err != nil {
+			//Reports of deleted shop
+			shop = dao.Shop{ID: id, Name: locale.T(ctx, "reports.deletedShop")}
+		}
+		err = r.sendShopReports(locale.FromContext(ctx), chatID, shop, byShop[id])
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+//reportReviewCallback handles admin buttons of reports
+func (r *ServeBot) reportReviewCallback(ctx context.Context, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	defer r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(cb.ID, ""))
+	if !r.isAdmin(cb.From.ID) {
+		log.WithField("userID", cb.From.ID).Warn("Review by non-admin")
+		return
+	}
+	action := strings.TrimPrefix(cb.Data, reportReviewPrefix)
+	if action == "" {
+		return
+	}
+	shopID, err := strconv.Atoi(action[1:])
+	if err != nil {
+		log.WithError(err).WithField("callbackData", cb.Data).Error("Unexpected callback data")
+		return
+	}
+	logger := log.WithFields(log.Fields{
+		"shopID":  shopID,
+		"adminID": cb.From.ID,
+	})
+	now := time.Now()
+	if action[:1] == reportArchive {
+		err = r.da.ArchiveShop(ctx, shopID, now)
+		if err != nil {
+			logger.WithError(err).Error("Database error")
+			r.SendText(chatID, locale.T(ctx, "admin.error", err.Error()))
+			return
+		}
+		cache.Flush()
+		logger.Info("Shop closed after report")
+	}
+	cnt, err := r.reports.ResolveReports(ctx, shopID, cb.From.ID, now)
+	if err != nil {
+		logger.WithError(err).Error("Database error")
+		r.SendMsg(chatID, locale.T(ctx, "error.database"))
+		return
+	}
+	logger.WithField("reportCount", cnt).Info("Reports resolved")
+	r.SendMsg(chatID, locale.T(ctx, "reports.resolved", shopID, cnt))
+}
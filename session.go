@@ -0,0 +1,337 @@
+package wongdim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	gcache "github.com/patrickmn/go-cache"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//SessionTimeout is the idle time before a session is dropped, unless the
+	//flow sets its own
+	SessionTimeout = 30 * time.Minute
+
+	//SessionMemory keeps sessions in memory, they are lost on restart
+	SessionMemory = "memory"
+	//SessionBackend keeps sessions in the backend as user data
+	SessionBackend = "backend"
+
+	//StepEnd as the next step finishes the session
+	StepEnd = ""
+
+	//sessionPrefix is callback data of buttons made by sessionButton
+	sessionPrefix = "SS"
+	//sessionKey is the UserStore key prefix of sessions, followed by chat ID
+	sessionKey = "session:"
+)
+
+//Session is the state of a multi-step conversation of a user in a chat
+type Session struct {
+	ChatID int64
+	UserID int
+	Flow   string
+	Step   string
+	//Lang is language of the user, for prompts
+	Lang string
+	//Data is the state of flow, see Load and Store
+	Data    json.RawMessage
+	Expires time.Time
+}
+
+//Load decodes state of flow into v, leaving v unchanged if there is none
+func (s *Session) Load(v interface{}) error {
+	if len(s.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(s.Data, v)
+}
+
+//Store saves v as state of flow
+func (s *Session) Store(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.Data = data
+	return nil
+}
+
+//RetryError asks for input of the current step again, showing reason to user
+type RetryError struct {
+	Reason string
+}
+
+func (e *RetryError) Error() string {
+	return e.Reason
+}
+
+//Step is a state of a flow. Handlers return the next step, which is prompted
+//after the session is saved. Errors other than RetryError end the session
+type Step struct {
+	//Prompt returns the message asking for input, nil for none
+	Prompt func(s *Session) tgbotapi.Chattable
+	//Input handles message sent by user, nil if the step accepts buttons only
+	Input func(ctx context.Context, s *Session, msg *tgbotapi.Message) (string, error)
+	//Callback handles buttons made by sessionButton, with the data given
+	Callback func(ctx context.Context, s *Session, cb *tgbotapi.CallbackQuery, data string) (string, error)
+}
+
+//Flow is a declarative multi-step conversation
+type Flow struct {
+	Name  string
+	Start string
+	//Timeout is the idle time allowed, SessionTimeout if zero
+	Timeout time.Duration
+	Steps   map[string]Step
+}
+
+//SessionStore keeps sessions by chat and user. Expired sessions are not
+//returned
+type SessionStore interface {
+	Session(ctx context.Context, chatID int64, userID int) (Session, bool, error)
+	SaveSession(ctx context.Context, s Session) error
+	DeleteSession(ctx context.Context, chatID int64, userID int) error
+}
+
+//memorySessionStore keeps sessions in memory
+type memorySessionStore struct {
+	sessions *gcache.Cache
+}
+
+//NewMemorySessionStore returns session store in memory
+func NewMemorySessionStore() SessionStore {
+	return memorySessionStore{gcache.New(SessionTimeout, SessionTimeout)}
+}
+
+func memorySessionKey(chatID int64, userID int) string {
+	return fmt.Sprintf("%d:%d", chatID, userID)
+}
+
+func (m memorySessionStore) Session(ctx context.Context, chatID int64, userID int) (Session, bool, error) {
+	v, ok := m.sessions.Get(memorySessionKey(chatID, userID))
+	if !ok {
+		return Session{}, false, nil
+	}
+	return v.(Session), true, nil
+}
+
+func (m memorySessionStore) SaveSession(ctx context.Context, s Session) error {
+	m.sessions.Set(memorySessionKey(s.ChatID, s.UserID), s, time.Until(s.Expires))
+	return nil
+}
+
+func (m memorySessionStore) DeleteSession(ctx context.Context, chatID int64, userID int) error {
+	m.sessions.Delete(memorySessionKey(chatID, userID))
+	return nil
+}
+
+//userSessionStore keeps sessions as user data in backend, surviving restart
+type userSessionStore struct {
+	users dao.UserStore
+}
+
+//NewUserSessionStore returns session store saving to user data of backend
+func NewUserSessionStore(users dao.UserStore) SessionStore {
+	return userSessionStore{users}
+}
+
+func (u userSessionStore) Session(ctx context.Context, chatID int64, userID int) (Session, bool, error) {
+	var s Session
+	found, err := dao.LoadUserData(ctx, u.users, userID, sessionKey+strconv.FormatInt(chatID, 10), &s)
+	if err != nil || !found {
+		return Session{}, false, err
+	}
+	if time.Now().After(s.Expires) {
+		return Session{}, false, u.DeleteSession(ctx, chatID, userID)
+	}
+	return s, true, nil
+}
+
+func (u userSessionStore) SaveSession(ctx context.Context, s Session) error {
+	return dao.SaveUserData(ctx, u.users, s.UserID, sessionKey+strconv.FormatInt(s.ChatID, 10), s)
+}
+
+func (u userSessionStore) DeleteSession(ctx context.Context, chatID int64, userID int) error {
+	return u.users.DeleteUserData(ctx, userID, sessionKey+strconv.FormatInt(chatID, 10))
+}
+
+// WithSessionStorage configures where sessions are kept, SessionMemory or
+// SessionBackend
+func WithSessionStorage(storage string) Option {
+	return func(s *ServeBot) error {
+		switch storage {
+		case SessionMemory, SessionBackend:
+			s.sessionStorage = storage
+			return nil
+		}
+		return fmt.Errorf("Unknown session storage: %s", storage)
+	}
+}
+
+//registerFlow makes flow available to StartSession
+func (r *ServeBot) registerFlow(f Flow) {
+	if r.flows == nil {
+		r.flows = make(map[string]Flow)
+	}
+	r.flows[f.Name] = f
+}
+
+//sessionButton makes a button handled by Callback of current step
+func sessionButton(text, data string) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(text, sessionPrefix+data)
+}
+
+//StartSession begins flow for user in chat with state data, replacing any
+//active session
+func (r *ServeBot) StartSession(ctx context.Context, chatID int64, userID int, flow string, data interface{}) error {
+	f, ok := r.flows[flow]
+	if !ok {
+		return fmt.Errorf("Unknown flow: %s", flow)
+	}
+	s := Session{ChatID: chatID, UserID: userID, Flow: flow}
+	if data != nil {
+		err := s.Store(data)
+		if err != nil {
+			return err
+		}
+	}
+	log.WithFields(log.Fields{
+		"userID": userID,
+		"flow":   flow,
+	}).Info("Session started")
+	return r.advance(ctx, f, s, f.Start, nil)
+}
+
+//advance moves session to next step returned by a handler and prompts for
+//it
+func (r *ServeBot) advance(ctx context.Context, f Flow, s Session, next string, err error) error {
+	var retry *RetryError
+	if errors.As(err, &retry) {
+		err = r.SendText(s.ChatID, retry.Reason)
+		if err != nil {
+			return err
+		}
+		next = s.Step
+	} else if err != nil {
+		//Session may be inconsistent after other errors
+		r.sessions.DeleteSession(ctx, s.ChatID, s.UserID)
+		r.SendMsg(s.ChatID, locale.T(ctx, "error.system"))
+		return err
+	}
+	if next == StepEnd {
+		return r.sessions.DeleteSession(ctx, s.ChatID, s.UserID)
+	}
+	step, ok := f.Steps[next]
+	if !ok {
+		r.sessions.DeleteSession(ctx, s.ChatID, s.UserID)
+		return fmt.Errorf("Unknown step %s of flow %s", next, f.Name)
+	}
+	timeout := f.Timeout
+	if timeout == 0 {
+		timeout = SessionTimeout
+	}
+	s.Step, s.Expires = next, time.Now().Add(timeout)
+	s.Lang = locale.FromContext(ctx)
+	err = r.sessions.SaveSession(ctx, s)
+	if err != nil {
+		return err
+	}
+	if step.Prompt == nil {
+		return nil
+	}
+	prompt := step.Prompt(&s)
+	if msg, ok := prompt.(tgbotapi.MessageConfig); ok && s.ChatID < 0 {
+		//Groups have negative ID, where privacy mode only delivers replies to
+		//the bot
+		msg.Text += locale.Get(s.Lang, "session.groupReply")
+		prompt = msg
+	}
+	_, err = r.bot.Send(prompt)
+	return err
+}
+
+//activeSession returns session of user in chat with its flow
+func (r *ServeBot) activeSession(ctx context.Context, chatID int64, userID int) (Session, Flow, bool) {
+	s, ok, err := r.sessions.Session(ctx, chatID, userID)
+	if err != nil {
+		log.WithError(err).Error("Cannot load session")
+		return Session{}, Flow{}, false
+	}
+	if !ok {
+		return Session{}, Flow{}, false
+	}
+	f, ok := r.flows[s.Flow]
+	if !ok {
+		log.WithField("flow", s.Flow).Warn("Session of unknown flow dropped")
+		r.sessions.DeleteSession(ctx, chatID, userID)
+	}
+	return s, f, ok
+}
+
+//sessionMessage routes message to the active session of sender, and handles
+///cancel. Other commands are not routed. It returns false if the message is
+//not handled
+func (r *ServeBot) sessionMessage(ctx context.Context, msg *tgbotapi.Message) bool {
+	if msg.From == nil {
+		return false
+	}
+	cancel := msg.IsCommand() && msg.Command() == "cancel"
+	if msg.IsCommand() && !cancel {
+		return false
+	}
+	s, f, ok := r.activeSession(ctx, msg.Chat.ID, msg.From.ID)
+	var err error
+	switch {
+	case !ok && cancel:
+		err = r.SendMsg(msg.Chat.ID, locale.T(ctx, "session.none"))
+	case !ok:
+		return false
+	case cancel:
+		err = r.sessions.DeleteSession(ctx, s.ChatID, s.UserID)
+		if err == nil {
+			log.WithFields(log.Fields{
+				"userID": s.UserID,
+				"flow":   s.Flow,
+			}).Info("Session cancelled")
+			err = r.SendMsg(msg.Chat.ID, locale.T(ctx, "session.cancelled"))
+		}
+	case f.Steps[s.Step].Input == nil:
+		err = r.SendMsg(msg.Chat.ID, locale.T(ctx, "session.useButtons"))
+	default:
+		next, stepErr := f.Steps[s.Step].Input(ctx, &s, msg)
+		err = r.advance(ctx, f, s, next, stepErr)
+	}
+	if err != nil {
+		log.WithError(err).Error("Session error")
+	}
+	return true
+}
+
+//sessionCallback routes button made by sessionButton to the active session
+//of user pressing it
+func (r *ServeBot) sessionCallback(ctx context.Context, cb *tgbotapi.CallbackQuery) {
+	defer r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(cb.ID, ""))
+	s, f, ok := r.activeSession(ctx, cb.Message.Chat.ID, cb.From.ID)
+	var err error
+	switch {
+	case !ok:
+		err = r.SendMsg(cb.Message.Chat.ID, locale.T(ctx, "session.expired"))
+	case f.Steps[s.Step].Callback == nil:
+		//Button of earlier step
+	default:
+		next, stepErr := f.Steps[s.Step].Callback(ctx, &s, cb, cb.Data[len(sessionPrefix):])
+		err = r.advance(ctx, f, s, next, stepErr)
+	}
+	if err != nil {
+		log.WithError(err).Error("Session error")
+	}
+}
@@ -0,0 +1,188 @@
+package wongdim
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+//testChatID is the private chat of testUserID
+const testChatID = testUserID
+
+func privateMessage(text string) *tgbotapi.Message {
+	msg := &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: testChatID, Type: "private"},
+		From: &tgbotapi.User{ID: testUserID},
+		Text: text,
+	}
+	if strings.HasPrefix(text, "/") {
+		msg.Entities = &[]tgbotapi.MessageEntity{{Type: "bot_command", Length: len(strings.Fields(text)[0])}}
+	}
+	return msg
+}
+
+func sessionPress(data string) *tgbotapi.CallbackQuery {
+	return &tgbotapi.CallbackQuery{
+		ID:      "1",
+		From:    &tgbotapi.User{ID: testUserID},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: testChatID, Type: "private"}},
+		Data:    sessionPrefix + data,
+	}
+}
+
+func TestSessionSubmitSteps(t *testing.T) {
+	ctx := context.Background()
+	r, tg := newTestBot(t)
+	r.registerFlow(r.submitFlowDef())
+	err := r.StartSubmit(ctx, testChatID, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if texts := tg.texts(); len(texts) != 1 || texts[0] != locale.Get(locale.Default, "submit.askName") {
+		t.Errorf("Name expected to be asked, actual %q", texts)
+	}
+	location := privateMessage("")
+	location.Location = &tgbotapi.Location{Latitude: 22.3203, Longitude: 114.1729}
+	cases := []struct {
+		name string
+		msg  *tgbotapi.Message
+		data string
+		//step is the step after input, StepEnd if the session is over
+		step string
+		//sent is the start of the first message sent
+		sent string
+	}{
+		{"name", privateMessage("金華冰廳"), "", stepDistrict, locale.Get(locale.Default, "submit.askDistrict")},
+		{"back", nil, submitBack, stepName, locale.Get(locale.Default, "submit.askName")},
+		{"skip kept name", nil, submitSkip, stepDistrict, locale.Get(locale.Default, "submit.askDistrict")},
+		{"location not address", location, "", stepDistrict, locale.Get(locale.Default, "session.textOnly")},
+		{"district", privateMessage("旺角"), "", stepType, locale.Get(locale.Default, "submit.askType")},
+		{"type", privateMessage("茶餐廳"), "", stepAddress, locale.Get(locale.Default, "submit.askAddress")},
+		{"location address", location, "", stepURL, locale.Get(locale.Default, "submit.askURL")},
+		{"skip url", nil, submitSkip, stepNotes, locale.Get(locale.Default, "submit.askNotes")},
+		{"skip notes", nil, submitSkip, stepConfirm, locale.Get(locale.Default, "submit.confirm", "")},
+		{"skip last", nil, submitSkip, stepConfirm, ""},
+		{"text at confirm", privateMessage("OK"), "", stepConfirm, locale.Get(locale.Default, "submit.useButtons")},
+		{"cancel", nil, submitCancel, StepEnd, locale.Get(locale.Default, "session.cancelled")},
+	}
+	for _, c := range cases {
+		if c.msg != nil {
+			if !r.sessionMessage(ctx, c.msg) {
+				t.Errorf("%s: message expected to be handled", c.name)
+			}
+		} else {
+			r.sessionCallback(ctx, sessionPress(c.data))
+		}
+		s, ok, err := r.sessions.Session(ctx, testChatID, testUserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			s.Step = StepEnd
+		}
+		if s.Step != c.step {
+			t.Errorf("%s: step expected %q, actual %q", c.name, c.step, s.Step)
+		}
+		texts := tg.texts()
+		if len(texts) == 0 || !strings.HasPrefix(texts[0], c.sent) {
+			t.Errorf("%s: message expected to begin %q, actual %q", c.name, c.sent, texts)
+		}
+	}
+}
+
+func TestSessionCancel(t *testing.T) {
+	ctx := context.Background()
+	r, tg := newTestBot(t)
+	r.registerFlow(r.submitFlowDef())
+	cases := []struct {
+		name    string
+		started bool
+		text    string
+		handled bool
+		want    string
+	}{
+		{"cancel", true, "/cancel", true, locale.Get(locale.Default, "session.cancelled")},
+		{"cancel without session", false, "/cancel", true, locale.Get(locale.Default, "session.none")},
+		{"other command", true, "/help", false, ""},
+		{"text without session", false, "咖啡", false, ""},
+	}
+	for _, c := range cases {
+		r.sessions.DeleteSession(ctx, testChatID, testUserID)
+		if c.started {
+			err := r.StartSubmit(ctx, testChatID, testUserID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tg.texts()
+		}
+		if handled := r.sessionMessage(ctx, privateMessage(c.text)); handled != c.handled {
+			t.Errorf("%s: handled expected %v, actual %v", c.name, c.handled, handled)
+		}
+		texts := tg.texts()
+		if c.want == "" && len(texts) > 0 || c.want != "" && (len(texts) != 1 || texts[0] != c.want) {
+			t.Errorf("%s: expected %q, actual %q", c.name, c.want, texts)
+		}
+		_, active, _ := r.sessions.Session(ctx, testChatID, testUserID)
+		if wantActive := c.started && c.text != "/cancel"; active != wantActive {
+			t.Errorf("%s: session active expected %v, actual %v", c.name, wantActive, active)
+		}
+	}
+}
+
+func TestSessionTimeout(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestBot(t)
+	cases := []struct {
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{0, SessionTimeout},
+		{time.Minute, time.Minute},
+	}
+	for _, c := range cases {
+		r.registerFlow(Flow{Name: "wait", Start: "wait", Timeout: c.timeout, Steps: map[string]Step{"wait": {}}})
+		start := time.Now()
+		err := r.StartSession(ctx, testChatID, testUserID, "wait", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, ok, err := r.sessions.Session(ctx, testChatID, testUserID)
+		if err != nil || !ok {
+			t.Fatalf("Session of timeout %v expected, found %v: %v", c.timeout, ok, err)
+		}
+		if s.Expires.Before(start.Add(c.want)) || s.Expires.After(time.Now().Add(c.want)) {
+			t.Errorf("Timeout %v expected to expire in %v, actual %v", c.timeout, c.want, s.Expires.Sub(start))
+		}
+	}
+}
+
+func TestSessionStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	r, tg := newTestBot(t)
+	stores := map[string]SessionStore{
+		SessionMemory:  NewMemorySessionStore(),
+		SessionBackend: NewUserSessionStore(r.users),
+	}
+	for name, store := range stores {
+		err := store.SaveSession(ctx, Session{ChatID: testChatID, UserID: testUserID, Flow: submitFlow, Expires: time.Now().Add(50 * time.Millisecond)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok, err := store.Session(ctx, testChatID, testUserID); err != nil || !ok {
+			t.Errorf("%s: session expected before expiry, found %v: %v", name, ok, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if _, ok, err := store.Session(ctx, testChatID, testUserID); err != nil || ok {
+			t.Errorf("%s: session expected to expire, found %v: %v", name, ok, err)
+		}
+	}
+	//Buttons of expired sessions are answered
+	r.sessionCallback(ctx, sessionPress(submitSkip))
+	if texts := tg.texts(); len(texts) != 1 || texts[0] != locale.Get(locale.Default, "session.expired") {
+		t.Errorf("Expired session expected to be reported, actual %q", texts)
+	}
+}
@@ -0,0 +1,112 @@
+package wongdim
+
+import (
+	"context"
+	"errors"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	gcache "github.com/patrickmn/go-cache"
+	log "github.com/sirupsen/logrus"
+)
+
+//listRefresh is callback data of refresh button of stale lists, followed by
+//query token
+const listRefresh = "RF"
+
+//listSnapshot is the order of shops shown in a list message. Searches are in
+//random order, so pages are taken from the snapshot instead of a new search
+type listSnapshot struct {
+	Key     string
+	ShopIDs []int
+}
+
+//listSnapshots holds snapshots by chat ID and message ID
+var listSnapshots = gcache.New(ListKeyTimeout, 2*ListKeyTimeout)
+
+//pinList saves shops as snapshot of list message
+func pinList(chatID int64, messageID int, key string, shops []dao.Shop) {
+	ids := make([]int, len(shops))
+	for i := range shops {
+		ids[i] = shops[i].ID
+	}
+	listSnapshots.SetDefault(listMessageKey(chatID, messageID), listSnapshot{Key: key, ShopIDs: ids})
+	listKeys.SetDefault(listMessageKey(chatID, messageID), key)
+}
+
+//pinnedShops returns shops of search key in order of snapshot of list
+//message. Shops dropped from the search since are still shown unless
+//deleted, and new shops are left out. It returns true if the search has
+//changed, or the snapshot is lost
+func (r ServeBot) pinnedShops(ctx context.Context, chatID int64, messageID int, key string, shops []dao.Shop) ([]dao.Shop, bool, error) {
+	v, ok := listSnapshots.Get(listMessageKey(chatID, messageID))
+	if !ok {
+		pinList(chatID, messageID, key, shops)
+		return shops, true, nil
+	}
+	snapshot := v.(listSnapshot)
+	if snapshot.Key != key {
+		//Another search, such as toggling open now, starts a new snapshot
+		pinList(chatID, messageID, key, shops)
+		return shops, false, nil
+	}
+	current := make(map[int]dao.Shop, len(shops))
+	for i := range shops {
+		current[shops[i].ID] = shops[i]
+	}
+	pinned := make([]dao.Shop, 0, len(snapshot.ShopIDs))
+	changed := false
+	for _, id := range snapshot.ShopIDs {
+		shop, ok := current[id]
+		if ok {
+			delete(current, id)
+		} else {
+			changed = true
+			var err error
+			shop, err = r.da.ShopByID(ctx, id)
+			if errors.Is(err, dao.ErrShopNotFound) {
+				continue
+			} else if err != nil {
+				return nil, false, err
+			}
+		}
+		pinned = append(pinned, shop)
+	}
+	return pinned, changed || len(current) > 0, nil
+}
+
+//refreshButton replaces snapshot of list with a new search
+func refreshButton(lang, token string) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(locale.Get(lang, "button.refresh"), listRefresh+token)
+}
+
+//refreshCallback handles refresh button of stale lists
+func (r *ServeBot) refreshCallback(ctx context.Context, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	defer r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(cb.ID, ""))
+	key, ok := r.queryKey(ctx, cb.Data[len(listRefresh):])
+	if !ok {
+		r.SendMsg(chatID, locale.T(ctx, "search.expired"))
+		return
+	}
+	shops, err := r.shopsByKey(ctx, key)
+	if err != nil {
+		log.WithError(err).Error("Database error")
+		r.SendMsg(chatID, locale.T(ctx, "error.database"))
+		return
+	}
+	if len(shops) == 0 {
+		r.SendMsg(chatID, locale.T(ctx, "search.noResult"))
+		return
+	}
+	log.WithFields(log.Fields{
+		"query":     key,
+		"resultCnt": len(shops),
+	}).Info("List refreshed")
+	pinList(chatID, cb.Message.MessageID, key, shops)
+	err = r.RefreshList(ctx, chatID, cb.Message.MessageID, shops, key, EntriesPerPage, 0, false)
+	if err != nil {
+		log.WithError(err).Error("Telegram error")
+	}
+}
@@ -0,0 +1,63 @@
+package wongdim
+
+import (
+	"context"
+	"testing"
+
+	"equa.link/wongdim/dao"
+)
+
+func TestPinnedShops(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestBot(t)
+	shops := func(ids ...int) []dao.Shop {
+		list := make([]dao.Shop, len(ids))
+		for i, id := range ids {
+			list[i] = dao.Shop{ID: id}
+		}
+		return list
+	}
+	cases := []struct {
+		name string
+		//pinned is the snapshot of list, nil for none
+		pinned    []dao.Shop
+		pinnedKey string
+		current   []dao.Shop
+		want      []int
+		stale     bool
+	}{
+		{"lost", nil, "", shops(2, 1), []int{2, 1}, true},
+		{"reordered", shops(1, 2), "", shops(2, 1), []int{1, 2}, false},
+		{"other search", shops(1, 2), "<other>", shops(2, 1), []int{2, 1}, false},
+		{"dropped", shops(1, 2, 3), "", shops(3, 1), []int{1, 2, 3}, true},
+		{"deleted", shops(1, 4, 2), "", shops(2, 1), []int{1, 2}, true},
+		{"added", shops(2), "", shops(1, 2), []int{2}, true},
+	}
+	key := simpleSearchPrefix + "美食"
+	for i, c := range cases {
+		messageID := i + 1
+		if c.pinned != nil {
+			pinKey := key
+			if c.pinnedKey != "" {
+				pinKey = c.pinnedKey
+			}
+			pinList(testChatID, messageID, pinKey, c.pinned)
+		}
+		pinned, stale, err := r.pinnedShops(ctx, testChatID, messageID, key, c.current)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		got := make([]int, len(pinned))
+		for j := range pinned {
+			got[j] = pinned[j].ID
+		}
+		if !equalInts(got, c.want) || stale != c.stale {
+			t.Errorf("%s expected: %v %v, actual %v %v", c.name, c.want, c.stale, got, stale)
+		}
+		//Next page is taken from the same snapshot, or the one just pinned
+		if _, again, _ := r.pinnedShops(ctx, testChatID, messageID, key, c.current); again != (stale && c.pinned != nil) {
+			t.Errorf("%s: stale expected %v on next page", c.name, !again)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package wongdim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//SubmitTimeout is the idle time before an unfinished submission is dropped
+	SubmitTimeout = 30 * time.Minute
+
+	//submitFlow is the session flow of submit dialog
+	submitFlow = "submit"
+	//reviewPrefix is callback data of admin buttons, followed by action and
+	//submission ID
+	reviewPrefix = "SV"
+
+	submitBack    = "<"
+	submitSkip    = ">"
+	submitCancel  = "X"
+	submitConfirm = "!"
+
+	reviewApprove = "A"
+	reviewReject  = "R"
+	reviewEdit    = "E"
+)
+
+//Steps of submit dialog
+const (
+	stepName     = "name"
+	stepDistrict = "district"
+	stepType     = "type"
+	stepAddress  = "address"
+	stepURL      = "url"
+	stepNotes    = "notes"
+	stepConfirm  = "confirm"
+)
+
+//submitSteps are steps of submit dialog in order asked
+var submitSteps = []string{stepName, stepDistrict, stepType, stepAddress, stepURL, stepNotes, stepConfirm}
+
+//submitDialog is the state of an unfinished submission
+type submitDialog struct {
+	Shop   dao.Shop
+	EditID int //Submission edited by admin, 0 for new submission
+}
+
+//stepPrompt returns question of step in lang and whether it may be skipped
+func stepPrompt(lang, step string) (string, bool) {
+	switch step {
+	case stepName:
+		return locale.Get(lang, "submit.askName"), false
+	case stepDistrict:
+		return locale.Get(lang, "submit.askDistrict"), false
+	case stepType:
+		return locale.Get(lang, "submit.askType"), false
+	case stepAddress:
+		return locale.Get(lang, "submit.askAddress"), true
+	case stepURL:
+		return locale.Get(lang, "submit.askURL"), true
+	case stepNotes:
+		return locale.Get(lang, "submit.askNotes"), true
+	}
+	return "", false
+}
+
+//stepValue returns the current value of field asked in step
+func stepValue(shop dao.Shop, step string) string {
+	switch step {
+	case stepName:
+		return shop.Name
+	case stepDistrict:
+		return shop.District
+	case stepType:
+		return shop.Type
+	case stepAddress:
+		if shop.Address == "" && shop.HasPhyLoc() {
+			lat, long := shop.ToCoord()
+			return fmt.Sprintf("📍%f, %f", lat, long)
+		}
+		return shop.Address
+	case stepURL:
+		return shop.URL
+	case stepNotes:
+		return shop.Notes
+	}
+	return ""
+}
+
+//submissionText describes a submitted shop in lang, without markup as the
+//fields are entered by users
+func submissionText(lang string, shop dao.Shop) string {
+	lines := []string{
+		locale.Get(lang, "submit.name", shop.Name),
+		locale.Get(lang, "submit.district", shop.District),
+		locale.Get(lang, "submit.type", shop.Type),
+	}
+	if v := stepValue(shop, stepAddress); v != "" {
+		lines = append(lines, locale.Get(lang, "submit.address", v))
+	}
+	if shop.URL != "" {
+		lines = append(lines, locale.Get(lang, "submit.url", shop.URL))
+	}
+	if shop.Notes != "" {
+		lines = append(lines, locale.Get(lang, "submit.notes", shop.Notes))
+	}
+	return strings.Join(lines, "\n")
+}
+
+//stepOffset returns the step before (-1) or after (1) step
+func stepOffset(step string, offset int) string {
+	for i := range submitSteps {
+		if submitSteps[i] == step {
+			i = min(max(i+offset, 0), len(submitSteps)-1)
+			return submitSteps[i]
+		}
+	}
+	return step
+}
+
+//submitFlowDef returns the flow of submit dialog
+func (r *ServeBot) submitFlowDef() Flow {
+	steps := make(map[string]Step, len(submitSteps))
+	for _, step := range submitSteps {
+		steps[step] = Step{
+			Prompt:   submitPrompt,
+			Input:    submitInput,
+			Callback: r.submitCallback,
+		}
+	}
+	return Flow{Name: submitFlow, Start: stepName, Timeout: SubmitTimeout, Steps: steps}
+}
+
+//StartSubmit begins a submit dialog for user in chat
+func (r *ServeBot) StartSubmit(ctx context.Context, chatID int64, userID int) error {
+	return r.StartSession(ctx, chatID, userID, submitFlow, submitDialog{})
+}
+
+//submitPrompt asks for the field of current step, or for confirmation
+func submitPrompt(s *Session) tgbotapi.Chattable {
+	var d submitDialog
+	s.Load(&d)
+	nav := make([]tgbotapi.InlineKeyboardButton, 0, 3)
+	if s.Step != stepName {
+		nav = append(nav, sessionButton(locale.Get(s.Lang, "button.back"), submitBack))
+	}
+	var text string
+	if s.Step == stepConfirm {
+		text = locale.Get(s.Lang, "submit.confirm", submissionText(s.Lang, d.Shop))
+		nav = append(nav, sessionButton(locale.Get(s.Lang, "button.submit"), submitConfirm))
+	} else {
+		var optional bool
+		text, optional = stepPrompt(s.Lang, s.Step)
+		current := stepValue(d.Shop, s.Step)
+		if current != "" {
+			text += locale.Get(s.Lang, "submit.current", current)
+		}
+		//Required fields can be kept when editing
+		if optional || current != "" {
+			nav = append(nav, sessionButton(locale.Get(s.Lang, "button.skip"), submitSkip))
+		}
+	}
+	nav = append(nav, sessionButton(locale.Get(s.Lang, "button.cancel"), submitCancel))
+	msg := tgbotapi.NewMessage(s.ChatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(nav)
+	return msg
+}
+
+//submitInput handles text or location sent for current step
+func submitInput(ctx context.Context, s *Session, msg *tgbotapi.Message) (string, error) {
+	var d submitDialog
+	err := s.Load(&d)
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimSpace(msg.Text)
+	switch {
+	case msg.Location != nil && s.Step == stepAddress:
+		d.Shop.Position = dao.Coord{Lat: msg.Location.Latitude, Long: msg.Location.Longitude}
+		d.Shop.Geohash = ""
+	case msg.Location != nil || text == "":
+		return "", &RetryError{locale.T(ctx, "session.textOnly")}
+	case s.Step == stepName:
+		d.Shop.Name = text
+	case s.Step == stepDistrict:
+		d.Shop.District = text
+	case s.Step == stepType:
+		d.Shop.Type = text
+	case s.Step == stepAddress:
+		d.Shop.Address = text
+	case s.Step == stepURL:
+		d.Shop.URL = text
+	case s.Step == stepNotes:
+		d.Shop.Notes = text
+	default:
+		return "", &RetryError{locale.T(ctx, "submit.useButtons")}
+	}
+	return stepOffset(s.Step, 1), s.Store(d)
+}
+
+//submitCallback handles buttons of submit dialog
+func (r *ServeBot) submitCallback(ctx context.Context, s *Session, cb *tgbotapi.CallbackQuery, data string) (string, error) {
+	switch data {
+	case submitCancel:
+		return StepEnd, r.SendMsg(s.ChatID, locale.T(ctx, "session.cancelled"))
+	case submitBack:
+		return stepOffset(s.Step, -1), nil
+	case submitSkip:
+		return stepOffset(s.Step, 1), nil
+	case submitConfirm:
+		if s.Step != stepConfirm {
+			return s.Step, nil
+		}
+		return r.finishSubmit(ctx, s, cb)
+	}
+	return s.Step, nil
+}
+
+//finishSubmit saves the submission and sends it to admins for review
+func (r *ServeBot) finishSubmit(ctx context.Context, s *Session, cb *tgbotapi.CallbackQuery) (string, error) {
+	var d submitDialog
+	err := s.Load(&d)
+	if err != nil {
+		return "", err
+	}
+	err = d.Shop.Validate()
+	if err != nil {
+		return "", &RetryError{locale.T(ctx, "submit.incomplete", err.Error())}
+	}
+	if !d.Shop.HasPhyLoc() && d.Shop.Address == "" && d.Shop.URL == "" {
+		r.SendMsg(s.ChatID, locale.T(ctx, "submit.needAddress"))
+		return stepAddress, nil
+	}
+	var sub dao.Submission
+	if d.EditID != 0 {
+		//Admin edit replaces the shop of a pending submission
+		sub, err = r.submissions.SubmissionByID(ctx, d.EditID)
+		if err == nil {
+			sub.Shop = d.Shop
+			err = r.submissions.UpdateSubmission(ctx, sub)
+		}
+	} else {
+		sub, err = r.submissions.AddSubmission(ctx, dao.Submission{
+			Shop:     d.Shop,
+			UserID:   cb.From.ID,
+			UserName: cb.From.UserName,
+			ChatID:   s.ChatID,
+			Created:  time.Now(),
+			Status:   dao.SubmissionPending,
+		})
+	}
+	if err != nil {
+		log.WithError(err).Error("Database error")
+		return "", &RetryError{locale.T(ctx, "error.database")}
+	}
+	log.WithFields(log.Fields{
+		"submissionID": sub.ID,
+		"userID":       cb.From.ID,
+		"shopName":     sub.Shop.Name,
+	}).Info("Shop submitted")
+	if d.EditID != 0 {
+		return StepEnd, r.sendReview(locale.FromContext(ctx), s.ChatID, sub)
+	}
+	r.notifyAdmins(ctx, sub)
+	return StepEnd, r.SendMsg(s.ChatID, locale.T(ctx, "submit.thanks"))
+}
+
+//sendReview sends submission to chat in lang with approve, reject and edit
+//buttons
+func (r *ServeBot) sendReview(lang string, chatID int64, sub dao.Submission) error {
+	id := strconv.Itoa(sub.ID)
+	msg := tgbotapi.NewMessage(chatID, locale.Get(lang, "review.title",
+		sub.ID, sub.UserName, sub.UserID, submissionText(lang, sub.Shop)))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(locale.Get(lang, "button.approve"), reviewPrefix+reviewApprove+id),
+		tgbotapi.NewInlineKeyboardButtonData(locale.Get(lang, "button.reject"), reviewPrefix+reviewReject+id),
+		tgbotapi.NewInlineKeyboardButtonData(locale.Get(lang, "button.edit"), reviewPrefix+reviewEdit+id),
+	))
+	_, err := r.bot.Send(msg)
+	return err
+}
+
+//notifyAdmins sends submission to every admin in private chat, in their
+//language
+func (r *ServeBot) notifyAdmins(ctx context.Context, sub dao.Submission) {
+	if len(r.admins) == 0 {
+		log.WithField("submissionID", sub.ID).Warn("No admin to review submission")
+	}
+	for id := range r.admins {
+		err := r.sendReview(r.langOf(ctx, id), int64(id), sub)
+		if err != nil {
+			log.WithError(err).WithField("adminID", id).Error("Cannot notify admin")
+		}
+	}
+}
+
+//reviewCallback handles admin buttons of a submission
+func (r *ServeBot) reviewCallback(ctx context.Context, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	defer r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(cb.ID, ""))
+	if !r.isAdmin(cb.From.ID) {
+		log.WithField("userID", cb.From.ID).Warn("Review by non-admin")
+		return
+	}
+	action := strings.TrimPrefix(cb.Data, reviewPrefix)
+	if action == "" {
+		return
+	}
+	id, err := strconv.Atoi(action[1:])
+	if err != nil {
+		log.WithError(err).WithField("callbackData", cb.Data).Error("Unexpected callback data")
+		return
+	}
+	sub, err := r.submissions.SubmissionByID(ctx, id)
+	if err != nil {
+		log.WithError(err).Error("Database error")
+		r.SendMsg(chatID, locale.T(ctx, "review.notFound"))
+		return
+	}
+	if sub.Status != dao.SubmissionPending {
+		r.SendMsg(chatID, locale.T(ctx, "review.done", sub.ID, sub.ReviewedBy))
+		return
+	}
+	logger := log.WithFields(log.Fields{
+		"submissionID": sub.ID,
+		"adminID":      cb.From.ID,
+	})
+	switch action[:1] {
+	case reviewApprove:
+		r.approveSubmission(ctx, cb, sub)
+	case reviewReject:
+		sub.Status, sub.ReviewedBy = dao.SubmissionRejected, cb.From.ID
+		err = r.submissions.UpdateSubmission(ctx, sub)
+		if err != nil {
+			logger.WithError(err).Error("Database error")
+			r.SendMsg(chatID, locale.T(ctx, "error.database"))
+			return
+		}
+		logger.Info("Submission rejected")
+		r.SendMsg(chatID, locale.T(ctx, "review.rejected", sub.ID))
+		r.SendText(sub.ChatID, locale.Get(r.langOf(ctx, sub.UserID), "submit.rejected", sub.Shop.Name))
+	case reviewEdit:
+		err = r.StartSession(ctx, chatID, cb.From.ID, submitFlow, submitDialog{Shop: sub.Shop, EditID: sub.ID})
+		if err != nil {
+			logger.WithError(err).Error("Session error")
+			return
+		}
+		logger.Info("Submission edit started")
+	}
+}
+
+//approveSubmission writes submitted shop to backend. Shops without
+//coordinates are left for the geocoding batch
+func (r *ServeBot) approveSubmission(ctx context.Context, cb *tgbotapi.CallbackQuery, sub dao.Submission) {
+	chatID := cb.Message.Chat.ID
+	logger := log.WithFields(log.Fields{
+		"submissionID": sub.ID,
+		"adminID":      cb.From.ID,
+	})
+	shop := sub.Shop
+	shop.ID = 0
+	if len(shop.Tags) == 0 {
+		shop.Tags = []string{shop.Type}
+	}
+	shop, err := r.da.CreateShop(ctx, shop)
+	var conflict *dao.ConflictError
+	var invalid *dao.ValidationError
+	switch {
+	case errors.As(err, &conflict):
+		r.SendMsg(chatID, locale.T(ctx, "review.conflict", sub.ID, conflict.ShopID))
+		return
+	case errors.As(err, &invalid):
+		r.SendMsg(chatID, locale.T(ctx, "review.invalid", sub.ID, invalid.Reason))
+		return
+	case err != nil:
+		logger.WithError(err).Error("Database error")
+		r.SendMsg(chatID, locale.T(ctx, "error.database"))
+		return
+	}
+	sub.Status, sub.ReviewedBy, sub.ShopID = dao.SubmissionApproved, cb.From.ID, shop.ID
+	err = r.submissions.UpdateSubmission(ctx, sub)
+	if err != nil {
+		logger.WithError(err).Error("Database error")
+	}
+	cache.Flush()
+	logger.WithField("shopID", shop.ID).Info("Submission approved")
+	reply := locale.T(ctx, "review.approved", sub.ID, shop.ID)
+	if !shop.HasPhyLoc() && shop.Address != "" {
+		reply += locale.T(ctx, "review.geocodeLater")
+	}
+	r.SendMsg(chatID, reply)
+	r.SendText(sub.ChatID, locale.Get(r.langOf(ctx, sub.UserID), "submit.approved", shop.Name))
+}
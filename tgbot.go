@@ -7,13 +7,17 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"equa.link/wongdim/batch"
 	"equa.link/wongdim/batch/bingmap"
 	"equa.link/wongdim/batch/googlemap"
 	"equa.link/wongdim/dao"
+	"equa.link/wongdim/locale"
+	"equa.link/wongdim/render"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	ghash "github.com/mmcloughlin/geohash"
+	gcache "github.com/patrickmn/go-cache"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -25,7 +29,31 @@ type ServeBot struct {
 	keyFile   string
 	certFile  string
 	da        dao.Backend
-	helpMsg   string
+	//helpMsg is help message by language, locale.Default for others
+	helpMsg  map[string]string
+	holidays dao.Holidays
+	//admins are Telegram user IDs allowed to review and manage shops
+	admins      map[int]struct{}
+	submissions dao.SubmissionStore
+	reports     dao.ReportStore
+	//favourites is nil if backend cannot store favourites
+	favourites dao.FavouriteStore
+	users      dao.UserStore
+	//sessionStorage is SessionMemory or SessionBackend
+	sessionStorage string
+	sessions       SessionStore
+	flows          map[string]Flow
+	commands       []Command
+	//reportThreshold is the number of closed reports flagging a shop
+	reportThreshold int
+	//lunchDuration is the time before a lunch poll is closed
+	lunchDuration time.Duration
+	renderer      *render.Renderer
+	//rateEvery and rateBurst limit requests of a user, see WithRateLimit
+	rateEvery time.Duration
+	rateBurst int
+	buckets   *gcache.Cache
+	bans      *banList
 }
 
 // Option is a constructor argument for Retrievr
@@ -40,17 +68,36 @@ const (
 	EntriesPerPage = 10
 	//GeohashPrecision is the no. of characters used to represent a coordinates
 	GeohashPrecision = 9
-	//DistanceLimit is the search area radius
+	//DistanceLimit is the search area radius, unless user chooses another
 	DistanceLimit = "500m"
+	//UpdateTimeout is the time allowed for serving a single update, including
+	//backend queries
+	UpdateTimeout = 30 * time.Second
+	//ClosingSoon is the time before closing a shop is shown as closing soon
+	ClosingSoon = 30 * time.Minute
 
 	geoSearchPrefix    = "<G>"
 	simpleSearchPrefix = "<S>"
 	advSearchPrefix    = "<A>"
+	//advAllSearchPrefix is for advanced search including closed shops
+	advAllSearchPrefix = "<AA>"
+	//openNowPrefix is put before other prefixes to keep only shops open now
+	openNowPrefix = "<O>"
+
+	//openNowWord in keywords keeps only shops open now
+	openNowWord = "營業中"
 )
 
 // New return new instance of ServeBot
 func New(options ...Option) (r *ServeBot, err error) {
-	r = &ServeBot{}
+	r = &ServeBot{
+		reportThreshold: DefaultReportThreshold,
+		sessionStorage:  SessionBackend,
+		lunchDuration:   DefaultLunchPollDuration,
+		rateEvery:       DefaultRateInterval,
+		rateBurst:       DefaultRateBurst,
+		bans:            &banList{users: make(map[int]ban)},
+	}
 	for f := range options {
 		err = options[f](r)
 		if err != nil {
@@ -60,9 +107,61 @@ func New(options ...Option) (r *ServeBot, err error) {
 	if r.da == nil {
 		return nil, fmt.Errorf("Datastore undefined")
 	}
-	shopCnt, err := r.da.ShopCount()
+	if r.renderer == nil {
+		r.renderer = render.Default()
+	}
+	if store, ok := r.da.(dao.SubmissionStore); ok {
+		r.submissions = store
+	} else {
+		log.Warn("Backend cannot store submissions, keeping them in memory")
+		r.submissions = dao.NewMemoryBackend(nil)
+	}
+	if store, ok := r.da.(dao.ReportStore); ok {
+		r.reports = store
+	} else {
+		log.Warn("Backend cannot store reports, keeping them in memory")
+		r.reports = dao.NewMemoryBackend(nil)
+	}
+	if store, ok := r.da.(dao.FavouriteStore); ok {
+		r.favourites = store
+	} else {
+		log.Warn("Backend cannot store favourites")
+	}
+	if store, ok := r.da.(dao.UserStore); ok {
+		r.users = store
+	} else {
+		log.Warn("Backend cannot store user data, keeping them in memory")
+		r.users = dao.NewMemoryBackend(nil)
+	}
+	if purger, ok := r.users.(dao.UserDataPurger); ok {
+		go purgeQueryTokens(purger)
+	} else {
+		log.Warn("Backend cannot purge user data, keeping expired searches")
+	}
+	if r.sessionStorage == SessionMemory {
+		r.sessions = NewMemorySessionStore()
+	} else {
+		r.sessions = NewUserSessionStore(r.users)
+	}
+	//Buckets idle for this long are full again
+	r.buckets = gcache.New(r.rateEvery*time.Duration(r.rateBurst)+time.Minute, 10*time.Minute)
+	err = r.loadBans(context.Background())
+	if err != nil {
+		log.WithError(err).Error("Cannot load banned users")
+	}
+	err = r.restoreLunches(context.Background())
+	if err != nil {
+		log.WithError(err).Error("Cannot restore lunch polls")
+	}
+	r.registerFlow(r.submitFlowDef())
+	r.registerFlow(r.reportFlowDef())
+	for _, c := range r.commandDefs() {
+		r.registerCommand(c)
+	}
+	shopCnt, err := r.da.ShopCount(context.Background())
 	log.WithField("shopCount", shopCnt).Info("Data loaded")
 	log.WithField("accountName", r.bot.Self.UserName).Info("Authorized on account")
+	r.publishCommands()
 	return r, nil
 }
 
@@ -112,8 +211,60 @@ func WithBackend(backend dao.Backend) Option {
 
 // WithHelpMsg supplies help message to the bot to be displayed with /help
 func WithHelpMsg(helpMsg string) Option {
+	return WithLocaleHelpMsg(locale.Default, helpMsg)
+}
+
+// WithLocaleHelpMsg supplies help message in lang, users of languages without
+// one get the default help message
+func WithLocaleHelpMsg(lang, helpMsg string) Option {
+	return func(s *ServeBot) error {
+		if !locale.Supported(lang) {
+			return fmt.Errorf("Unsupported language: %s", lang)
+		}
+		if s.helpMsg == nil {
+			s.helpMsg = make(map[string]string)
+		}
+		s.helpMsg[lang] = helpMsg
+		return nil
+	}
+}
+
+// WithHolidays configures public holidays (YYYY-MM-DD) used for opening hours
+func WithHolidays(dates []string) Option {
+	return func(s *ServeBot) error {
+		var err error
+		s.holidays, err = dao.NewHolidays(dates...)
+		return err
+	}
+}
+
+// WithAdmins configures Telegram user IDs of admins
+func WithAdmins(ids []int) Option {
 	return func(s *ServeBot) error {
-		s.helpMsg = helpMsg
+		s.admins = make(map[int]struct{}, len(ids))
+		for _, id := range ids {
+			s.admins[id] = struct{}{}
+		}
+		return nil
+	}
+}
+
+//isAdmin checks if user is one of the configured admins
+func (r *ServeBot) isAdmin(userID int) bool {
+	_, ok := r.admins[userID]
+	return ok
+}
+
+// WithTemplates configures parse mode of shop messages, render.ModeHTML or
+// render.ModeMarkdownV2, and the directory of templates overriding the
+// defaults, which may be empty
+func WithTemplates(mode, dir string) Option {
+	return func(s *ServeBot) error {
+		renderer, err := render.New(mode, dir)
+		if err != nil {
+			return err
+		}
+		s.renderer = renderer
 		return nil
 	}
 }
@@ -131,10 +282,7 @@ func WithCert(certFile, keyFile string) Option {
 func (r *ServeBot) Connect() error {
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
-	updates, err := r.bot.GetUpdatesChan(u)
-	if err != nil {
-		log.Fatal(err)
-	}
+	updates := r.updatesChan(u)
 	for i := 0; i < 5; i++ {
 		go r.process(updates)
 	}
@@ -183,7 +331,7 @@ func (r *ServeBot) Listen() error {
 	if info.LastErrorDate != 0 {
 		log.Errorf("Telegram callback failed: %s", info.LastErrorMessage)
 	}
-	updates := r.bot.ListenForWebhook("/" + r.bot.Token)
+	updates := r.listenForWebhook("/" + r.bot.Token)
 	for i := 0; i < 5; i++ {
 		go r.process(updates)
 	}
@@ -194,286 +342,434 @@ func (r *ServeBot) Listen() error {
 }
 
 func (r *ServeBot) process(updates tgbotapi.UpdatesChannel) {
+	//Language is needed to greet groups joined
+	handle := r.withLang(r.onlyAddressed(r.limitUpdates(r.processUpdate)))
 	for update := range updates {
+		ctx, cancel := context.WithTimeout(context.Background(), UpdateTimeout)
+		handle(ctx, update)
+		cancel()
+	}
+}
 
-		switch {
-		case update.InlineQuery != nil:
-			// Inline query
-			offset := 0
-			if update.InlineQuery.Offset != "" {
-				var err error
-				offset, err = strconv.Atoi(update.InlineQuery.Offset)
-				if err != nil {
-					offset = 50
-				}
-			}
-			// Skip empty queries
-			if strings.TrimSpace(update.InlineQuery.Query) == "" {
-				continue
-			}
-			if strings.Contains(strings.ToLower(update.InlineQuery.Query), "drop table") {
-				log.WithFields(
-					log.Fields{
-						"query":    strings.TrimSpace(update.InlineQuery.Query),
-						"lang":     update.InlineQuery.From.LanguageCode,
-						"fullName": update.InlineQuery.From.FirstName + " " + update.InlineQuery.From.LastName,
-						"userName": update.InlineQuery.From,
-						"userID":   update.InlineQuery.From.ID,
-					}).Warn("SQL injection detected")
-				continue
-			}
-			var shops []dao.Shop
+func (r *ServeBot) processUpdate(ctx context.Context, update tgbotapi.Update) {
+	switch {
+	case update.InlineQuery != nil:
+		// Inline query
+		offset := 0
+		if update.InlineQuery.Offset != "" {
 			var err error
-			if update.InlineQuery.Location != nil {
-				shops, err = r.shopsWithKeywordSortByDist(strings.TrimSpace(update.InlineQuery.Query),
-					update.InlineQuery.Location.Latitude,
-					update.InlineQuery.Location.Longitude,
-				)
-			} else {
-				shops, err = r.shopWithTags(strings.TrimSpace(update.InlineQuery.Query))
-			}
-			log.WithFields(
-				log.Fields{
-					"query":     strings.TrimSpace(update.InlineQuery.Query),
-					"resultCnt": len(shops),
-				}).Info("Inline query")
+			offset, err = strconv.Atoi(update.InlineQuery.Offset)
 			if err != nil {
-				log.WithError(err).Error("Database error")
-				continue
+				offset = 50
 			}
-			orgLen := len(shops)
-			if orgLen > 50 {
-				//Paging, telegram does not support over 50 inline results
-				shops = shops[offset:min(orgLen, offset+50)]
-			}
-			result := make([]interface{}, len(shops))
-			for i := range shops {
-				if shops[i].HasPhyLoc() {
-					lat, long := shops[i].ToCoord()
-					r := tgbotapi.NewInlineQueryResultVenue(
-						update.InlineQuery.Query+strconv.Itoa(shops[i].ID), fmt.Sprintf("%s (%s)", shops[i].Name, shops[i].Type),
-						shops[i].Address, lat, long)
-					r.InputMessageContent = tgbotapi.InputVenueMessageContent{
-						Latitude:  lat,
-						Longitude: long,
-						Title:     shops[i].Name,
-						Address:   shops[i].Address,
-					}
-					var t tgbotapi.InlineKeyboardButton
-					if shops[i].URL != "" {
-						t = tgbotapi.NewInlineKeyboardButtonURL("🏠店舖網站", shops[i].URL)
-					}
-					t = tgbotapi.NewInlineKeyboardButtonURL("🔍Google 店名", "https://google.com/search?q="+url.PathEscape(shops[i].Name))
+		}
+		// Skip empty queries
+		if strings.TrimSpace(update.InlineQuery.Query) == "" {
+			return
+		}
+		var shops []dao.Shop
+		var err error
+		query, openNow := splitOpenNow(strings.TrimSpace(update.InlineQuery.Query))
+		if update.InlineQuery.Location != nil {
+			shops, err = r.shopsWithKeywordSortByDist(ctx, query,
+				update.InlineQuery.Location.Latitude,
+				update.InlineQuery.Location.Longitude,
+			)
+		} else {
+			shops, err = r.shopWithTags(ctx, query)
+		}
+		if openNow {
+			shops = r.openNow(shops, time.Now())
+		}
+		log.WithFields(
+			log.Fields{
+				"query":     strings.TrimSpace(update.InlineQuery.Query),
+				"resultCnt": len(shops),
+			}).Info("Inline query")
+		if err != nil {
+			log.WithError(err).Error("Database error")
+			return
+		}
+		orgLen := len(shops)
+		if orgLen > 50 {
+			//Paging, telegram does not support over 50 inline results
+			shops = shops[offset:min(orgLen, offset+50)]
+		}
+		result := make([]interface{}, len(shops))
+		for i := range shops {
+			favBtn := r.favButton(ctx, shops[i])
+			if shops[i].HasPhyLoc() {
+				lat, long := shops[i].ToCoord()
+				r := tgbotapi.NewInlineQueryResultVenue(
+					update.InlineQuery.Query+strconv.Itoa(shops[i].ID), fmt.Sprintf("%s (%s)", shops[i].Name, shops[i].Type),
+					shops[i].Address, lat, long)
+				r.InputMessageContent = tgbotapi.InputVenueMessageContent{
+					Latitude:  lat,
+					Longitude: long,
+					Title:     shops[i].Name,
+					Address:   shops[i].Address,
+				}
+				var t tgbotapi.InlineKeyboardButton
+				if shops[i].URL != "" {
+					t = tgbotapi.NewInlineKeyboardButtonURL(locale.T(ctx, "button.website"), shops[i].URL)
+				}
+				t = tgbotapi.NewInlineKeyboardButtonURL(locale.T(ctx, "button.google"), "https://google.com/search?q="+url.PathEscape(shops[i].Name))
 
-					l := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(t))
+				l := tgbotapi.NewInlineKeyboardMarkup(append(tgbotapi.NewInlineKeyboardRow(t), favBtn...))
+				r.ReplyMarkup = &l
+				result[i] = r
+			} else {
+				text, err := r.renderer.Render(render.TmplInline, r.renderer.View(shops[i], ""))
+				if err != nil {
+					log.WithError(err).Error("Template error")
+					return
+				}
+				content := tgbotapi.InputTextMessageContent{
+					Text:      render.Truncate(text, render.MaxMessageLen),
+					ParseMode: r.renderer.Mode(),
+				}
+				r := tgbotapi.NewInlineQueryResultArticle(
+					update.InlineQuery.Query+strconv.Itoa(shops[i].ID),
+					fmt.Sprintf("%s - (%s)", shops[i].String(), shops[i].District),
+					content.Text,
+				)
+				r.InputMessageContent = content
+				r.URL = shops[i].URL
+				if favBtn != nil {
+					l := tgbotapi.NewInlineKeyboardMarkup(favBtn)
 					r.ReplyMarkup = &l
-					result[i] = r
-				} else {
-					r := tgbotapi.NewInlineQueryResultArticleMarkdown(
-						update.InlineQuery.Query+strconv.Itoa(shops[i].ID),
-						fmt.Sprintf("%s - (%s)", shops[i].String(), shops[i].District),
-						fmt.Sprintf("%s - (%s)", shops[i].String(), shops[i].District)+shops[i].URL,
-					)
-					r.URL = shops[i].URL
-					result[i] = r
 				}
-
+				result[i] = r
 			}
 
-			inlineCfg := tgbotapi.InlineConfig{
-				InlineQueryID: update.InlineQuery.ID,
-				IsPersonal:    true,
-				Results:       result,
-			}
-			if offset+50 < orgLen {
-				inlineCfg.NextOffset = strconv.Itoa(offset + 50)
+		}
+
+		inlineCfg := tgbotapi.InlineConfig{
+			InlineQueryID: update.InlineQuery.ID,
+			IsPersonal:    true,
+			Results:       result,
+		}
+		if offset+50 < orgLen {
+			inlineCfg.NextOffset = strconv.Itoa(offset + 50)
+		}
+		_, err = r.bot.AnswerInlineQuery(inlineCfg)
+	case update.CallbackQuery != nil:
+		if strings.HasPrefix(update.CallbackQuery.Data, favPrefix) {
+			//Also pressed in inline results posted to other chats
+			r.favCallback(ctx, update.CallbackQuery)
+			return
+		}
+		//When user click one of the inline button in message in direct chat
+		if update.CallbackQuery.Message != nil {
+			if update.CallbackQuery.Data == "---" {
+				r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, update.CallbackQuery.Data))
+				return
 			}
-			_, err = r.bot.AnswerInlineQuery(inlineCfg)
-		case update.CallbackQuery != nil:
-			//When user click one of the inline button in message in direct chat
-			if update.CallbackQuery.Message != nil {
-				if update.CallbackQuery.Data == "---" {
+			//Buttons routed to handlers are answered by them
+			if strings.HasPrefix(update.CallbackQuery.Data, sessionPrefix) {
+				r.sessionCallback(ctx, update.CallbackQuery)
+			} else if strings.HasPrefix(update.CallbackQuery.Data, reviewPrefix) {
+				r.reviewCallback(ctx, update.CallbackQuery)
+			} else if strings.HasPrefix(update.CallbackQuery.Data, reportPrefix) {
+				r.reportCallback(ctx, update.CallbackQuery)
+			} else if strings.HasPrefix(update.CallbackQuery.Data, reportReviewPrefix) {
+				r.reportReviewCallback(ctx, update.CallbackQuery)
+			} else if strings.HasPrefix(update.CallbackQuery.Data, lunchPrefix) {
+				r.lunchCallback(ctx, update.CallbackQuery)
+			} else if update.CallbackQuery.Data == randomAgain || strings.HasPrefix(update.CallbackQuery.Data, randomPrefix) {
+				r.randomCallback(ctx, update.CallbackQuery)
+			} else if strings.HasPrefix(update.CallbackQuery.Data, langPrefix) {
+				r.langCallback(ctx, update.CallbackQuery)
+			} else if strings.HasPrefix(update.CallbackQuery.Data, listRefresh) {
+				r.refreshCallback(ctx, update.CallbackQuery)
+			} else if strings.HasPrefix(update.CallbackQuery.Data, facetMenu) {
+				r.facetCallback(ctx, update.CallbackQuery)
+			} else if update.CallbackQuery.Data == historyClear {
+				r.clearHistory(ctx, update.CallbackQuery)
+			} else if update.CallbackQuery.Data[0] == 'P' {
+				//Jump to another page, data is offset and query token
+				pageInfo := strings.SplitN(update.CallbackQuery.Data[1:], "|", 2)
+				offset, err := strconv.Atoi(pageInfo[0])
+				if err != nil || len(pageInfo) < 2 {
+					log.WithField("callbackData", update.CallbackQuery.Data).Error("Unexpected callback data")
 					r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, update.CallbackQuery.Data))
-					continue
+					return
 				}
-				if update.CallbackQuery.Data[0] == 'P' {
-					//Jump to another page
-					pageInfo := strings.Split(update.CallbackQuery.Data[1:], "||")
-					var shops []dao.Shop
-					offset, err := strconv.Atoi(pageInfo[0])
-					if strings.HasPrefix(pageInfo[1], geoSearchPrefix) {
-						shops, err = r.shopWithGeohash(strings.TrimPrefix(pageInfo[1], geoSearchPrefix), DistanceLimit)
-					} else if strings.HasPrefix(pageInfo[1], advSearchPrefix) {
-						shops, err = r.advSearch(strings.TrimPrefix(pageInfo[1], advSearchPrefix))
-					} else {
-						shops, err = r.shopWithTags(strings.TrimPrefix(pageInfo[1], simpleSearchPrefix))
-					}
-					if err != nil {
-						log.WithError(err).Error("Database query error")
-					}
-					if len(shops) == 0 {
-						log.WithField("query", pageInfo[1]).Error("Cache hit failed")
-						r.SendMsg(update.CallbackQuery.Message.Chat.ID, "系統錯誤，請稍後重試")
-						r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, update.CallbackQuery.Data))
-						continue
-					}
-					err = r.RefreshList(update.CallbackQuery.Message.Chat.ID,
-						update.CallbackQuery.Message.MessageID,
-						shops,
-						strings.Join(pageInfo[1:], "||"),
-						EntriesPerPage, offset,
-					)
-					if err != nil {
-						log.WithError(err).Error("Telegram error")
-					}
+				//Legacy buttons separate the key with "||"
+				key, ok := r.queryKey(ctx, strings.TrimPrefix(pageInfo[1], "|"))
+				if !ok {
+					r.SendMsg(update.CallbackQuery.Message.Chat.ID, locale.T(ctx, "search.expired"))
+					r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, update.CallbackQuery.Data))
+					return
+				}
+				shops, err := r.shopsByKey(ctx, key)
+				if err != nil {
+					log.WithError(err).Error("Database query error")
+				}
+				if len(shops) == 0 && err == nil && strings.HasPrefix(key, openNowPrefix) {
+					r.SendMsg(update.CallbackQuery.Message.Chat.ID, locale.T(ctx, "search.noneOpen"))
+					r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, update.CallbackQuery.Data))
+					return
+				}
+				if len(shops) == 0 && err == nil && strings.HasPrefix(key, geoSearchPrefix) {
+					_, radius := splitGeoKey(strings.TrimPrefix(key, geoSearchPrefix))
+					r.SendMsg(update.CallbackQuery.Message.Chat.ID, locale.T(ctx, "search.noneNearby", radius))
+					r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, update.CallbackQuery.Data))
+					return
+				}
+				if len(shops) == 0 {
+					log.WithField("query", key).Error("Cache hit failed")
+					r.SendMsg(update.CallbackQuery.Message.Chat.ID, locale.T(ctx, "error.system"))
+					r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, update.CallbackQuery.Data))
+					return
+				}
+				//Keep order of shops already shown
+				pinned, stale, err := r.pinnedShops(ctx, update.CallbackQuery.Message.Chat.ID,
+					update.CallbackQuery.Message.MessageID, key, shops)
+				if err != nil {
+					log.WithError(err).Error("Database query error")
+				} else if len(pinned) > 0 {
+					shops = pinned
+				}
+				if offset >= len(shops) {
+					offset = 0
+				}
+				err = r.RefreshList(ctx, update.CallbackQuery.Message.Chat.ID,
+					update.CallbackQuery.Message.MessageID,
+					shops, key,
+					EntriesPerPage, offset, stale,
+				)
+				if err != nil {
+					log.WithError(err).Error("Telegram error")
+				}
+				r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, update.CallbackQuery.Data))
+			} else {
+				//Pick an item and post its detail, behaves same as picking
+				//single item
+				itemID, err := strconv.Atoi(update.CallbackQuery.Data)
+				if err != nil {
+					log.WithError(err).WithField("callbackData", update.CallbackQuery.Data).Printf("Unexpected callback data")
 				} else {
-					//Pick an item and post its detail, behaves same as picking
-					//single item
-					itemID, err := strconv.Atoi(update.CallbackQuery.Data)
+					result, err := r.da.ShopByID(ctx, itemID)
+					log.WithFields(log.Fields{
+						"shopID":   itemID,
+						"shopName": result.Name,
+					}).Info("Single shop selected")
 					if err != nil {
-						log.WithError(err).WithField("callbackData", update.CallbackQuery.Data).Printf("Unexpected callback data")
-					} else {
-						result, err := r.da.ShopByID(itemID)
+						r.SendMsg(update.CallbackQuery.Message.Chat.ID, locale.T(ctx, "error.shopNotFound"))
 						log.WithFields(log.Fields{
-							"shopID":   itemID,
-							"shopName": result.Name,
-						}).Info("Single shop selected")
-						if err != nil {
-							r.SendMsg(update.CallbackQuery.Message.Chat.ID, "資料庫錯誤! 找不到店舖")
-							log.WithFields(log.Fields{
-								"shopID": itemID,
-							}).WithError(err).Error("Shop not found")
-						} else {
-							r.SendSingleShop(update.CallbackQuery.Message.Chat.ID, result)
-						}
+							"shopID": itemID,
+						}).WithError(err).Error("Shop not found")
+					} else {
+						r.SendSingleShop(ctx, update.CallbackQuery.Message.Chat.ID, result)
+						r.recordView(ctx, update.CallbackQuery.From, itemID, listSource(update.CallbackQuery.Message))
 					}
 				}
 				r.bot.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, update.CallbackQuery.Data))
 			}
-		case update.Message != nil:
-			//Direct chat
-			switch {
-			case update.Message.Location != nil:
-				//Posting location
-				shops, err := r.shopWithCoord(update.Message.Location.Latitude,
-					update.Message.Location.Longitude, DistanceLimit)
+		}
+	case update.Message != nil:
+		//Direct chat, or group chat when the bot is addressed. Messages of
+		//active session are not searches
+		if r.sessionMessage(ctx, update.Message) {
+			return
+		}
+		if r.serveCommand(ctx, update.Message) {
+			return
+		}
+		switch {
+		case update.Message.Location != nil:
+			//Posting location
+			if update.Message.From != nil {
+				rememberLocation(update.Message.From.ID, update.Message.Location.Latitude, update.Message.Location.Longitude)
+			}
+			radius := r.userRadius(ctx, update.Message.From)
+			shops, err := r.shopWithCoord(ctx, update.Message.Location.Latitude,
+				update.Message.Location.Longitude, radius)
+			if err != nil {
+				r.SendMsg(update.Message.Chat.ID, locale.T(ctx, "error.database"))
+				log.WithError(err).Error("Database error")
+			}
+			log.WithFields(log.Fields{
+				"radius":    radius,
+				"resultCnt": len(shops),
+			}).Info("Location search")
+			geoHashStr := ghash.EncodeWithPrecision(update.Message.Location.Latitude, update.Message.Location.Longitude, GeohashPrecision)
+			key := geoKey(geoHashStr, radius)
+			switch len(shops) {
+			case 0:
+				//Offer other radii to widen the search
+				msg := tgbotapi.NewMessage(update.Message.Chat.ID, locale.T(ctx, "search.noneNearby", radius))
+				msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(radiusRow(key, r.tokenFunc(ctx)))
+				_, err = r.bot.Send(msg)
+			case 1:
+				err = r.SendSingleShop(ctx, update.Message.Chat.ID, shops[0])
+				r.recordView(ctx, update.Message.From, shops[0].ID, keySource(key))
+			default:
+				err = r.SendList(ctx, update.Message.Chat.ID, shops, key, EntriesPerPage, 0)
+			}
+			if err != nil {
+				log.WithError(err).Error("Telegram error")
+			}
+
+		case len(update.Message.Text) > 0:
+			var shops []dao.Shop
+			var err error
+			//key identifies the search for paging
+			var key string
+			var openNow bool
+			if strings.HasPrefix(update.Message.Text, "/query") {
+				//queryall includes closed shops for historical lookup
+				includeClosed := strings.HasPrefix(update.Message.Text, "/queryall")
+				var queryStr string
+				queryStr, openNow = splitOpenNow(strings.TrimSpace(update.Message.CommandArguments()))
+				var q dao.Query
+				q, err = r.parseQuery(ctx, update.Message.From, queryStr)
+				if err == nil {
+					openNow = openNow || q.OpenNow
+					q.OpenNow = false
+					shops, err = r.advSearch(ctx, q, includeClosed)
+				}
+				if text, ok := queryErrorText(ctx, err); ok {
+					log.WithError(err).Info("Invalid query")
+					err = r.SendText(update.Message.Chat.ID, text)
+					if err != nil {
+						log.WithError(err).Error("Telegram error")
+					}
+					return
+				}
 				if err != nil {
-					r.SendMsg(update.Message.Chat.ID, "資料庫錯誤！請稍後再試")
+					r.SendMsg(update.Message.Chat.ID, locale.T(ctx, "error.database"))
 					log.WithError(err).Error("Database error")
+					return
 				}
-				log.WithField("resultCnt", len(shops)).Info("Location search")
-				switch len(shops) {
-				case 0:
-					err = r.SendMsg(update.Message.Chat.ID, "附近找不到店舖！")
-				case 1:
-					err = r.SendSingleShop(update.Message.Chat.ID, shops[0])
-				default:
-					geoHashStr := ghash.EncodeWithPrecision(update.Message.Location.Latitude, update.Message.Location.Longitude, GeohashPrecision)
-					err = r.SendList(update.Message.Chat.ID, shops, geoSearchPrefix+geoHashStr, EntriesPerPage, 0)
+				key = advSearchPrefix + q.String()
+				msg := "Advance search"
+				if includeClosed {
+					key = advAllSearchPrefix + q.String()
+					msg = "Advance search with closed shops"
 				}
+				log.WithFields(log.Fields{
+					"query":     q.String(),
+					"resultCnt": len(shops),
+				}).Info(msg)
+			} else {
+				//Text search
+				var queryStr string
+				queryStr, openNow = splitOpenNow(strings.TrimSpace(update.Message.Text))
+				key = simpleSearchPrefix + queryStr
+				shops, err = r.shopWithTags(ctx, queryStr)
 				if err != nil {
-					log.WithError(err).Error("Telegram error")
+					r.SendMsg(update.Message.Chat.ID, locale.T(ctx, "error.database"))
+					log.WithError(err).Error("Database error")
+					return
 				}
-
-			case len(update.Message.Text) > 0:
-				if update.Message.Text == "/start" || update.Message.Text == "/help" {
-					r.SendMsg(update.Message.Chat.ID, r.helpMsg)
-					if update.Message.Text == "/start" {
-						log.Info("New joiner")
-					}
-				} else {
-					var shops []dao.Shop
-					var err error
-					if strings.HasPrefix(update.Message.Text, "/query") {
-						queryStr := strings.TrimPrefix(update.Message.Text, "/query ")
-						shops, err = r.advSearch(strings.TrimSpace(queryStr))
-						if err != nil {
-							r.SendMsg(update.Message.Chat.ID, "資料庫錯誤")
-							log.WithError(err).Error("Database error")
-						}
-						log.WithFields(log.Fields{
-							"query":     queryStr,
-							"resultCnt": len(shops),
-						}).Info("Advance search")
-					} else {
-						//Text search
-						if strings.Contains(strings.ToLower(update.Message.Text), "drop table") {
-							log.WithFields(
-								log.Fields{
-									"query":    strings.TrimSpace(update.Message.Text),
-									"lang":     update.Message.From.LanguageCode,
-									"fullName": update.Message.From.FirstName + " " + update.Message.From.LastName,
-									"userName": update.Message.From,
-									"userID":   update.Message.From.ID,
-								}).Warn("SQL injection detected")
-							continue
-						}
-						shops, err = r.shopWithTags(strings.TrimSpace(update.Message.Text))
-						if err != nil {
-							r.SendMsg(update.Message.Chat.ID, "資料庫錯誤")
-							log.WithError(err).Error("Database error")
-						}
-						log.WithFields(log.Fields{
-							"query":     update.Message.Text,
-							"resultCnt": len(shops),
-						}).Printf("Simple search")
-					}
-					switch len(shops) {
-					case 0:
-						//Run against districts
-						kwList := strings.Split(update.Message.Text, " ")
-						hasSuggested := false
-						for i := range kwList {
-							if !r.isDistrict(kwList[i]) {
-								sList, err := r.da.SuggestKeyword(kwList[i])
-								if err != nil || len(sList) == 0 {
-									break
-								}
-								err = r.SendMsg(update.Message.Chat.ID, fmt.Sprintf("關鍵字找不到任何結果\n可嘗試以下關鍵字:\n%s", strings.Join(sList, " ")))
-								hasSuggested = true
-								break
-							}
-						}
-						if !hasSuggested {
-							err = r.SendMsg(update.Message.Chat.ID, "關鍵字找不到任何結果\n可嘗試直接提供座標 (📎>Location) 搜尋座標附近店舖")
-						}
-					case 1:
-						err = r.SendSingleShop(update.Message.Chat.ID, shops[0])
-					default:
-						if strings.HasPrefix(update.Message.Text, "/query") {
-							err = r.SendList(update.Message.Chat.ID, shops, advSearchPrefix+strings.TrimPrefix(update.Message.Text, "/query "), EntriesPerPage, 0)
-						} else {
-							err = r.SendList(update.Message.Chat.ID, shops, simpleSearchPrefix+update.Message.Text, EntriesPerPage, 0)
+				log.WithFields(log.Fields{
+					"query":     update.Message.Text,
+					"resultCnt": len(shops),
+				}).Printf("Simple search")
+			}
+			if openNow {
+				key = openNowPrefix + key
+				shops = r.openNow(shops, time.Now())
+			}
+			switch {
+			case len(shops) == 0 && openNow:
+				err = r.SendMsg(update.Message.Chat.ID, locale.T(ctx, "search.noneOpen"))
+			case len(shops) == 0:
+				//Run against districts
+				kwList := strings.Split(update.Message.Text, " ")
+				hasSuggested := false
+				for i := range kwList {
+					if !r.isDistrict(ctx, kwList[i]) {
+						sList, err := r.da.SuggestKeyword(ctx, kwList[i])
+						if err != nil || len(sList) == 0 {
+							break
 						}
+						err = r.SendText(update.Message.Chat.ID, locale.T(ctx, "search.suggest", strings.Join(sList, " ")))
+						hasSuggested = true
+						break
 					}
-					if err != nil {
-						log.WithError(err).Error("Telegram error")
-					}
 				}
+				if !hasSuggested {
+					err = r.SendMsg(update.Message.Chat.ID, locale.T(ctx, "search.tryLocation"))
+				}
+			case len(shops) == 1:
+				err = r.SendSingleShop(ctx, update.Message.Chat.ID, shops[0])
+				r.recordView(ctx, update.Message.From, shops[0].ID, keySource(key))
+			default:
+				err = r.SendList(ctx, update.Message.Chat.ID, shops, key, EntriesPerPage, 0)
+			}
+			if err != nil {
+				log.WithError(err).Error("Telegram error")
 			}
 		}
 	}
 }
 
-// SendMsg sends simple telegram message back to user
+// SendMsg sends simple telegram message back to user. Text is fixed
+// Markdown, shop data goes through renderer instead
 func (r ServeBot) SendMsg(chatID int64, text string) error {
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ParseMode = tgbotapi.ModeMarkdown
-	_, err := r.bot.Send(msg)
-	if err != nil {
-		return err
+	for _, part := range render.Split(text, render.MaxMessageLen) {
+		msg := tgbotapi.NewMessage(chatID, part)
+		msg.ParseMode = tgbotapi.ModeMarkdown
+		_, err := r.bot.Send(msg)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// SendText sends plain telegram message without markup, for text entered by
+// users
+func (r ServeBot) SendText(chatID int64, text string) error {
+	for _, part := range render.Split(text, render.MaxMessageLen) {
+		_, err := r.bot.Send(tgbotapi.NewMessage(chatID, part))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//sendRendered sends text made by renderer, split if too long. markup is sent
+//with the last message, which is returned
+func (r ServeBot) sendRendered(chatID int64, text string, markup interface{}) (tgbotapi.Message, error) {
+	parts := render.Split(text, render.MaxMessageLen)
+	var sent tgbotapi.Message
+	for i, part := range parts {
+		msg := tgbotapi.NewMessage(chatID, part)
+		msg.ParseMode = r.renderer.Mode()
+		msg.DisableWebPagePreview = true
+		if i == len(parts)-1 {
+			msg.ReplyMarkup = markup
+		}
+		var err error
+		sent, err = r.bot.Send(msg)
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
 // RefreshList edit an already sent message to refresh shops list when
-// user request next/prev page
-func (r ServeBot) RefreshList(chatID int64, messageID int, shops []dao.Shop, key string, limit, offset int) error {
-	msgBody, buttons := shopListMessage(shops, key, limit, offset)
-	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, msgBody)
-	editMsg.ParseMode = tgbotapi.ModeMarkdown
+// user request next/prev page. Stale lists come with a refresh button
+func (r ServeBot) RefreshList(ctx context.Context, chatID int64, messageID int, shops []dao.Shop, key string, limit, offset int, stale bool) error {
+	msgBody, buttons, err := r.shopListMessage(ctx, shops, key, limit, offset)
+	if err != nil {
+		return err
+	}
+	if stale {
+		buttons.InlineKeyboard = append(buttons.InlineKeyboard,
+			tgbotapi.NewInlineKeyboardRow(refreshButton(locale.FromContext(ctx), r.queryToken(ctx, key))))
+	}
+	//Only one message can be edited
+	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, render.Truncate(msgBody, render.MaxMessageLen))
+	editMsg.ParseMode = r.renderer.Mode()
 	editMsg.DisableWebPagePreview = true
-	_, err := r.bot.Send(editMsg)
+	_, err = r.bot.Send(editMsg)
 	if err != nil {
 		err = fmt.Errorf("Error editing message: %w", err)
 	}
@@ -486,34 +782,38 @@ func (r ServeBot) RefreshList(chatID int64, messageID int, shops []dao.Shop, key
 }
 
 //SendList sends a restaurant list along with callback inline btns
-func (r ServeBot) SendList(chatID int64, shops []dao.Shop, key string, limit, offset int) error {
-	msgBody, buttons := shopListMessage(shops, key, limit, offset)
-	msg := tgbotapi.NewMessage(chatID, msgBody)
-	msg.ParseMode = tgbotapi.ModeMarkdown
-	msg.DisableWebPagePreview = true
-	msg.ReplyMarkup = buttons
-	_, err := r.bot.Send(msg)
+func (r ServeBot) SendList(ctx context.Context, chatID int64, shops []dao.Shop, key string, limit, offset int) error {
+	msgBody, buttons, err := r.shopListMessage(ctx, shops, key, limit, offset)
+	if err != nil {
+		return err
+	}
+	sent, err := r.sendRendered(chatID, msgBody, buttons)
+	if err == nil {
+		pinList(chatID, sent.MessageID, key, shops)
+	}
 	return err
 }
 
-func shopListMessage(shops []dao.Shop, key string, limit, offset int) (string, tgbotapi.InlineKeyboardMarkup) {
-	msgBody := strings.Builder{}
+//shopListMessage returns list of shops of search key. Buttons refer to
+//searches by query token
+func (r ServeBot) shopListMessage(ctx context.Context, shops []dao.Shop, key string, limit, offset int) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	token := r.tokenFunc(ctx)
+	lang := locale.FromContext(ctx)
 	// Do paging
 	pageInd := fmt.Sprintf("%d/%d", offset/EntriesPerPage+1, (len(shops)+EntriesPerPage-1)/EntriesPerPage)
 	pagedShop := shops[offset:min(len(shops), offset+limit)]
+	now := time.Now()
 	btns := make([]tgbotapi.InlineKeyboardButton, 0, len(pagedShop))
+	items := make([]render.ListItem, len(pagedShop))
 	// Generate message body and nav buttons
 	for i := range pagedShop {
-		msgBody.WriteString(fmt.Sprintf("(%d) *%s* (%s) - %s", i+1, pagedShop[i].Name, pagedShop[i].Type, pagedShop[i].District))
-		if pagedShop[i].URL != "" {
-			msgBody.WriteString(fmt.Sprintf(" [連結](%s)", pagedShop[i].URL))
-		}
-		if pagedShop[i].Notes != "" {
-			msgBody.WriteString(fmt.Sprintf("\n📝%s", pagedShop[i].Notes))
-		}
-		msgBody.WriteString("\n")
+		items[i] = render.ListItem{Index: i + 1, ShopView: r.renderer.View(pagedShop[i], statusText(lang, pagedShop[i], now))}
 		btns = append(btns, tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(i+1), strconv.Itoa(pagedShop[i].ID)))
 	}
+	msgBody, err := r.renderer.Render(render.TmplList, items)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
 	fullInlineKb := make([][]tgbotapi.InlineKeyboardButton, 0)
 	if len(btns) > 5 {
 		//Split into 2 rows if more than 5 btns
@@ -524,7 +824,7 @@ func shopListMessage(shops []dao.Shop, key string, limit, offset int) (string, t
 	//Add prev/next btn on second row
 	pageControl := make([]tgbotapi.InlineKeyboardButton, 0)
 	if offset > 0 {
-		pageControl = append(pageControl, tgbotapi.NewInlineKeyboardButtonData("⏮️", fmt.Sprintf("P%d||%s", max(0, offset-limit), key)))
+		pageControl = append(pageControl, tgbotapi.NewInlineKeyboardButtonData("⏮️", fmt.Sprintf("P%d|%s", max(0, offset-limit), token(key))))
 		//Insert page number
 		pageControl = append(pageControl, tgbotapi.NewInlineKeyboardButtonData(pageInd, "---"))
 	}
@@ -533,42 +833,187 @@ func shopListMessage(shops []dao.Shop, key string, limit, offset int) (string, t
 			//Insert page number
 			pageControl = append(pageControl, tgbotapi.NewInlineKeyboardButtonData(pageInd, "---"))
 		}
-		pageControl = append(pageControl, tgbotapi.NewInlineKeyboardButtonData("⏭️", fmt.Sprintf("P%d||%s", min(len(shops), offset+limit), key)))
+		pageControl = append(pageControl, tgbotapi.NewInlineKeyboardButtonData("⏭️", fmt.Sprintf("P%d|%s", min(len(shops), offset+limit), token(key))))
 	}
 	if len(pageControl) > 0 {
 		fullInlineKb = append(fullInlineKb, pageControl)
 	}
+	//Toggle open now filter, restarting from first page
+	if strings.HasPrefix(key, openNowPrefix) {
+		fullInlineKb = append(fullInlineKb, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(locale.Get(lang, "button.showAll"), "P0|"+token(strings.TrimPrefix(key, openNowPrefix)))))
+	} else if hasHours(shops) {
+		fullInlineKb = append(fullInlineKb, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(locale.Get(lang, "button.openNow"), "P0|"+token(openNowPrefix+key))))
+	}
+	if row := facetRow(lang, key, shops, token); len(row) > 0 {
+		fullInlineKb = append(fullInlineKb, row)
+	}
+	if strings.HasPrefix(strings.TrimPrefix(key, openNowPrefix), geoSearchPrefix) {
+		fullInlineKb = append(fullInlineKb, radiusRow(key, token), tgbotapi.NewInlineKeyboardRow(randomButton(lang, token(key))))
+	}
+	if strings.HasPrefix(strings.TrimPrefix(key, openNowPrefix), historySearchPrefix) {
+		fullInlineKb = append(fullInlineKb, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(locale.Get(lang, "button.clearHistory"), historyClear)))
+	}
 
-	return msgBody.String(), tgbotapi.NewInlineKeyboardMarkup(fullInlineKb...)
+	return msgBody, tgbotapi.NewInlineKeyboardMarkup(fullInlineKb...), nil
+}
+
+//hasHours checks if opening hours of any shop is known
+func hasHours(shops []dao.Shop) bool {
+	for i := range shops {
+		if shops[i].Hours != nil {
+			return true
+		}
+	}
+	return false
+}
+
+//hoursText describes opening hours of today in lang, empty if unknown
+func (r ServeBot) hoursText(lang string, shop dao.Shop, now time.Time) string {
+	if shop.Hours == nil || shop.StatusAt(now) != dao.StatusOpen {
+		return ""
+	}
+	sessions := shop.Hours.SessionsOn(now, r.holidays)
+	if len(sessions) == 0 {
+		return locale.Get(lang, "hours.closedToday")
+	}
+	text := locale.Get(lang, "hours.today", dao.FormatSessions(sessions))
+	if d, open := shop.Hours.ClosesIn(now, r.holidays); open && d <= ClosingSoon {
+		text += locale.Get(lang, "hours.closingSoon")
+	}
+	return text
+}
+
+//statusText describes shop status at time now in lang, empty if the shop is
+//open
+func statusText(lang string, shop dao.Shop, now time.Time) string {
+	switch shop.StatusAt(now) {
+	case dao.StatusTempClosed:
+		if shop.StatusUntil.IsZero() {
+			return locale.Get(lang, "status.tempClosed")
+		}
+		return locale.Get(lang, "status.tempClosedUntil", shop.StatusUntil.In(dao.HKT).Format("2006-01-02"))
+	case dao.StatusClosed:
+		if shop.StatusSince.IsZero() {
+			return locale.Get(lang, "status.closed")
+		}
+		return locale.Get(lang, "status.closedSince", shop.StatusSince.In(dao.HKT).Format("2006-01-02"))
+	case dao.StatusMoved:
+		return locale.Get(lang, "status.moved")
+	}
+	return ""
 }
 
 //SendSingleShop sends single shop data to Chat, along with
 // coordinates
-func (r ServeBot) SendSingleShop(chatID int64, shop dao.Shop) error {
+func (r ServeBot) SendSingleShop(ctx context.Context, chatID int64, shop dao.Shop) error {
+	now := time.Now()
+	lang := locale.FromContext(ctx)
+	status := statusText(lang, shop, now)
+	if hours := r.hoursText(lang, shop, now); hours != "" {
+		status = hours
+	}
 	if shop.HasPhyLoc() {
 		lat, long := shop.ToCoord()
 		venue := tgbotapi.NewVenue(chatID, fmt.Sprintf("%s-%s (%s)", shop.Name, shop.District, shop.Type), shop.Address, lat, long)
 
 		var row []tgbotapi.InlineKeyboardButton
-		row = append(row, tgbotapi.NewInlineKeyboardButtonURL("🔍Google 店名", "https://google.com/search?q="+url.QueryEscape(shop.Name)))
+		row = append(row, tgbotapi.NewInlineKeyboardButtonURL(locale.Get(lang, "button.google"), "https://google.com/search?q="+url.QueryEscape(shop.Name)))
 		if shop.URL != "" {
-			row = append(row, tgbotapi.NewInlineKeyboardButtonURL("🏠店舖網站", shop.URL))
+			row = append(row, tgbotapi.NewInlineKeyboardButtonURL(locale.Get(lang, "button.website"), shop.URL))
 		}
-		venue.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(row)
+		if shop.Status == dao.StatusMoved && shop.MovedTo != 0 {
+			//Same callback data as picking the shop from a list
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(locale.Get(lang, "button.movedTo"), strconv.Itoa(shop.MovedTo)))
+		}
+		venue.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(row, r.actionRow(ctx, shop))
 		_, err := r.bot.Send(venue)
 		if err != nil {
 			return fmt.Errorf("ChatID %v cannot be sent: %v", chatID, err)
 		}
 	} else {
 		//non-physical store
-		r.SendMsg(chatID, fmt.Sprintf("*%s* (%s) - \n[連結](%s)", shop.Name, shop.Type, shop.URL))
+		text, err := r.renderer.Render(render.TmplDetail, r.renderer.View(shop, status))
+		if err != nil {
+			return err
+		}
+		_, err = r.sendRendered(chatID, text, tgbotapi.NewInlineKeyboardMarkup(r.actionRow(ctx, shop)))
+		if err != nil {
+			return fmt.Errorf("ChatID %v cannot be sent: %v", chatID, err)
+		}
+	}
+	if status != "" {
+		r.SendText(chatID, status)
 	}
 	if shop.Notes != "" {
-		r.SendMsg(chatID, fmt.Sprintf("📝備註: %s", shop.Notes))
+		text, err := r.renderer.Render(render.TmplNotes, r.renderer.View(shop, status))
+		if err != nil {
+			return err
+		}
+		_, err = r.sendRendered(chatID, text, nil)
+		return err
 	}
 	return nil
 }
 
+//actionRow is the keyboard row of actions on shop by user
+func (r ServeBot) actionRow(ctx context.Context, shop dao.Shop) []tgbotapi.InlineKeyboardButton {
+	return append(r.favButton(ctx, shop), reportButton(locale.FromContext(ctx), shop))
+}
+
+//splitOpenNow removes the open now keyword from query. The keyword is kept
+//as an ordinary keyword if it is the only one.
+func splitOpenNow(query string) (string, bool) {
+	words := strings.Fields(query)
+	rest := make([]string, 0, len(words))
+	for _, w := range words {
+		if w != openNowWord {
+			rest = append(rest, w)
+		}
+	}
+	if len(rest) == len(words) || len(rest) == 0 {
+		return query, false
+	}
+	return strings.Join(rest, " "), true
+}
+
+//openNow keeps shops open at time now, shops without opening hours are dropped
+func (r ServeBot) openNow(shops []dao.Shop, now time.Time) []dao.Shop {
+	result := make([]dao.Shop, 0, len(shops))
+	for _, shop := range shops {
+		if shop.OpenAt(now, r.holidays) {
+			result = append(result, shop)
+		}
+	}
+	return result
+}
+
+//shopsByKey reruns the search identified by paging key
+func (r ServeBot) shopsByKey(ctx context.Context, key string) ([]dao.Shop, error) {
+	if strings.HasPrefix(key, openNowPrefix) {
+		shops, err := r.shopsByKey(ctx, strings.TrimPrefix(key, openNowPrefix))
+		return r.openNow(shops, time.Now()), err
+	}
+	switch {
+	case strings.HasPrefix(key, facetPrefix):
+		return r.facetShops(ctx, key)
+	case strings.HasPrefix(key, favSearchPrefix):
+		return r.favShops(ctx, strings.TrimPrefix(key, favSearchPrefix))
+	case strings.HasPrefix(key, historySearchPrefix):
+		return r.historyShops(ctx, strings.TrimPrefix(key, historySearchPrefix))
+	case strings.HasPrefix(key, geoSearchPrefix):
+		geohash, radius := splitGeoKey(strings.TrimPrefix(key, geoSearchPrefix))
+		return r.shopWithGeohash(ctx, geohash, radius, false)
+	case strings.HasPrefix(key, advAllSearchPrefix):
+		return r.advSearchKey(ctx, strings.TrimPrefix(key, advAllSearchPrefix), true)
+	case strings.HasPrefix(key, advSearchPrefix):
+		return r.advSearchKey(ctx, strings.TrimPrefix(key, advSearchPrefix), false)
+	}
+	return r.shopWithTags(ctx, strings.TrimPrefix(key, simpleSearchPrefix))
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -0,0 +1,148 @@
+package wongdim
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"equa.link/wongdim/dao"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	ghash "github.com/mmcloughlin/geohash"
+)
+
+const (
+	//testUserID is the Telegram user of favourites and history in tests
+	testUserID = 42
+	//testBotID is the Telegram user of the bot in tests
+	testBotID = 99
+)
+
+//fakeTelegram records requests to Bot API and answers them all with a message
+type fakeTelegram struct {
+	mu       sync.Mutex
+	requests []telegramRequest
+}
+
+//telegramRequest is a Bot API method called with its parameters
+type telegramRequest struct {
+	Method string
+	Params url.Values
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	f.mu.Lock()
+	f.requests = append(f.requests, telegramRequest{Method: path.Base(req.URL.Path), Params: req.PostForm})
+	f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":1}}}`))
+}
+
+//texts returns text of messages sent since last call
+func (f *fakeTelegram) texts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	texts := make([]string, 0, len(f.requests))
+	for _, req := range f.requests {
+		if req.Method == "sendMessage" {
+			texts = append(texts, req.Params.Get("text"))
+		}
+	}
+	f.requests = nil
+	return texts
+}
+
+//newTestBot returns a bot talking to a fake Telegram, on a memory backend
+//with two open shops in different districts and a closed one
+func newTestBot(t *testing.T) (*ServeBot, *fakeTelegram) {
+	t.Helper()
+	tg := &fakeTelegram{}
+	server := httptest.NewServer(tg)
+	t.Cleanup(server.Close)
+	bot := &tgbotapi.BotAPI{Token: "test", Self: tgbotapi.User{ID: testBotID, UserName: "wongdim_bot"}, Client: server.Client()}
+	bot.SetAPIEndpoint(server.URL + "/bot%s/%s")
+	m := dao.NewMemoryBackend([]dao.Shop{
+		{ID: 1, Name: "留白", Address: "荃灣昌寧商場地下12號舖", Type: "咖啡", District: "荃灣", Position: dao.Coord{Lat: 22.371154, Long: 114.112603}, Tags: []string{"荃灣", "咖啡", "美食"}},
+		{ID: 2, Name: "金華冰廳", Address: "旺角弼街47號", Type: "茶餐廳", District: "旺角", Position: dao.Coord{Lat: 22.3203, Long: 114.1729}, Tags: []string{"旺角", "茶餐廳", "美食"}},
+		{ID: 3, Name: "荃灣咖啡室", Address: "荃灣沙咀道1號", Type: "咖啡", District: "荃灣", Position: dao.Coord{Lat: 22.3712, Long: 114.1127}, Tags: []string{"荃灣", "咖啡", "美食"}, Status: dao.StatusClosed},
+	})
+	return &ServeBot{
+		bot:        bot,
+		da:         m,
+		favourites: m,
+		users:      m,
+		sessions:   NewMemorySessionStore(),
+		flows:      make(map[string]Flow),
+	}, tg
+}
+
+//shopIDs returns IDs of shops in ascending order
+func shopIDs(shops []dao.Shop) []int {
+	ids := make([]int, len(shops))
+	for i := range shops {
+		ids[i] = shops[i].ID
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func TestShopsByKey(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestBot(t)
+	err := r.favourites.AddFavourite(ctx, testUserID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dao.SaveUserData(ctx, r.users, testUserID, historyKey, []viewRecord{{ShopID: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := strconv.Itoa(testUserID)
+	geohash := ghash.EncodeWithPrecision(22.3711, 114.1126, GeohashPrecision)
+	cases := []struct {
+		key  string
+		want []int
+	}{
+		{simpleSearchPrefix + "美食", []int{1, 2}},
+		{"美食", []int{1, 2}},
+		{favSearchPrefix + user, []int{2}},
+		{historySearchPrefix + user, []int{1}},
+		{geoKey(geohash, "500m"), []int{1}},
+		{advSearchPrefix + "美食", []int{1, 2}},
+		{advAllSearchPrefix + "美食", []int{1, 2, 3}},
+		{advSearchPrefix + "美食 near:" + geohash + "@500m", []int{1}},
+		{advAllSearchPrefix + "美食 near:" + geohash + "@500m", []int{1, 3}},
+		{facetKey(simpleSearchPrefix+"美食", dao.QueryDistrict, "旺角"), []int{2}},
+		{facetKey(favSearchPrefix+user, dao.QueryType, "茶餐廳"), []int{2}},
+		{facetKey(advAllSearchPrefix+"美食", dao.QueryDistrict, "荃灣"), []int{1, 3}},
+		{openNowPrefix + simpleSearchPrefix + "美食", []int{}},
+	}
+	for _, c := range cases {
+		shops, err := r.shopsByKey(ctx, c.key)
+		if err != nil {
+			t.Errorf("%s: %v", c.key, err)
+			continue
+		}
+		if got := shopIDs(shops); !equalInts(got, c.want) {
+			t.Errorf("%s expected: %v, actual %v", c.key, c.want, got)
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package wongdim
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"equa.link/wongdim/dao"
+	gcache "github.com/patrickmn/go-cache"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//QueryTokenTimeout is how long a search is kept for buttons referring to
+	//it
+	QueryTokenTimeout = 30 * 24 * time.Hour
+
+	//queryTokenKey is the UserStore key prefix of searches, followed by token
+	queryTokenKey = "query:"
+	//systemUserID is the UserStore user of records not belonging to any user.
+	//Telegram user IDs are positive
+	systemUserID = 0
+	//queryTokenLen is the length of token in bytes before encoding
+	queryTokenLen = 9
+	//queryTokenPurgeEvery is the interval of removing expired searches from
+	//UserStore
+	queryTokenPurgeEvery = 24 * time.Hour
+)
+
+//querySpec is a search referred by token. Key encodes mode, keywords,
+//location, radius and filters of the search, see shopsByKey
+type querySpec struct {
+	Key     string
+	Created time.Time
+}
+
+//queryTokens holds search keys by token, in front of UserStore
+var queryTokens = gcache.New(time.Hour, 2*time.Hour)
+
+//tokenOf returns token of search key. Tokens are derived from keys, so the
+//same search always gets the same token
+func tokenOf(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return base64.RawURLEncoding.EncodeToString(sum[:queryTokenLen])
+}
+
+//queryToken registers search key and returns its token for callback data,
+//which Telegram limits to 64 bytes
+func (r ServeBot) queryToken(ctx context.Context, key string) string {
+	token := tokenOf(key)
+	if _, ok := queryTokens.Get(token); ok {
+		return token
+	}
+	queryTokens.SetDefault(token, key)
+	err := dao.SaveUserData(ctx, r.users, systemUserID, queryTokenKey+token, querySpec{Key: key, Created: time.Now()})
+	if err != nil {
+		//Token still works until restart
+		log.WithError(err).WithField("query", key).Error("Cannot save query token")
+	}
+	return token
+}
+
+//queryKey returns search key of token in callback data. Buttons made before
+//tokens carry the key itself, which always begins with "<". It returns false
+//if the token has expired
+func (r ServeBot) queryKey(ctx context.Context, token string) (string, bool) {
+	if strings.HasPrefix(token, "<") {
+		return token, true
+	}
+	if key, ok := queryTokens.Get(token); ok {
+		return key.(string), true
+	}
+	var spec querySpec
+	found, err := dao.LoadUserData(ctx, r.users, systemUserID, queryTokenKey+token, &spec)
+	if err != nil {
+		log.WithError(err).WithField("token", token).Error("Cannot load query token")
+		return "", false
+	}
+	if !found {
+		return "", false
+	}
+	if time.Since(spec.Created) > QueryTokenTimeout {
+		r.users.DeleteUserData(ctx, systemUserID, queryTokenKey+token)
+		return "", false
+	}
+	queryTokens.SetDefault(token, spec.Key)
+	return spec.Key, true
+}
+
+//purgeQueryTokens removes searches saved longer than QueryTokenTimeout ago,
+//now and every queryTokenPurgeEvery. Their buttons no longer work anyway
+func purgeQueryTokens(purger dao.UserDataPurger) {
+	ticker := time.NewTicker(queryTokenPurgeEvery)
+	defer ticker.Stop()
+	for ; true; <-ticker.C {
+		n, err := purger.PurgeUserData(context.Background(), systemUserID, queryTokenKey, time.Now().Add(-QueryTokenTimeout))
+		if err != nil {
+			log.WithError(err).Error("Cannot purge expired query tokens")
+			continue
+		}
+		log.WithField("count", n).Debug("Purged expired query tokens")
+	}
+}
+
+//tokenFunc returns queryToken bound to ctx, for shopListMessage
+func (r ServeBot) tokenFunc(ctx context.Context) func(string) string {
+	return func(key string) string {
+		return r.queryToken(ctx, key)
+	}
+}
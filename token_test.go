@@ -0,0 +1,59 @@
+package wongdim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"equa.link/wongdim/dao"
+)
+
+func TestQueryToken(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestBot(t)
+	key := advSearchPrefix + "咖啡 near:wecnvgm2r@1km"
+	token := r.queryToken(ctx, key)
+	if len(token) > 64-len(listRefresh) {
+		t.Errorf("Token %q too long for callback data", token)
+	}
+	if again := r.queryToken(ctx, key); again != token {
+		t.Errorf("Same search expected to get token %q, actual %q", token, again)
+	}
+	expired := tokenOf(simpleSearchPrefix + "expired")
+	err := dao.SaveUserData(ctx, r.users, systemUserID, queryTokenKey+expired, querySpec{
+		Key:     simpleSearchPrefix + "expired",
+		Created: time.Now().Add(-QueryTokenTimeout - time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		//restart drops tokens held in memory
+		restart bool
+		token   string
+		want    string
+		ok      bool
+	}{
+		{"cached", false, token, key, true},
+		{"saved", true, token, key, true},
+		{"key in button", true, key, key, true},
+		{"expired", true, expired, "", false},
+		{"expired again", true, expired, "", false},
+		{"unknown", true, tokenOf("unknown"), "", false},
+	}
+	for _, c := range cases {
+		if c.restart {
+			queryTokens.Flush()
+		}
+		got, ok := r.queryKey(ctx, c.token)
+		if got != c.want || ok != c.ok {
+			t.Errorf("%s expected: %q %v, actual %q %v", c.name, c.want, c.ok, got, ok)
+		}
+	}
+	var spec querySpec
+	found, err := dao.LoadUserData(ctx, r.users, systemUserID, queryTokenKey+expired, &spec)
+	if err != nil || found {
+		t.Errorf("Expired token expected to be deleted, found %v: %v", found, err)
+	}
+}
@@ -0,0 +1,99 @@
+package wongdim
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	log "github.com/sirupsen/logrus"
+)
+
+//pollUpdate is the part of update about polls, which the bot library drops
+type pollUpdate struct {
+	Poll *pollResult `json:"poll"`
+}
+
+//decodeUpdate decodes update in data, with poll if it is about one
+func decodeUpdate(data []byte) (tgbotapi.Update, *pollResult, error) {
+	var update tgbotapi.Update
+	err := json.Unmarshal(data, &update)
+	if err != nil {
+		return update, nil, err
+	}
+	var p pollUpdate
+	err = json.Unmarshal(data, &p)
+	return update, p.Poll, err
+}
+
+//dispatch passes update to ch. Closed polls are handled here, updates of
+//polls still open are votes and ignored
+func (r *ServeBot) dispatch(update tgbotapi.Update, poll *pollResult, ch chan<- tgbotapi.Update) {
+	if poll == nil {
+		ch <- update
+		return
+	}
+	if poll.IsClosed {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), UpdateTimeout)
+			defer cancel()
+			r.lunchPollClosed(ctx, *poll)
+		}()
+	}
+}
+
+//updatesChan is GetUpdatesChan of the bot library, keeping updates of polls
+func (r *ServeBot) updatesChan(config tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel {
+	ch := make(chan tgbotapi.Update, r.bot.Buffer)
+	go func() {
+		for {
+			params := url.Values{}
+			params.Set("offset", strconv.Itoa(config.Offset))
+			params.Set("timeout", strconv.Itoa(config.Timeout))
+			resp, err := r.bot.MakeRequest("getUpdates", params)
+			var updates []json.RawMessage
+			if err == nil {
+				err = json.Unmarshal(resp.Result, &updates)
+			}
+			if err != nil {
+				log.WithError(err).Error("Cannot get updates, retrying in 3 seconds")
+				time.Sleep(3 * time.Second)
+				continue
+			}
+			for i := range updates {
+				update, poll, err := decodeUpdate(updates[i])
+				if update.UpdateID < config.Offset {
+					continue
+				}
+				config.Offset = update.UpdateID + 1
+				if err != nil {
+					log.WithError(err).Error("Unexpected update")
+					continue
+				}
+				r.dispatch(update, poll, ch)
+			}
+		}
+	}()
+	return ch
+}
+
+//listenForWebhook is ListenForWebhook of the bot library, keeping updates
+//of polls
+func (r *ServeBot) listenForWebhook(pattern string) tgbotapi.UpdatesChannel {
+	ch := make(chan tgbotapi.Update, r.bot.Buffer)
+	http.HandleFunc(pattern, func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		update, poll, err := decodeUpdate(data)
+		if err != nil {
+			log.WithError(err).Error("Unexpected update")
+			return
+		}
+		r.dispatch(update, poll, ch)
+	})
+	return ch
+}